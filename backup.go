@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/spf13/cobra"
+)
+
+const defaultBackupProgressInterval = 100
+
+// backupRetryInterval is the delay before retrying a backup step which made no progress,
+// e.g. the source database is locked by a writer.
+const backupRetryInterval = 100 * time.Millisecond
+
+// backupProgressFunc is called after each backup step with the remaining and total page counts.
+type backupProgressFunc func(remaining int, total int)
+
+// backupDB copies the database to the output path using SQLite online backup API.
+// pagesPerStep pages are copied in each step, non-positive value means copying all pages
+// in a single step. The backup is written to a temporary file in the output directory,
+// which is renamed to the output path on success and removed on failure.
+//
+// ref: https://www.sqlite.org/backup.html
+func backupDB(
+	ctx context.Context,
+	db *sqlx.DB,
+	output string,
+	pagesPerStep int,
+	onProgress backupProgressFunc,
+) error {
+	if _, err := os.Stat(output); err == nil {
+		return fmt.Errorf("backup output %q already exists", output)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("stat backup output %q: %w", output, err)
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(output), filepath.Base(output)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create backup temp file: %w", err)
+	}
+	tempOutput := tempFile.Name()
+	tempFile.Close()
+
+	if err := backupDBTo(ctx, db, tempOutput, pagesPerStep, onProgress); err != nil {
+		os.Remove(tempOutput)
+		return err
+	}
+	if err := os.Rename(tempOutput, output); err != nil {
+		os.Remove(tempOutput)
+		return fmt.Errorf("rename backup output %q: %w", output, err)
+	}
+
+	return nil
+}
+
+func backupDBTo(
+	ctx context.Context,
+	db *sqlx.DB,
+	output string,
+	pagesPerStep int,
+	onProgress backupProgressFunc,
+) error {
+	destConn, err := (&sqlite3.SQLiteDriver{}).Open(output)
+	if err != nil {
+		return fmt.Errorf("open backup output %q: %w", output, err)
+	}
+	defer destConn.Close()
+
+	srcConn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get source connection: %w", err)
+	}
+	defer srcConn.Close()
+
+	if pagesPerStep <= 0 {
+		pagesPerStep = -1
+	}
+
+	return srcConn.Raw(func(driverConn interface{}) error {
+		src, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected source connection type %T", driverConn)
+		}
+
+		backup, err := destConn.(*sqlite3.SQLiteConn).Backup("main", src, "main")
+		if err != nil {
+			return fmt.Errorf("start backup: %w", err)
+		}
+
+		remaining := -1
+		for {
+			if err := ctx.Err(); err != nil {
+				backup.Finish()
+				return err
+			}
+
+			done, err := backup.Step(pagesPerStep)
+			if err != nil {
+				backup.Finish()
+				return fmt.Errorf("backup step: %w", err)
+			}
+			if onProgress != nil {
+				onProgress(backup.Remaining(), backup.PageCount())
+			}
+			if done {
+				break
+			}
+
+			// NOTE: SQLITE_BUSY and SQLITE_LOCKED are not reported by Step, a step without
+			//       progress means the source or destination is locked, hence back off.
+			if backup.Remaining() == remaining {
+				select {
+				case <-ctx.Done():
+				case <-time.After(backupRetryInterval):
+				}
+			}
+			remaining = backup.Remaining()
+		}
+
+		if err := backup.Finish(); err != nil {
+			return fmt.Errorf("finish backup: %w", err)
+		}
+		return nil
+	})
+}
+
+func createBackupCmd() *cobra.Command {
+	var (
+		flagOutput           string
+		flagProgressInterval int
+	)
+
+	cmd := &cobra.Command{
+		Use:          "backup",
+		Short:        "Create an online backup of the database",
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if flagOutput == "" {
+				return fmt.Errorf("--output is required")
+			}
+
+			logger, err := createLogger(cmd)
+			if err != nil {
+				setupLogger.Error(err, "failed to create logger")
+				return err
+			}
+
+			db, err := openDB(cmd)
+			if err != nil {
+				setupLogger.Error(err, "create db")
+				return err
+			}
+			defer db.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			logger = logger.WithName("backup").WithValues("output", flagOutput)
+			err = backupDB(ctx, db, flagOutput, flagProgressInterval, logBackupProgress(logger))
+			if err != nil {
+				logger.Error(err, "backup failed")
+				return err
+			}
+			logger.Info("backup completed")
+
+			return nil
+		},
+	}
+
+	bindDBDSNFlag(cmd.Flags())
+	cmd.Flags().StringVar(
+		&flagOutput, "output", "",
+		"path of the backup database file",
+	)
+	cmd.Flags().IntVar(
+		&flagProgressInterval, "progress-interval", defaultBackupProgressInterval,
+		"number of pages to copy between progress reports. 0 means copying all pages at once.",
+	)
+
+	return cmd
+}
+
+func logBackupProgress(logger logr.Logger) backupProgressFunc {
+	return func(remaining int, total int) {
+		logger.Info("backup progress", "copied", total-remaining, "total", total)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// backupTestRowText makes the rows span multiple pages.
+func backupTestRowText(int) interface{} {
+	return strings.Repeat("a", 128)
+}
+
+func assertBackupData(t *testing.T, output string, rows int) {
+	db := openTestDB(t, "--db-dsn", output)
+	defer db.Close()
+
+	var count, sum int
+	assert.NoError(t, db.QueryRow("SELECT count(*), sum(id) FROM test").Scan(&count, &sum))
+	assert.Equal(t, rows, count)
+	assert.Equal(t, rows*(rows-1)/2, sum)
+}
+
+func TestBackupCmd(t *testing.T) {
+	const rows = 1000
+	dsn := createTestDBFile(t, rows, backupTestRowText)
+	output := filepath.Join(t.TempDir(), "backup.db")
+
+	cmd := createMainCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs([]string{"backup", "--db-dsn", dsn, "--output", output, "--progress-interval", "10"})
+	assert.NoError(t, cmd.Execute())
+
+	assertBackupData(t, output, rows)
+
+	t.Run("OutputExists", func(t *testing.T) {
+		cmd := createMainCmd()
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"backup", "--db-dsn", dsn, "--output", output})
+		assert.Error(t, cmd.Execute())
+	})
+}
+
+func TestBackupDB_Progress(t *testing.T) {
+	const rows = 1000
+	db := openTestDB(t, "--db-dsn", createTestDBFile(t, rows, backupTestRowText))
+	defer db.Close()
+
+	var reports []string
+	output := filepath.Join(t.TempDir(), "backup.db")
+	err := backupDB(context.Background(), db, output, 10, func(remaining int, total int) {
+		reports = append(reports, fmt.Sprintf("%d/%d", total-remaining, total))
+	})
+	assert.NoError(t, err)
+
+	assert.Greater(t, len(reports), 1)
+	assert.Equal(t, "10/", reports[0][:3])
+	last := strings.Split(reports[len(reports)-1], "/")
+	assert.Equal(t, last[0], last[1])
+
+	assertBackupData(t, output, rows)
+}
+
+func TestBackupDB_Failure(t *testing.T) {
+	const rows = 1000
+	db := openTestDB(t, "--db-dsn", createTestDBFile(t, rows, backupTestRowText))
+	defer db.Close()
+
+	outputDir := t.TempDir()
+	output := filepath.Join(outputDir, "backup.db")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := backupDB(ctx, db, output, 10, func(remaining int, total int) {
+		cancel()
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	entries, err := os.ReadDir(outputDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries, "partial backup should be removed")
+
+	t.Log("retry")
+	assert.NoError(t, backupDB(context.Background(), db, output, 10, nil))
+	assertBackupData(t, output, rows)
+}
+
+func TestBackupDB_SourceLocked(t *testing.T) {
+	const rows = 100
+	dsn := createTestDBFile(t, rows, backupTestRowText)
+	// fail immediately with SQLITE_BUSY instead of waiting in the busy handler
+	db := openTestDB(t, "--db-dsn", dsn+"?_busy_timeout=0")
+	defer db.Close()
+	// open the source connection before locking the database
+	db.SetMaxOpenConns(1)
+	assert.NoError(t, db.Ping())
+
+	// exclusive lock blocks the readers in rollback journal mode
+	lockDB := openTestDB(t, "--db-dsn", dsn)
+	defer lockDB.Close()
+	lockConn, err := lockDB.Conn(context.Background())
+	assert.NoError(t, err)
+	defer lockConn.Close()
+	_, err = lockConn.ExecContext(context.Background(), "BEGIN EXCLUSIVE")
+	assert.NoError(t, err)
+
+	const lockDuration = 5 * backupRetryInterval
+	go func() {
+		time.Sleep(lockDuration)
+		lockConn.ExecContext(context.Background(), "COMMIT")
+	}()
+
+	steps := 0
+	output := filepath.Join(t.TempDir(), "backup.db")
+	start := time.Now()
+	err = backupDB(context.Background(), db, output, -1, func(remaining int, total int) {
+		steps += 1
+	})
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), lockDuration)
+	// retrying without back off takes thousands of steps
+	assert.LessOrEqual(t, steps, int(lockDuration/backupRetryInterval)+2)
+
+	assertBackupData(t, output, rows)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/cobra"
+)
+
+var errCheckFailed = errors.New("database check failed")
+
+// checkDB runs the integrity checks on the database and returns the reported problems.
+// Empty list will be returned if no problem is found.
+//
+// ref: https://www.sqlite.org/pragma.html#pragma_integrity_check
+func checkDB(ctx context.Context, db *sqlx.DB, foreignKeys bool) ([]string, error) {
+	var problems []string
+
+	for _, pragma := range []string{"integrity_check", "quick_check"} {
+		var rows []string
+		if err := db.SelectContext(ctx, &rows, fmt.Sprintf("PRAGMA %s", pragma)); err != nil {
+			return nil, fmt.Errorf("run %s: %w", pragma, err)
+		}
+		for _, row := range rows {
+			// a single "ok" row is returned when no problem is found
+			if row == "ok" {
+				continue
+			}
+			problems = append(problems, fmt.Sprintf("%s: %s", pragma, row))
+		}
+	}
+
+	if foreignKeys {
+		var rows []struct {
+			Table  string `db:"table"`
+			RowID  *int64 `db:"rowid"`
+			Parent string `db:"parent"`
+			FKID   int64  `db:"fkid"`
+		}
+		if err := db.SelectContext(ctx, &rows, "PRAGMA foreign_key_check"); err != nil {
+			return nil, fmt.Errorf("run foreign_key_check: %w", err)
+		}
+		for _, row := range rows {
+			rowID := "NULL"
+			if row.RowID != nil {
+				rowID = fmt.Sprint(*row.RowID)
+			}
+			problems = append(problems, fmt.Sprintf(
+				"foreign_key_check: %s(rowid=%s) violates foreign key %d referencing %s",
+				row.Table, rowID, row.FKID, row.Parent,
+			))
+		}
+	}
+
+	return problems, nil
+}
+
+func createCheckCmd() *cobra.Command {
+	var flagForeignKeys bool
+
+	cmd := &cobra.Command{
+		Use:          "check",
+		Short:        "Check the integrity of the database",
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openDB(cmd)
+			if err != nil {
+				setupLogger.Error(err, "create db")
+				return err
+			}
+			defer db.Close()
+
+			problems, err := checkDB(context.Background(), db, flagForeignKeys)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if len(problems) < 1 {
+				fmt.Fprintln(out, "OK")
+				return nil
+			}
+			for _, problem := range problems {
+				fmt.Fprintln(out, problem)
+			}
+			return errCheckFailed
+		},
+	}
+
+	bindDBDSNFlag(cmd.Flags())
+	cmd.Flags().BoolVar(&flagForeignKeys, "foreign-keys", false, "Also check the foreign key constraints?")
+
+	return cmd
+}
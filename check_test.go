@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runCheckCmd(t *testing.T, args ...string) (string, error) {
+	cmd := createMainCmd()
+	var stdout bytes.Buffer
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs(append([]string{"check"}, args...))
+	err := cmd.Execute()
+	return stdout.String(), err
+}
+
+func TestCheckCmd(t *testing.T) {
+	dsn := "//" + filepath.Join(t.TempDir(), "test.db")
+
+	db := openTestDB(t, "--db-dsn", dsn)
+	_, err := db.Exec("CREATE TABLE authors (id integer primary key)")
+	assert.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE books (id integer primary key, author_id int REFERENCES authors(id))")
+	assert.NoError(t, err)
+	_, err = db.Exec("INSERT INTO authors (id) VALUES (1)")
+	assert.NoError(t, err)
+	_, err = db.Exec("INSERT INTO books (id, author_id) VALUES (1, 1)")
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	t.Run("OK", func(t *testing.T) {
+		output, err := runCheckCmd(t, "--db-dsn", dsn, "--foreign-keys")
+		assert.NoError(t, err)
+		assert.Equal(t, "OK\n", output)
+	})
+
+	t.Run("ForeignKeyViolation", func(t *testing.T) {
+		db := openTestDB(t, "--db-dsn", dsn)
+		// foreign keys are not enforced by default
+		_, err := db.Exec("INSERT INTO books (id, author_id) VALUES (2, 42)")
+		assert.NoError(t, err)
+		assert.NoError(t, db.Close())
+
+		output, err := runCheckCmd(t, "--db-dsn", dsn)
+		assert.NoError(t, err)
+		assert.Equal(t, "OK\n", output)
+
+		output, err = runCheckCmd(t, "--db-dsn", dsn, "--foreign-keys")
+		assert.ErrorIs(t, err, errCheckFailed)
+		assert.Contains(t, output, "foreign_key_check: books(rowid=2) violates foreign key 0 referencing authors")
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	cliFlagConfig = "config"
+
+	// envPrefix is the prefix of environment variables for overriding flags,
+	// e.g. `SQLITE_REST_DB_DSN` for `--db-dsn`.
+	envPrefix = "SQLITE_REST"
+)
+
+func bindConfigFlag(fs *pflag.FlagSet) {
+	fs.String(cliFlagConfig, "", "Path to the YAML/TOML config file. Keys are the flag names, e.g. db-dsn.")
+}
+
+// loadConfig applies values from the config file and environment variables to the flags
+// not set from the command line. Precedence: flag > environment variable > config file.
+func loadConfig(cmd *cobra.Command) error {
+	v := viper.New()
+
+	var rv error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if rv != nil {
+			return
+		}
+		if err := v.BindEnv(f.Name, flagEnvName(f.Name)); err != nil {
+			rv = fmt.Errorf("bind env for %q: %w", f.Name, err)
+		}
+	})
+	if rv != nil {
+		return rv
+	}
+
+	configFile, err := cmd.Flags().GetString(cliFlagConfig)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", cliFlagConfig, err)
+	}
+	if configFile == "" {
+		configFile = v.GetString(cliFlagConfig)
+	}
+	if configFile != "" {
+		v.SetConfigFile(configFile)
+		if err := v.ReadInConfig(); err != nil {
+			return fmt.Errorf("read config file %q: %w", configFile, err)
+		}
+	}
+
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if rv != nil || f.Changed || f.Name == cliFlagConfig {
+			return
+		}
+		if !v.IsSet(f.Name) {
+			return
+		}
+
+		if err := setFlagFromConfig(cmd.Flags(), f.Name, v.Get(f.Name)); err != nil {
+			rv = fmt.Errorf("apply config %q: %w", f.Name, err)
+		}
+	})
+
+	return rv
+}
+
+// flagEnvName returns the environment variable name of the flag, e.g. `SQLITE_REST_DB_DSN` for `db-dsn`.
+func flagEnvName(flagName string) string {
+	return envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+func setFlagFromConfig(fs *pflag.FlagSet, name string, value interface{}) error {
+	if values, ok := value.([]interface{}); ok {
+		// slice flags append values on each set
+		for _, v := range values {
+			if err := fs.Set(name, cast.ToString(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fs.Set(name, cast.ToString(value))
+}
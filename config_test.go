@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func parseServeCmdWithConfig(t *testing.T, args ...string) *cobra.Command {
+	cmd, _, err := createMainCmd().Find([]string{"serve"})
+	assert.NoError(t, err)
+	assert.NoError(t, cmd.ParseFlags(args))
+	assert.NoError(t, loadConfig(cmd))
+	return cmd
+}
+
+func writeConfigFile(t *testing.T, name string, content string) string {
+	p := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	return p
+}
+
+func TestLoadConfig(t *testing.T) {
+	configFile := writeConfigFile(t, "config.yaml", `
+db-dsn: test.db
+http-addr: ":9090"
+auth-rsa-public-key: /etc/sqlite-rest/rsa.pub
+db-max-open-conns: 4
+db-wal: true
+security-allow-table:
+  - books
+  - authors
+`)
+
+	t.Run("FromConfigFile", func(t *testing.T) {
+		cmd := parseServeCmdWithConfig(t, "--config", configFile)
+
+		dsn, _ := cmd.Flags().GetString(cliFlagDBDSN)
+		assert.Equal(t, "test.db", dsn)
+		httpAddr, _ := cmd.Flags().GetString("http-addr")
+		assert.Equal(t, ":9090", httpAddr)
+		rsaPublicKey, _ := cmd.Flags().GetString("auth-rsa-public-key")
+		assert.Equal(t, "/etc/sqlite-rest/rsa.pub", rsaPublicKey)
+		maxOpenConns, _ := cmd.Flags().GetInt(cliFlagDBMaxOpenConns)
+		assert.Equal(t, 4, maxOpenConns)
+		wal, _ := cmd.Flags().GetBool(cliFlagDBWAL)
+		assert.True(t, wal)
+		tables, _ := cmd.Flags().GetStringSlice("security-allow-table")
+		assert.Equal(t, []string{"books", "authors"}, tables)
+	})
+
+	t.Run("FlagTakesPrecedence", func(t *testing.T) {
+		cmd := parseServeCmdWithConfig(t, "--config", configFile, "--http-addr", ":8888")
+
+		httpAddr, _ := cmd.Flags().GetString("http-addr")
+		assert.Equal(t, ":8888", httpAddr)
+		dsn, _ := cmd.Flags().GetString(cliFlagDBDSN)
+		assert.Equal(t, "test.db", dsn)
+	})
+
+	t.Run("EnvTakesPrecedence", func(t *testing.T) {
+		t.Setenv("SQLITE_REST_DB_DSN", "env.db")
+
+		cmd := parseServeCmdWithConfig(t, "--config", configFile)
+
+		dsn, _ := cmd.Flags().GetString(cliFlagDBDSN)
+		assert.Equal(t, "env.db", dsn)
+	})
+
+	t.Run("TOML", func(t *testing.T) {
+		tomlConfigFile := writeConfigFile(t, "config.toml", `
+db-dsn = "test.db"
+log-level = 8
+`)
+		cmd := parseServeCmdWithConfig(t, "--config", tomlConfigFile)
+
+		dsn, _ := cmd.Flags().GetString(cliFlagDBDSN)
+		assert.Equal(t, "test.db", dsn)
+		logLevel, _ := cmd.Flags().GetInt8(cliFlagLogLevel)
+		assert.EqualValues(t, 8, logLevel)
+	})
+
+	t.Run("InvalidConfigFile", func(t *testing.T) {
+		cmd, _, err := createMainCmd().Find([]string{"serve"})
+		assert.NoError(t, err)
+		assert.NoError(t, cmd.ParseFlags([]string{"--config", filepath.Join(t.TempDir(), "missing.yaml")}))
+		assert.Error(t, loadConfig(cmd))
+	})
+}
+
+func TestLoadConfig_Env(t *testing.T) {
+	t.Setenv("SQLITE_REST_HTTP_ADDR", ":9090")
+	t.Setenv("SQLITE_REST_SECURITY_ALLOW_TABLE", "books,authors")
+	t.Setenv("SQLITE_REST_DB_MAX_OPEN_CONNS", "4")
+
+	serverOpts := new(ServerOptions)
+	cmd := &cobra.Command{Use: "test"}
+	serverOpts.bindCLIFlags(cmd.Flags())
+	bindConfigFlag(cmd.Flags())
+	cmd.Flags().Int(cliFlagDBMaxOpenConns, 1, "")
+	assert.NoError(t, cmd.ParseFlags(nil))
+
+	assert.NoError(t, loadConfig(cmd))
+	assert.Equal(t, []string{"books", "authors"}, serverOpts.SecurityOptions.EnabledTableOrViews)
+	maxOpenConns, _ := cmd.Flags().GetInt(cliFlagDBMaxOpenConns)
+	assert.Equal(t, 4, maxOpenConns)
+
+	serverOpts.Logger = createTestLogger(t)
+	db := openTestDB(t, "--db-dsn", ":memory:")
+	defer db.Close()
+	serverOpts.Queryer = db
+	serverOpts.Execer = db
+	serverOpts.AuthOptions.disableAuth = true
+	server, err := NewServer(serverOpts)
+	assert.NoError(t, err)
+	assert.Equal(t, ":9090", server.server.Addr)
+}
+
+func TestLoadConfig_EnvConfigFile(t *testing.T) {
+	configFile := writeConfigFile(t, "config.yaml", "db-dsn: test.db\n")
+	t.Setenv("SQLITE_REST_CONFIG", configFile)
+
+	cmd := parseServeCmdWithConfig(t)
+
+	dsn, _ := cmd.Flags().GetString(cliFlagDBDSN)
+	assert.Equal(t, "test.db", dsn)
+}
+
+func TestFlagEnvName(t *testing.T) {
+	assert.Equal(t, "SQLITE_REST_HTTP_ADDR", flagEnvName("http-addr"))
+	assert.Equal(t, "SQLITE_REST_DB_DSN", flagEnvName(cliFlagDBDSN))
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 	"github.com/spf13/cobra"
 )
 
@@ -14,10 +19,310 @@ func openDB(cmd *cobra.Command) (*sqlx.DB, error) {
 		return nil, fmt.Errorf("read %s: %w", cliFlagDBDSN, err)
 	}
 
-	db, err := sqlx.Open("sqlite3", dsn)
+	maxOpenConns, err := cmd.Flags().GetInt(cliFlagDBMaxOpenConns)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("read %s: %w", cliFlagDBMaxOpenConns, err)
+	}
+	maxIdleConns, err := cmd.Flags().GetInt(cliFlagDBMaxIdleConns)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", cliFlagDBMaxIdleConns, err)
+	}
+	busyTimeout, err := cmd.Flags().GetDuration(cliFlagDBBusyTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", cliFlagDBBusyTimeout, err)
+	}
+	enableWAL, err := cmd.Flags().GetBool(cliFlagDBWAL)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", cliFlagDBWAL, err)
+	}
+	enableForeignKeys, err := cmd.Flags().GetBool(cliFlagDBForeignKeys)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", cliFlagDBForeignKeys, err)
+	}
+	initSQL, err := cmd.Flags().GetString(cliFlagDBInitSQL)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", cliFlagDBInitSQL, err)
+	}
+	synchronous, err := cmd.Flags().GetString(cliFlagDBSynchronous)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", cliFlagDBSynchronous, err)
+	}
+	if synchronous != "" && !isValidSynchronousMode(synchronous) {
+		return nil, fmt.Errorf("invalid %s %q, must be one of: %s", cliFlagDBSynchronous, synchronous, strings.Join(synchronousModes, ", "))
+	}
+
+	if busyTimeout > 0 {
+		dsn = dsnWithParam(dsn, fmt.Sprint(busyTimeout.Milliseconds()), dsnParamBusyTimeout, "_timeout")
+	}
+	if enableForeignKeys {
+		// NOTE: foreign_keys is a per-connection setting, setting it via DSN applies
+		// `PRAGMA foreign_keys=ON` to every new connection.
+		dsn = dsnWithParam(dsn, "1", dsnParamForeignKeys, "_fk")
+	}
+	if synchronous != "" {
+		// NOTE: synchronous is a per-connection setting as well
+		dsn = dsnWithParam(dsn, strings.ToUpper(synchronous), dsnParamSynchronous, "_sync")
+	}
+
+	var db *sqlx.DB
+	if stmts := splitSQLStatements(initSQL); len(stmts) > 0 {
+		db = sqlx.NewDb(sql.OpenDB(newInitSQLConnector(dsn, stmts)), "sqlite3")
+	} else {
+		db, err = sqlx.Open("sqlite3", dsn)
+		if err != nil {
+			return nil, err
+		}
+	}
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxIdleConns)
+
+	if enableWAL {
+		if err := enableWALJournalMode(db); err != nil {
+			db.Close()
+			return nil, err
+		}
 	}
 
 	return db, nil
 }
+
+// splitSQLStatements splits the semicolon-separated SQL statements.
+func splitSQLStatements(s string) []string {
+	var rv []string
+	for _, stmt := range strings.Split(s, ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			rv = append(rv, stmt)
+		}
+	}
+	return rv
+}
+
+// initSQLConnector opens SQLite connections and executes the init SQL statements
+// on each new connection.
+type initSQLConnector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+var _ driver.Connector = (*initSQLConnector)(nil)
+
+func newInitSQLConnector(dsn string, stmts []string) *initSQLConnector {
+	return &initSQLConnector{
+		dsn: dsn,
+		driver: &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				for _, stmt := range stmts {
+					if _, err := conn.Exec(stmt, nil); err != nil {
+						return fmt.Errorf("execute init SQL %q: %w", stmt, err)
+					}
+				}
+				return nil
+			},
+		},
+	}
+}
+
+func (c *initSQLConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *initSQLConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// enableWALJournalMode switches the database to WAL journal mode. The setting is persistent
+// for the database file.
+//
+// ref: https://www.sqlite.org/wal.html
+func enableWALJournalMode(db *sqlx.DB) error {
+	var journalMode string
+	if err := db.Get(&journalMode, "PRAGMA journal_mode=WAL"); err != nil {
+		return fmt.Errorf("enable WAL journal mode: %w", err)
+	}
+	if !strings.EqualFold(journalMode, "wal") {
+		return fmt.Errorf("enable WAL journal mode: unexpected journal mode %q", journalMode)
+	}
+
+	return nil
+}
+
+const (
+	walCheckpointModePassive  = "passive"
+	walCheckpointModeFull     = "full"
+	walCheckpointModeRestart  = "restart"
+	walCheckpointModeTruncate = "truncate"
+)
+
+// WALCheckpointResult describes the result of `PRAGMA wal_checkpoint`.
+// Log and Checkpointed are -1 if the database is not in WAL mode.
+type WALCheckpointResult struct {
+	// Busy is 1 if the checkpoint was blocked from completing, 0 otherwise.
+	Busy int64 `json:"busy"`
+	// Log is the number of pages in the WAL file.
+	Log int64 `json:"log"`
+	// Checkpointed is the number of pages written back to the database file.
+	Checkpointed int64 `json:"checkpointed"`
+}
+
+func isValidWALCheckpointMode(mode string) bool {
+	switch mode {
+	case walCheckpointModePassive, walCheckpointModeFull, walCheckpointModeRestart, walCheckpointModeTruncate:
+		return true
+	default:
+		return false
+	}
+}
+
+// walCheckpoint runs the WAL checkpoint with the mode.
+//
+// ref: https://www.sqlite.org/pragma.html#pragma_wal_checkpoint
+func walCheckpoint(
+	ctx context.Context,
+	queryer sqlx.QueryerContext,
+	mode string,
+) (WALCheckpointResult, error) {
+	var rv WALCheckpointResult
+	if !isValidWALCheckpointMode(mode) {
+		return rv, fmt.Errorf("invalid WAL checkpoint mode %q", mode)
+	}
+
+	err := queryer.QueryRowxContext(ctx, fmt.Sprintf("PRAGMA wal_checkpoint(%s)", strings.ToUpper(mode))).
+		Scan(&rv.Busy, &rv.Log, &rv.Checkpointed)
+	if err != nil {
+		return rv, fmt.Errorf("checkpoint WAL: %w", err)
+	}
+
+	return rv, nil
+}
+
+const (
+	dsnParamBusyTimeout = "_busy_timeout"
+	dsnParamForeignKeys = "_foreign_keys"
+	dsnParamSynchronous = "_synchronous"
+)
+
+// synchronousModes lists the PRAGMA synchronous settings, indexed by the numeric value.
+//
+// ref: https://www.sqlite.org/pragma.html#pragma_synchronous
+var synchronousModes = []string{"off", "normal", "full", "extra"}
+
+func isValidSynchronousMode(s string) bool {
+	for _, mode := range synchronousModes {
+		if strings.EqualFold(s, mode) {
+			return true
+		}
+	}
+	return false
+}
+
+// querySynchronousMode returns the PRAGMA synchronous setting of the connection.
+func querySynchronousMode(ctx context.Context, queryer sqlx.QueryerContext) (string, error) {
+	var v int
+	if err := queryer.QueryRowxContext(ctx, "PRAGMA synchronous").Scan(&v); err != nil {
+		return "", fmt.Errorf("query synchronous: %w", err)
+	}
+	if v < 0 || v >= len(synchronousModes) {
+		return fmt.Sprint(v), nil
+	}
+	return synchronousModes[v], nil
+}
+
+// dsnWithParam appends the parameter to the DSN if none of the keys (including aliases) is present.
+// The first key is used when appending.
+func dsnWithParam(dsn string, value string, keys ...string) string {
+	if _, rawQuery, ok := strings.Cut(dsn, "?"); ok {
+		params, _ := url.ParseQuery(rawQuery)
+		for _, key := range keys {
+			if params.Has(key) {
+				return dsn
+			}
+		}
+		return dsn + "&" + keys[0] + "=" + url.QueryEscape(value)
+	}
+
+	return dsn + "?" + keys[0] + "=" + url.QueryEscape(value)
+}
+
+// TableColumn describes a column from `PRAGMA table_info`.
+type TableColumn struct {
+	CID          int64   `db:"cid" json:"-"`
+	Name         string  `db:"name" json:"name"`
+	Type         string  `db:"type" json:"type"`
+	NotNull      bool    `db:"notnull" json:"notnull"`
+	DefaultValue *string `db:"dflt_value" json:"default"`
+	// PrimaryKey is the 1-based index of the column in the primary key, or 0 if not part of it.
+	PrimaryKey int64 `db:"pk" json:"pk"`
+}
+
+func queryTableColumns(
+	ctx context.Context,
+	queryer sqlx.QueryerContext,
+	table string,
+) ([]TableColumn, error) {
+	var rv []TableColumn
+	err := sqlx.SelectContext(
+		ctx, queryer, &rv,
+		"select cid, name, type, `notnull`, dflt_value, pk from pragma_table_info(?)",
+		table,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query table info of %q: %w", table, err)
+	}
+
+	return rv, nil
+}
+
+// queryIntegerPrimaryKeyColumn returns the name of the `INTEGER PRIMARY KEY` column
+// of the table. Such column is an alias of the rowid. Empty string will be returned
+// if the table doesn't declare one.
+//
+// ref: https://www.sqlite.org/lang_createtable.html#rowid
+func queryIntegerPrimaryKeyColumn(
+	ctx context.Context,
+	queryer sqlx.QueryerContext,
+	table string,
+) (string, error) {
+	columns, err := queryTableColumns(ctx, queryer, table)
+	if err != nil {
+		return "", err
+	}
+
+	var pkColumns []TableColumn
+	for _, column := range columns {
+		if column.PrimaryKey > 0 {
+			pkColumns = append(pkColumns, column)
+		}
+	}
+	if len(pkColumns) != 1 {
+		// no primary key or composite primary key
+		return "", nil
+	}
+	if !strings.EqualFold(pkColumns[0].Type, "integer") {
+		return "", nil
+	}
+
+	return pkColumns[0].Name, nil
+}
+
+// TableOrView describes a table or view from `sqlite_master`.
+type TableOrView struct {
+	Name string `db:"name" json:"name"`
+	// Type is either "table" or "view".
+	Type string `db:"type" json:"type"`
+}
+
+func queryTableOrViews(
+	ctx context.Context,
+	queryer sqlx.QueryerContext,
+) ([]TableOrView, error) {
+	var rv []TableOrView
+	err := sqlx.SelectContext(
+		ctx, queryer, &rv,
+		"select name, type from sqlite_master where type in ('table', 'view') order by name",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query tables and views: %w", err)
+	}
+
+	return rv, nil
+}
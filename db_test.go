@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+// openTestDB opens the database with the serve command flags.
+func openTestDB(t testing.TB, args ...string) *sqlx.DB {
+	cmd, _, err := createMainCmd().Find([]string{"serve"})
+	if err != nil {
+		t.Fatal(err)
+		return nil
+	}
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatal(err)
+		return nil
+	}
+
+	db, err := openDB(cmd)
+	if err != nil {
+		t.Fatal(err)
+		return nil
+	}
+	return db
+}
+
+// createTestDBFile creates a database file with `test (id int, s text, f real)` table and
+// inserts rows rows, with text returning the s value of each row. The DSN is returned.
+func createTestDBFile(t testing.TB, rows int, text func(i int) interface{}) string {
+	dsn := "//" + filepath.Join(t.TempDir(), "test.db")
+
+	db := openTestDB(t, "--db-dsn", dsn)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE test (id int, s text, f real)")
+	assert.NoError(t, err)
+	tx, err := db.Beginx()
+	assert.NoError(t, err)
+	for i := 0; i < rows; i++ {
+		_, err := tx.Exec("INSERT INTO test (id, s, f) VALUES (?, ?, ?)", i, text(i), float64(i)+0.5)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tx.Commit())
+
+	return dsn
+}
+
+// createTestContextWithOpenedDB creates a test context serving the opened database.
+func createTestContextWithOpenedDB(t testing.TB, db *sqlx.DB, enabledTables ...string) *TestContext {
+	server, err := NewServer(&ServerOptions{
+		Logger:  createTestLogger(t).WithName("test"),
+		Queryer: db,
+		Execer:  db,
+		SecurityOptions: ServerSecurityOptions{
+			EnabledTableOrViews: enabledTables,
+		},
+		AuthOptions: ServerAuthOptions{disableAuth: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+		return nil
+	}
+
+	return NewTestContextWithDB(t, server.server.Handler, db, func(t testing.TB) {
+		assert.NoError(t, db.Close())
+	}, "")
+}
+
+func TestDSNWithParam(t *testing.T) {
+	cases := []struct {
+		dsn      string
+		expected string
+	}{
+		{"test.db", "test.db?_busy_timeout=100"},
+		{"file:test.db?cache=shared", "file:test.db?cache=shared&_busy_timeout=100"},
+		{"test.db?_busy_timeout=5", "test.db?_busy_timeout=5"},
+		{"test.db?_timeout=5", "test.db?_timeout=5"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, dsnWithParam(c.dsn, "100", dsnParamBusyTimeout, "_timeout"), c.dsn)
+	}
+}
+
+func TestOpenDB_BusyTimeout(t *testing.T) {
+	dsn := "//" + filepath.Join(t.TempDir(), "test.db")
+
+	writer := openTestDB(t, "--db-dsn", dsn)
+	defer writer.Close()
+	_, err := writer.Exec("CREATE TABLE test (id int)")
+	assert.NoError(t, err)
+
+	// hold the write lock for a while
+	conn, err := writer.Conn(context.Background())
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.ExecContext(context.Background(), "BEGIN IMMEDIATE")
+	assert.NoError(t, err)
+	_, err = conn.ExecContext(context.Background(), "INSERT INTO test (id) VALUES (1)")
+	assert.NoError(t, err)
+
+	t.Run("WithinTimeout", func(t *testing.T) {
+		db := openTestDB(t, "--db-dsn", dsn, "--db-busy-timeout", "5s")
+		defer db.Close()
+
+		released := make(chan struct{})
+		go func() {
+			defer close(released)
+			time.Sleep(200 * time.Millisecond)
+			_, err := conn.ExecContext(context.Background(), "COMMIT")
+			assert.NoError(t, err)
+		}()
+
+		_, err := db.Exec("INSERT INTO test (id) VALUES (2)")
+		assert.NoError(t, err)
+		<-released
+
+		var count int
+		assert.NoError(t, db.Get(&count, "SELECT count(*) FROM test"))
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("TimeoutExceeded", func(t *testing.T) {
+		_, err := conn.ExecContext(context.Background(), "BEGIN IMMEDIATE")
+		assert.NoError(t, err)
+		defer conn.ExecContext(context.Background(), "ROLLBACK")
+
+		db := openTestDB(t, "--db-dsn", dsn, "--db-busy-timeout", "10ms")
+		defer db.Close()
+
+		_, err = db.Exec("INSERT INTO test (id) VALUES (3)")
+		var sqliteErr sqlite3.Error
+		if assert.ErrorAs(t, err, &sqliteErr) {
+			assert.Equal(t, sqlite3.ErrBusy, sqliteErr.Code)
+		}
+	})
+}
+
+func TestOpenDB_WAL(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		db := openTestDB(t, "--db-dsn", "//"+filepath.Join(t.TempDir(), "test.db"))
+		defer db.Close()
+
+		var journalMode string
+		assert.NoError(t, db.Get(&journalMode, "PRAGMA journal_mode"))
+		assert.Equal(t, "delete", journalMode)
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		db := openTestDB(
+			t,
+			"--db-dsn", "//"+filepath.Join(t.TempDir(), "test.db"),
+			"--db-wal",
+			"--db-max-open-conns", "0",
+			"--db-busy-timeout", "10ms",
+		)
+		defer db.Close()
+
+		var journalMode string
+		assert.NoError(t, db.Get(&journalMode, "PRAGMA journal_mode"))
+		assert.Equal(t, "wal", journalMode)
+
+		_, err := db.Exec("CREATE TABLE test (id int)")
+		assert.NoError(t, err)
+
+		// hold a read transaction, which blocks writers in rollback journal mode
+		readTx, err := db.Beginx()
+		assert.NoError(t, err)
+		defer readTx.Rollback()
+		var count int
+		assert.NoError(t, readTx.Get(&count, "SELECT count(*) FROM test"))
+
+		_, err = db.Exec("INSERT INTO test (id) VALUES (1)")
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				var count int
+				assert.NoError(t, db.Get(&count, "SELECT count(*) FROM test"))
+				assert.Equal(t, 1, count)
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("InMemory", func(t *testing.T) {
+		cmd, _, err := createMainCmd().Find([]string{"serve"})
+		assert.NoError(t, err)
+		assert.NoError(t, cmd.ParseFlags([]string{"--db-dsn", ":memory:", "--db-wal"}))
+
+		_, err = openDB(cmd)
+		assert.Error(t, err)
+	})
+}
+
+func TestOpenDB_ConnectionPool(t *testing.T) {
+	dsn := "//" + filepath.Join(t.TempDir(), "test.db")
+
+	db := openTestDB(t, "--db-dsn", dsn, "--db-max-open-conns", "1")
+	assert.Equal(t, 1, db.Stats().MaxOpenConnections)
+
+	_, err := db.Exec("CREATE TABLE test (id int, s text)")
+	assert.NoError(t, err)
+
+	tc := createTestContextWithOpenedDB(t, db, enabledTestTables...)
+	defer tc.CleanUp(t)
+
+	const concurrency = 20
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			payload := bytes.NewBufferString(fmt.Sprintf(`{"id": %d, "s": "a"}`, i))
+			req := tc.NewRequest(t, http.MethodPost, "test", payload)
+			req.Header.Set("Content-Type", "application/json")
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		}(i)
+	}
+	wg.Wait()
+
+	var count int
+	assert.NoError(t, db.Get(&count, "SELECT count(*) FROM test"))
+	assert.Equal(t, concurrency, count)
+}
+
+func TestOpenDB_ForeignKeys(t *testing.T) {
+	insertOrphan := func(t *testing.T, args ...string) *http.Response {
+		db := openTestDB(t, append([]string{"--db-dsn", "//" + filepath.Join(t.TempDir(), "test.db")}, args...)...)
+		tc := createTestContextWithOpenedDB(t, db, "parent", "child")
+		t.Cleanup(func() { tc.CleanUp(t) })
+
+		tc.ExecuteSQL(t, "CREATE TABLE parent (id integer primary key)")
+		tc.ExecuteSQL(t, "CREATE TABLE child (id integer primary key, parent_id int references parent(id))")
+		tc.ExecuteSQL(t, "INSERT INTO parent (id) VALUES (1)")
+
+		req := tc.NewRequest(t, http.MethodPost, "child", bytes.NewBufferString(`{"parent_id": 2}`))
+		req.Header.Set("Content-Type", "application/json")
+		return tc.ExecuteRequest(t, req)
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		resp := insertOrphan(t)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		resp := insertOrphan(t, "--db-foreign-keys")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Contains(t, body["hint"], "FOREIGN KEY constraint failed")
+	})
+}
+
+func TestOpenDB_InitSQL(t *testing.T) {
+	db := openTestDB(
+		t,
+		"--db-dsn", "//"+filepath.Join(t.TempDir(), "test.db"),
+		"--db-init-sql", "PRAGMA cache_size=-64000; PRAGMA temp_store=MEMORY;",
+		// close connections after use to force reconnecting
+		"--db-max-idle-conns", "0",
+	)
+	defer db.Close()
+
+	for i := 0; i < 3; i++ {
+		var cacheSize int
+		assert.NoError(t, db.Get(&cacheSize, "PRAGMA cache_size"))
+		assert.Equal(t, -64000, cacheSize)
+
+		var tempStore int
+		assert.NoError(t, db.Get(&tempStore, "PRAGMA temp_store"))
+		assert.Equal(t, 2, tempStore) // MEMORY
+	}
+	assert.Greater(t, db.Stats().MaxIdleClosed, int64(1))
+}
+
+func TestOpenDB_Synchronous(t *testing.T) {
+	openDBWithSynchronous := func(t *testing.T, synchronous string) *sqlx.DB {
+		return openTestDB(
+			t,
+			"--db-dsn", "//"+filepath.Join(t.TempDir(), "test.db"),
+			"--db-synchronous", synchronous,
+			// close connections after use to force reconnecting
+			"--db-max-idle-conns", "0",
+		)
+	}
+
+	for _, synchronous := range synchronousModes {
+		t.Run(synchronous, func(t *testing.T) {
+			db := openDBWithSynchronous(t, synchronous)
+			defer db.Close()
+
+			for i := 0; i < 2; i++ {
+				mode, err := querySynchronousMode(context.Background(), db)
+				assert.NoError(t, err)
+				assert.Equal(t, synchronous, mode)
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		cmd, _, err := createMainCmd().Find([]string{"serve"})
+		assert.NoError(t, err)
+		assert.NoError(t, cmd.ParseFlags([]string{"--db-dsn", ":memory:", "--db-synchronous", "fast"}))
+		_, err = openDB(cmd)
+		assert.Error(t, err)
+	})
+
+	t.Run("Throughput", func(t *testing.T) {
+		const rows = 200
+		insertDuration := func(t *testing.T, synchronous string) time.Duration {
+			db := openDBWithSynchronous(t, synchronous)
+			defer db.Close()
+
+			_, err := db.Exec("CREATE TABLE test (id int)")
+			assert.NoError(t, err)
+			start := time.Now()
+			for i := 0; i < rows; i++ {
+				// each insert is committed in its own transaction
+				_, err := db.Exec("INSERT INTO test (id) VALUES (?)", i)
+				assert.NoError(t, err)
+			}
+			return time.Since(start)
+		}
+
+		off := insertDuration(t, "off")
+		full := insertDuration(t, "full")
+		t.Logf("insert %d rows: off=%s full=%s", rows, off, full)
+		assert.Less(t, off, full)
+	})
+}
+
+func TestSplitSQLStatements(t *testing.T) {
+	assert.Empty(t, splitSQLStatements(""))
+	assert.Empty(t, splitSQLStatements(" ; ;"))
+	assert.Equal(
+		t,
+		[]string{"PRAGMA cache_size=-64000", "PRAGMA temp_store=MEMORY"},
+		splitSQLStatements("PRAGMA cache_size=-64000; PRAGMA temp_store=MEMORY;"),
+	)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/cobra"
+)
+
+const (
+	exportFormatCSV    = "csv"
+	exportFormatJSON   = "json"
+	exportFormatNDJSON = "ndjson"
+)
+
+// quoteIdentifier quotes the SQLite identifier.
+//
+// ref: https://www.sqlite.org/lang_keywords.html
+func quoteIdentifier(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// rowsWriter writes the rows in the export format.
+type rowsWriter interface {
+	WriteHeader(columns []string) error
+	WriteRow(row map[string]interface{}) error
+	Close() error
+}
+
+type csvRowsWriter struct {
+	w       *csv.Writer
+	columns []string
+	record  []string
+}
+
+func (rw *csvRowsWriter) WriteHeader(columns []string) error {
+	rw.columns = columns
+	rw.record = make([]string, len(columns))
+	return rw.w.Write(columns)
+}
+
+func (rw *csvRowsWriter) WriteRow(row map[string]interface{}) error {
+	for idx, column := range rw.columns {
+		rw.record[idx] = formatCSVValue(row[column])
+	}
+	return rw.w.Write(rw.record)
+}
+
+func (rw *csvRowsWriter) Close() error {
+	rw.w.Flush()
+	return rw.w.Error()
+}
+
+// jsonRowsWriter writes the rows as JSON array or newline-delimited JSON objects.
+type jsonRowsWriter struct {
+	w       io.Writer
+	enc     *json.Encoder
+	ndjson  bool
+	written int
+}
+
+func (rw *jsonRowsWriter) WriteHeader(columns []string) error {
+	if rw.ndjson {
+		return nil
+	}
+	_, err := io.WriteString(rw.w, "[")
+	return err
+}
+
+func (rw *jsonRowsWriter) WriteRow(row map[string]interface{}) error {
+	if !rw.ndjson && rw.written > 0 {
+		if _, err := io.WriteString(rw.w, ","); err != nil {
+			return err
+		}
+	}
+	rw.written++
+	return rw.enc.Encode(row)
+}
+
+func (rw *jsonRowsWriter) Close() error {
+	if rw.ndjson {
+		return nil
+	}
+	_, err := io.WriteString(rw.w, "]\n")
+	return err
+}
+
+func newRowsWriter(w io.Writer, format string) (rowsWriter, error) {
+	switch format {
+	case exportFormatCSV:
+		return &csvRowsWriter{w: csv.NewWriter(w)}, nil
+	case exportFormatJSON, exportFormatNDJSON:
+		return &jsonRowsWriter{
+			w:      w,
+			enc:    json.NewEncoder(w),
+			ndjson: format == exportFormatNDJSON,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// exportTable writes all rows of the table in the format. Rows are streamed without
+// buffering the whole table.
+func exportTable(ctx context.Context, db *sqlx.DB, table string, format string, w io.Writer) error {
+	rw, err := newRowsWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.QueryxContext(ctx, fmt.Sprintf("SELECT * FROM %s", quoteIdentifier(table)))
+	if err != nil {
+		return fmt.Errorf("query table %q: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("read columns: %w", err)
+	}
+	if err := rw.WriteHeader(columns); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		row := make(map[string]interface{})
+		if err := rows.MapScan(row); err != nil {
+			return fmt.Errorf("scan row: %w", err)
+		}
+		if err := rw.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read rows: %w", err)
+	}
+
+	return rw.Close()
+}
+
+func createExportCmd() *cobra.Command {
+	var (
+		flagTable  string
+		flagOutput string
+		flagFormat string
+	)
+
+	cmd := &cobra.Command{
+		Use:          "export",
+		Short:        "Export the rows of a table",
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if flagTable == "" {
+				return fmt.Errorf("--table is required")
+			}
+			switch flagFormat {
+			case exportFormatCSV, exportFormatJSON, exportFormatNDJSON:
+			default:
+				return fmt.Errorf("unsupported --format %q", flagFormat)
+			}
+
+			db, err := openDB(cmd)
+			if err != nil {
+				setupLogger.Error(err, "create db")
+				return err
+			}
+			defer db.Close()
+
+			if flagOutput == "" || flagOutput == "-" {
+				return exportTable(context.Background(), db, flagTable, flagFormat, cmd.OutOrStdout())
+			}
+
+			f, err := os.Create(flagOutput)
+			if err != nil {
+				return fmt.Errorf("create output %q: %w", flagOutput, err)
+			}
+			if err := exportTable(context.Background(), db, flagTable, flagFormat, f); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		},
+	}
+
+	bindDBDSNFlag(cmd.Flags())
+	cmd.Flags().StringVar(&flagTable, "table", "", "name of the table or view to export")
+	cmd.Flags().StringVar(&flagOutput, "output", "", "path of the output file. Defaults to stdout.")
+	cmd.Flags().StringVar(&flagFormat, "format", exportFormatCSV, "output format: csv, json or ndjson")
+
+	return cmd
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// exportTestRowText returns values to be quoted in CSV, as well as empty string and NULL.
+func exportTestRowText(i int) interface{} {
+	switch i % 10 {
+	case 1:
+		return ""
+	case 2:
+		return nil
+	default:
+		return fmt.Sprintf("row %d, \"quoted\"\nline", i)
+	}
+}
+
+// assertExportRoundTrip inserts the exported rows to the imported table and checks that
+// it has the same content as the rows of the source query.
+func assertExportRoundTrip(t *testing.T, dsn string, source string, rows []map[string]interface{}, expectedRows int) {
+	db := openTestDB(t, "--db-dsn", dsn)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE imported (id int, s text, f real)")
+	assert.NoError(t, err)
+	for _, row := range rows {
+		_, err := db.NamedExec("INSERT INTO imported (id, s, f) VALUES (:id, :s, :f)", row)
+		assert.NoError(t, err)
+	}
+
+	var count int
+	assert.NoError(t, db.QueryRow("SELECT count(*) FROM imported").Scan(&count))
+	assert.Equal(t, expectedRows, count)
+	assert.NoError(t, db.QueryRow(
+		fmt.Sprintf("SELECT count(*) FROM (%s EXCEPT SELECT * FROM imported)", source),
+	).Scan(&count))
+	assert.Equal(t, 0, count)
+}
+
+func runExportCmd(t *testing.T, args ...string) ([]byte, error) {
+	out := &bytes.Buffer{}
+	cmd := createMainCmd()
+	cmd.SetOut(out)
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs(append([]string{"export"}, args...))
+	err := cmd.Execute()
+	return out.Bytes(), err
+}
+
+func TestExportCmd(t *testing.T) {
+	const rows = 1000
+
+	t.Run("csv", func(t *testing.T) {
+		dsn := createTestDBFile(t, rows, exportTestRowText)
+		output := filepath.Join(t.TempDir(), "test.csv")
+
+		_, err := runExportCmd(t, "--db-dsn", dsn, "--table", "test", "--output", output)
+		assert.NoError(t, err)
+
+		f, err := os.Open(output)
+		assert.NoError(t, err)
+		defer f.Close()
+		records, err := csv.NewReader(f).ReadAll()
+		assert.NoError(t, err)
+		assert.Len(t, records, rows+1)
+		assert.Equal(t, []string{"id", "s", "f"}, records[0])
+
+		// NULL and empty string are both written as empty field
+		assert.Equal(t, []string{"1", "", "1.5"}, records[2])
+		assert.Equal(t, []string{"2", "", "2.5"}, records[3])
+
+		var exported []map[string]interface{}
+		for _, record := range records[1:] {
+			row := map[string]interface{}{}
+			for idx, column := range records[0] {
+				// same as import, empty field is read as NULL
+				if record[idx] == "" {
+					row[column] = nil
+				} else {
+					row[column] = record[idx]
+				}
+			}
+			exported = append(exported, row)
+		}
+		assertExportRoundTrip(t, dsn, "SELECT id, nullif(s, ''), f FROM test", exported, rows)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		dsn := createTestDBFile(t, rows, exportTestRowText)
+
+		out, err := runExportCmd(t, "--db-dsn", dsn, "--table", "test", "--format", "json")
+		assert.NoError(t, err)
+
+		var exported []map[string]interface{}
+		assert.NoError(t, json.Unmarshal(out, &exported))
+		assertExportRoundTrip(t, dsn, "SELECT * FROM test", exported, rows)
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		dsn := createTestDBFile(t, rows, exportTestRowText)
+
+		out, err := runExportCmd(t, "--db-dsn", dsn, "--table", "test", "--format", "ndjson")
+		assert.NoError(t, err)
+
+		var exported []map[string]interface{}
+		scanner := bufio.NewScanner(bytes.NewReader(out))
+		for scanner.Scan() {
+			var row map[string]interface{}
+			assert.NoError(t, json.Unmarshal(scanner.Bytes(), &row))
+			exported = append(exported, row)
+		}
+		assert.NoError(t, scanner.Err())
+		assertExportRoundTrip(t, dsn, "SELECT * FROM test", exported, rows)
+	})
+
+	t.Run("empty table", func(t *testing.T) {
+		dsn := createTestDBFile(t, 0, nil)
+
+		out, err := runExportCmd(t, "--db-dsn", dsn, "--table", "test", "--format", "json")
+		assert.NoError(t, err)
+		assert.Equal(t, "[]\n", string(out))
+	})
+
+	t.Run("unknown table", func(t *testing.T) {
+		dsn := createTestDBFile(t, 0, nil)
+
+		_, err := runExportCmd(t, "--db-dsn", dsn, "--table", `unknown"; DROP TABLE test; --`)
+		assert.Error(t, err)
+
+		db := openTestDB(t, "--db-dsn", dsn)
+		defer db.Close()
+		var count int
+		assert.NoError(t, db.QueryRow("SELECT count(*) FROM test").Scan(&count))
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		dsn := createTestDBFile(t, 0, nil)
+
+		_, err := runExportCmd(t, "--db-dsn", dsn, "--table", "test", "--format", "xml")
+		assert.Error(t, err)
+	})
+}
@@ -1,22 +1,30 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/go-logr/logr"
-	"github.com/golang-jwt/jwt"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 	"github.com/supabase/postgrest-go"
@@ -26,10 +34,11 @@ import (
 var enabledTestTables = []string{"test", "test_view"}
 
 type TestContext struct {
-	server    *httptest.Server
-	db        *sqlx.DB
-	cleanUpDB func(t testing.TB)
-	authToken string
+	server     *httptest.Server
+	db         *sqlx.DB
+	cleanUpDB  func(t testing.TB)
+	authToken  string
+	httpClient *http.Client
 }
 
 func NewTestContextWithDB(
@@ -85,6 +94,9 @@ func (tc *TestContext) Client() *postgrest.Client {
 }
 
 func (tc *TestContext) HTTPClient() *http.Client {
+	if tc.httpClient != nil {
+		return tc.httpClient
+	}
 	return &http.Client{}
 }
 
@@ -123,6 +135,13 @@ func createTestLogger(t testing.TB) logr.Logger {
 }
 
 func createTestContextUsingInMemoryDB(t testing.TB) *TestContext {
+	return createTestContextUsingInMemoryDBWithServerOptions(t, nil)
+}
+
+func createTestContextUsingInMemoryDBWithServerOptions(
+	t testing.TB,
+	configureServerOpts func(opts *ServerOptions),
+) *TestContext {
 	t.Log("creating in-memory db")
 	db, err := sqlx.Open("sqlite3", ":memory:")
 	if err != nil {
@@ -138,6 +157,9 @@ func createTestContextUsingInMemoryDB(t testing.TB) *TestContext {
 	}
 	serverOpts.AuthOptions.disableAuth = true
 	serverOpts.SecurityOptions.EnabledTableOrViews = enabledTestTables
+	if configureServerOpts != nil {
+		configureServerOpts(serverOpts)
+	}
 	server, err := NewServer(serverOpts)
 	if err != nil {
 		t.Fatal(err)
@@ -157,24 +179,121 @@ func createTestContextUsingInMemoryDB(t testing.TB) *TestContext {
 	)
 }
 
-func createTestContextWithHMACTokenAuth(t testing.TB) *TestContext {
-	t.Log("creating test dir")
-	dir, err := os.MkdirTemp("", "sqlite-rest-test")
+// generateSelfSignedCert generates a self-signed certificate for 127.0.0.1 & localhost
+// and writes the certificate & private key files under dir.
+func generateSelfSignedCert(t testing.TB, dir string) (certFile string, keyFile string) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"sqlite-rest test"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:     []string{"localhost"},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+
+	certFile = filepath.Join(dir, "tls.crt")
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0644)
+	assert.NoError(t, err)
+	keyFile = filepath.Join(dir, "tls.key")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600)
+	assert.NoError(t, err)
+
+	return certFile, keyFile
+}
+
+// createTLSTestClient creates a http client trusting the certificate.
+func createTLSTestClient(t testing.TB, certFile string) *http.Client {
+	certPEM, err := os.ReadFile(certFile)
+	assert.NoError(t, err)
+
+	certPool := x509.NewCertPool()
+	assert.True(t, certPool.AppendCertsFromPEM(certPEM))
+
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: certPool},
+		},
+	}
+}
+
+// createTestContextUsingInMemoryDBWithTLS creates a test context serving with
+// a self-signed certificate.
+func createTestContextUsingInMemoryDBWithTLS(t testing.TB) *TestContext {
+	dir := t.TempDir()
+	certFile, keyFile := generateSelfSignedCert(t, dir)
+
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.TLSCertFile = certFile
+		opts.TLSKeyFile = keyFile
+	})
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
 	if err != nil {
 		t.Fatal(err)
 		return nil
 	}
+	// restart the test server with TLS
+	handler := tc.server.Config.Handler
+	tc.server.Close()
+	tc.server = httptest.NewUnstartedServer(handler)
+	tc.server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	tc.server.StartTLS()
+	tc.httpClient = createTLSTestClient(t, certFile)
 
-	t.Log("creating test token file")
-	testToken := []byte("test-token")
-	testTokenFile := filepath.Join(dir, "token")
-	if err := os.WriteFile(testTokenFile, testToken, 0644); err != nil {
+	return tc
+}
+
+// createTestContextWithKeyFileAuth creates a test context with the auth key written to a key file.
+// The configureAuthOpts sets the key file to the auth options, and signToken signs the
+// auth token used by the test context.
+func createTestContextWithKeyFileAuth(
+	t testing.TB,
+	keyFileContent []byte,
+	configureAuthOpts func(opts *ServerAuthOptions, keyFile string),
+	signToken func() (string, error),
+) *TestContext {
+	return createTestContextWithTokenAuth(
+		t,
+		func(opts *ServerOptions, dir string) error {
+			t.Log("creating test token file")
+			testTokenFile := filepath.Join(dir, "token")
+			if err := os.WriteFile(testTokenFile, keyFileContent, 0644); err != nil {
+				return err
+			}
+			configureAuthOpts(&opts.AuthOptions, testTokenFile)
+			return nil
+		},
+		signToken,
+	)
+}
+
+// createTestContextWithTokenAuth creates a test context with token auth. The setupAuth
+// prepares the auth keys under the test dir and sets the server options.
+func createTestContextWithTokenAuth(
+	t testing.TB,
+	setupAuth func(opts *ServerOptions, dir string) error,
+	signToken func() (string, error),
+) *TestContext {
+	t.Log("creating test dir")
+	dir, err := os.MkdirTemp("", "sqlite-rest-test")
+	if err != nil {
 		t.Fatal(err)
 		return nil
 	}
 
-	authToken := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.StandardClaims{})
-	authTokenString, err := authToken.SignedString(testToken)
+	authTokenString, err := signToken()
 	if err != nil {
 		t.Fatal(err)
 		return nil
@@ -192,8 +311,11 @@ func createTestContextWithHMACTokenAuth(t testing.TB) *TestContext {
 		Queryer: db,
 		Execer:  db,
 	}
-	serverOpts.AuthOptions.TokenFilePath = testTokenFile
 	serverOpts.SecurityOptions.EnabledTableOrViews = enabledTestTables
+	if err := setupAuth(serverOpts, dir); err != nil {
+		t.Fatal(err)
+		return nil
+	}
 	server, err := NewServer(serverOpts)
 	if err != nil {
 		t.Fatal(err)
@@ -219,92 +341,153 @@ func createTestContextWithHMACTokenAuth(t testing.TB) *TestContext {
 	)
 }
 
-func createTestContextWithRSATokenAuth(t testing.TB) *TestContext {
-	t.Log("creating test dir")
-	dir, err := os.MkdirTemp("", "sqlite-rest-test")
-	if err != nil {
-		t.Fatal(err)
-		return nil
-	}
+func createTestContextWithHMACTokenAuth(t testing.TB) *TestContext {
+	testToken := []byte("test-token")
 
-	t.Log("creating test token file")
-	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
-	if err != nil {
-		t.Fatal(err)
-		return nil
-	}
-	b, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	return createTestContextWithKeyFileAuth(
+		t,
+		testToken,
+		func(opts *ServerAuthOptions, keyFile string) {
+			opts.TokenFilePath = keyFile
+		},
+		func() (string, error) {
+			authToken := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{})
+			return authToken.SignedString(testToken)
+		},
+	)
+}
+
+func encodePublicKeyAsPEM(t testing.TB, publicKey interface{}) []byte {
+	b, err := x509.MarshalPKIXPublicKey(publicKey)
 	if err != nil {
 		t.Fatal(err)
 		return nil
 	}
-	publicKeyPem := pem.EncodeToMemory(&pem.Block{
+	return pem.EncodeToMemory(&pem.Block{
 		Type:  "PUBLIC KEY",
 		Bytes: b,
 	})
+}
 
-	testTokenFile := filepath.Join(dir, "token")
-	if err := os.WriteFile(testTokenFile, publicKeyPem, 0644); err != nil {
-		t.Fatal(err)
-		return nil
-	}
-
-	authToken := jwt.NewWithClaims(jwt.SigningMethodRS256, &jwt.StandardClaims{})
-	authTokenString, err := authToken.SignedString(privateKey)
+func createTestContextWithRSATokenAuth(t testing.TB) *TestContext {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
 	if err != nil {
 		t.Fatal(err)
 		return nil
 	}
 
-	db, err := sqlx.Open("sqlite3", "//"+filepath.Join(dir, "test.db"))
+	return createTestContextWithKeyFileAuth(
+		t,
+		encodePublicKeyAsPEM(t, &privateKey.PublicKey),
+		func(opts *ServerAuthOptions, keyFile string) {
+			opts.RSAPublicKeyFilePath = keyFile
+		},
+		func() (string, error) {
+			authToken := jwt.NewWithClaims(jwt.SigningMethodRS256, &jwt.RegisteredClaims{})
+			return authToken.SignedString(privateKey)
+		},
+	)
+}
+
+func createTestContextWithECDSATokenAuth(t testing.TB) *TestContext {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
 		t.Fatal(err)
 		return nil
 	}
 
-	t.Log("creating server")
-	serverOpts := &ServerOptions{
-		Logger:  createTestLogger(t).WithName("test"),
-		Queryer: db,
-		Execer:  db,
-	}
-	serverOpts.AuthOptions.RSAPublicKeyFilePath = testTokenFile
-	serverOpts.SecurityOptions.EnabledTableOrViews = enabledTestTables
-	server, err := NewServer(serverOpts)
+	return createTestContextWithKeyFileAuth(
+		t,
+		encodePublicKeyAsPEM(t, &privateKey.PublicKey),
+		func(opts *ServerAuthOptions, keyFile string) {
+			opts.ECDSAPublicKeyFilePath = keyFile
+		},
+		func() (string, error) {
+			authToken := jwt.NewWithClaims(jwt.SigningMethodES256, &jwt.RegisteredClaims{})
+			return authToken.SignedString(privateKey)
+		},
+	)
+}
+
+func createTestContextWithEd25519TokenAuth(t testing.TB) *TestContext {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
 	if err != nil {
 		t.Fatal(err)
 		return nil
 	}
 
-	return NewTestContextWithDB(
+	return createTestContextWithKeyFileAuth(
 		t,
-		server.server.Handler,
-		db,
-		func(t testing.TB) {
-			if err := db.Close(); err != nil {
-				t.Fatalf("closing db: %s", err)
-				return
-			}
+		encodePublicKeyAsPEM(t, publicKey),
+		func(opts *ServerAuthOptions, keyFile string) {
+			opts.Ed25519PublicKeyFilePath = keyFile
+		},
+		func() (string, error) {
+			authToken := jwt.NewWithClaims(jwt.SigningMethodEdDSA, &jwt.RegisteredClaims{})
+			return authToken.SignedString(privateKey)
+		},
+	)
+}
 
-			if err := os.RemoveAll(dir); err != nil {
-				t.Fatalf("removing test dir %q: %s", dir, err)
-				return
+// createTestContextWithHMACClaimsAuth creates a test context using HMAC token auth. The returned
+// function signs token with the given claims.
+func createTestContextWithHMACClaimsAuth(
+	t testing.TB,
+	configureServerOpts func(opts *ServerOptions),
+) (*TestContext, func(claims jwt.Claims) string) {
+	testToken := []byte("test-token")
+	signToken := func(claims jwt.Claims) string {
+		authToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testToken)
+		assert.NoError(t, err)
+		return authToken
+	}
+
+	tc := createTestContextWithTokenAuth(
+		t,
+		func(opts *ServerOptions, dir string) error {
+			tokenFile := filepath.Join(dir, "token")
+			if err := os.WriteFile(tokenFile, testToken, 0644); err != nil {
+				return err
 			}
+			opts.AuthOptions.TokenFilePath = tokenFile
+			configureServerOpts(opts)
+			return nil
+		},
+		func() (string, error) {
+			return signToken(&jwt.RegisteredClaims{}), nil
 		},
-		authTokenString,
 	)
+
+	return tc, signToken
 }
 
 type MigrationTestContext struct {
-	migrator  *dbMigrator
-	db        *sqlx.DB
-	cleanUpDB func(t testing.TB)
+	migrator      *dbMigrator
+	db            *sqlx.DB
+	migrationsDir string
+	cleanUpDB     func(t testing.TB)
 }
 
 func (mtc *MigrationTestContext) Migrator() *dbMigrator {
 	return mtc.migrator
 }
 
+// DryRunMigrator creates a migrator in dry run mode using the same db and migrations.
+func (mtc *MigrationTestContext) DryRunMigrator(t testing.TB) *dbMigrator {
+	migrator, err := NewMigrator(&MigrateOptions{
+		Logger:    createTestLogger(t).WithName("test"),
+		DB:        mtc.db.DB,
+		SourceDIR: mtc.migrationsDir,
+		DryRun:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+		return nil
+	}
+
+	return migrator
+}
+
 func (mtc *MigrationTestContext) CleanUp(t testing.TB) {
 	if mtc.cleanUpDB != nil {
 		mtc.cleanUpDB(t)
@@ -314,6 +497,14 @@ func (mtc *MigrationTestContext) CleanUp(t testing.TB) {
 func NewMigrationTestContext(
 	t testing.TB,
 	migrations map[string]string,
+) *MigrationTestContext {
+	return NewMigrationTestContextWithOptions(t, migrations, nil)
+}
+
+func NewMigrationTestContextWithOptions(
+	t testing.TB,
+	migrations map[string]string,
+	configureMigrateOpts func(opts *MigrateOptions),
 ) *MigrationTestContext {
 	t.Log("creating test dir")
 	dir, err := os.MkdirTemp("", "sqlite-rest-test")
@@ -350,6 +541,9 @@ func NewMigrationTestContext(
 		DB:        db.DB,
 		SourceDIR: migrationsDir,
 	}
+	if configureMigrateOpts != nil {
+		configureMigrateOpts(migratorOpts)
+	}
 
 	migrator, err := NewMigrator(migratorOpts)
 	if err != nil {
@@ -358,8 +552,9 @@ func NewMigrationTestContext(
 	}
 
 	return &MigrationTestContext{
-		migrator: migrator,
-		db:       db,
+		migrator:      migrator,
+		db:            db,
+		migrationsDir: migrationsDir,
 		cleanUpDB: func(t testing.TB) {
 			if err := db.Close(); err != nil {
 				t.Errorf("closing in-memory db: %s", err)
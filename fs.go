@@ -1,7 +1,11 @@
 package main
 
 import (
+	"errors"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 )
 
@@ -70,4 +74,77 @@ func readFileWithStatCache(file string) func() ([]byte, error) {
 
 		return slow()
 	}
-}
\ No newline at end of file
+}
+
+// readDirFilesWithStatCache returns a reader reading the content of the regular files
+// in the directory. Files are listed on each read, and each file content is cached
+// via readFileWithStatCache. Symlinks are resolved to their targets and dotfiles are
+// skipped, so a Kubernetes secret volume (`..data` symlinks) can be read directly.
+func readDirFilesWithStatCache(dir string) func() ([][]byte, error) {
+	mu := new(sync.Mutex)
+	fileReaders := map[string]func() ([]byte, error){}
+
+	getFileReader := func(file string) func() ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r, exists := fileReaders[file]; exists {
+			return r
+		}
+		r := readFileWithStatCache(file)
+		fileReaders[file] = r
+		return r
+	}
+
+	evictFileReaders := func(files map[string]struct{}) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for file := range fileReaders {
+			if _, exists := files[file]; !exists {
+				delete(fileReaders, file)
+			}
+		}
+	}
+
+	return func() ([][]byte, error) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		var rv [][]byte
+		files := map[string]struct{}{}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+
+			file := filepath.Join(dir, entry.Name())
+			stat, err := os.Stat(file)
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+				// dangling symlink or removed after listing
+				continue
+			case err != nil:
+				return nil, err
+			}
+			if !stat.Mode().IsRegular() {
+				continue
+			}
+
+			content, err := getFileReader(file)()
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+				continue
+			case err != nil:
+				return nil, err
+			}
+			files[file] = struct{}{}
+			rv = append(rv, content)
+		}
+		evictFileReaders(files)
+
+		return rv, nil
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/spf13/cobra"
+)
+
+const defaultImportBatchSize = 500
+
+// rowsReader reads the rows in the import format. io.EOF is returned when all rows are read.
+type rowsReader interface {
+	ReadRow() (map[string]interface{}, error)
+}
+
+// csvRowsReader reads the CSV records with the first record as column names. Empty fields
+// are read as NULL, which is the same as the CSV request body.
+type csvRowsReader struct {
+	r       *csv.Reader
+	columns []string
+}
+
+func (rr *csvRowsReader) ReadRow() (map[string]interface{}, error) {
+	if rr.columns == nil {
+		columns, err := rr.r.Read()
+		if err != nil {
+			return nil, err
+		}
+		rr.columns = columns
+	}
+
+	record, err := rr.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	row := make(map[string]interface{}, len(rr.columns))
+	for idx, column := range rr.columns {
+		if record[idx] == "" {
+			row[column] = nil
+		} else {
+			row[column] = record[idx]
+		}
+	}
+	return row, nil
+}
+
+// jsonRowsReader reads the rows from JSON array or newline-delimited JSON objects.
+type jsonRowsReader struct {
+	dec     *json.Decoder
+	ndjson  bool
+	started bool
+}
+
+func (rr *jsonRowsReader) ReadRow() (map[string]interface{}, error) {
+	if !rr.ndjson {
+		if !rr.started {
+			rr.started = true
+			token, err := rr.dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			if delim, ok := token.(json.Delim); !ok || delim != '[' {
+				return nil, fmt.Errorf("expect JSON array, got %v", token)
+			}
+		}
+		if !rr.dec.More() {
+			return nil, io.EOF
+		}
+	}
+
+	var row map[string]interface{}
+	if err := rr.dec.Decode(&row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+func newRowsReader(r io.Reader, format string) (rowsReader, error) {
+	switch format {
+	case exportFormatCSV:
+		return &csvRowsReader{r: csv.NewReader(r)}, nil
+	case exportFormatJSON, exportFormatNDJSON:
+		dec := json.NewDecoder(r)
+		dec.UseNumber()
+		return &jsonRowsReader{dec: dec, ndjson: format == exportFormatNDJSON}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// insertRows inserts the rows to the table. Consecutive rows with the same columns are
+// inserted with a multi-row INSERT, so the columns missing from a row are filled with the
+// column defaults instead of NULL. Each INSERT binds at most maxVariables values.
+func insertRows(
+	ctx context.Context,
+	execer sqlx.ExecerContext,
+	table string,
+	rows []map[string]interface{},
+	maxVariables int,
+) error {
+	for len(rows) > 0 {
+		columns := make([]string, 0, len(rows[0]))
+		for column := range rows[0] {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+
+		n := 1
+		for n < len(rows) && hasColumns(rows[n], columns) {
+			n++
+		}
+		if err := insertRowsWithColumns(ctx, execer, table, columns, rows[:n], maxVariables); err != nil {
+			return err
+		}
+		rows = rows[n:]
+	}
+	return nil
+}
+
+// hasColumns checks if the row has exactly the columns.
+func hasColumns(row map[string]interface{}, columns []string) bool {
+	if len(row) != len(columns) {
+		return false
+	}
+	for _, column := range columns {
+		if _, exists := row[column]; !exists {
+			return false
+		}
+	}
+	return true
+}
+
+func insertRowsWithColumns(
+	ctx context.Context,
+	execer sqlx.ExecerContext,
+	table string,
+	columns []string,
+	rows []map[string]interface{},
+	maxVariables int,
+) error {
+	if len(columns) < 1 {
+		query := fmt.Sprintf("INSERT INTO %s DEFAULT VALUES", quoteIdentifier(table))
+		for range rows {
+			if _, err := execer.ExecContext(ctx, query); err != nil {
+				return fmt.Errorf("insert rows: %w", err)
+			}
+		}
+		return nil
+	}
+
+	quotedColumns := make([]string, len(columns))
+	for idx, column := range columns {
+		quotedColumns[idx] = quoteIdentifier(column)
+	}
+	placeholder := "(" + strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",") + ")"
+
+	batchSize := max(maxVariables/len(columns), 1)
+	for start := 0; start < len(rows); start += batchSize {
+		batch := rows[start:min(start+batchSize, len(rows))]
+		placeholders := make([]string, len(batch))
+		values := make([]interface{}, 0, len(batch)*len(columns))
+		for idx, row := range batch {
+			placeholders[idx] = placeholder
+			for _, column := range columns {
+				values = append(values, row[column])
+			}
+		}
+
+		query := fmt.Sprintf(
+			"INSERT INTO %s (%s) VALUES %s",
+			quoteIdentifier(table), strings.Join(quotedColumns, ","), strings.Join(placeholders, ","),
+		)
+		if _, err := execer.ExecContext(ctx, query, values...); err != nil {
+			return fmt.Errorf("insert rows: %w", err)
+		}
+	}
+	return nil
+}
+
+// defaultMaxVariableNumber is the default SQLITE_MAX_VARIABLE_NUMBER of legacy SQLite
+// versions, which is used if the limit of the connection can't be read.
+const defaultMaxVariableNumber = 999
+
+// getMaxVariableNumber returns the max number of bound parameters of the connection.
+func getMaxVariableNumber(conn *sqlx.Conn) int {
+	rv := defaultMaxVariableNumber
+	_ = conn.Raw(func(driverConn interface{}) error {
+		if c, ok := driverConn.(*sqlite3.SQLiteConn); ok {
+			rv = c.GetLimit(sqlite3.SQLITE_LIMIT_VARIABLE_NUMBER)
+		}
+		return nil
+	})
+	return rv
+}
+
+type importProgressFunc func(imported int)
+
+// importTable inserts the rows read from r to the table in a single transaction and returns
+// the number of imported rows. Existing rows are deleted first if truncate is set.
+func importTable(
+	ctx context.Context,
+	db *sqlx.DB,
+	table string,
+	format string,
+	r io.Reader,
+	truncate bool,
+	batchSize int,
+	progress importProgressFunc,
+) (int, error) {
+	rr, err := newRowsReader(r, format)
+	if err != nil {
+		return 0, err
+	}
+	if batchSize < 1 {
+		batchSize = defaultImportBatchSize
+	}
+
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("open connection: %w", err)
+	}
+	defer conn.Close()
+	maxVariables := getMaxVariableNumber(conn)
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if truncate {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", quoteIdentifier(table))); err != nil {
+			return 0, fmt.Errorf("truncate table %q: %w", table, err)
+		}
+	}
+
+	imported := 0
+	batch := make([]map[string]interface{}, 0, batchSize)
+	flush := func() error {
+		if len(batch) < 1 {
+			return nil
+		}
+		if err := insertRows(ctx, tx, table, batch, maxVariables); err != nil {
+			return err
+		}
+		imported += len(batch)
+		batch = batch[:0]
+		if progress != nil {
+			progress(imported)
+		}
+		return nil
+	}
+
+	for {
+		row, err := rr.ReadRow()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return imported, fmt.Errorf("read row %d: %w", imported+len(batch)+1, err)
+		}
+		batch = append(batch, row)
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				return imported, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return imported, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return imported, fmt.Errorf("commit transaction: %w", err)
+	}
+	return imported, nil
+}
+
+func createImportCmd() *cobra.Command {
+	var (
+		flagTable     string
+		flagInput     string
+		flagFormat    string
+		flagTruncate  bool
+		flagBatchSize int
+	)
+
+	cmd := &cobra.Command{
+		Use:          "import",
+		Short:        "Import rows to a table",
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if flagTable == "" {
+				return fmt.Errorf("--table is required")
+			}
+			if flagInput == "" {
+				return fmt.Errorf("--input is required")
+			}
+			if flagBatchSize < 1 {
+				return fmt.Errorf("--batch-size must be positive")
+			}
+
+			logger, err := createLogger(cmd)
+			if err != nil {
+				setupLogger.Error(err, "failed to create logger")
+				return err
+			}
+
+			var input io.Reader = cmd.InOrStdin()
+			if flagInput != "-" {
+				f, err := os.Open(flagInput)
+				if err != nil {
+					return fmt.Errorf("open input %q: %w", flagInput, err)
+				}
+				defer f.Close()
+				input = f
+			}
+
+			db, err := openDB(cmd)
+			if err != nil {
+				setupLogger.Error(err, "create db")
+				return err
+			}
+			defer db.Close()
+
+			logger = logger.WithName("import").WithValues("table", flagTable)
+			imported, err := importTable(
+				context.Background(), db, flagTable, flagFormat, input,
+				flagTruncate, flagBatchSize, logImportProgress(logger),
+			)
+			if err != nil {
+				logger.Error(err, "import failed")
+				return err
+			}
+			logger.Info("import completed", "rows", imported)
+
+			return nil
+		},
+	}
+
+	bindDBDSNFlag(cmd.Flags())
+	cmd.Flags().StringVar(&flagTable, "table", "", "name of the table to import to")
+	cmd.Flags().StringVar(&flagInput, "input", "", "path of the input file. Use - to read from stdin.")
+	cmd.Flags().StringVar(&flagFormat, "format", exportFormatCSV, "input format: csv, json or ndjson")
+	cmd.Flags().BoolVar(&flagTruncate, "truncate", false, "Delete existing rows before import?")
+	cmd.Flags().IntVar(
+		&flagBatchSize, "batch-size", defaultImportBatchSize,
+		"max number of rows to insert per INSERT statement",
+	)
+
+	return cmd
+}
+
+func logImportProgress(logger logr.Logger) importProgressFunc {
+	return func(imported int) {
+		logger.Info("import progress", "imported", imported)
+	}
+}
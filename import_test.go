@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeImportTestCSV(t *testing.T, rows int) string {
+	p := filepath.Join(t.TempDir(), "test.csv")
+	f, err := os.Create(p)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	assert.NoError(t, w.Write([]string{"id", "s", "f"}))
+	for i := 0; i < rows; i++ {
+		assert.NoError(t, w.Write([]string{
+			fmt.Sprint(i), fmt.Sprintf("row %d, \"quoted\"", i), fmt.Sprint(float64(i) + 0.5),
+		}))
+	}
+	w.Flush()
+	assert.NoError(t, w.Error())
+
+	return p
+}
+
+func runImportCmd(stdin string, args ...string) error {
+	cmd := createMainCmd()
+	cmd.SetIn(strings.NewReader(stdin))
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs(append([]string{"import"}, args...))
+	return cmd.Execute()
+}
+
+func TestImportCmd(t *testing.T) {
+	t.Run("csv", func(t *testing.T) {
+		const rows = 10000
+		dsn := createTestDBFile(t, 0, nil)
+		input := writeImportTestCSV(t, rows)
+
+		err := runImportCmd("", "--db-dsn", dsn, "--table", "test", "--input", input, "--batch-size", "300")
+		assert.NoError(t, err)
+
+		db := openTestDB(t, "--db-dsn", dsn)
+		defer db.Close()
+
+		var count int
+		assert.NoError(t, db.QueryRow("SELECT count(*) FROM test").Scan(&count))
+		assert.Equal(t, rows, count)
+
+		for _, id := range []int{0, 299, 300, 5000, rows - 1} {
+			var (
+				s string
+				f float64
+			)
+			assert.NoError(t, db.QueryRow("SELECT s, f FROM test WHERE id = ?", id).Scan(&s, &f))
+			assert.Equal(t, fmt.Sprintf("row %d, \"quoted\"", id), s)
+			assert.Equal(t, float64(id)+0.5, f)
+		}
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		dsn := createTestDBFile(t, 0, nil)
+		input := writeImportTestCSV(t, 10)
+
+		assert.NoError(t, runImportCmd("", "--db-dsn", dsn, "--table", "test", "--input", input))
+		assert.NoError(t, runImportCmd("", "--db-dsn", dsn, "--table", "test", "--input", input))
+
+		db := openTestDB(t, "--db-dsn", dsn)
+		defer db.Close()
+
+		var count int
+		assert.NoError(t, db.QueryRow("SELECT count(*) FROM test").Scan(&count))
+		assert.Equal(t, 20, count)
+
+		assert.NoError(t, runImportCmd("", "--db-dsn", dsn, "--table", "test", "--input", input, "--truncate"))
+		assert.NoError(t, db.QueryRow("SELECT count(*) FROM test").Scan(&count))
+		assert.Equal(t, 10, count)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		dsn := createTestDBFile(t, 0, nil)
+
+		err := runImportCmd(
+			`[{"id": 1, "s": "a"}, {"id": 2, "f": 2.5}]`,
+			"--db-dsn", dsn, "--table", "test", "--input", "-", "--format", "json",
+		)
+		assert.NoError(t, err)
+
+		db := openTestDB(t, "--db-dsn", dsn)
+		defer db.Close()
+
+		var sum int
+		assert.NoError(t, db.QueryRow("SELECT sum(id) FROM test WHERE s IS NULL OR f IS NULL").Scan(&sum))
+		assert.Equal(t, 3, sum)
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		dsn := createTestDBFile(t, 0, nil)
+
+		err := runImportCmd(
+			"{\"id\": 1, \"s\": \"a\"}\n{\"id\": 2, \"s\": \"b\"}\n",
+			"--db-dsn", dsn, "--table", "test", "--input", "-", "--format", "ndjson",
+		)
+		assert.NoError(t, err)
+
+		db := openTestDB(t, "--db-dsn", dsn)
+		defer db.Close()
+
+		var s string
+		assert.NoError(t, db.QueryRow("SELECT group_concat(s, ',') FROM test ORDER BY id").Scan(&s))
+		assert.Equal(t, "a,b", s)
+	})
+
+	t.Run("failed import is rolled back", func(t *testing.T) {
+		dsn := createTestDBFile(t, 0, nil)
+		input := writeImportTestCSV(t, 10)
+
+		assert.NoError(t, runImportCmd("", "--db-dsn", dsn, "--table", "test", "--input", input))
+		err := runImportCmd(
+			`[{"id": 1}, {"unknown": 2}]`,
+			"--db-dsn", dsn, "--table", "test", "--input", "-", "--format", "json", "--truncate", "--batch-size", "1",
+		)
+		assert.Error(t, err)
+
+		db := openTestDB(t, "--db-dsn", dsn)
+		defer db.Close()
+
+		var count int
+		assert.NoError(t, db.QueryRow("SELECT count(*) FROM test").Scan(&count))
+		assert.Equal(t, 10, count)
+	})
+
+	t.Run("missing columns use defaults", func(t *testing.T) {
+		dsn := "//" + filepath.Join(t.TempDir(), "test.db")
+		db := openTestDB(t, "--db-dsn", dsn)
+		defer db.Close()
+		_, err := db.Exec("CREATE TABLE test (id int, s text DEFAULT 'default', f real)")
+		assert.NoError(t, err)
+
+		err = runImportCmd(
+			`[{"id": 1, "s": "a"}, {"id": 2}, {"id": 3, "s": null}, {}, {"id": 5}]`,
+			"--db-dsn", dsn, "--table", "test", "--input", "-", "--format", "json",
+		)
+		assert.NoError(t, err)
+
+		var s string
+		assert.NoError(t, db.QueryRow("SELECT group_concat(coalesce(id, '-') || ':' || coalesce(s, 'NULL'), ',') FROM test").Scan(&s))
+		assert.Equal(t, "1:a,2:default,3:NULL,-:default,5:default", s)
+	})
+}
+
+func TestImportTable_VariableLimit(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t, "--db-dsn", "//"+filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+	// the limit is set per connection
+	db.SetMaxOpenConns(1)
+
+	conn, err := db.Conn(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Raw(func(driverConn interface{}) error {
+		driverConn.(*sqlite3.SQLiteConn).SetLimit(sqlite3.SQLITE_LIMIT_VARIABLE_NUMBER, 999)
+		return nil
+	}))
+	_, err = conn.ExecContext(ctx, "CREATE TABLE test (a int, b int, c int, d int)")
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Close())
+
+	const rows = 1000
+	var input strings.Builder
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&input, "{\"a\": %d, \"b\": 1, \"c\": 2, \"d\": 3}\n", i)
+	}
+
+	// 500 rows * 4 columns exceeds the limit
+	imported, err := importTable(ctx, db, "test", exportFormatNDJSON, strings.NewReader(input.String()), false, 500, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, rows, imported)
+
+	var count int
+	assert.NoError(t, db.QueryRow("SELECT count(distinct a) FROM test").Scan(&count))
+	assert.Equal(t, rows, count)
+}
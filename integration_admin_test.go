@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testAdminToken = "test-admin-token"
+
+func createAdminTestContext(t testing.TB, backupDir string, dbArgs ...string) *TestContext {
+	db := openTestDB(t, append([]string{"--db-dsn", "//" + filepath.Join(t.TempDir(), "test.db")}, dbArgs...)...)
+
+	server, err := NewServer(&ServerOptions{
+		Logger:      createTestLogger(t).WithName("test"),
+		Queryer:     db,
+		Execer:      db,
+		AuthOptions: ServerAuthOptions{disableAuth: true},
+		AdminToken:  testAdminToken,
+		BackupDir:   backupDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+		return nil
+	}
+
+	tc := NewTestContextWithDB(t, server.server.Handler, db, func(t testing.TB) {
+		assert.NoError(t, db.Close())
+	}, testAdminToken)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+	for i := 0; i < 100; i++ {
+		tc.ExecuteSQL(t, "INSERT INTO test (id, s) VALUES (?, ?)", i, "a")
+	}
+
+	return tc
+}
+
+func assertBackupIdenticalToSource(t *testing.T, tc *TestContext, backupFile string) {
+	backupDB := openTestDB(t, "--db-dsn", backupFile)
+	defer backupDB.Close()
+
+	var integrity string
+	assert.NoError(t, backupDB.Get(&integrity, "PRAGMA integrity_check"))
+	assert.Equal(t, "ok", integrity)
+
+	query := "SELECT id, s FROM test ORDER BY id"
+	var expected, actual []struct {
+		ID int    `db:"id"`
+		S  string `db:"s"`
+	}
+	assert.NoError(t, tc.DB().Select(&expected, query))
+	assert.NoError(t, backupDB.Select(&actual, query))
+	assert.NotEmpty(t, actual)
+	assert.Equal(t, expected, actual)
+}
+
+func TestAdminBackup(t *testing.T) {
+	t.Run("Unauthorized", func(t *testing.T) {
+		t.Parallel()
+		tc := createAdminTestContext(t, "")
+		defer tc.CleanUp(t)
+
+		for _, token := range []string{"", "invalid"} {
+			tc.authToken = token
+			resp := tc.ExecuteRequest(t, tc.NewRequest(t, http.MethodPost, "_admin/backup", nil))
+			resp.Body.Close()
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContextUsingInMemoryDB(t)
+		defer tc.CleanUp(t)
+
+		resp := tc.ExecuteRequest(t, tc.NewRequest(t, http.MethodPost, "_admin/backup", nil))
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		t.Parallel()
+		tc := createAdminTestContext(t, "")
+		defer tc.CleanUp(t)
+
+		resp := tc.ExecuteRequest(t, tc.NewRequest(t, http.MethodPost, "_admin/backup", nil))
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/octet-stream", resp.Header.Get("Content-Type"))
+
+		backupFile := filepath.Join(t.TempDir(), "backup.db")
+		b, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(backupFile, b, 0644))
+
+		assertBackupIdenticalToSource(t, tc, backupFile)
+	})
+
+	t.Run("ToFile", func(t *testing.T) {
+		t.Parallel()
+		backupDir := t.TempDir()
+		tc := createAdminTestContext(t, backupDir)
+		defer tc.CleanUp(t)
+
+		req := tc.NewRequest(t, http.MethodPost, "_admin/backup", bytes.NewBufferString(`{"dest": "backup.db"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var body map[string]string
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, filepath.Join(backupDir, "backup.db"), body["dest"])
+
+		assertBackupIdenticalToSource(t, tc, body["dest"])
+	})
+
+	t.Run("ToFileOutsideBackupDir", func(t *testing.T) {
+		t.Parallel()
+		tc := createAdminTestContext(t, t.TempDir())
+		defer tc.CleanUp(t)
+
+		for _, dest := range []string{"../backup.db", filepath.Join(t.TempDir(), "backup.db")} {
+			payload, _ := json.Marshal(map[string]string{"dest": dest})
+			req := tc.NewRequest(t, http.MethodPost, "_admin/backup", bytes.NewBuffer(payload))
+			req.Header.Set("Content-Type", "application/json")
+			resp := tc.ExecuteRequest(t, req)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode, dest)
+		}
+	})
+
+	t.Run("ToFileWithoutBackupDir", func(t *testing.T) {
+		t.Parallel()
+		tc := createAdminTestContext(t, "")
+		defer tc.CleanUp(t)
+
+		req := tc.NewRequest(t, http.MethodPost, "_admin/backup", bytes.NewBufferString(`{"dest": "/tmp/backup.db"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func TestAdminCheckpoint(t *testing.T) {
+	executeCheckpoint := func(t *testing.T, tc *TestContext, payload string) (*http.Response, WALCheckpointResult) {
+		req := tc.NewRequest(t, http.MethodPost, "_admin/checkpoint", bytes.NewBufferString(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		var rv WALCheckpointResult
+		if resp.StatusCode == http.StatusOK {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&rv))
+		}
+		return resp, rv
+	}
+
+	for _, mode := range []string{"", "passive", "full", "restart", "TRUNCATE"} {
+		mode := mode
+		t.Run("Mode_"+mode, func(t *testing.T) {
+			t.Parallel()
+			dbFile := filepath.Join(t.TempDir(), "test.db")
+			tc := createAdminTestContext(t, "", "--db-dsn", "//"+dbFile, "--db-wal")
+			defer tc.CleanUp(t)
+
+			resp, rv := executeCheckpoint(t, tc, `{"mode": "`+mode+`"}`)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.EqualValues(t, 0, rv.Busy)
+			assert.GreaterOrEqual(t, rv.Log, int64(0))
+			assert.GreaterOrEqual(t, rv.Checkpointed, int64(0))
+		})
+	}
+
+	t.Run("WALSizeDecreases", func(t *testing.T) {
+		t.Parallel()
+		dbFile := filepath.Join(t.TempDir(), "test.db")
+		tc := createAdminTestContext(t, "", "--db-dsn", "//"+dbFile, "--db-wal")
+		defer tc.CleanUp(t)
+
+		walSize := func(t *testing.T) int64 {
+			stat, err := os.Stat(dbFile + "-wal")
+			assert.NoError(t, err)
+			return stat.Size()
+		}
+
+		sizeBefore := walSize(t)
+		assert.Greater(t, sizeBefore, int64(0))
+
+		resp, rv := executeCheckpoint(t, tc, `{"mode": "truncate"}`)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.EqualValues(t, 0, rv.Busy)
+		assert.Less(t, walSize(t), sizeBefore)
+	})
+
+	t.Run("InvalidMode", func(t *testing.T) {
+		t.Parallel()
+		tc := createAdminTestContext(t, "")
+		defer tc.CleanUp(t)
+
+		resp, _ := executeCheckpoint(t, tc, `{"mode": "passive); DROP TABLE test; --"}`)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestAdminVacuum(t *testing.T) {
+	executeVacuum := func(t *testing.T, tc *TestContext, payload string) (*http.Response, map[string]interface{}) {
+		req := tc.NewRequest(t, http.MethodPost, "_admin/vacuum", bytes.NewBufferString(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		var rv map[string]interface{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&rv))
+		return resp, rv
+	}
+
+	insertAndDeleteRows := func(t *testing.T, tc *TestContext) {
+		tx, err := tc.DB().Beginx()
+		assert.NoError(t, err)
+		for i := 0; i < 5000; i++ {
+			_, err := tx.Exec("INSERT INTO test (id, s) VALUES (?, ?)", i, strings.Repeat("a", 256))
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, tx.Commit())
+		tc.ExecuteSQL(t, "DELETE FROM test WHERE id > 10")
+	}
+
+	fileSize := func(t *testing.T, p string) int64 {
+		stat, err := os.Stat(p)
+		assert.NoError(t, err)
+		return stat.Size()
+	}
+
+	t.Run("InPlace", func(t *testing.T) {
+		t.Parallel()
+		dbFile := filepath.Join(t.TempDir(), "test.db")
+		tc := createAdminTestContext(t, "", "--db-dsn", "//"+dbFile)
+		defer tc.CleanUp(t)
+
+		insertAndDeleteRows(t, tc)
+		sizeBefore := fileSize(t, dbFile)
+
+		resp, rv := executeVacuum(t, tc, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, rv, "elapsed_ms")
+		assert.GreaterOrEqual(t, rv["elapsed_ms"], float64(0))
+		assert.NotContains(t, rv, "dest")
+
+		assert.Less(t, fileSize(t, dbFile), sizeBefore)
+	})
+
+	t.Run("Into", func(t *testing.T) {
+		t.Parallel()
+		backupDir := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "test.db")
+		tc := createAdminTestContext(t, backupDir, "--db-dsn", "//"+dbFile)
+		defer tc.CleanUp(t)
+
+		insertAndDeleteRows(t, tc)
+
+		resp, rv := executeVacuum(t, tc, `{"dest": "vacuum.db"}`)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		dest := filepath.Join(backupDir, "vacuum.db")
+		assert.Equal(t, dest, rv["dest"])
+
+		assert.Less(t, fileSize(t, dest), fileSize(t, dbFile))
+		assertBackupIdenticalToSource(t, tc, dest)
+	})
+
+	t.Run("IntoOutsideBackupDir", func(t *testing.T) {
+		t.Parallel()
+		tc := createAdminTestContext(t, t.TempDir())
+		defer tc.CleanUp(t)
+
+		resp, _ := executeVacuum(t, tc, `{"dest": "../vacuum.db"}`)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuth_RSAPublicKeyDir(t *testing.T) {
+	generateKey := func(t *testing.T) *rsa.PrivateKey {
+		privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+		assert.NoError(t, err)
+		return privateKey
+	}
+	signToken := func(privateKey *rsa.PrivateKey) (string, error) {
+		authToken := jwt.NewWithClaims(jwt.SigningMethodRS256, &jwt.RegisteredClaims{})
+		return authToken.SignedString(privateKey)
+	}
+
+	keyA, keyB, keyC := generateKey(t), generateKey(t), generateKey(t)
+
+	var keysDir string
+	tc := createTestContextWithTokenAuth(
+		t,
+		func(opts *ServerOptions, dir string) error {
+			// layout of a Kubernetes secret volume:
+			//
+			//   a.pem -> ..data/a.pem
+			//   ..data -> ..2024_01_01
+			//   ..2024_01_01/a.pem
+			keysDir = filepath.Join(dir, "keys")
+			dataDir := filepath.Join(keysDir, "..2024_01_01")
+			if err := os.MkdirAll(dataDir, 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink("..2024_01_01", filepath.Join(keysDir, "..data")); err != nil {
+				return err
+			}
+			for name, key := range map[string]*rsa.PrivateKey{"a.pem": keyA, "b.pem": keyB} {
+				p := filepath.Join(dataDir, name)
+				if err := os.WriteFile(p, encodePublicKeyAsPEM(t, &key.PublicKey), 0644); err != nil {
+					return err
+				}
+				if err := os.Symlink(filepath.Join("..data", name), filepath.Join(keysDir, name)); err != nil {
+					return err
+				}
+			}
+			// non-key files are skipped
+			if err := os.WriteFile(filepath.Join(keysDir, "README"), []byte("keys"), 0644); err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(keysDir, ".hidden.pem"), []byte("invalid"), 0644); err != nil {
+				return err
+			}
+
+			opts.AuthOptions.RSAPublicKeyDirPath = keysDir
+			return nil
+		},
+		func() (string, error) {
+			return signToken(keyA)
+		},
+	)
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+	type testCase struct {
+		name               string
+		key                *rsa.PrivateKey
+		expectedStatusCode int
+	}
+	runCases := func(t *testing.T, cases []testCase) {
+		for _, c := range cases {
+			authToken, err := signToken(c.key)
+			assert.NoError(t, err)
+			tc.authToken = authToken
+
+			req := tc.NewRequest(t, http.MethodGet, "test", nil)
+			resp := tc.ExecuteRequest(t, req)
+			resp.Body.Close()
+
+			assert.Equal(t, c.expectedStatusCode, resp.StatusCode, c.name)
+		}
+	}
+
+	runCases(t, []testCase{
+		{name: "key A", key: keyA, expectedStatusCode: http.StatusOK},
+		{name: "key B", key: keyB, expectedStatusCode: http.StatusOK},
+		{name: "key C", key: keyC, expectedStatusCode: http.StatusUnauthorized},
+	})
+
+	t.Log("rotate key B to key C")
+	{
+		assert.NoError(t, os.Remove(filepath.Join(keysDir, "b.pem")))
+		p := filepath.Join(keysDir, "c.pem")
+		assert.NoError(t, os.WriteFile(p, encodePublicKeyAsPEM(t, &keyC.PublicKey), 0644))
+
+		runCases(t, []testCase{
+			{name: "key A", key: keyA, expectedStatusCode: http.StatusOK},
+			{name: "key B", key: keyB, expectedStatusCode: http.StatusUnauthorized},
+			{name: "key C", key: keyC, expectedStatusCode: http.StatusOK},
+		})
+	}
+}
+
+type authClaimsTestCase struct {
+	name               string
+	claims             jwt.Claims
+	expectedStatusCode int
+}
+
+func testAuthClaims(
+	t *testing.T,
+	configureServerOpts func(opts *ServerOptions),
+	cases []authClaimsTestCase,
+) {
+	tc, signToken := createTestContextWithHMACClaimsAuth(t, configureServerOpts)
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+	for _, c := range cases {
+		tc.authToken = signToken(c.claims)
+
+		req := tc.NewRequest(t, http.MethodGet, "test", nil)
+		resp := tc.ExecuteRequest(t, req)
+		resp.Body.Close()
+
+		assert.Equal(t, c.expectedStatusCode, resp.StatusCode, c.name)
+	}
+}
+
+func TestAuth_Audience(t *testing.T) {
+	t.Run("validation enabled", func(t *testing.T) {
+		testAuthClaims(
+			t,
+			func(opts *ServerOptions) {
+				opts.AuthOptions.Audience = "sqlite-rest"
+			},
+			[]authClaimsTestCase{
+				{
+					name:               "matched audience",
+					claims:             &jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"sqlite-rest"}},
+					expectedStatusCode: http.StatusOK,
+				},
+				{
+					name:               "mismatched audience",
+					claims:             &jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"other"}},
+					expectedStatusCode: http.StatusUnauthorized,
+				},
+				{
+					name:               "missing audience",
+					claims:             &jwt.RegisteredClaims{},
+					expectedStatusCode: http.StatusUnauthorized,
+				},
+			},
+		)
+	})
+
+	t.Run("validation disabled", func(t *testing.T) {
+		testAuthClaims(
+			t,
+			func(opts *ServerOptions) {},
+			[]authClaimsTestCase{
+				{
+					name:               "any audience",
+					claims:             &jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"other"}},
+					expectedStatusCode: http.StatusOK,
+				},
+				{
+					name:               "missing audience",
+					claims:             &jwt.RegisteredClaims{},
+					expectedStatusCode: http.StatusOK,
+				},
+			},
+		)
+	})
+}
+
+func TestAuth_Issuer(t *testing.T) {
+	testAuthClaims(
+		t,
+		func(opts *ServerOptions) {
+			opts.AuthOptions.Issuer = "https://issuer.example.com"
+		},
+		[]authClaimsTestCase{
+			{
+				name:               "matched issuer",
+				claims:             &jwt.RegisteredClaims{Issuer: "https://issuer.example.com"},
+				expectedStatusCode: http.StatusOK,
+			},
+			{
+				name:               "mismatched issuer",
+				claims:             &jwt.RegisteredClaims{Issuer: "https://other.example.com"},
+				expectedStatusCode: http.StatusUnauthorized,
+			},
+			{
+				name:               "missing issuer",
+				claims:             &jwt.RegisteredClaims{},
+				expectedStatusCode: http.StatusUnauthorized,
+			},
+		},
+	)
+}
+
+func TestServerAuthOptions_defaults(t *testing.T) {
+	t.Run("issuer without auth method", func(t *testing.T) {
+		opts := &ServerAuthOptions{Issuer: "https://issuer.example.com"}
+		err := opts.defaults()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "--auth-jwt-issuer")
+	})
+
+	t.Run("multiple auth methods", func(t *testing.T) {
+		opts := &ServerAuthOptions{
+			RSAPublicKeyFilePath: "rsa.pem",
+			TokenFilePath:        "token",
+		}
+		assert.Error(t, opts.defaults())
+	})
+}
+
+func TestAuth_ClockSkew(t *testing.T) {
+	expiredClaims := func() jwt.Claims {
+		return &jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-30 * time.Second)),
+		}
+	}
+
+	t.Run("with skew", func(t *testing.T) {
+		testAuthClaims(
+			t,
+			func(opts *ServerOptions) {
+				opts.AuthOptions.ClockSkew = 60 * time.Second
+			},
+			[]authClaimsTestCase{
+				{
+					name:               "expired within skew",
+					claims:             expiredClaims(),
+					expectedStatusCode: http.StatusOK,
+				},
+				{
+					name: "expired beyond skew",
+					claims: &jwt.RegisteredClaims{
+						ExpiresAt: jwt.NewNumericDate(time.Now().Add(-90 * time.Second)),
+					},
+					expectedStatusCode: http.StatusUnauthorized,
+				},
+			},
+		)
+	})
+
+	t.Run("without skew", func(t *testing.T) {
+		testAuthClaims(
+			t,
+			func(opts *ServerOptions) {},
+			[]authClaimsTestCase{
+				{
+					name:               "expired",
+					claims:             expiredClaims(),
+					expectedStatusCode: http.StatusUnauthorized,
+				},
+			},
+		)
+	})
+}
+
+func TestAuth_APIKey(t *testing.T) {
+	const (
+		apiKey      = "test-api-key"
+		otherAPIKey = "other-api-key"
+	)
+	testToken := []byte("test-token")
+
+	createTestContext := func(t *testing.T, hashed bool) *TestContext {
+		return createTestContextWithTokenAuth(
+			t,
+			func(opts *ServerOptions, dir string) error {
+				key := apiKey
+				if hashed {
+					h := sha256.Sum256([]byte(apiKey))
+					key = hex.EncodeToString(h[:])
+				}
+				apiKeyFile := filepath.Join(dir, "api-keys")
+				content := fmt.Sprintf("%s\n\nanother-key\n", key)
+				if err := os.WriteFile(apiKeyFile, []byte(content), 0644); err != nil {
+					return err
+				}
+
+				tokenFile := filepath.Join(dir, "token")
+				if err := os.WriteFile(tokenFile, testToken, 0644); err != nil {
+					return err
+				}
+
+				opts.AuthOptions.APIKeyFilePath = apiKeyFile
+				opts.AuthOptions.APIKeyHashed = hashed
+				opts.AuthOptions.TokenFilePath = tokenFile
+				return nil
+			},
+			func() (string, error) {
+				return "", nil
+			},
+		)
+	}
+
+	runTest := func(t *testing.T, hashed bool) {
+		tc := createTestContext(t, hashed)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+		bearerToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{}).
+			SignedString(testToken)
+		assert.NoError(t, err)
+
+		cases := []struct {
+			name               string
+			apiKey             string
+			bearerToken        string
+			expectedStatusCode int
+			expectedAuthFailed float64
+		}{
+			{name: "valid api key", apiKey: apiKey, expectedStatusCode: http.StatusOK},
+			{name: "invalid api key", apiKey: otherAPIKey, expectedStatusCode: http.StatusUnauthorized, expectedAuthFailed: 1},
+			{
+				name:               "api key takes precedence",
+				apiKey:             otherAPIKey,
+				bearerToken:        bearerToken,
+				expectedStatusCode: http.StatusUnauthorized,
+				expectedAuthFailed: 1,
+			},
+			{name: "fallback to bearer token", bearerToken: bearerToken, expectedStatusCode: http.StatusOK},
+			{name: "no credential", expectedStatusCode: http.StatusUnauthorized, expectedAuthFailed: 1},
+		}
+
+		for _, c := range cases {
+			tc.authToken = c.bearerToken
+			req := tc.NewRequest(t, http.MethodGet, "test", nil)
+			if c.apiKey != "" {
+				req.Header.Set("X-Api-Key", c.apiKey)
+			}
+
+			authFailedBefore := testutil.ToFloat64(metricsAuthFailedRequestsTotal)
+			resp := tc.ExecuteRequest(t, req)
+			resp.Body.Close()
+			authFailed := testutil.ToFloat64(metricsAuthFailedRequestsTotal) - authFailedBefore
+
+			assert.Equal(t, c.expectedStatusCode, resp.StatusCode, c.name)
+			assert.Equal(t, c.expectedAuthFailed, authFailed, c.name)
+		}
+	}
+
+	t.Run("plain keys", func(t *testing.T) {
+		runTest(t, false)
+	})
+
+	t.Run("hashed keys", func(t *testing.T) {
+		runTest(t, true)
+	})
+}
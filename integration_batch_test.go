@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	createTestContext := func(t testing.TB) *TestContext {
+		tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+			opts.SecurityOptions.EnabledTableOrViews = []string{"test"}
+			opts.SecurityOptions.ReadOnlyTableOrViews = []string{"test_readonly"}
+		})
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+		tc.ExecuteSQL(t, "CREATE TABLE test_readonly (id int)")
+		return tc
+	}
+
+	executeBatch := func(t *testing.T, tc *TestContext, payload string) (*http.Response, []BatchOperationResult) {
+		req := tc.NewRequest(t, http.MethodPost, "_batch", bytes.NewBufferString(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		var rv []BatchOperationResult
+		if resp.StatusCode != http.StatusBadRequest || resp.Header.Get("Content-Type") == mediaTypeJSON {
+			_ = json.NewDecoder(resp.Body).Decode(&rv)
+		}
+		return resp, rv
+	}
+
+	queryIDs := func(t *testing.T, tc *TestContext) []int {
+		var rv []int
+		assert.NoError(t, tc.DB().Select(&rv, "SELECT id FROM test ORDER BY id"))
+		return rv
+	}
+
+	t.Run("Commit", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		resp, results := executeBatch(t, tc, `[
+			{"method": "POST", "path": "/test", "body": [{"id": 1, "s": "a"}, {"id": 2, "s": "a"}, {"id": 3, "s": "a"}]},
+			{"method": "PATCH", "path": "/test", "query": "id=eq.1", "body": {"s": "b"}},
+			{"method": "DELETE", "path": "/test", "query": "id=eq.2"}
+		]`)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		if assert.Len(t, results, 3) {
+			assert.Equal(t, http.StatusCreated, results[0].Status)
+			for _, result := range results {
+				assert.Less(t, result.Status, http.StatusMultipleChoices)
+			}
+		}
+
+		assert.Equal(t, []int{1, 3}, queryIDs(t, tc))
+		var s string
+		assert.NoError(t, tc.DB().Get(&s, "SELECT s FROM test WHERE id = 1"))
+		assert.Equal(t, "b", s)
+	})
+
+	t.Run("RollbackOnFailure", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (1, "a")`)
+
+		resp, results := executeBatch(t, tc, `[
+			{"method": "POST", "path": "/test", "body": {"id": 2, "s": "a"}},
+			{"method": "DELETE", "path": "/test", "query": "id=eq.1"},
+			{"method": "POST", "path": "/test", "body": {"id": 3, "unknown": "a"}},
+			{"method": "POST", "path": "/test", "body": {"id": 4, "s": "a"}}
+		]`)
+
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		if assert.Len(t, results, 3) {
+			assert.Equal(t, http.StatusCreated, results[0].Status)
+			assert.Equal(t, http.StatusInternalServerError, results[2].Status)
+			assert.Contains(t, string(results[2].Body), "no column named unknown")
+		}
+
+		assert.Equal(t, []int{1}, queryIDs(t, tc))
+	})
+
+	t.Run("RollbackOnAccessRestricted", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		resp, results := executeBatch(t, tc, `[
+			{"method": "POST", "path": "/test", "body": {"id": 1, "s": "a"}},
+			{"method": "POST", "path": "/test_readonly", "body": {"id": 1}}
+		]`)
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Len(t, results, 2)
+		assert.Empty(t, queryIDs(t, tc))
+	})
+
+	t.Run("InvalidOperation", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		for _, payload := range []string{
+			`{"method": "POST", "path": "/test"}`,
+			`[{"method": "GET", "path": "/test"}]`,
+			`[{"method": "POST", "path": "test"}]`,
+			`[{"method": "POST", "path": "/test/1"}]`,
+		} {
+			resp, _ := executeBatch(t, tc, payload)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, payload)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGzipCompression(t *testing.T) {
+	createTestContext := func(t testing.TB, rows int) *TestContext {
+		tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+			opts.GzipMinSize = defaultGzipMinSize
+		})
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+		for i := 0; i < rows; i++ {
+			tc.ExecuteSQL(t, "INSERT INTO test (id, s) VALUES (?, ?)", i, strings.Repeat("a", 32))
+		}
+
+		return tc
+	}
+
+	queryWithGzip := func(t *testing.T, tc *TestContext) *http.Response {
+		req := tc.NewRequest(t, http.MethodGet, "test", nil)
+		// NOTE: setting the header explicitly disables the transparent decompression of http.Client
+		req.Header.Set("Accept-Encoding", "gzip")
+		return tc.ExecuteRequest(t, req)
+	}
+
+	t.Run("Compressed", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t, 100)
+		defer tc.CleanUp(t)
+
+		resp := queryWithGzip(t, tc)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+		assert.Contains(t, resp.Header.Values("Vary"), "Accept-Encoding")
+
+		gr, err := gzip.NewReader(resp.Body)
+		assert.NoError(t, err)
+		defer gr.Close()
+
+		var rv []map[string]interface{}
+		assert.NoError(t, json.NewDecoder(gr).Decode(&rv))
+		assert.Len(t, rv, 100)
+	})
+
+	t.Run("BelowThreshold", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t, 1)
+		defer tc.CleanUp(t)
+
+		resp := queryWithGzip(t, tc)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Content-Encoding"))
+		assert.Contains(t, resp.Header.Values("Vary"), "Accept-Encoding")
+
+		var rv []map[string]interface{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&rv))
+		assert.Len(t, rv, 1)
+	})
+
+	t.Run("ETag", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t, 100)
+		defer tc.CleanUp(t)
+
+		query := func(t *testing.T, acceptEncoding string, ifNoneMatch string) *http.Response {
+			req := tc.NewRequest(t, http.MethodGet, "test", nil)
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+			if ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", ifNoneMatch)
+			}
+			resp := tc.ExecuteRequest(t, req)
+			resp.Body.Close()
+			return resp
+		}
+
+		resp := query(t, "identity", "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		identityETag := resp.Header.Get("ETag")
+		assert.NotEmpty(t, identityETag)
+
+		resp = query(t, "gzip", "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+		gzipETag := resp.Header.Get("ETag")
+		assert.Equal(t, withETagSuffix(identityETag, etagSuffixGzip), gzipETag)
+
+		resp = query(t, "gzip", gzipETag)
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+		assert.Equal(t, gzipETag, resp.Header.Get("ETag"))
+
+		resp = query(t, "identity", identityETag)
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+		assert.Equal(t, identityETag, resp.Header.Get("ETag"))
+	})
+
+	t.Run("NotAccepted", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t, 100)
+		defer tc.CleanUp(t)
+
+		req := tc.NewRequest(t, http.MethodGet, "test", nil)
+		req.Header.Set("Accept-Encoding", "identity")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Content-Encoding"))
+		assert.Contains(t, resp.Header.Values("Vary"), "Accept-Encoding")
+		b, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.True(t, json.Valid(b), fmt.Sprintf("invalid JSON: %s", b))
+	})
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	cases := map[string]bool{
+		"":                    false,
+		"gzip":                true,
+		"deflate, gzip;q=1.0": true,
+		"GZIP":                true,
+		"gzip;q=0":            false,
+		"br":                  false,
+	}
+
+	for header, expected := range cases {
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		assert.NoError(t, err)
+		req.Header.Set("Accept-Encoding", header)
+		assert.Equal(t, expected, acceptsGzip(req), header)
+	}
+}
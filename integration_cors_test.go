@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORS(t *testing.T) {
+	preflight := func(t *testing.T, tc *TestContext, origin string, method string) *http.Response {
+		req := tc.NewRequest(t, http.MethodOptions, "test", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		return tc.ExecuteRequest(t, req)
+	}
+
+	t.Run("allow all by default", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContextUsingInMemoryDB(t)
+		defer tc.CleanUp(t)
+
+		resp := preflight(t, tc, "https://example.com", http.MethodPost)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, http.MethodPost, resp.Header.Get("Access-Control-Allow-Methods"))
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+			opts.CORSOptions.AllowedOrigins = []string{"https://example.com"}
+			opts.CORSOptions.AllowedMethods = []string{http.MethodGet}
+			opts.CORSOptions.AllowedHeaders = []string{"Authorization"}
+			opts.CORSOptions.MaxAge = 600
+		})
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+		t.Log("allowed origin")
+		{
+			resp := preflight(t, tc, "https://example.com", http.MethodGet)
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "https://example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, http.MethodGet, resp.Header.Get("Access-Control-Allow-Methods"))
+			assert.Equal(t, "600", resp.Header.Get("Access-Control-Max-Age"))
+		}
+
+		t.Log("disallowed origin")
+		{
+			resp := preflight(t, tc, "https://evil.example.com", http.MethodGet)
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+			assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+		}
+
+		t.Log("disallowed method")
+		{
+			resp := preflight(t, tc, "https://example.com", http.MethodDelete)
+			defer resp.Body.Close()
+
+			assert.Empty(t, resp.Header.Get("Access-Control-Allow-Methods"))
+		}
+
+		t.Log("actual request from allowed origin")
+		{
+			req := tc.NewRequest(t, http.MethodGet, "test", nil)
+			req.Header.Set("Origin", "https://example.com")
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "https://example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+		}
+
+		t.Log("actual request from disallowed origin")
+		{
+			req := tc.NewRequest(t, http.MethodGet, "test", nil)
+			req.Header.Set("Origin", "https://evil.example.com")
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+
+			assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+		}
+	})
+}
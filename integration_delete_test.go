@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -74,6 +76,81 @@ func testDelete_SingleTable(t *testing.T, createTestContext func(t testing.TB) *
 		assert.Len(t, rv, 1)
 		assert.EqualValues(t, 1, rv[0]["id"])
 	})
+
+	t.Run("RowsAffected", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+		tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (1, "a"), (2, "a"), (3, "a")`)
+
+		cases := []struct {
+			filter   string
+			expected string
+		}{
+			{filter: "gt.1", expected: "2"},
+			{filter: "gt.1", expected: "0"},
+			{filter: "eq.1", expected: "1"},
+		}
+
+		for _, c := range cases {
+			req := tc.NewRequest(t, http.MethodDelete, "test", nil)
+			q := req.URL.Query()
+			q.Set("id", c.filter)
+			req.URL.RawQuery = q.Encode()
+
+			resp := tc.ExecuteRequest(t, req)
+			resp.Body.Close()
+
+			assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+			assert.Equal(t, c.expected, resp.Header.Get("X-Rows-Affected"), "id=%s", c.filter)
+		}
+	})
+
+	t.Run("MaxAffected", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+		for i := 1; i <= 10; i++ {
+			tc.ExecuteSQL(t, "INSERT INTO test (id, s) VALUES (?, ?)", i, "a")
+		}
+
+		deleteWithMaxAffected := func(t *testing.T, filter string, maxAffected string) *http.Response {
+			req := tc.NewRequest(t, http.MethodDelete, "test", nil)
+			req.Header.Set("Prefer", "max-affected="+maxAffected)
+			q := req.URL.Query()
+			q.Set("id", filter)
+			req.URL.RawQuery = q.Encode()
+			return tc.ExecuteRequest(t, req)
+		}
+		countRows := func(t *testing.T) int {
+			var count int
+			assert.NoError(t, tc.DB().Get(&count, "SELECT count(*) FROM test"))
+			return count
+		}
+
+		resp := deleteWithMaxAffected(t, "gt.0", "5")
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, "would affect 10 rows, limit is 5", body["hint"])
+		assert.Equal(t, 10, countRows(t))
+
+		resp = deleteWithMaxAffected(t, "gt.0", "invalid")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, 10, countRows(t))
+
+		resp = deleteWithMaxAffected(t, "gt.5", "5")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, "5", resp.Header.Get("X-Rows-Affected"))
+		assert.Equal(t, 5, countRows(t))
+	})
 }
 
 func TestDelete_SingleTable(t *testing.T) {
@@ -88,4 +165,12 @@ func TestDelete_SingleTable(t *testing.T) {
 	t.Run("RSA token auth", func(t *testing.T) {
 		testDelete_SingleTable(t, createTestContextWithRSATokenAuth)
 	})
+
+	t.Run("ECDSA token auth", func(t *testing.T) {
+		testDelete_SingleTable(t, createTestContextWithECDSATokenAuth)
+	})
+
+	t.Run("Ed25519 token auth", func(t *testing.T) {
+		testDelete_SingleTable(t, createTestContextWithEd25519TokenAuth)
+	})
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableOrViewEvents(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.SSEPollInterval = 20 * time.Millisecond
+	})
+	defer tc.CleanUp(t)
+	// :memory: database is per connection
+	tc.DB().SetMaxOpenConns(1)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id integer primary key, s text)")
+	tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (1, "a"), (2, "b")`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req := tc.NewRequest(t, http.MethodGet, "test/events?id=gt.1", nil)
+	req = req.WithContext(ctx)
+	resp := tc.ExecuteRequest(t, req)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	scanner := bufio.NewScanner(resp.Body)
+	// readEvent reads the next event or comment
+	readEvent := func(t *testing.T) (event string, data map[string]interface{}, comment string) {
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if event != "" || comment != "" {
+					return event, data, comment
+				}
+			case strings.HasPrefix(line, ":"):
+				comment = strings.TrimSpace(strings.TrimPrefix(line, ":"))
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &data))
+			}
+		}
+		assert.NoError(t, scanner.Err())
+		t.Fatal("stream closed")
+		return
+	}
+
+	_, _, comment := readEvent(t)
+	assert.Equal(t, "ready", comment)
+
+	t.Log("insert")
+	{
+		tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (3, "c")`)
+		// filtered out
+		tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (0, "z")`)
+
+		event, data, _ := readEvent(t)
+		assert.Equal(t, "insert", event)
+		assert.EqualValues(t, 3, data["id"])
+		assert.Equal(t, "c", data["s"])
+	}
+
+	t.Log("update")
+	{
+		tc.ExecuteSQL(t, `UPDATE test SET s = "bb" WHERE id = 2`)
+
+		event, data, _ := readEvent(t)
+		assert.Equal(t, "update", event)
+		assert.EqualValues(t, 2, data["id"])
+		assert.Equal(t, "bb", data["s"])
+	}
+
+	t.Log("delete")
+	{
+		tc.ExecuteSQL(t, `DELETE FROM test WHERE id = 3`)
+
+		event, data, _ := readEvent(t)
+		assert.Equal(t, "delete", event)
+		assert.EqualValues(t, 3, data["id"])
+		assert.Equal(t, "c", data["s"])
+	}
+}
+
+func TestTableOrViewEvents_NoAccess(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDB(t)
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE secret (id int)")
+
+	req := tc.NewRequest(t, http.MethodGet, "secret/events", nil)
+	resp := tc.ExecuteRequest(t, req)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
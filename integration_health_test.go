@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthz(t *testing.T) {
+	getHealthz := func(t *testing.T, tc *TestContext, path string) *http.Response {
+		// NOTE: no auth header is set
+		req, err := http.NewRequest(http.MethodGet, tc.ServerURL().String()+path, nil)
+		assert.NoError(t, err)
+		return tc.ExecuteRequest(t, req)
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContextWithHMACTokenAuth(t)
+		defer tc.CleanUp(t)
+
+		resp := getHealthz(t, tc, "/healthz")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var body map[string]string
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, map[string]string{"status": "ok", "version": ServerVersion, "synchronous": "normal"}, body)
+	})
+
+	t.Run("CustomPath", func(t *testing.T) {
+		t.Parallel()
+		tc, _ := createTestContextWithHMACClaimsAuth(t, func(opts *ServerOptions) {
+			opts.HealthPath = "/-/health"
+		})
+		defer tc.CleanUp(t)
+
+		resp := getHealthz(t, tc, "/-/health")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		// default path falls back to table route, which requires auth
+		resp = getHealthz(t, tc, "/healthz")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
+
+func TestReadyz(t *testing.T) {
+	getReadyz := func(t *testing.T, tc *TestContext) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, tc.ServerURL().String()+"/readyz", nil)
+		assert.NoError(t, err)
+		return tc.ExecuteRequest(t, req)
+	}
+
+	t.Run("Ready", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContextWithHMACTokenAuth(t)
+		defer tc.CleanUp(t)
+
+		resp := getReadyz(t, tc)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("DatabaseClosed", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContextUsingInMemoryDB(t)
+		defer tc.CleanUp(t)
+
+		assert.NoError(t, tc.DB().Close())
+
+		resp := getReadyz(t, tc)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Contains(t, body["hint"], "ping database")
+	})
+
+	t.Run("PendingMigrations", func(t *testing.T) {
+		t.Parallel()
+		mtc := NewMigrationTestContext(t, map[string]string{
+			"1_test.up.sql":   `create table test (id int);`,
+			"1_test.down.sql": `drop table test;`,
+		})
+		defer mtc.CleanUp(t)
+
+		tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+			opts.MigratorState = mtc.Migrator()
+		})
+		defer tc.CleanUp(t)
+
+		resp := getReadyz(t, tc)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		assert.NoError(t, mtc.Migrator().Up(ctx, migrationStepAll))
+
+		resp = getReadyz(t, tc)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
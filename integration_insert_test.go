@@ -2,10 +2,18 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/supabase/postgrest-go"
 )
 
 func testInsert_SingleTable(t *testing.T, createTestContext func(t testing.TB) *TestContext) {
@@ -72,6 +80,50 @@ func testInsert_SingleTable(t *testing.T, createTestContext func(t testing.TB) *
 		}
 	})
 
+	t.Run("InsertCSV", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+
+		payload := bytes.NewBufferString("id,s\n1,a\n2,\"b,c\"\n3,\n")
+		req := tc.NewRequest(t, http.MethodPost, "test", payload)
+		req.Header.Set("Content-Type", "text/csv")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		client := tc.Client()
+		res, _, err := client.From("test").Select("*", "", false).
+			Order("id", &postgrest.OrderOpts{Ascending: true}).
+			Execute()
+		assert.NoError(t, err)
+
+		var rv []map[string]interface{}
+		tc.DecodeResult(t, res, &rv)
+		assert.Equal(t, []map[string]interface{}{
+			{"id": float64(1), "s": "a"},
+			{"id": float64(2), "s": "b,c"},
+			{"id": float64(3), "s": nil},
+		}, rv)
+	})
+
+	t.Run("InsertCSVMismatchedColumns", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+
+		payload := bytes.NewBufferString("id,s\n1,a\n2\n")
+		req := tc.NewRequest(t, http.MethodPost, "test", payload)
+		req.Header.Set("Content-Type", "text/csv")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
 	t.Run("UpsertMergeDuplicates", func(t *testing.T) {
 		t.Parallel()
 		tc := createTestContext(t)
@@ -163,6 +215,305 @@ func testInsert_SingleTable(t *testing.T, createTestContext func(t testing.TB) *
 	})
 }
 
+func TestInsert_ReturnLocation(t *testing.T) {
+	createTestContext := func(t testing.TB) *TestContext {
+		return createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+			opts.ReturnLocation = true
+		})
+	}
+
+	insertAndFollowLocation := func(t *testing.T, tc *TestContext, expectedLocation string) {
+		payload := bytes.NewBufferString(`{"s": "b"}`)
+		req := tc.NewRequest(t, http.MethodPost, "test", payload)
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		location := resp.Header.Get("Location")
+		assert.Equal(t, expectedLocation, location)
+
+		req = tc.NewRequest(t, http.MethodGet, strings.TrimPrefix(location, "/"), nil)
+		followResp := tc.ExecuteRequest(t, req)
+		defer followResp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, followResp.StatusCode)
+		res, err := io.ReadAll(followResp.Body)
+		assert.NoError(t, err)
+
+		var rv []map[string]interface{}
+		tc.DecodeResult(t, res, &rv)
+		assert.Len(t, rv, 1)
+		assert.EqualValues(t, "b", rv[0]["s"])
+	}
+
+	t.Run("IntegerPrimaryKey", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id integer primary key, s text)")
+		tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (1, "a")`)
+
+		insertAndFollowLocation(t, tc, "/test?id=eq.2")
+	})
+
+	t.Run("Rowid", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id text primary key, s text)")
+		tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES ("foo", "a")`)
+
+		insertAndFollowLocation(t, tc, "/test?rowid=eq.2")
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContextUsingInMemoryDB(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id integer primary key, s text)")
+
+		payload := bytes.NewBufferString(`{"s": "b"}`)
+		req := tc.NewRequest(t, http.MethodPost, "test", payload)
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Location"))
+	})
+}
+
+func TestInsert_MaxRequestSize(t *testing.T) {
+	createTestContext := func(t testing.TB) *TestContext {
+		return createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+			opts.MaxRequestBodyBytes = 64
+		})
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id integer primary key, s text)")
+
+		payload := bytes.NewBufferString(fmt.Sprintf(`{"s": "%s"}`, strings.Repeat("a", 128)))
+		req := tc.NewRequest(t, http.MethodPost, "test", payload)
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id integer primary key, s text)")
+
+		payload := bytes.NewBufferString("s\n" + strings.Repeat("a", 128))
+		req := tc.NewRequest(t, http.MethodPost, "test", payload)
+		req.Header.Set("Content-Type", "text/csv")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("WithinLimit", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id integer primary key, s text)")
+
+		payload := bytes.NewBufferString(`{"s": "a"}`)
+		req := tc.NewRequest(t, http.MethodPost, "test", payload)
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	})
+}
+
+func TestInsert_BeforeInsertHook(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.BeforeInsert = func(table string, data map[string]interface{}) error {
+			if id, ok := data["id"].(float64); ok && id < 0 {
+				return fmt.Errorf("%s.id must be non-negative", table)
+			}
+			return nil
+		}
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+	insert := func(t *testing.T, payload string) *http.Response {
+		req := tc.NewRequest(t, http.MethodPost, "test", bytes.NewBufferString(payload))
+		req.Header.Set("Content-Type", "application/json")
+		return tc.ExecuteRequest(t, req)
+	}
+
+	t.Log("rejected")
+	{
+		resp := insert(t, `[{"id": 1}, {"id": -1}]`)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "test.id must be non-negative", body["hint"])
+	}
+
+	t.Log("accepted")
+	{
+		resp := insert(t, `{"id": 1}`)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	var count int
+	assert.NoError(t, tc.DB().Get(&count, "SELECT count(*) FROM test"))
+	assert.Equal(t, 1, count)
+}
+
+func TestInsert_BusyRetry(t *testing.T) {
+	dsn := "//" + filepath.Join(t.TempDir(), "test.db")
+
+	db := openTestDB(t, "--db-dsn", dsn, "--db-busy-timeout", "1ms")
+	server, err := NewServer(&ServerOptions{
+		Logger:          createTestLogger(t).WithName("test"),
+		Queryer:         db,
+		Execer:          db,
+		SecurityOptions: ServerSecurityOptions{EnabledTableOrViews: enabledTestTables},
+		AuthOptions:     ServerAuthOptions{disableAuth: true},
+		DBRetryCount:    2,
+		DBRetryDelay:    50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := NewTestContextWithDB(t, server.server.Handler, db, func(t testing.TB) {
+		assert.NoError(t, db.Close())
+	}, "")
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+	// hold the write lock with another connection
+	writer := openTestDB(t, "--db-dsn", dsn)
+	defer writer.Close()
+	conn, err := writer.Conn(context.Background())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	insert := func(t *testing.T) *http.Response {
+		req := tc.NewRequest(t, http.MethodPost, "test", bytes.NewBufferString(`{"id": 1}`))
+		req.Header.Set("Content-Type", "application/json")
+		return tc.ExecuteRequest(t, req)
+	}
+
+	t.Run("RetriesExhausted", func(t *testing.T) {
+		_, err := conn.ExecContext(context.Background(), "BEGIN IMMEDIATE")
+		assert.NoError(t, err)
+		defer conn.ExecContext(context.Background(), "ROLLBACK")
+
+		start := time.Now()
+		resp := insert(t)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		// 50ms + 100ms
+		assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "SQLITE_BUSY", body["code"])
+	})
+
+	t.Run("RetrySucceeded", func(t *testing.T) {
+		_, err := conn.ExecContext(context.Background(), "BEGIN IMMEDIATE")
+		assert.NoError(t, err)
+
+		released := make(chan struct{})
+		go func() {
+			defer close(released)
+			time.Sleep(80 * time.Millisecond)
+			_, err := conn.ExecContext(context.Background(), "COMMIT")
+			assert.NoError(t, err)
+		}()
+
+		resp := insert(t)
+		defer resp.Body.Close()
+		<-released
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	})
+}
+
+func TestInsert_ConstraintErrorCode(t *testing.T) {
+	tc := createTestContextUsingInMemoryDB(t)
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, `CREATE TABLE test (
+		id integer primary key,
+		s text not null,
+		email text,
+		price real,
+		CONSTRAINT uq_email UNIQUE (email),
+		CONSTRAINT positive_price CHECK (price > 0)
+	)`)
+	tc.ExecuteSQL(t, `INSERT INTO test (id, s, email) VALUES (1, "a", "a@example.com")`)
+
+	cases := []struct {
+		payload string
+		code    string
+		hint    string
+	}{
+		{
+			payload: `{"s": "b", "email": "a@example.com"}`,
+			code:    "SQLITE_CONSTRAINT_UNIQUE",
+			hint:    "UNIQUE constraint failed: test.email",
+		},
+		{
+			payload: `{"id": 1, "s": "b"}`,
+			code:    "SQLITE_CONSTRAINT_PRIMARYKEY",
+			hint:    "UNIQUE constraint failed: test.id",
+		},
+		{
+			payload: `{"id": 2}`,
+			code:    "SQLITE_CONSTRAINT_NOTNULL",
+			hint:    "NOT NULL constraint failed: test.s",
+		},
+		{
+			payload: `{"s": "b", "price": -1}`,
+			code:    "SQLITE_CONSTRAINT_CHECK",
+			hint:    "CHECK constraint failed: positive_price",
+		},
+	}
+
+	for _, c := range cases {
+		req := tc.NewRequest(t, http.MethodPost, "test", bytes.NewBufferString(c.payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		resp.Body.Close()
+
+		assert.Equal(t, c.code, body["code"], c.payload)
+		assert.Equal(t, c.hint, body["hint"], c.payload)
+	}
+}
+
 func TestInsert_SingleTable(t *testing.T) {
 	t.Run("in memory db", func(t *testing.T) {
 		testInsert_SingleTable(t, createTestContextUsingInMemoryDB)
@@ -175,4 +526,91 @@ func TestInsert_SingleTable(t *testing.T) {
 	t.Run("RSA token auth", func(t *testing.T) {
 		testDelete_SingleTable(t, createTestContextWithRSATokenAuth)
 	})
+
+	t.Run("ECDSA token auth", func(t *testing.T) {
+		testInsert_SingleTable(t, createTestContextWithECDSATokenAuth)
+	})
+
+	t.Run("Ed25519 token auth", func(t *testing.T) {
+		testInsert_SingleTable(t, createTestContextWithEd25519TokenAuth)
+	})
+}
+
+func TestPreferReturnHeadersOnly(t *testing.T) {
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, nil)
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id integer primary key, s text)")
+
+	cases := []struct {
+		method          string
+		target          string
+		body            string
+		expectedStatus  int
+		expectedHeaders map[string]string
+	}{
+		{
+			method:         http.MethodPost,
+			target:         "test",
+			body:           `{"id": 1, "s": "a"}`,
+			expectedStatus: http.StatusCreated,
+			expectedHeaders: map[string]string{
+				headerNameRowsAffected: "1",
+				"Location":             "/test?id=eq.1",
+			},
+		},
+		{
+			method:          http.MethodPatch,
+			target:          "test?id=eq.1",
+			body:            `{"s": "b"}`,
+			expectedStatus:  http.StatusAccepted,
+			expectedHeaders: map[string]string{headerNameRowsAffected: "1"},
+		},
+		{
+			method:          http.MethodPut,
+			target:          "test?id=eq.1",
+			body:            `{"id": 1, "s": "c"}`,
+			expectedStatus:  http.StatusOK,
+			expectedHeaders: map[string]string{headerNameRowsAffected: "1"},
+		},
+		{
+			method:          http.MethodDelete,
+			target:          "test?id=eq.1",
+			expectedStatus:  http.StatusAccepted,
+			expectedHeaders: map[string]string{headerNameRowsAffected: "1"},
+		},
+	}
+
+	for _, c := range cases {
+		var body io.Reader
+		if c.body != "" {
+			body = strings.NewReader(c.body)
+		}
+		req := tc.NewRequest(t, c.method, c.target, body)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Prefer", "return=headers-only")
+		resp := tc.ExecuteRequest(t, req)
+
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.NoError(t, err)
+
+		assert.Equal(t, c.expectedStatus, resp.StatusCode, c.method)
+		assert.Empty(t, respBody, c.method)
+		for k, v := range c.expectedHeaders {
+			assert.Equal(t, v, resp.Header.Get(k), "%s %s", c.method, k)
+		}
+	}
+
+	t.Log("insert without headers-only")
+	{
+		req := tc.NewRequest(t, http.MethodPost, "test", strings.NewReader(`{"id": 2, "s": "a"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Location"))
+		assert.Empty(t, resp.Header.Get(headerNameRowsAffected))
+	}
 }
@@ -2,9 +2,15 @@ package main
 
 import (
 	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -137,3 +143,317 @@ func TestMigration(t *testing.T) {
 		})
 	})
 }
+
+func TestMigration_Status(t *testing.T) {
+	tc := NewMigrationTestContext(t, map[string]string{
+		"1_test.up.sql":    `create table test (id int);`,
+		"1_test.down.sql":  `drop table test;`,
+		"2_test2.up.sql":   `create table test2 (id int);`,
+		"2_test2.down.sql": `drop table test2;`,
+	})
+	defer tc.CleanUp(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	assertStatus := func(t *testing.T, expectedVersion uint) {
+		version, dirty, err := tc.Migrator().Status(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedVersion, version)
+		assert.False(t, dirty)
+	}
+
+	t.Log("no migrations applied")
+	assertStatus(t, 0)
+
+	t.Log("up 1 step")
+	assert.NoError(t, tc.Migrator().Up(ctx, 1))
+	assertStatus(t, 1)
+
+	t.Log("up 1 step")
+	assert.NoError(t, tc.Migrator().Up(ctx, 1))
+	assertStatus(t, 2)
+
+	t.Log("down all")
+	assert.NoError(t, tc.Migrator().Down(ctx, migrationStepAll))
+	assertStatus(t, 0)
+}
+
+func TestMigration_UseTransactions(t *testing.T) {
+	migrations := map[string]string{
+		"1_test.up.sql": `
+create table test (id int);
+create table test2 invalid sql;
+`,
+		"1_test.down.sql": `drop table test;`,
+	}
+
+	tableExists := func(t *testing.T, tc *MigrationTestContext) bool {
+		var count int
+		err := tc.db.Get(&count, "select count(*) from sqlite_master where type = 'table' and name = 'test'")
+		assert.NoError(t, err)
+		return count > 0
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		t.Parallel()
+		tc := NewMigrationTestContext(t, migrations)
+		defer tc.CleanUp(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err := tc.Migrator().Up(ctx, migrationStepAll)
+		assert.Error(t, err)
+		assert.False(t, tableExists(t, tc), "partial migration should be rolled back")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		tc := NewMigrationTestContextWithOptions(t, migrations, func(opts *MigrateOptions) {
+			useTransactions := false
+			opts.UseTransactions = &useTransactions
+		})
+		defer tc.CleanUp(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err := tc.Migrator().Up(ctx, migrationStepAll)
+		assert.Error(t, err)
+		assert.True(t, tableExists(t, tc), "partial migration should be kept")
+	})
+}
+
+func TestMigration_Validate(t *testing.T) {
+	tc := NewMigrationTestContext(t, map[string]string{
+		"1_test.up.sql":    `create table test (id int);`,
+		"1_test.down.sql":  `drop table test;`,
+		"2_test2.up.sql":   `create table test2 (id int);`,
+		"2_test2.down.sql": `drop table test2;`,
+	})
+	defer tc.CleanUp(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Log("no migrations applied")
+	assert.NoError(t, tc.Migrator().Validate(ctx))
+	exists, err := tc.Migrator().checksumsTableExists(ctx)
+	assert.NoError(t, err)
+	assert.False(t, exists, "validate should not create checksums table")
+
+	assert.NoError(t, tc.Migrator().Up(ctx, 1))
+	assert.NoError(t, tc.Migrator().Validate(ctx))
+
+	t.Log("modifying pending migration")
+	err = os.WriteFile(
+		filepath.Join(tc.migrationsDir, "2_test2.up.sql"),
+		[]byte(`create table test2 (id int, s text);`),
+		0644,
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, tc.Migrator().Validate(ctx))
+
+	t.Log("modifying applied migration")
+	err = os.WriteFile(
+		filepath.Join(tc.migrationsDir, "1_test.up.sql"),
+		[]byte(`create table test (id int, s text);`),
+		0644,
+	)
+	assert.NoError(t, err)
+
+	err = tc.Migrator().Validate(ctx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "1_test.up.sql")
+
+	t.Log("up should fail before applying migrations")
+	assert.Error(t, tc.Migrator().Up(ctx, migrationStepAll))
+	version, _, err := tc.Migrator().Status(ctx)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, version)
+
+	t.Log("reverted migration is not validated")
+	assert.NoError(t, tc.Migrator().Down(ctx, migrationStepAll))
+	assert.NoError(t, tc.Migrator().Validate(ctx))
+}
+
+func TestMigration_Seed(t *testing.T) {
+	tc := NewMigrationTestContextWithOptions(t, map[string]string{
+		"1_test.up.sql":    `create table test (id int);`,
+		"1_test.down.sql":  `drop table test;`,
+		"1_test.seed.sql":  `insert into test (id) values (1), (2);`,
+		"2_test2.up.sql":   `create table test2 (id int);`,
+		"2_test2.down.sql": `drop table test2;`,
+		"2_test2.seed.sql": `insert into test2 (id) values (1); insert into test (id) values (3);`,
+		"3_test3.up.sql":   `create table test3 (id int);`,
+		"3_test3.down.sql": `drop table test3;`,
+		"3_test3.seed.sql": `insert into test3 (id) values (1);`,
+	}, func(opts *MigrateOptions) {
+		opts.ApplySeed = true
+	})
+	defer tc.CleanUp(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	countRows := func(t *testing.T, table string) int {
+		var count int
+		assert.NoError(t, tc.db.Get(&count, fmt.Sprintf("select count(*) from %s", table)))
+		return count
+	}
+
+	t.Log("up 1 step")
+	assert.NoError(t, tc.Migrator().Up(ctx, 1))
+	assert.Equal(t, 2, countRows(t, "test"))
+
+	t.Log("up all")
+	assert.NoError(t, tc.Migrator().Up(ctx, migrationStepAll))
+	assert.Equal(t, 3, countRows(t, "test"))
+	assert.Equal(t, 1, countRows(t, "test2"))
+	assert.Equal(t, 1, countRows(t, "test3"))
+
+	t.Log("rerunning migrations")
+	assert.NoError(t, tc.Migrator().Up(ctx, migrationStepAll))
+	assert.Equal(t, 3, countRows(t, "test"))
+	assert.Equal(t, 1, countRows(t, "test2"))
+	assert.Equal(t, 1, countRows(t, "test3"))
+
+	t.Log("down does not un-apply seeds")
+	assert.NoError(t, tc.Migrator().Down(ctx, 1))
+	assert.Equal(t, 3, countRows(t, tableNameSeeds))
+}
+
+func TestMigration_DryRun(t *testing.T) {
+	migrations := map[string]string{
+		"1_test.up.sql":    `create table test (id int);`,
+		"1_test.down.sql":  `drop table test;`,
+		"2_test2.up.sql":   `create table test2 (id int);`,
+		"2_test2.down.sql": `drop table test2;`,
+	}
+
+	listTables := func(t *testing.T, tc *MigrationTestContext) []string {
+		var rv []string
+		err := tc.db.Select(
+			&rv,
+			"select name from sqlite_master where type = 'table' and name in ('test', 'test2') order by name",
+		)
+		assert.NoError(t, err)
+		return rv
+	}
+
+	t.Run("up", func(t *testing.T) {
+		t.Parallel()
+		tc := NewMigrationTestContext(t, migrations)
+		defer tc.CleanUp(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		dryRunMigrator := tc.DryRunMigrator(t)
+		assert.NoError(t, dryRunMigrator.Up(ctx, migrationStepAll))
+		assert.Empty(t, listTables(t, tc))
+		exists, err := dryRunMigrator.checksumsTableExists(ctx)
+		assert.NoError(t, err)
+		assert.False(t, exists, "dry run should not create checksums table")
+
+		version, _, err := tc.Migrator().Status(ctx)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 0, version)
+
+		t.Log("dry run from applied version")
+		assert.NoError(t, tc.Migrator().Up(ctx, 1))
+		assert.NoError(t, dryRunMigrator.Up(ctx, migrationStepAll))
+		assert.Equal(t, []string{"test"}, listTables(t, tc))
+	})
+
+	t.Run("down", func(t *testing.T) {
+		t.Parallel()
+		tc := NewMigrationTestContext(t, migrations)
+		defer tc.CleanUp(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		assert.NoError(t, tc.Migrator().Up(ctx, migrationStepAll))
+
+		dryRunMigrator := tc.DryRunMigrator(t)
+		assert.NoError(t, dryRunMigrator.Down(ctx, 1))
+		assert.NoError(t, dryRunMigrator.Down(ctx, migrationStepAll))
+		assert.Equal(t, []string{"test", "test2"}, listTables(t, tc))
+
+		version, _, err := tc.Migrator().Status(ctx)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 2, version)
+	})
+
+	t.Run("failed migrations", func(t *testing.T) {
+		t.Parallel()
+		tc := NewMigrationTestContext(t, map[string]string{
+			"1_test.up.sql":  `create table test (id int);`,
+			"2_test2.up.sql": `create table test2 invalid sql;`,
+		})
+		defer tc.CleanUp(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err := tc.DryRunMigrator(t).Up(ctx, migrationStepAll)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "2_test2.up.sql")
+		assert.Empty(t, listTables(t, tc))
+	})
+}
+
+//go:embed testdata/migrations/*.sql
+var testEmbeddedMigrations embed.FS
+
+func TestMigration_SourceFS(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	sourceFS, err := fs.Sub(testEmbeddedMigrations, "testdata/migrations")
+	assert.NoError(t, err)
+
+	migrator, err := NewMigrator(&MigrateOptions{
+		Logger:   createTestLogger(t).WithName("test"),
+		DB:       db.DB,
+		SourceFS: sourceFS,
+	})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tableExists := func(name string) bool {
+		var count int
+		err := db.Get(&count, "select count(*) from sqlite_master where type = 'table' and name = ?", name)
+		assert.NoError(t, err)
+		return count > 0
+	}
+
+	assert.NoError(t, migrator.Up(ctx, migrationStepAll))
+	assert.True(t, tableExists("test"))
+	assert.True(t, tableExists("test2"))
+
+	assert.NoError(t, migrator.Down(ctx, migrationStepAll))
+	assert.False(t, tableExists("test"))
+	assert.False(t, tableExists("test2"))
+}
+
+func TestMigrateOptions_defaults(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	t.Run("no source", func(t *testing.T) {
+		opts := &MigrateOptions{DB: db.DB}
+		assert.Error(t, opts.defaults())
+	})
+
+	t.Run("both sources", func(t *testing.T) {
+		opts := &MigrateOptions{DB: db.DB, SourceDIR: t.TempDir(), SourceFS: testEmbeddedMigrations}
+		assert.Error(t, opts.defaults())
+	})
+}
@@ -2,11 +2,20 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/supabase/postgrest-go"
 )
 
 func TestSecurityNegativeCases(t *testing.T) {
@@ -98,3 +107,788 @@ func TestSecuritySQLInjection(t *testing.T) {
 		assert.Len(t, rv, 1)
 	})
 }
+
+func TestSecurityReadOnlyTable(t *testing.T) {
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.SecurityOptions.EnabledTableOrViews = []string{"test"}
+		opts.SecurityOptions.ReadOnlyTableOrViews = []string{"test_readonly"}
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test_readonly (id int)")
+	tc.ExecuteSQL(t, "CREATE TABLE test_denied (id int)")
+	tc.ExecuteSQL(t, "INSERT INTO test_readonly (id) VALUES (1)")
+
+	cases := []struct {
+		method         string
+		table          string
+		expectedStatus int
+	}{
+		{method: http.MethodGet, table: "test_readonly", expectedStatus: http.StatusOK},
+		{method: http.MethodPost, table: "test_readonly", expectedStatus: http.StatusForbidden},
+		{method: http.MethodPatch, table: "test_readonly", expectedStatus: http.StatusForbidden},
+		{method: http.MethodDelete, table: "test_readonly", expectedStatus: http.StatusForbidden},
+		{method: http.MethodGet, table: "test_denied", expectedStatus: http.StatusForbidden},
+		{method: http.MethodPost, table: "test_denied", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		var body io.Reader
+		if c.method == http.MethodPost || c.method == http.MethodPatch {
+			body = bytes.NewBufferString(`{"id": 2}`)
+		}
+		req := tc.NewRequest(t, c.method, c.table, body)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp := tc.ExecuteRequest(t, req)
+		resp.Body.Close()
+
+		assert.Equal(t, c.expectedStatus, resp.StatusCode, "%s %s", c.method, c.table)
+	}
+
+	var count int
+	assert.NoError(t, tc.db.Get(&count, "SELECT count(*) FROM test_readonly"))
+	assert.Equal(t, 1, count)
+}
+
+func TestSecurityWildcardTable(t *testing.T) {
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.SecurityOptions.EnabledTableOrViews = nil
+		opts.SecurityOptions.WildcardTablePatterns = []string{"user_*"}
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE user_profiles (id int)")
+	tc.ExecuteSQL(t, "CREATE TABLE order_lines (id int)")
+
+	cases := []struct {
+		method         string
+		table          string
+		expectedStatus int
+	}{
+		{method: http.MethodGet, table: "user_profiles", expectedStatus: http.StatusOK},
+		{method: http.MethodPost, table: "user_profiles", expectedStatus: http.StatusCreated},
+		{method: http.MethodDelete, table: "user_profiles", expectedStatus: http.StatusAccepted},
+		{method: http.MethodGet, table: "order_lines", expectedStatus: http.StatusForbidden},
+		{method: http.MethodPost, table: "order_lines", expectedStatus: http.StatusForbidden},
+		{method: http.MethodDelete, table: "order_lines", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		var body io.Reader
+		if c.method == http.MethodPost {
+			body = bytes.NewBufferString(`{"id": 1}`)
+		}
+		req := tc.NewRequest(t, c.method, c.table, body)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp := tc.ExecuteRequest(t, req)
+		resp.Body.Close()
+
+		assert.Equal(t, c.expectedStatus, resp.StatusCode, "%s %s", c.method, c.table)
+	}
+
+	t.Run("InvalidPattern", func(t *testing.T) {
+		opts := &ServerSecurityOptions{WildcardTablePatterns: []string{"user_["}}
+		assert.Error(t, opts.defaults())
+	})
+}
+
+func TestSecurityDenyMode(t *testing.T) {
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.SecurityOptions.EnabledTableOrViews = nil
+		opts.SecurityOptions.DenyMode = true
+		opts.SecurityOptions.DeniedTableOrViews = []string{"secrets"}
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE secrets (id int)")
+	tc.ExecuteSQL(t, "CREATE TABLE books (id int)")
+	tc.ExecuteSQL(t, "CREATE TABLE authors (id int)")
+	tc.ExecuteSQL(t, "CREATE TABLE "+tableNameMigrationChecksums+" (id int)")
+	tc.ExecuteSQL(t, "CREATE TABLE "+tableNameSeeds+" (id int)")
+
+	cases := []struct {
+		method         string
+		table          string
+		expectedStatus int
+	}{
+		{method: http.MethodGet, table: "books", expectedStatus: http.StatusOK},
+		{method: http.MethodPost, table: "books", expectedStatus: http.StatusCreated},
+		{method: http.MethodGet, table: "authors", expectedStatus: http.StatusOK},
+		{method: http.MethodGet, table: "secrets", expectedStatus: http.StatusForbidden},
+		{method: http.MethodPost, table: "secrets", expectedStatus: http.StatusForbidden},
+		{method: http.MethodGet, table: "sqlite_master", expectedStatus: http.StatusForbidden},
+		{method: http.MethodGet, table: tableNameMigrationChecksums, expectedStatus: http.StatusForbidden},
+		{method: http.MethodPost, table: tableNameMigrationChecksums, expectedStatus: http.StatusForbidden},
+		{method: http.MethodGet, table: tableNameSeeds, expectedStatus: http.StatusForbidden},
+		{method: http.MethodPost, table: tableNameSeeds, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		var body io.Reader
+		if c.method == http.MethodPost {
+			body = bytes.NewBufferString(`{"id": 1}`)
+		}
+		req := tc.NewRequest(t, c.method, c.table, body)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp := tc.ExecuteRequest(t, req)
+		resp.Body.Close()
+
+		assert.Equal(t, c.expectedStatus, resp.StatusCode, "%s %s", c.method, c.table)
+	}
+
+	t.Run("MixedConfiguration", func(t *testing.T) {
+		opts := &ServerSecurityOptions{
+			DenyMode:            true,
+			DeniedTableOrViews:  []string{"secrets"},
+			EnabledTableOrViews: []string{"books"},
+		}
+		assert.Error(t, opts.defaults())
+
+		opts = &ServerSecurityOptions{DeniedTableOrViews: []string{"secrets"}}
+		assert.Error(t, opts.defaults())
+	})
+}
+
+func TestSecurityAllowTableFile(t *testing.T) {
+	allowTableFile := filepath.Join(t.TempDir(), "tables.txt")
+	assert.NoError(t, os.WriteFile(allowTableFile, []byte("# allowed tables\nbooks\n"), 0o600))
+
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.SecurityOptions.EnabledTableOrViews = nil
+		opts.SecurityOptions.EnabledTableOrViewsFile = allowTableFile
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE books (id int)")
+	tc.ExecuteSQL(t, "CREATE TABLE authors (id int)")
+
+	get := func(t *testing.T, table string) int {
+		req := tc.NewRequest(t, http.MethodGet, table, nil)
+		resp := tc.ExecuteRequest(t, req)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, get(t, "books"))
+	assert.Equal(t, http.StatusForbidden, get(t, "authors"))
+
+	t.Log("update allow table file")
+	{
+		assert.NoError(t, os.WriteFile(allowTableFile, []byte("books\nauthors\n"), 0o600))
+		// make sure the modification time is changed
+		modTime := time.Now().Add(time.Second)
+		assert.NoError(t, os.Chtimes(allowTableFile, modTime, modTime))
+
+		assert.Equal(t, http.StatusOK, get(t, "books"))
+		assert.Equal(t, http.StatusOK, get(t, "authors"))
+	}
+
+	t.Log("remove table from allow table file")
+	{
+		assert.NoError(t, os.WriteFile(allowTableFile, []byte("authors\n"), 0o600))
+		modTime := time.Now().Add(2 * time.Second)
+		assert.NoError(t, os.Chtimes(allowTableFile, modTime, modTime))
+
+		assert.Equal(t, http.StatusForbidden, get(t, "books"))
+		assert.Equal(t, http.StatusOK, get(t, "authors"))
+	}
+}
+
+func TestSecurityAllowTableByMethod(t *testing.T) {
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.SecurityOptions.EnabledTableOrViews = []string{"test_all"}
+		opts.SecurityOptions.ReadTableOrViews = []string{"test_read", "test_read_write"}
+		opts.SecurityOptions.WriteTableOrViews = []string{"test_write", "test_read_write"}
+		opts.SecurityOptions.DeleteTableOrViews = []string{"test_delete"}
+	})
+	defer tc.CleanUp(t)
+
+	tables := []string{"test_all", "test_read", "test_write", "test_delete", "test_read_write", "test_none"}
+	for _, table := range tables {
+		tc.ExecuteSQL(t, fmt.Sprintf("CREATE TABLE %s (id int)", table))
+	}
+
+	cases := []struct {
+		table   string
+		allowed map[string]bool
+	}{
+		{
+			table:   "test_all",
+			allowed: map[string]bool{http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPatch: true, http.MethodDelete: true},
+		},
+		{
+			table:   "test_read",
+			allowed: map[string]bool{http.MethodGet: true, http.MethodHead: true},
+		},
+		{
+			table:   "test_write",
+			allowed: map[string]bool{http.MethodPost: true, http.MethodPatch: true},
+		},
+		{
+			table:   "test_delete",
+			allowed: map[string]bool{http.MethodDelete: true},
+		},
+		{
+			table:   "test_read_write",
+			allowed: map[string]bool{http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPatch: true},
+		},
+		{
+			table:   "test_none",
+			allowed: map[string]bool{},
+		},
+	}
+
+	for _, c := range cases {
+		for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPatch, http.MethodDelete} {
+			var body io.Reader
+			if method == http.MethodPost || method == http.MethodPatch {
+				body = bytes.NewBufferString(`{"id": 1}`)
+			}
+			req := tc.NewRequest(t, method, c.table, body)
+			if body != nil {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			resp := tc.ExecuteRequest(t, req)
+			resp.Body.Close()
+
+			if c.allowed[method] {
+				assert.NotEqual(t, http.StatusForbidden, resp.StatusCode, "%s %s", method, c.table)
+				assert.Less(t, resp.StatusCode, 300, "%s %s", method, c.table)
+			} else {
+				assert.Equal(t, http.StatusForbidden, resp.StatusCode, "%s %s", method, c.table)
+			}
+		}
+	}
+}
+
+func TestSecurityOptionsAllowHeader(t *testing.T) {
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.SecurityOptions.EnabledTableOrViews = []string{"test_all"}
+		opts.SecurityOptions.ReadOnlyTableOrViews = []string{"test_readonly"}
+		opts.SecurityOptions.ReadTableOrViews = []string{"test_read_write"}
+		opts.SecurityOptions.WriteTableOrViews = []string{"test_read_write"}
+	})
+	defer tc.CleanUp(t)
+
+	cases := []struct {
+		table          string
+		expectedStatus int
+		expectedAllow  string
+	}{
+		{
+			table:          "test_all",
+			expectedStatus: http.StatusOK,
+			expectedAllow:  "GET, POST, PATCH, PUT, DELETE, HEAD, OPTIONS",
+		},
+		{
+			table:          "test_readonly",
+			expectedStatus: http.StatusOK,
+			expectedAllow:  "GET, HEAD, OPTIONS",
+		},
+		{
+			table:          "test_read_write",
+			expectedStatus: http.StatusOK,
+			expectedAllow:  "GET, POST, PATCH, PUT, HEAD, OPTIONS",
+		},
+		{
+			table:          "test_none",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, c := range cases {
+		req := tc.NewRequest(t, http.MethodOptions, c.table, nil)
+		resp := tc.ExecuteRequest(t, req)
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.NoError(t, err)
+
+		assert.Equal(t, c.expectedStatus, resp.StatusCode, c.table)
+		if c.expectedStatus == http.StatusOK {
+			assert.Equal(t, c.expectedAllow, resp.Header.Get("Allow"), c.table)
+			assert.Empty(t, b, c.table)
+		}
+	}
+}
+
+func TestSecurityIPAllowList(t *testing.T) {
+	cases := []struct {
+		name           string
+		ipAllowList    []string
+		behindProxy    bool
+		forwardedFor   string
+		realIP         string
+		expectedStatus int
+	}{
+		{name: "empty allow list", expectedStatus: http.StatusOK},
+		{name: "exact IP matched", ipAllowList: []string{"127.0.0.1"}, expectedStatus: http.StatusOK},
+		{name: "exact IP not matched", ipAllowList: []string{"10.0.0.1"}, expectedStatus: http.StatusForbidden},
+		{name: "CIDR matched", ipAllowList: []string{"10.0.0.1", "127.0.0.0/8"}, expectedStatus: http.StatusOK},
+		{name: "CIDR not matched", ipAllowList: []string{"192.168.1.0/24"}, expectedStatus: http.StatusForbidden},
+		{
+			name:           "forwarded IP matched",
+			ipAllowList:    []string{"192.168.1.0/24"},
+			behindProxy:    true,
+			forwardedFor:   "192.168.1.10",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "forwarded IP not matched",
+			ipAllowList:    []string{"127.0.0.1"},
+			behindProxy:    true,
+			forwardedFor:   "192.168.1.10",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "spoofed leftmost forwarded IP rejected",
+			ipAllowList:    []string{"192.168.1.0/24"},
+			behindProxy:    true,
+			forwardedFor:   "192.168.1.10, 10.0.0.1",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "rightmost forwarded IP matched",
+			ipAllowList:    []string{"192.168.1.0/24"},
+			behindProxy:    true,
+			forwardedFor:   "10.0.0.1, 192.168.1.10",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "real IP headers ignored",
+			ipAllowList:    []string{"192.168.1.0/24"},
+			behindProxy:    true,
+			realIP:         "192.168.1.10",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "forwarded IP ignored when not behind proxy",
+			ipAllowList:    []string{"192.168.1.0/24"},
+			forwardedFor:   "192.168.1.10",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+				opts.BehindProxy = c.behindProxy
+				opts.SecurityOptions.IPAllowList = c.ipAllowList
+			})
+			defer tc.CleanUp(t)
+
+			tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+			req := tc.NewRequest(t, http.MethodGet, "test", nil)
+			if c.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", c.forwardedFor)
+			}
+			if c.realIP != "" {
+				req.Header.Set("X-Real-IP", c.realIP)
+				req.Header.Set("True-Client-IP", c.realIP)
+			}
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+
+			assert.Equal(t, c.expectedStatus, resp.StatusCode)
+		})
+	}
+
+	t.Run("invalid allow list", func(t *testing.T) {
+		opts := &ServerSecurityOptions{IPAllowList: []string{"not-an-ip"}}
+		assert.Error(t, opts.defaults())
+	})
+}
+
+func TestSecurityRowLevelSecurity(t *testing.T) {
+	tc, signToken := createTestContextWithHMACClaimsAuth(t, func(opts *ServerOptions) {
+		opts.SecurityOptions.RowLevelSecurityColumn = "owner"
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int, owner text)")
+	tc.ExecuteSQL(t, `INSERT INTO test (id, owner) VALUES (1, "user-a"), (2, "user-a"), (3, "user-b")`)
+
+	tokenA := signToken(&jwt.RegisteredClaims{Subject: "user-a"})
+	tokenB := signToken(&jwt.RegisteredClaims{Subject: "user-b"})
+
+	selectIDs := func(t *testing.T, authToken string) []interface{} {
+		tc.authToken = authToken
+		res, _, err := tc.Client().From("test").Select("id", "", false).
+			Order("id", &postgrest.OrderOpts{Ascending: true}).
+			Execute()
+		assert.NoError(t, err)
+
+		var rv []map[string]interface{}
+		tc.DecodeResult(t, res, &rv)
+		var ids []interface{}
+		for _, row := range rv {
+			ids = append(ids, row["id"])
+		}
+		return ids
+	}
+
+	assert.Equal(t, []interface{}{float64(1), float64(2)}, selectIDs(t, tokenA))
+	assert.Equal(t, []interface{}{float64(3)}, selectIDs(t, tokenB))
+
+	t.Log("user B cannot update or delete rows of user A")
+	{
+		tc.authToken = tokenB
+		_, _, err := tc.Client().From("test").
+			Update(map[string]interface{}{"id": 100}, "", "").
+			Execute()
+		assert.NoError(t, err)
+
+		_, _, err = tc.Client().From("test").Delete("", "").
+			Eq("id", "1").
+			Execute()
+		assert.NoError(t, err)
+
+		assert.Equal(t, []interface{}{float64(1), float64(2)}, selectIDs(t, tokenA))
+		assert.Equal(t, []interface{}{float64(100)}, selectIDs(t, tokenB))
+	}
+
+	t.Log("user B cannot bypass the row level security with filters")
+	{
+		tc.authToken = tokenB
+		for _, rawQuery := range []string{
+			"1%3D1+or+id=eq.0",
+			"id%3D0+or+1=eq.1",
+			"or=" + url.QueryEscape("(1=1 or id.eq.0,id.eq.1)"),
+			"unknown=eq.1",
+		} {
+			for _, method := range []string{http.MethodGet, http.MethodPatch, http.MethodDelete} {
+				var body io.Reader
+				if method == http.MethodPatch {
+					body = bytes.NewBufferString(`{"id": 200}`)
+				}
+				req := tc.NewRequest(t, method, "test?"+rawQuery, body)
+				if body != nil {
+					req.Header.Set("Content-Type", "application/json")
+				}
+				resp := tc.ExecuteRequest(t, req)
+				resp.Body.Close()
+				assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "%s %s", method, rawQuery)
+			}
+		}
+
+		req := tc.NewRequest(t, http.MethodGet, "test?or="+url.QueryEscape("(id.eq.1,id.eq.100)"), nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var rows []map[string]interface{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&rows))
+		assert.Equal(t, []map[string]interface{}{{"id": float64(100), "owner": "user-b"}}, rows)
+
+		assert.Equal(t, []interface{}{float64(1), float64(2)}, selectIDs(t, tokenA))
+	}
+
+	t.Log("missing claim")
+	{
+		tc.authToken = signToken(&jwt.RegisteredClaims{})
+		req := tc.NewRequest(t, http.MethodGet, "test", nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+func TestSecurityRoles(t *testing.T) {
+	rolesFile := filepath.Join(t.TempDir(), "roles.yaml")
+	rolesContent := `
+reader:
+  - test:GET
+writer:
+  - test:POST
+admin:
+  - "*:*"
+`
+	assert.NoError(t, os.WriteFile(rolesFile, []byte(rolesContent), 0644))
+
+	tc, signToken := createTestContextWithHMACClaimsAuth(t, func(opts *ServerOptions) {
+		opts.SecurityOptions.RolesFilePath = rolesFile
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+	cases := []struct {
+		name           string
+		role           interface{}
+		method         string
+		expectedStatus int
+	}{
+		{name: "reader can read", role: "reader", method: http.MethodGet, expectedStatus: http.StatusOK},
+		{name: "reader can head", role: "reader", method: http.MethodHead, expectedStatus: http.StatusOK},
+		{name: "reader cannot write", role: "reader", method: http.MethodPost, expectedStatus: http.StatusForbidden},
+		{name: "writer can write", role: "writer", method: http.MethodPost, expectedStatus: http.StatusCreated},
+		{name: "writer cannot read", role: "writer", method: http.MethodGet, expectedStatus: http.StatusForbidden},
+		{name: "writer cannot head", role: "writer", method: http.MethodHead, expectedStatus: http.StatusForbidden},
+		{name: "multiple roles can read", role: []string{"reader", "writer"}, method: http.MethodGet, expectedStatus: http.StatusOK},
+		{name: "multiple roles can write", role: []string{"reader", "writer"}, method: http.MethodPost, expectedStatus: http.StatusCreated},
+		{name: "admin can delete", role: "admin", method: http.MethodDelete, expectedStatus: http.StatusAccepted},
+		{name: "unknown role", role: "unknown", method: http.MethodGet, expectedStatus: http.StatusForbidden},
+		{name: "missing role", role: nil, method: http.MethodGet, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			claims := jwt.MapClaims{}
+			if c.role != nil {
+				claims["role"] = c.role
+			}
+			tc.authToken = signToken(claims)
+
+			var body io.Reader
+			if c.method == http.MethodPost {
+				body = bytes.NewBufferString(`{"id": 1}`)
+			}
+			req := tc.NewRequest(t, c.method, "test", body)
+			if body != nil {
+				req.Header.Set("Content-Type", "application/json")
+			}
+
+			failedBefore := testutil.ToFloat64(metricsAccessCheckFailedRequestsTotal)
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+
+			assert.Equal(t, c.expectedStatus, resp.StatusCode)
+			failedAfter := testutil.ToFloat64(metricsAccessCheckFailedRequestsTotal)
+			if c.expectedStatus == http.StatusForbidden {
+				assert.Equal(t, failedBefore+1, failedAfter)
+			} else {
+				assert.Equal(t, failedBefore, failedAfter)
+			}
+		})
+	}
+
+	t.Run("schema discovery", func(t *testing.T) {
+		for role, expected := range map[string][]string{
+			"reader": {"test"},
+			"writer": {},
+			"admin":  {"test"},
+		} {
+			tc.authToken = signToken(jwt.MapClaims{"role": role})
+			assert.Equal(t, expected, discoverTableOrViews(t, tc), role)
+		}
+	})
+}
+
+// discoverTableOrViews returns the names listed by the schema discovery.
+func discoverTableOrViews(t *testing.T, tc *TestContext) []string {
+	req := tc.NewRequest(t, http.MethodGet, "", nil)
+	resp := tc.ExecuteRequest(t, req)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var tableOrViews []TableOrView
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&tableOrViews))
+	rv := []string{}
+	for _, t := range tableOrViews {
+		rv = append(rv, t.Name)
+	}
+	return rv
+}
+
+func TestSecurityAllowFromDB(t *testing.T) {
+	const cacheTTL = 200 * time.Millisecond
+
+	tc, signToken := createTestContextWithHMACClaimsAuth(t, func(opts *ServerOptions) {
+		opts.SecurityOptions.EnabledTableOrViews = nil
+		opts.SecurityOptions.AllowFromDB = true
+		opts.SecurityOptions.AllowCacheTTL = cacheTTL
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE _permissions (role text, table_name text)")
+	tc.ExecuteSQL(t, "CREATE TABLE books (id int)")
+	tc.ExecuteSQL(t, "CREATE TABLE authors (id int)")
+	tc.ExecuteSQL(t, `INSERT INTO _permissions (role, table_name) VALUES ("reader", "books"), ("reader", "authors")`)
+
+	get := func(t *testing.T, role string, table string) int {
+		tc.authToken = signToken(jwt.MapClaims{"role": role})
+		req := tc.NewRequest(t, http.MethodGet, table, nil)
+		resp := tc.ExecuteRequest(t, req)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, get(t, "reader", "books"))
+	assert.Equal(t, http.StatusOK, get(t, "reader", "authors"))
+	assert.Equal(t, http.StatusForbidden, get(t, "writer", "books"))
+	assert.Equal(t, http.StatusForbidden, get(t, "reader", "_permissions"))
+
+	t.Log("schema discovery")
+	{
+		tc.authToken = signToken(jwt.MapClaims{"role": "reader"})
+		assert.Equal(t, []string{"authors", "books"}, discoverTableOrViews(t, tc))
+		tc.authToken = signToken(jwt.MapClaims{"role": "writer"})
+		assert.Equal(t, []string{}, discoverTableOrViews(t, tc))
+	}
+
+	t.Log("revoke permission")
+	{
+		tc.ExecuteSQL(t, `DELETE FROM _permissions WHERE table_name = "authors"`)
+
+		// cached permissions are used before the TTL expires
+		assert.Equal(t, http.StatusOK, get(t, "reader", "authors"))
+
+		time.Sleep(cacheTTL + 50*time.Millisecond)
+		assert.Equal(t, http.StatusForbidden, get(t, "reader", "authors"))
+		assert.Equal(t, http.StatusOK, get(t, "reader", "books"))
+	}
+}
+
+func TestSecurityColumnAllowList(t *testing.T) {
+	columnAllowFile := filepath.Join(t.TempDir(), "columns.yaml")
+	columnAllowContent := `
+users:
+  - id
+  - name
+  - profile
+`
+	assert.NoError(t, os.WriteFile(columnAllowFile, []byte(columnAllowContent), 0644))
+
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.SecurityOptions.EnabledTableOrViews = []string{"users", "test"}
+		opts.SecurityOptions.ColumnAllowFilePath = columnAllowFile
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE users (id int, name text, profile text, password_hash text)")
+	tc.ExecuteSQL(t, `INSERT INTO users VALUES (1, 'alice', '{"age": 18}', 'secret')`)
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int, password_hash text)")
+	tc.ExecuteSQL(t, "INSERT INTO test VALUES (1, 'secret')")
+
+	selectRows := func(t *testing.T, target string) (int, []map[string]interface{}) {
+		req := tc.NewRequest(t, http.MethodGet, target, nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		var rows []map[string]interface{}
+		if resp.StatusCode == http.StatusOK {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&rows))
+		}
+		return resp.StatusCode, rows
+	}
+
+	t.Run("select all", func(t *testing.T) {
+		for _, target := range []string{"users", "users?select=*"} {
+			statusCode, rows := selectRows(t, target)
+			assert.Equal(t, http.StatusOK, statusCode, target)
+			if assert.Len(t, rows, 1, target) {
+				assert.Equal(t, "alice", rows[0]["name"])
+				assert.NotContains(t, rows[0], "password_hash")
+			}
+		}
+	})
+
+	t.Run("select allowed columns", func(t *testing.T) {
+		statusCode, rows := selectRows(t, "users?select=id,nickname:name,profile->age")
+		assert.Equal(t, http.StatusOK, statusCode)
+		if assert.Len(t, rows, 1) {
+			assert.Equal(t, map[string]interface{}{
+				"id": float64(1), "nickname": "alice", "profile_age": float64(18),
+			}, rows[0])
+		}
+	})
+
+	t.Run("select denied column", func(t *testing.T) {
+		for _, target := range []string{
+			"users?select=id,password_hash",
+			"users?select=hash:password_hash::text",
+		} {
+			statusCode, _ := selectRows(t, target)
+			assert.Equal(t, http.StatusForbidden, statusCode, target)
+		}
+	})
+
+	t.Run("filter by denied column", func(t *testing.T) {
+		for _, target := range []string{
+			"users?password_hash=eq.secret",
+			"users?password_hash=like.s*",
+			"users?password_hash=not.eq.secret",
+			"users?password_hash=fts.secret&fts_table=test",
+			"users?or=(id.eq.2,password_hash.eq.secret)",
+			"users?and=(id.eq.1,not.password_hash.like.s*)",
+		} {
+			statusCode, _ := selectRows(t, target)
+			assert.Equal(t, http.StatusForbidden, statusCode, target)
+		}
+	})
+
+	t.Run("order by denied column", func(t *testing.T) {
+		for _, target := range []string{
+			"users?order=password_hash",
+			"users?order=id.asc,password_hash.desc",
+			"users?order=password_hash.asc.nocase",
+		} {
+			statusCode, _ := selectRows(t, target)
+			assert.Equal(t, http.StatusForbidden, statusCode, target)
+		}
+	})
+
+	t.Run("filter and order by allowed columns", func(t *testing.T) {
+		statusCode, rows := selectRows(t, "users?name=eq.alice&or=(id.eq.1,name.eq.bob)&order=name.desc,id")
+		assert.Equal(t, http.StatusOK, statusCode)
+		assert.Len(t, rows, 1)
+	})
+
+	t.Run("table not in allow list", func(t *testing.T) {
+		statusCode, rows := selectRows(t, "test")
+		assert.Equal(t, http.StatusOK, statusCode)
+		if assert.Len(t, rows, 1) {
+			assert.Equal(t, "secret", rows[0]["password_hash"])
+		}
+	})
+}
+
+func TestSecurityDisableIntrospection(t *testing.T) {
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.SecurityOptions.AllowSchemaAccess = true
+		opts.SecurityOptions.AllowCommonTableExpressions = true
+		opts.SecurityOptions.DisableIntrospection = true
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int, pragmatic text)")
+	tc.ExecuteSQL(t, "INSERT INTO test VALUES (1, 'yes')")
+
+	get := func(t *testing.T, target string) int {
+		req := tc.NewRequest(t, http.MethodGet, target, nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	t.Run("blocked", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, get(t, "test?schema=true"))
+
+		for _, target := range []string{
+			"test?with=" + url.QueryEscape("names as (select name from sqlite_master)"),
+			"test?with=" + url.QueryEscape("names as (select name from SQLITE_SCHEMA)"),
+			"test?with=" + url.QueryEscape("names as (select name from pragma_table_info('test'))"),
+			"test?select=" + url.QueryEscape("id,PRAGMA"),
+		} {
+			assert.Equal(t, http.StatusBadRequest, get(t, target), target)
+		}
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		for _, target := range []string{
+			"test",
+			"test?select=id,pragmatic",
+			"test?with=" + url.QueryEscape("ids as (select id from test)"),
+		} {
+			assert.Equal(t, http.StatusOK, get(t, target), target)
+		}
+	})
+}
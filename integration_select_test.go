@@ -1,12 +1,23 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 	"github.com/supabase/postgrest-go"
 )
@@ -266,6 +277,397 @@ func testSelect_SingleTable(t *testing.T, createTestContext func(t testing.TB) *
 		}
 	})
 
+	t.Run("SelectTotalCount", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+		tc.ExecuteSQL(t, `INSERT INTO test (id) VALUES (1), (2), (3), (4), (5)`)
+
+		cases := []struct {
+			rawQuery           string
+			expectedStatusCode int
+			expectedRows       int
+			expectedTotalCount string
+		}{
+			{rawQuery: "", expectedStatusCode: http.StatusOK, expectedRows: 5, expectedTotalCount: "5"},
+			{rawQuery: "id=gt.1", expectedStatusCode: http.StatusOK, expectedRows: 4, expectedTotalCount: "4"},
+			{rawQuery: "limit=2", expectedStatusCode: http.StatusPartialContent, expectedRows: 2, expectedTotalCount: "5"},
+			{rawQuery: "limit=2&offset=4&id=gt.1", expectedStatusCode: http.StatusPartialContent, expectedRows: 0, expectedTotalCount: "4"},
+		}
+
+		for _, c := range cases {
+			req := tc.NewRequest(t, http.MethodGet, "test?"+c.rawQuery, nil)
+			req.Header.Set("Prefer", "count=exact")
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+
+			assert.Equal(t, c.expectedStatusCode, resp.StatusCode, c.rawQuery)
+			assert.Equal(t, c.expectedTotalCount, resp.Header.Get("X-Total-Count"), c.rawQuery)
+
+			res, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			var rv []map[string]interface{}
+			tc.DecodeResult(t, res, &rv)
+			assert.Len(t, rv, c.expectedRows, c.rawQuery)
+		}
+
+		t.Log("without count preference")
+		{
+			req := tc.NewRequest(t, http.MethodGet, "test", nil)
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Empty(t, resp.Header.Get("X-Total-Count"))
+		}
+	})
+
+	t.Run("SelectPreferenceHandling", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+		tc.ExecuteSQL(t, `INSERT INTO test (id) VALUES (1), (2)`)
+
+		cases := []struct {
+			prefer             string
+			expectedStatusCode int
+		}{
+			{prefer: "unknown=value", expectedStatusCode: http.StatusOK},
+			{prefer: "handling=lenient,unknown=value", expectedStatusCode: http.StatusOK},
+			{prefer: "handling=strict,count=exact", expectedStatusCode: http.StatusOK},
+			{prefer: "handling=strict,unknown=value", expectedStatusCode: http.StatusBadRequest},
+			{prefer: "unknown=value,handling=strict", expectedStatusCode: http.StatusBadRequest},
+			{prefer: "handling=strict,unknown", expectedStatusCode: http.StatusBadRequest},
+			{prefer: "handling=foo", expectedStatusCode: http.StatusBadRequest},
+		}
+
+		for _, c := range cases {
+			req := tc.NewRequest(t, http.MethodGet, "test", nil)
+			req.Header.Set("Prefer", c.prefer)
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+
+			assert.Equal(t, c.expectedStatusCode, resp.StatusCode, c.prefer)
+		}
+	})
+
+	t.Run("SelectEstimatedCount", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+		tc.ExecuteSQL(t, "CREATE INDEX test_id ON test (id)")
+		tx, err := tc.DB().Beginx()
+		assert.NoError(t, err)
+		for i := 0; i < 5000; i++ {
+			_, err := tx.Exec("INSERT INTO test (id, s) VALUES (?, ?)", i, strings.Repeat("a", 100))
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, tx.Commit())
+
+		queryCount := func(t *testing.T, rawQuery string) (int, int64) {
+			req := tc.NewRequest(t, http.MethodGet, "test?"+rawQuery, nil)
+			req.Header.Set("Prefer", "count=estimated")
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+
+			count, err := strconv.ParseInt(resp.Header.Get("X-Total-Count"), 10, 64)
+			assert.NoError(t, err)
+			return resp.StatusCode, count
+		}
+
+		t.Log("estimate from page count")
+		{
+			statusCode, count := queryCount(t, "limit=10")
+			assert.Equal(t, http.StatusPartialContent, statusCode)
+			assert.Greater(t, count, int64(5000/2))
+			assert.Less(t, count, int64(5000*2))
+		}
+
+		t.Log("filtered request uses exact count")
+		{
+			statusCode, count := queryCount(t, "limit=10&id=lt.10")
+			assert.Equal(t, http.StatusPartialContent, statusCode)
+			assert.EqualValues(t, 10, count)
+		}
+
+		t.Log("estimate from ANALYZE stats")
+		{
+			tc.ExecuteSQL(t, "ANALYZE")
+			tc.ExecuteSQL(t, "INSERT INTO test (id, s) VALUES (?, ?)", 5000, "a")
+
+			statusCode, count := queryCount(t, "limit=10")
+			assert.Equal(t, http.StatusPartialContent, statusCode)
+			assert.EqualValues(t, 5000, count)
+		}
+	})
+
+	t.Run("SelectEstimatedCountSmallTable", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+		tc.ExecuteSQL(t, `INSERT INTO test (id) VALUES (1), (2), (3), (4), (5)`)
+
+		req := tc.NewRequest(t, http.MethodGet, "test", nil)
+		req.Header.Set("Prefer", "count=estimated")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "5", resp.Header.Get("X-Total-Count"))
+	})
+
+	t.Run("SelectPaginationLinks", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+		var ps []string
+		for i := 0; i < 10; i++ {
+			ps = append(ps, fmt.Sprintf("(%d)", i+1))
+		}
+		tc.ExecuteSQL(t, fmt.Sprintf(`INSERT INTO test (id) VALUES %s`, strings.Join(ps, ", ")))
+
+		linkPattern := regexp.MustCompile(`<([^>]+)>; rel="([a-z]+)"`)
+		readLinks := func(t *testing.T, rangeHeader string, rawQuery string, countExact bool) map[string]url.Values {
+			req := tc.NewRequest(t, http.MethodGet, "test?"+rawQuery, nil)
+			if rangeHeader != "" {
+				req.Header.Set("Range", rangeHeader)
+			}
+			if countExact {
+				req.Header.Set("Prefer", "count=exact")
+			}
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+
+			rv := map[string]url.Values{}
+			for _, m := range linkPattern.FindAllStringSubmatch(resp.Header.Get("Link"), -1) {
+				u, err := url.Parse(m[1])
+				assert.NoError(t, err)
+				assert.Equal(t, "/test", u.Path)
+				rv[m[2]] = u.Query()
+			}
+			return rv
+		}
+
+		t.Log("unknown count")
+		{
+			links := readLinks(t, "", "limit=3&offset=4&id=gt.0", false)
+			assert.Len(t, links, 2)
+			assert.Equal(t, "1", links["prev"].Get("offset"))
+			assert.Equal(t, "7", links["next"].Get("offset"))
+			assert.Equal(t, "3", links["next"].Get("limit"))
+			assert.Equal(t, "gt.0", links["next"].Get("id"))
+		}
+
+		t.Log("exact count")
+		{
+			links := readLinks(t, "", "limit=3&offset=3", true)
+			assert.Len(t, links, 4)
+			assert.Equal(t, "0", links["first"].Get("offset"))
+			assert.Equal(t, "0", links["prev"].Get("offset"))
+			assert.Equal(t, "6", links["next"].Get("offset"))
+			assert.Equal(t, "7", links["last"].Get("offset"))
+		}
+
+		t.Log("unaligned offset")
+		{
+			links := readLinks(t, "", "limit=3&offset=4", true)
+			assert.Len(t, links, 4)
+			assert.Equal(t, "0", links["first"].Get("offset"))
+			assert.Equal(t, "1", links["prev"].Get("offset"))
+			assert.Equal(t, "7", links["next"].Get("offset"))
+			assert.Equal(t, "7", links["last"].Get("offset"))
+		}
+
+		t.Log("limit exceeds count")
+		{
+			links := readLinks(t, "", "limit=20", true)
+			assert.Len(t, links, 2)
+			assert.Equal(t, "0", links["first"].Get("offset"))
+			assert.Equal(t, "0", links["last"].Get("offset"))
+		}
+
+		t.Log("range header")
+		{
+			links := readLinks(t, "0-4", "", true)
+			assert.Len(t, links, 3)
+			assert.Equal(t, "0", links["first"].Get("offset"))
+			assert.Equal(t, "5", links["next"].Get("offset"))
+			assert.Equal(t, "5", links["next"].Get("limit"))
+			assert.Equal(t, "5", links["last"].Get("offset"))
+		}
+
+		t.Log("not paginated")
+		{
+			links := readLinks(t, "", "", true)
+			assert.Empty(t, links)
+		}
+	})
+
+	t.Run("SelectCursorPagination", func(t *testing.T) {
+		t.Parallel()
+		const (
+			rowsCount = 1000
+			pageSize  = 100
+		)
+
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+		var ps []string
+		for i := 0; i < rowsCount; i++ {
+			ps = append(ps, fmt.Sprintf("(%d)", i+1))
+		}
+		tc.ExecuteSQL(t, fmt.Sprintf(`INSERT INTO test (id) VALUES %s`, strings.Join(ps, ", ")))
+
+		readPage := func(t *testing.T, order string, cursor string) ([]map[string]interface{}, string) {
+			req := tc.NewRequest(t, http.MethodGet, "test", nil)
+			q := req.URL.Query()
+			q.Set("order", order)
+			q.Set("limit", fmt.Sprint(pageSize))
+			if cursor != "" {
+				q.Set("cursor", cursor)
+			}
+			req.URL.RawQuery = q.Encode()
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			res, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			var rv []map[string]interface{}
+			tc.DecodeResult(t, res, &rv)
+			return rv, resp.Header.Get("Next-Cursor")
+		}
+
+		t.Run("asc", func(t *testing.T) {
+			var (
+				cursor string
+				pages  int
+			)
+			for {
+				rv, nextCursor := readPage(t, "id.asc", cursor)
+				if len(rv) < 1 {
+					break
+				}
+				assert.Len(t, rv, pageSize)
+				for idx, row := range rv {
+					assert.EqualValues(t, pages*pageSize+idx+1, row["id"])
+				}
+				pages += 1
+
+				cursor = nextCursor
+				assert.Equal(t, fmt.Sprint(pages*pageSize), cursor)
+			}
+			assert.Equal(t, rowsCount/pageSize, pages)
+		})
+
+		t.Run("desc", func(t *testing.T) {
+			rv, nextCursor := readPage(t, "id.desc", "")
+			assert.Len(t, rv, pageSize)
+			assert.EqualValues(t, rowsCount, rv[0]["id"])
+			assert.Equal(t, fmt.Sprint(rowsCount-pageSize+1), nextCursor)
+
+			rv, nextCursor = readPage(t, "id.desc", "51")
+			assert.Len(t, rv, 50)
+			assert.EqualValues(t, 50, rv[0]["id"])
+			assert.EqualValues(t, 1, rv[49]["id"])
+			assert.Empty(t, nextCursor, "last page should not return next cursor")
+		})
+
+		t.Run("invalid", func(t *testing.T) {
+			for _, rawQuery := range []string{
+				"cursor=1",
+				"cursor=1&order=id.asc,id.desc",
+				"cursor=1&order=id.asc&limit=10&offset=10",
+				"cursor=0&order=1%3D1+or+id.asc",
+				"cursor=0&order=unknown.asc",
+				"order=" + url.QueryEscape("(select 1) or id"),
+			} {
+				req := tc.NewRequest(t, http.MethodGet, "test?"+rawQuery, nil)
+				resp := tc.ExecuteRequest(t, req)
+				resp.Body.Close()
+
+				assert.Equal(t, http.StatusBadRequest, resp.StatusCode, rawQuery)
+			}
+		})
+	})
+
+	t.Run("SelectAsCSV", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text, v real)")
+		tc.ExecuteSQL(t, `INSERT INTO test (id, s, v) VALUES (1, "a,b", 1.5), (2, 'say "hi"', null), (3, null, 3)`)
+
+		req := tc.NewRequest(t, http.MethodGet, "test?order=id.asc", nil)
+		req.Header.Set("Accept", "text/csv")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+
+		res, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Equal(
+			t,
+			"id,s,v\n1,\"a,b\",1.5\n2,\"say \"\"hi\"\"\",\n3,,3\n",
+			string(res),
+		)
+
+		records, err := csv.NewReader(bytes.NewReader(res)).ReadAll()
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"id", "s", "v"},
+			{"1", "a,b", "1.5"},
+			{"2", `say "hi"`, ""},
+			{"3", "", "3"},
+		}, records)
+	})
+
+	t.Run("SelectAsNDJSON", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+		tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (1, "a"), (2, "b"), (3, "c")`)
+
+		req := tc.NewRequest(t, http.MethodGet, "test?order=id.asc", nil)
+		req.Header.Set("Accept", "application/x-ndjson")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+		var rv []map[string]interface{}
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var row map[string]interface{}
+			tc.DecodeResult(t, scanner.Bytes(), &row)
+			rv = append(rv, row)
+		}
+		assert.NoError(t, scanner.Err())
+		assert.Len(t, rv, 3)
+		for idx, row := range rv {
+			assert.EqualValues(t, idx+1, row["id"])
+			assert.EqualValues(t, string('a'+rune(idx)), row["s"])
+		}
+	})
+
 	t.Run("SelectView", func(t *testing.T) {
 		t.Parallel()
 		tc := createTestContext(t)
@@ -403,6 +805,201 @@ func testSelect_SingleTable(t *testing.T, createTestContext func(t testing.TB) *
 		}
 	})
 
+	t.Run("SelectNotIn", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+		tc.ExecuteSQL(t, `INSERT INTO test (id) VALUES (1), (2), (3)`)
+
+		cases := []struct {
+			rawQuery    string
+			expectedIDs []int
+		}{
+			{rawQuery: "id=not.in.(1,4)", expectedIDs: []int{2, 3}},
+			{rawQuery: "id=not.in.(2)", expectedIDs: []int{1, 3}},
+			{rawQuery: "id=not.in.()", expectedIDs: []int{1, 2, 3}},
+			{rawQuery: "id=notin.(1,2)", expectedIDs: []int{3}},
+			{rawQuery: "id=notin.(2)", expectedIDs: []int{1, 3}},
+			{rawQuery: "id=notin.()", expectedIDs: []int{1, 2, 3}},
+			{rawQuery: "id=in.()", expectedIDs: []int{}},
+			{rawQuery: "id=not.notin.(1,2)", expectedIDs: []int{1, 2}},
+		}
+
+		for _, c := range cases {
+			req := tc.NewRequest(t, http.MethodGet, "test?order=id.asc&"+c.rawQuery, nil)
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode, c.rawQuery)
+
+			res, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			var rv []map[string]interface{}
+			tc.DecodeResult(t, res, &rv)
+			ids := make([]int, 0, len(rv))
+			for _, row := range rv {
+				ids = append(ids, int(row["id"].(float64)))
+			}
+			assert.Equal(t, c.expectedIDs, ids, c.rawQuery)
+		}
+	})
+
+	t.Run("SelectILike", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+		tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (1, "Hello"), (2, "HELLO world"), (3, "hi")`)
+
+		cases := []struct {
+			rawQuery    string
+			expectedIDs []int
+		}{
+			{rawQuery: "s=ilike.hello", expectedIDs: []int{1}},
+			{rawQuery: "s=ilike.hello%25", expectedIDs: []int{1, 2}},
+			{rawQuery: "s=ilike.%25WORLD", expectedIDs: []int{2}},
+			{rawQuery: "s=not.ilike.HELLO%25", expectedIDs: []int{3}},
+		}
+
+		for _, c := range cases {
+			req := tc.NewRequest(t, http.MethodGet, "test?order=id.asc&"+c.rawQuery, nil)
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode, c.rawQuery)
+
+			res, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			var rv []map[string]interface{}
+			tc.DecodeResult(t, res, &rv)
+			ids := make([]int, 0, len(rv))
+			for _, row := range rv {
+				ids = append(ids, int(row["id"].(float64)))
+			}
+			assert.Equal(t, c.expectedIDs, ids, c.rawQuery)
+		}
+	})
+
+	t.Run("SelectInLargeList", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+		tc.ExecuteSQL(t, "WITH RECURSIVE seq(id) AS (SELECT 1 UNION ALL SELECT id + 1 FROM seq LIMIT 1200) INSERT INTO test SELECT id FROM seq")
+
+		// 1, 3, 5, ... 1999
+		values := make([]string, 0, 1000)
+		for i := 0; i < 1000; i++ {
+			values = append(values, strconv.Itoa(i*2+1))
+		}
+		inList := "(" + strings.Join(values, ",") + ")"
+
+		queryCount := func(t *testing.T, filter string) int {
+			req := tc.NewRequest(t, http.MethodGet, "test?id="+filter, nil)
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode, filter)
+
+			res, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			var rv []map[string]interface{}
+			tc.DecodeResult(t, res, &rv)
+			for _, row := range rv {
+				id := int(row["id"].(float64))
+				if strings.HasPrefix(filter, "in.") {
+					assert.Equal(t, 1, id%2)
+				} else {
+					assert.Equal(t, 0, id%2)
+				}
+			}
+			return len(rv)
+		}
+
+		assert.Equal(t, 600, queryCount(t, "in."+inList))
+		assert.Equal(t, 600, queryCount(t, "notin."+inList))
+		assert.Equal(t, 600, queryCount(t, "not.in."+inList))
+	})
+
+	t.Run("SelectJSONPath", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int, data text)")
+		tc.ExecuteSQL(
+			t,
+			`INSERT INTO test (id, data) VALUES
+				(1, '{"name": "Alice", "age": 30, "address": {"city": "Paris"}, "tags": ["a", "b"]}'),
+				(2, '{"name": "Bob", "age": 25, "address": {"city": "London"}, "tags": ["b", "c"]}'),
+				(3, '{"name": "Carol''s", "age": 35, "tags": []}')`,
+		)
+
+		query := func(t *testing.T, rawQuery string) []map[string]interface{} {
+			req := tc.NewRequest(t, http.MethodGet, "test?order=id.asc&"+rawQuery, nil)
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode, rawQuery)
+
+			res, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			var rv []map[string]interface{}
+			tc.DecodeResult(t, res, &rv)
+			return rv
+		}
+		ids := func(rows []map[string]interface{}) []int {
+			rv := make([]int, 0, len(rows))
+			for _, row := range rows {
+				rv = append(rv, int(row["id"].(float64)))
+			}
+			return rv
+		}
+
+		t.Log("filter by json path")
+		{
+			cases := []struct {
+				rawQuery    string
+				expectedIDs []int
+			}{
+				{rawQuery: "data=jpath.->>$.name.eq.Alice", expectedIDs: []int{1}},
+				{rawQuery: "data=jpath.->$.age.gt.26", expectedIDs: []int{1, 3}},
+				{rawQuery: "data=jpath.$.address.city.in.(\"Paris\",\"Tokyo\")", expectedIDs: []int{1}},
+				{rawQuery: "data=jpath.->>$.address.city.is.null", expectedIDs: []int{3}},
+				{rawQuery: "data=not.jpath.->>$.name.eq.Alice", expectedIDs: []int{2, 3}},
+				{rawQuery: "data=jpath.->>$.name.eq.Carol's", expectedIDs: []int{3}},
+				{rawQuery: "data=jarrelem.$.tags.eq.b", expectedIDs: []int{1, 2}},
+				{rawQuery: "data=jarrelem.$.tags.eq.c", expectedIDs: []int{2}},
+				{rawQuery: "data=not.jarrelem.$.tags.eq.a", expectedIDs: []int{2, 3}},
+			}
+			for _, c := range cases {
+				assert.Equal(t, c.expectedIDs, ids(query(t, c.rawQuery)), c.rawQuery)
+			}
+		}
+
+		t.Log("invalid json path query")
+		{
+			req := tc.NewRequest(t, http.MethodGet, "test?data=jpath.->>$.name", nil)
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		}
+
+		t.Log("select json path")
+		{
+			rows := query(t, "select=id,data->>name,data->address->city,city:data->address->>city,data->tags->0")
+			assert.Len(t, rows, 3)
+			assert.Equal(t, "Alice", rows[0]["data_name"])
+			assert.Equal(t, "Paris", rows[0]["data_address_city"])
+			assert.Equal(t, "Paris", rows[0]["city"])
+			assert.Equal(t, "a", rows[0]["data_tags_0"])
+			assert.Equal(t, "Bob", rows[1]["data_name"])
+			assert.Equal(t, "London", rows[1]["city"])
+			assert.Nil(t, rows[2]["city"])
+			assert.Nil(t, rows[2]["data_tags_0"])
+		}
+	})
+
 	t.Run("SelectWithAdaptingColumns", func(t *testing.T) {
 		t.Parallel()
 		tc := createTestContext(t)
@@ -439,4 +1036,814 @@ func TestSelect_SingleTable(t *testing.T) {
 	t.Run("RSA token auth", func(t *testing.T) {
 		testSelect_SingleTable(t, createTestContextWithRSATokenAuth)
 	})
+
+	t.Run("ECDSA token auth", func(t *testing.T) {
+		testSelect_SingleTable(t, createTestContextWithECDSATokenAuth)
+	})
+
+	t.Run("Ed25519 token auth", func(t *testing.T) {
+		testSelect_SingleTable(t, createTestContextWithEd25519TokenAuth)
+	})
+}
+
+func TestSchemaDiscovery(t *testing.T) {
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.SecurityOptions.ReadOnlyTableOrViews = []string{"test_readonly"}
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+	tc.ExecuteSQL(t, "CREATE VIEW test_view AS SELECT * FROM test")
+	tc.ExecuteSQL(t, "CREATE TABLE test_readonly (id int)")
+	tc.ExecuteSQL(t, "CREATE TABLE test_hidden (id int)")
+
+	req := tc.NewRequest(t, http.MethodGet, "", nil)
+	resp := tc.ExecuteRequest(t, req)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	res, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	var rv []map[string]interface{}
+	tc.DecodeResult(t, res, &rv)
+	assert.Equal(t, []map[string]interface{}{
+		{"name": "test", "type": "table"},
+		{"name": "test_readonly", "type": "table"},
+		{"name": "test_view", "type": "view"},
+	}, rv)
+}
+
+func TestSelectSchema(t *testing.T) {
+	describe := func(t *testing.T, tc *TestContext) *http.Response {
+		req := tc.NewRequest(t, http.MethodGet, "test?schema=true", nil)
+		return tc.ExecuteRequest(t, req)
+	}
+
+	t.Run("CompositePrimaryKey", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+			opts.SecurityOptions.AllowSchemaAccess = true
+		})
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, `CREATE TABLE test (
+			a integer not null,
+			b text,
+			s text not null default 'foo',
+			primary key (b, a)
+		)`)
+
+		resp := describe(t, tc)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		res, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		var rv []map[string]interface{}
+		tc.DecodeResult(t, res, &rv)
+		assert.Equal(t, []map[string]interface{}{
+			{"name": "a", "type": "INTEGER", "notnull": true, "default": nil, "pk": float64(2)},
+			{"name": "b", "type": "TEXT", "notnull": false, "default": nil, "pk": float64(1)},
+			{"name": "s", "type": "TEXT", "notnull": true, "default": "'foo'", "pk": float64(0)},
+		}, rv)
+	})
+
+	t.Run("NoTable", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+			opts.SecurityOptions.AllowSchemaAccess = true
+		})
+		defer tc.CleanUp(t)
+
+		resp := describe(t, tc)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContextUsingInMemoryDB(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+		resp := describe(t, tc)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func TestSelectETag(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDB(t)
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+	tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (1, "a")`)
+
+	query := func(t *testing.T, ifNoneMatch string) *http.Response {
+		req := tc.NewRequest(t, http.MethodGet, "test", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		return tc.ExecuteRequest(t, req)
+	}
+
+	resp := query(t, "")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	resp = query(t, etag)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	b, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Empty(t, b)
+
+	resp = query(t, `"foo", W/`+etag)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (2, "b")`)
+
+	resp = query(t, etag)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+
+	tc.ExecuteSQL(t, `UPDATE test SET s = "c" WHERE id = 2`)
+	newETag := resp.Header.Get("ETag")
+	resp = query(t, newETag)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, newETag, resp.Header.Get("ETag"))
+}
+
+func TestSelectLastModified(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.LastModifiedColumn = "updated_at"
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text, updated_at DATETIME)")
+	tc.ExecuteSQL(t, `INSERT INTO test (id, s, updated_at) VALUES (1, "a", "2024-01-01 10:00:00"), (2, "b", "2024-01-02 10:00:00")`)
+	tc.ExecuteSQL(t, "CREATE TABLE test_view (id int)")
+
+	query := func(t *testing.T, table string, ifModifiedSince string) *http.Response {
+		req := tc.NewRequest(t, http.MethodGet, table, nil)
+		if ifModifiedSince != "" {
+			req.Header.Set("If-Modified-Since", ifModifiedSince)
+		}
+		return tc.ExecuteRequest(t, req)
+	}
+
+	resp := query(t, "test", "")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	lastModified := resp.Header.Get("Last-Modified")
+	assert.Equal(t, "Tue, 02 Jan 2024 10:00:00 GMT", lastModified)
+
+	t.Log("unchanged")
+	{
+		resp := query(t, "test", lastModified)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+		b, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Empty(t, b)
+	}
+
+	t.Log("updated")
+	{
+		tc.ExecuteSQL(t, `UPDATE test SET s = "c", updated_at = "2024-01-03 10:00:00" WHERE id = 1`)
+
+		resp := query(t, "test", lastModified)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "Wed, 03 Jan 2024 10:00:00 GMT", resp.Header.Get("Last-Modified"))
+		lastModified = resp.Header.Get("Last-Modified")
+	}
+
+	t.Log("filtered")
+	{
+		resp := query(t, "test?id=eq.2", "")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "Tue, 02 Jan 2024 10:00:00 GMT", resp.Header.Get("Last-Modified"))
+	}
+
+	t.Log("deleted")
+	{
+		req := tc.NewRequest(t, http.MethodGet, "test", nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		etag := resp.Header.Get("ETag")
+		assert.NotEmpty(t, etag)
+
+		tc.ExecuteSQL(t, "DELETE FROM test WHERE id = 2")
+
+		// deleted rows are not detected by the last modified column
+		resp = query(t, "test", lastModified)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+		// ETag takes precedence and detects the deletion
+		req = tc.NewRequest(t, http.MethodGet, "test", nil)
+		req.Header.Set("If-Modified-Since", lastModified)
+		req.Header.Set("If-None-Match", etag)
+		resp = tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var rows []map[string]interface{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&rows))
+		assert.Len(t, rows, 1)
+	}
+
+	t.Log("no last modified column")
+	{
+		resp := query(t, "test_view", lastModified)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Last-Modified"))
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.CacheControl = "max-age=60"
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+	tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (1, "a")`)
+
+	t.Log("query")
+	var etag string
+	{
+		req := tc.NewRequest(t, http.MethodGet, "test", nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "max-age=60", resp.Header.Get("Cache-Control"))
+		etag = resp.Header.Get("ETag")
+	}
+
+	t.Log("not modified")
+	{
+		req := tc.NewRequest(t, http.MethodGet, "test", nil)
+		req.Header.Set("If-None-Match", etag)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+		assert.Equal(t, "max-age=60", resp.Header.Get("Cache-Control"))
+	}
+
+	t.Log("query error")
+	{
+		req := tc.NewRequest(t, http.MethodGet, "test?unknown=eq.1", nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Cache-Control"))
+	}
+
+	t.Log("update")
+	{
+		req := tc.NewRequest(t, http.MethodPatch, "test?id=eq.1", bytes.NewBufferString(`{"s": "b"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+	}
+}
+
+func TestSelectHead(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDB(t)
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+	tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (1, "a"), (2, "b"), (3, "c")`)
+
+	execute := func(t *testing.T, method string, accept string) (*http.Response, []byte) {
+		req := tc.NewRequest(t, method, "test?limit=2&order=id", nil)
+		req.Header.Set("Prefer", "count=exact")
+		// HEAD response has no body to compress, compare the identity representation
+		req.Header.Set("Accept-Encoding", "identity")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		b, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp, b
+	}
+
+	for _, accept := range []string{"", "text/csv", "application/x-ndjson"} {
+		getResp, getBody := execute(t, http.MethodGet, accept)
+		assert.Equal(t, http.StatusPartialContent, getResp.StatusCode, accept)
+		assert.NotEmpty(t, getBody, accept)
+
+		headResp, headBody := execute(t, http.MethodHead, accept)
+		assert.Equal(t, getResp.StatusCode, headResp.StatusCode, accept)
+		assert.Empty(t, headBody, accept)
+
+		headers := []string{"Content-Type", "Content-Range", "X-Total-Count", "Link"}
+		if accept != "application/x-ndjson" {
+			headers = append(headers, "ETag", "Next-Cursor")
+		}
+		for _, header := range headers {
+			assert.NotEmpty(t, getResp.Header.Get(header), "%s %s", accept, header)
+			assert.Equal(t, getResp.Header.Get(header), headResp.Header.Get(header), "%s %s", accept, header)
+		}
+	}
+}
+
+func TestSelect_MaxLimit(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.MaxLimit = 100
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+	tc.ExecuteSQL(t, "WITH RECURSIVE seq(id) AS (SELECT 1 UNION ALL SELECT id + 1 FROM seq LIMIT 200) INSERT INTO test SELECT id FROM seq")
+
+	cases := []struct {
+		rawQuery       string
+		rangeHeader    string
+		expectedRows   int
+		expectedCapped bool
+	}{
+		{rawQuery: "limit=10000", expectedRows: 100, expectedCapped: true},
+		{rawQuery: "limit=-1", expectedRows: 100, expectedCapped: true},
+		{rawQuery: "limit=10", expectedRows: 10},
+		{rawQuery: "limit=100", expectedRows: 100},
+		{rangeHeader: "0-9999", expectedRows: 100, expectedCapped: true},
+		{rangeHeader: "150-", expectedRows: 50, expectedCapped: true},
+		{rangeHeader: "0-9", expectedRows: 10},
+	}
+
+	for _, c := range cases {
+		req := tc.NewRequest(t, http.MethodGet, "test?"+c.rawQuery, nil)
+		if c.rangeHeader != "" {
+			req.Header.Set("Range", c.rangeHeader)
+		}
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, c)
+
+		if c.expectedCapped {
+			assert.Equal(t, "true", resp.Header.Get("X-Capped-Limit"), c)
+		} else {
+			assert.Empty(t, resp.Header.Get("X-Capped-Limit"), c)
+		}
+
+		res, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		var rv []map[string]interface{}
+		tc.DecodeResult(t, res, &rv)
+		assert.Len(t, rv, c.expectedRows, c)
+	}
+}
+
+func TestSelect_FullTextSearch(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.SecurityOptions.EnabledTableOrViews = []string{"test", "test_fts"}
+	})
+	defer tc.CleanUp(t)
+
+	// NOTE: FTS5 requires building with sqlite_fts5 tag, while the MATCH syntax is the same as FTS4
+	tc.ExecuteSQL(t, "CREATE TABLE test (id integer primary key, title text, body text)")
+	tc.ExecuteSQL(t, `CREATE VIRTUAL TABLE test_fts USING fts4(content="test", title, body)`)
+	tc.ExecuteSQL(
+		t,
+		`INSERT INTO test (id, title, body) VALUES
+			(1, "sqlite", "a small and fast database engine"),
+			(2, "postgres", "an advanced open source database"),
+			(3, "go", "a programming language")`,
+	)
+	tc.ExecuteSQL(t, "INSERT INTO test_fts (test_fts) VALUES ('rebuild')")
+
+	cases := []struct {
+		table       string
+		rawQuery    string
+		expectedIDs []int
+	}{
+		{table: "test_fts", rawQuery: "select=id:rowid&test_fts=fts.database", expectedIDs: []int{1, 2}},
+		{table: "test_fts", rawQuery: "select=id:rowid&body=fts.programming", expectedIDs: []int{3}},
+		{table: "test_fts", rawQuery: "select=id:rowid&title=fts.database", expectedIDs: []int{}},
+		{table: "test", rawQuery: "select=id:rowid&fts_table=test_fts&body=fts.database", expectedIDs: []int{1, 2}},
+		{table: "test", rawQuery: "select=id:rowid&fts_table=test_fts&test_fts=fts.sqlite%20OR%20go", expectedIDs: []int{1, 3}},
+		{table: "test", rawQuery: "select=id:rowid&fts_table=test_fts&body=not.fts.database", expectedIDs: []int{3}},
+		{table: "test", rawQuery: "select=id:rowid&fts_table=test_fts&body=fts.database&id=gt.1", expectedIDs: []int{2}},
+	}
+
+	for _, c := range cases {
+		req := tc.NewRequest(t, http.MethodGet, c.table+"?order=rowid.asc&"+c.rawQuery, nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, c.rawQuery)
+
+		res, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		var rv []map[string]interface{}
+		tc.DecodeResult(t, res, &rv)
+		ids := make([]int, 0, len(rv))
+		for _, row := range rv {
+			ids = append(ids, int(row["id"].(float64)))
+		}
+		assert.Equal(t, c.expectedIDs, ids, c.rawQuery)
+	}
+
+	t.Log("fts table must be readable")
+	{
+		req := tc.NewRequest(t, http.MethodGet, "test?fts_table=sqlite_master&body=fts.database", nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+func TestSelect_CommonTableExpressions(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.SecurityOptions.AllowCommonTableExpressions = true
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+	tc.ExecuteSQL(t, "INSERT INTO test (id) VALUES (1), (2), (3), (4), (5)")
+	tc.ExecuteSQL(t, "CREATE VIEW test_view AS SELECT id FROM test")
+
+	query := func(t *testing.T, path string, rawQuery string) (*http.Response, []int) {
+		req := tc.NewRequest(t, http.MethodGet, path+"?order=id.asc&"+rawQuery, nil)
+		req.Header.Set("Prefer", "count=exact")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return resp, nil
+		}
+
+		res, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		var rv []map[string]interface{}
+		tc.DecodeResult(t, res, &rv)
+		ids := make([]int, 0, len(rv))
+		for _, row := range rv {
+			ids = append(ids, int(row["id"].(float64)))
+		}
+		return resp, ids
+	}
+
+	t.Log("not shadowing existing tables or views")
+	for _, rawQuery := range []string{
+		"with=" + url.QueryEscape("params as (select 1 as id)"),
+		"with=" + url.QueryEscape("params(id)as(select 1)") +
+			"&with=" + url.QueryEscape("odd(id)as(select id from params where id % 2 = 1)"),
+	} {
+		resp, ids := query(t, "test_view", rawQuery)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, rawQuery)
+		assert.Equal(t, []int{1, 2, 3, 4, 5}, ids, rawQuery)
+		assert.Equal(t, "5", resp.Header.Get("X-Total-Count"), rawQuery)
+	}
+
+	t.Log("shadowing the target or existing tables or views")
+	for _, with := range []string{
+		"test_view as (select id from test where id > 1)",
+		"TEST_VIEW(id)as(select id * 10 from test)",
+		"test as (select 1 as id)",
+		"Test as (select 1 as id)",
+	} {
+		resp, _ := query(t, "test_view", "with="+url.QueryEscape(with))
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, with)
+	}
+	{
+		rawQuery := "with=" + url.QueryEscape("params as (select 1 as id)") +
+			"&with=" + url.QueryEscape("test_view as (select id from params)")
+		resp, _ := query(t, "test_view", rawQuery)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, rawQuery)
+	}
+
+	t.Log("invalid with clause")
+	for _, with := range []string{
+		"params as (select 1); drop table test",
+		"params as (select 1) select 1 --)",
+		"params as (select id from test where id = ?)",
+		"params as (select 1)) select (1",
+		"select 1",
+	} {
+		resp, _ := query(t, "test_view", "with="+url.QueryEscape(with))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, with)
+	}
+
+	t.Log("disabled by default")
+	{
+		tc := createTestContextUsingInMemoryDB(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+		req := tc.NewRequest(t, http.MethodGet, "test?with="+url.QueryEscape("test as (select 1 as id)"), nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+func TestSelect_OrderCollation(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDB(t)
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+	tc.ExecuteSQL(t, "INSERT INTO test (id, s) VALUES (1, 'banana'), (2, 'Cherry'), (3, 'apple'), (4, 'Apricot'), (5, NULL)")
+
+	cases := []struct {
+		rawQuery    string
+		expectedIDs []float64
+	}{
+		{rawQuery: "order=s.nocase", expectedIDs: []float64{5, 3, 4, 1, 2}},
+		{rawQuery: "order=s.asc.nocase", expectedIDs: []float64{5, 3, 4, 1, 2}},
+		{rawQuery: "order=s.desc.nocase", expectedIDs: []float64{2, 1, 4, 3, 5}},
+		{rawQuery: "order=s.asc.nullslast.nocase", expectedIDs: []float64{3, 4, 1, 2, 5}},
+		{rawQuery: "order=s.asc.binary", expectedIDs: []float64{5, 4, 2, 3, 1}},
+	}
+
+	for _, c := range cases {
+		req := tc.NewRequest(t, http.MethodGet, "test?select=id&"+c.rawQuery, nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, c.rawQuery)
+
+		res, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		var rv []map[string]interface{}
+		tc.DecodeResult(t, res, &rv)
+		var ids []float64
+		for _, row := range rv {
+			ids = append(ids, row["id"].(float64))
+		}
+		assert.Equal(t, c.expectedIDs, ids, c.rawQuery)
+	}
+}
+
+func TestSelect_Functions(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDB(t)
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int, first text, last text)")
+	tc.ExecuteSQL(t, "INSERT INTO test (id, first, last) VALUES (1, 'Ada', 'Lovelace')")
+
+	selectRows := func(t *testing.T, selectParam string) (int, []map[string]interface{}) {
+		req := tc.NewRequest(t, http.MethodGet, "test?"+url.Values{"select": {selectParam}}.Encode(), nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		var rv []map[string]interface{}
+		if resp.StatusCode == http.StatusOK {
+			res, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			tc.DecodeResult(t, res, &rv)
+		}
+		return resp.StatusCode, rv
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		statusCode, rows := selectRows(t, "id,printf('%s, %s', last, first):full_name,initial:substr(first,1,1),upper(last)")
+		assert.Equal(t, http.StatusOK, statusCode)
+		if assert.Len(t, rows, 1) {
+			assert.Equal(t, map[string]interface{}{
+				"id":          float64(1),
+				"full_name":   "Lovelace, Ada",
+				"initial":     "A",
+				"upper(last)": "LOVELACE",
+			}, rows[0])
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, selectParam := range []string{
+			"load_extension('x')",
+			"lower((select name from sqlite_master))",
+			"lower(first) from test union select lower(last)",
+			"lower(first);drop table test",
+			"lower(first)--",
+			"lower(first/*)",
+			"lower(?)",
+			"lower('x)",
+			"lower(first))",
+			"lower(first):bad alias",
+		} {
+			statusCode, _ := selectRows(t, selectParam)
+			assert.Equal(t, http.StatusBadRequest, statusCode, selectParam)
+		}
+	})
+}
+
+func TestSelect_Streaming(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.StreamingThreshold = 10
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+
+	selectRows := func(t *testing.T) (*http.Response, []map[string]interface{}) {
+		req := tc.NewRequest(t, http.MethodGet, "test?order=id.asc", nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		res, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		var rv []map[string]interface{}
+		assert.NoError(t, json.Unmarshal(res, &rv), string(res))
+		return resp, rv
+	}
+
+	t.Log("buffered below threshold")
+	{
+		tc.ExecuteSQL(t, "WITH RECURSIVE seq(id) AS (SELECT 1 UNION ALL SELECT id + 1 FROM seq LIMIT 10) INSERT INTO test SELECT id, 's' || id FROM seq")
+
+		resp, rows := selectRows(t)
+		assert.Len(t, rows, 10)
+		assert.NotEmpty(t, resp.Header.Get("ETag"))
+	}
+
+	t.Log("streamed above threshold")
+	{
+		tc.ExecuteSQL(t, "WITH RECURSIVE seq(id) AS (SELECT 11 UNION ALL SELECT id + 1 FROM seq LIMIT 40) INSERT INTO test SELECT id, 's' || id FROM seq")
+
+		resp, rows := selectRows(t)
+		assert.Empty(t, resp.Header.Get("ETag"))
+		assert.Equal(t, int64(-1), resp.ContentLength)
+		assert.Contains(t, resp.TransferEncoding, "chunked")
+		if assert.Len(t, rows, 50) {
+			for idx, row := range rows {
+				assert.EqualValues(t, idx+1, row["id"])
+				assert.Equal(t, fmt.Sprintf("s%d", idx+1), row["s"])
+			}
+		}
+	}
+
+	t.Log("empty result above threshold")
+	{
+		req := tc.NewRequest(t, http.MethodGet, "test?id=gt.100", nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		res, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.JSONEq(t, "[]", string(res))
+	}
+}
+
+func TestSelect_StreamingReleasesConnection(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.StreamingThreshold = 10
+	})
+	defer tc.CleanUp(t)
+	// same as --db-max-open-conns=1
+	tc.DB().SetMaxOpenConns(1)
+
+	const rowsCount = 3*streamingPageSize + 10
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+	tc.ExecuteSQL(
+		t,
+		"WITH RECURSIVE seq(id) AS (SELECT 1 UNION ALL SELECT id + 1 FROM seq LIMIT ?) INSERT INTO test SELECT id, hex(randomblob(2048)) FROM seq",
+		rowsCount,
+	)
+
+	for _, accept := range []string{"application/json", "application/x-ndjson"} {
+		t.Run(accept, func(t *testing.T) {
+			req := tc.NewRequest(t, http.MethodGet, "test?order=id.asc", nil)
+			req.Header.Set("Accept", accept)
+			// avoid compression so the response doesn't fit in the socket buffers
+			req.Header.Set("Accept-Encoding", "identity")
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			t.Log("query while the streamed response is not read")
+			{
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				req := tc.NewRequest(t, http.MethodGet, "test?id=eq.1&select=id", nil).WithContext(ctx)
+				resp := tc.ExecuteRequest(t, req)
+				if assert.NotNil(t, resp) {
+					defer resp.Body.Close()
+					assert.Equal(t, http.StatusOK, resp.StatusCode)
+				}
+			}
+
+			b, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			var ids []int
+			if accept == "application/json" {
+				var rows []map[string]interface{}
+				assert.NoError(t, json.Unmarshal(b, &rows))
+				for _, row := range rows {
+					ids = append(ids, int(row["id"].(float64)))
+				}
+			} else {
+				for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+					var row map[string]interface{}
+					assert.NoError(t, json.Unmarshal([]byte(line), &row))
+					ids = append(ids, int(row["id"].(float64)))
+				}
+			}
+			if assert.Len(t, ids, rowsCount) {
+				for idx, id := range ids {
+					assert.Equal(t, idx+1, id)
+				}
+			}
+		})
+	}
+}
+
+func TestSelect_InListVariableLimit(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDB(t)
+	defer tc.CleanUp(t)
+
+	ctx := context.Background()
+	// :memory: database is per connection, the limit is also set per connection
+	conn, err := tc.DB().Conn(ctx)
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.NoError(t, conn.Raw(func(driverConn interface{}) error {
+		// the default SQLITE_MAX_VARIABLE_NUMBER of legacy SQLite versions
+		driverConn.(*sqlite3.SQLiteConn).SetLimit(sqlite3.SQLITE_LIMIT_VARIABLE_NUMBER, 999)
+		return nil
+	}))
+
+	_, err = conn.ExecContext(ctx, "CREATE TABLE test (id int)")
+	assert.NoError(t, err)
+	_, err = conn.ExecContext(ctx, "WITH RECURSIVE seq(id) AS (SELECT 1 UNION ALL SELECT id + 1 FROM seq LIMIT 1200) INSERT INTO test SELECT id FROM seq")
+	assert.NoError(t, err)
+
+	// 1, 3, 5, ... 1999
+	values := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		values = append(values, strconv.Itoa(i*2+1))
+	}
+	inList := "(" + strings.Join(values, ",") + ")"
+
+	t.Log("list bound as positional parameters exceeds the limit")
+	{
+		args := make([]interface{}, len(values))
+		for idx, v := range values {
+			args[idx] = v
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(values)), ",")
+		_, err := conn.QueryContext(ctx, "SELECT id FROM test WHERE id IN ("+placeholders+")", args...)
+		assert.ErrorContains(t, err, "too many SQL variables")
+	}
+
+	for _, c := range []struct {
+		filter   string
+		expected int
+	}{
+		{filter: "in." + inList, expected: 600},
+		{filter: "notin." + inList, expected: 600},
+		{filter: "not.in." + inList, expected: 600},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/test?id="+url.QueryEscape(c.filter), nil)
+		stmt, err := NewQueryCompilerFromRequest(req).CompileAsSelect("test")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, strings.Count(stmt.Query, "?"), stmt.Query)
+		assert.Len(t, stmt.Values, 1)
+
+		rows, err := conn.QueryContext(ctx, stmt.Query, stmt.Values...)
+		if !assert.NoError(t, err, c.filter) {
+			continue
+		}
+		count := 0
+		for rows.Next() {
+			count += 1
+		}
+		assert.NoError(t, rows.Err())
+		rows.Close()
+		assert.Equal(t, c.expected, count, c.filter)
+	}
 }
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableOrViewSubscribe(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.SubscribePollInterval = 20 * time.Millisecond
+	})
+	defer tc.CleanUp(t)
+	// :memory: database is per connection
+	tc.DB().SetMaxOpenConns(1)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id integer primary key, s text)")
+	tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (1, "a"), (2, "b")`)
+
+	dial := func(t *testing.T, path string, header http.Header) (*websocket.Conn, *http.Response, error) {
+		u := "ws" + strings.TrimPrefix(tc.ServerURL().String(), "http") + "/" + path
+		return websocket.DefaultDialer.Dial(u, header)
+	}
+
+	readDiff := func(t *testing.T, conn *websocket.Conn) map[string][]map[string]interface{} {
+		assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		var rv map[string][]map[string]interface{}
+		assert.NoError(t, conn.ReadJSON(&rv))
+		return rv
+	}
+
+	t.Run("diff", func(t *testing.T) {
+		conn, _, err := dial(t, "test/subscribe", nil)
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		assert.NoError(t, conn.WriteJSON(SubscriptionQuery{Query: "id=gt.1&order=id.asc"}))
+
+		t.Log("initial rows")
+		{
+			diff := readDiff(t, conn)
+			assert.Len(t, diff["added"], 1)
+			assert.EqualValues(t, 2, diff["added"][0]["id"])
+			assert.Empty(t, diff["removed"])
+			assert.Empty(t, diff["changed"])
+		}
+
+		t.Log("insert")
+		{
+			tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (3, "c")`)
+			// filtered out
+			tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (0, "z")`)
+
+			diff := readDiff(t, conn)
+			assert.Len(t, diff["added"], 1)
+			assert.EqualValues(t, 3, diff["added"][0]["id"])
+			assert.Equal(t, "c", diff["added"][0]["s"])
+			assert.Empty(t, diff["removed"])
+			assert.Empty(t, diff["changed"])
+		}
+
+		t.Log("update and delete")
+		{
+			tx := tc.DB().MustBegin()
+			tx.MustExec(`UPDATE test SET s = "bb" WHERE id = 2`)
+			tx.MustExec(`DELETE FROM test WHERE id = 3`)
+			assert.NoError(t, tx.Commit())
+
+			diff := readDiff(t, conn)
+			assert.Empty(t, diff["added"])
+			assert.Len(t, diff["changed"], 1)
+			assert.Equal(t, "bb", diff["changed"][0]["s"])
+			assert.Len(t, diff["removed"], 1)
+			assert.EqualValues(t, 3, diff["removed"][0]["id"])
+		}
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		conn, _, err := dial(t, "test/subscribe", nil)
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		assert.NoError(t, conn.WriteJSON(SubscriptionQuery{Query: "id=foo.1"}))
+
+		assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		var rv map[string]json.RawMessage
+		assert.NoError(t, conn.ReadJSON(&rv))
+		assert.Contains(t, rv, "error")
+	})
+
+	t.Run("no access", func(t *testing.T) {
+		tc.ExecuteSQL(t, "CREATE TABLE secret (id int)")
+
+		_, resp, err := dial(t, "secret/subscribe", nil)
+		assert.Error(t, err)
+		if assert.NotNil(t, resp) {
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		}
+	})
+
+	t.Run("origin not allowed", func(t *testing.T) {
+		tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+			opts.CORSOptions.AllowedOrigins = []string{"https://example.com"}
+		})
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+		u := "ws" + strings.TrimPrefix(tc.ServerURL().String(), "http") + "/test/subscribe"
+		_, resp, err := websocket.DefaultDialer.Dial(u, http.Header{"Origin": []string{"https://evil.com"}})
+		assert.Error(t, err)
+		if assert.NotNil(t, resp) {
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		}
+	})
+}
+
+func TestTableOrViewSubscribe_DisableIntrospection(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.SubscribePollInterval = 20 * time.Millisecond
+		opts.SecurityOptions.DisableIntrospection = true
+	})
+	defer tc.CleanUp(t)
+	// :memory: database is per connection
+	tc.DB().SetMaxOpenConns(1)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id integer primary key, s text)")
+	tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (1, "a")`)
+
+	subscribe := func(t *testing.T, query string) map[string]json.RawMessage {
+		u := "ws" + strings.TrimPrefix(tc.ServerURL().String(), "http") + "/test/subscribe"
+		conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		assert.NoError(t, conn.WriteJSON(SubscriptionQuery{Query: query}))
+		assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		var rv map[string]json.RawMessage
+		assert.NoError(t, conn.ReadJSON(&rv))
+		return rv
+	}
+
+	for _, query := range []string{
+		"select=" + url.QueryEscape("id,sqlite_master"),
+		"select=" + url.QueryEscape("id,length(pragma_table_info)"),
+		"select=" + url.QueryEscape("SQLITE_SCHEMA:s"),
+	} {
+		rv := subscribe(t, query)
+		if assert.Contains(t, rv, "error", query) {
+			assert.Contains(t, string(rv["error"]), "introspection is disabled", query)
+		}
+	}
+
+	rv := subscribe(t, "select=id,s")
+	assert.Contains(t, rv, "added")
+}
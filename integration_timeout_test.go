@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDriverNameWithSleep = "sqlite3_with_sleep"
+
+func init() {
+	sql.Register(testDriverNameWithSleep, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			// sleep(ms) blocks the query for the given milliseconds
+			return conn.RegisterFunc("sleep", func(ms int64) int64 {
+				time.Sleep(time.Duration(ms) * time.Millisecond)
+				return ms
+			}, false)
+		},
+	})
+}
+
+func TestRequestTimeout(t *testing.T) {
+	db, err := sqlx.Open(testDriverNameWithSleep, ":memory:")
+	assert.NoError(t, err)
+	// :memory: database is per connection
+	db.SetMaxOpenConns(1)
+
+	serverOpts := &ServerOptions{
+		Logger:         createTestLogger(t).WithName("test"),
+		Queryer:        db,
+		Execer:         db,
+		RequestTimeout: 100 * time.Millisecond,
+	}
+	serverOpts.AuthOptions.disableAuth = true
+	serverOpts.SecurityOptions.EnabledTableOrViews = enabledTestTables
+	server, err := NewServer(serverOpts)
+	assert.NoError(t, err)
+
+	tc := NewTestContextWithDB(t, server.server.Handler, db, func(t testing.TB) {
+		assert.NoError(t, db.Close())
+	}, "")
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test_data (id int)")
+	tc.ExecuteSQL(t, "INSERT INTO test_data (id) VALUES (1), (2), (3), (4), (5)")
+	tc.ExecuteSQL(t, "CREATE VIEW test AS SELECT id FROM test_data")
+	tc.ExecuteSQL(t, "CREATE VIEW test_view AS SELECT id, sleep(50) AS slept FROM test_data")
+
+	t.Log("fast query")
+	{
+		req := tc.NewRequest(t, http.MethodGet, "test", nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	t.Log("slow query")
+	{
+		req := tc.NewRequest(t, http.MethodGet, "test_view", nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	}
+}
+
+func TestClientDisconnect(t *testing.T) {
+	db, err := sqlx.Open(testDriverNameWithSleep, ":memory:")
+	assert.NoError(t, err)
+	// :memory: database is per connection
+	db.SetMaxOpenConns(1)
+
+	serverOpts := &ServerOptions{
+		Logger:  createTestLogger(t).WithName("test"),
+		Queryer: db,
+		Execer:  db,
+	}
+	serverOpts.AuthOptions.disableAuth = true
+	serverOpts.SecurityOptions.EnabledTableOrViews = enabledTestTables
+	server, err := NewServer(serverOpts)
+	assert.NoError(t, err)
+
+	tc := NewTestContextWithDB(t, server.server.Handler, db, func(t testing.TB) {
+		assert.NoError(t, db.Close())
+	}, "")
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test_data (id int)")
+	// 200 rows * 50ms = 10s
+	tc.ExecuteSQL(t, `INSERT INTO test_data (id)
+		WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 200) SELECT x FROM c`)
+	tc.ExecuteSQL(t, "CREATE VIEW test_view AS SELECT id, sleep(50) AS slept FROM test_data")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/test_view", nil).WithContext(ctx)
+
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		server.server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("query is not cancelled after client disconnected")
+	}
+
+	t.Log("connection is released")
+	{
+		var count int
+		assert.NoError(t, db.Get(&count, "SELECT count(*) FROM test_data"))
+		assert.Equal(t, 200, count)
+	}
+}
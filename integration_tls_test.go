@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLS(t *testing.T) {
+	t.Run("test server", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContextUsingInMemoryDBWithTLS(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+		tc.ExecuteSQL(t, "INSERT INTO test (id) VALUES (1)")
+
+		assert.Equal(t, "https", tc.ServerURL().Scheme)
+
+		req := tc.NewRequest(t, http.MethodGet, "test", nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotNil(t, resp.TLS)
+		assert.True(t, resp.TLS.HandshakeComplete)
+
+		res, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		var rv []map[string]interface{}
+		tc.DecodeResult(t, res, &rv)
+		assert.Equal(t, []map[string]interface{}{{"id": float64(1)}}, rv)
+	})
+
+	t.Run("start server", func(t *testing.T) {
+		t.Parallel()
+		certFile, keyFile := generateSelfSignedCert(t, t.TempDir())
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		addr := l.Addr().String()
+		assert.NoError(t, l.Close())
+
+		tc := createTestContextUsingInMemoryDB(t)
+		defer tc.CleanUp(t)
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+		server, err := NewServer(&ServerOptions{
+			Logger:          createTestLogger(t).WithName("test"),
+			Addr:            addr,
+			TLSCertFile:     certFile,
+			TLSKeyFile:      keyFile,
+			Queryer:         tc.DB(),
+			Execer:          tc.DB(),
+			AuthOptions:     ServerAuthOptions{disableAuth: true},
+			SecurityOptions: ServerSecurityOptions{EnabledTableOrViews: enabledTestTables},
+		})
+		assert.NoError(t, err)
+
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			server.Start(done)
+		}()
+		defer func() {
+			close(done)
+			<-stopped
+		}()
+
+		client := createTLSTestClient(t, certFile)
+		var resp *http.Response
+		assert.Eventually(t, func() bool {
+			resp, err = client.Get("https://" + addr + "/test")
+			return err == nil
+		}, 5*time.Second, 50*time.Millisecond)
+		if resp == nil {
+			return
+		}
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotNil(t, resp.TLS)
+
+		t.Log("plain HTTP request should be rejected")
+		plainResp, err := http.Get("http://" + addr + "/test")
+		if err == nil {
+			defer plainResp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, plainResp.StatusCode)
+		}
+	})
+
+	t.Run("missing key file", func(t *testing.T) {
+		opts := &ServerOptions{TLSCertFile: "tls.crt"}
+		assert.Error(t, opts.defaults())
+	})
+}
@@ -2,7 +2,11 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -104,6 +108,99 @@ func testUpdate_SingleTable(t *testing.T, createTestContext func(t testing.TB) *
 			assert.EqualValues(t, string('b'+rune(idx)), row["s"])
 		}
 	})
+
+	t.Run("UpdateCSV", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+		tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (1, "a"), (2, "a")`)
+
+		b := bytes.NewBufferString("s\nb\n")
+		req := tc.NewRequest(t, http.MethodPatch, "test?id=eq.1", b)
+		req.Header.Set("Content-Type", "text/csv")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		client := tc.Client()
+		res, _, err := client.From("test").Select("s", "", false).
+			Execute()
+		assert.NoError(t, err)
+
+		var rv []map[string]interface{}
+		tc.DecodeResult(t, res, &rv)
+		assert.Equal(t, []map[string]interface{}{{"s": "b"}, {"s": "a"}}, rv)
+	})
+
+	t.Run("RowsAffected", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+		tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (1, "a"), (1, "a"), (2, "a")`)
+
+		cases := []struct {
+			method   string
+			filter   string
+			expected string
+		}{
+			{method: http.MethodPatch, filter: "eq.1", expected: "2"},
+			{method: http.MethodPatch, filter: "eq.100", expected: "0"},
+			{method: http.MethodPut, filter: "eq.2", expected: "1"},
+			{method: http.MethodPut, filter: "eq.100", expected: "0"},
+		}
+
+		for _, c := range cases {
+			b := bytes.NewBufferString(`{"s": "b"}`)
+			req := tc.NewRequest(t, c.method, "test", b)
+			req.Header.Set("Content-Type", "application/json")
+			q := req.URL.Query()
+			q.Set("id", c.filter)
+			req.URL.RawQuery = q.Encode()
+
+			resp := tc.ExecuteRequest(t, req)
+			resp.Body.Close()
+
+			assert.Equal(t, c.expected, resp.Header.Get("X-Rows-Affected"), "%s id=%s", c.method, c.filter)
+		}
+	})
+
+	t.Run("MaxAffected", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+		tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (1, "a"), (2, "a"), (3, "a")`)
+
+		updateWithMaxAffected := func(t *testing.T, filter string) *http.Response {
+			req := tc.NewRequest(t, http.MethodPatch, "test", bytes.NewBufferString(`{"s": "b"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Prefer", "max-affected=2")
+			q := req.URL.Query()
+			q.Set("id", filter)
+			req.URL.RawQuery = q.Encode()
+			return tc.ExecuteRequest(t, req)
+		}
+		countUpdated := func(t *testing.T) int {
+			var count int
+			assert.NoError(t, tc.DB().Get(&count, `SELECT count(*) FROM test WHERE s = "b"`))
+			return count
+		}
+
+		resp := updateWithMaxAffected(t, "gt.0")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, 0, countUpdated(t))
+
+		resp = updateWithMaxAffected(t, "gt.1")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, 2, countUpdated(t))
+	})
 }
 
 func TestUpdate_SingleTable(t *testing.T) {
@@ -118,4 +215,323 @@ func TestUpdate_SingleTable(t *testing.T) {
 	t.Run("RSA token auth", func(t *testing.T) {
 		testUpdate_SingleTable(t, createTestContextWithRSATokenAuth)
 	})
+
+	t.Run("ECDSA token auth", func(t *testing.T) {
+		testUpdate_SingleTable(t, createTestContextWithECDSATokenAuth)
+	})
+
+	t.Run("Ed25519 token auth", func(t *testing.T) {
+		testUpdate_SingleTable(t, createTestContextWithEd25519TokenAuth)
+	})
+}
+
+func TestUpdate_MergePatch(t *testing.T) {
+	createTestContext := func(t testing.TB) *TestContext {
+		tc := createTestContextUsingInMemoryDB(t)
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text, n int)")
+		tc.ExecuteSQL(t, `INSERT INTO test (id, s, n) VALUES (1, "a", 10), (2, "b", 20)`)
+		return tc
+	}
+
+	patch := func(t *testing.T, tc *TestContext, contentType string, body string) *http.Response {
+		req := tc.NewRequest(t, http.MethodPatch, "test?id=eq.1", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		return tc.ExecuteRequest(t, req)
+	}
+
+	queryRows := func(t *testing.T, tc *TestContext) []map[string]interface{} {
+		var rv []map[string]interface{}
+		rows, err := tc.DB().Queryx("SELECT id, s, n FROM test ORDER BY id")
+		assert.NoError(t, err)
+		defer rows.Close()
+		for rows.Next() {
+			row := map[string]interface{}{}
+			assert.NoError(t, rows.MapScan(row))
+			rv = append(rv, row)
+		}
+		return rv
+	}
+
+	t.Run("NullAndAbsentKeys", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		resp := patch(t, tc, "application/merge-patch+json", `{"s": null, "n": 11}`)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, "1", resp.Header.Get("X-Rows-Affected"))
+
+		rows := queryRows(t, tc)
+		assert.Len(t, rows, 2)
+		// null deletes the value, absent key remains unchanged
+		assert.EqualValues(t, 1, rows[0]["id"])
+		assert.Nil(t, rows[0]["s"])
+		assert.EqualValues(t, 11, rows[0]["n"])
+		// filtered out row remains unchanged
+		assert.EqualValues(t, "b", rows[1]["s"])
+		assert.EqualValues(t, 20, rows[1]["n"])
+	})
+
+	t.Run("UnknownColumn", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		resp := patch(t, tc, "application/merge-patch+json", `{"foo": 1}`)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("InvalidPatch", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		for _, body := range []string{`[{"s": "c"}]`, `null`, `{}`, `{"s": {"a": 1}}`} {
+			resp := patch(t, tc, "application/merge-patch+json", body)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+		}
+	})
+
+	t.Run("ContentTypeMismatch", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		// unknown column is not validated for plain JSON update
+		resp := patch(t, tc, "application/json", `{"foo": 1}`)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+		resp = patch(t, tc, "application/json", `{"s": null}`)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	})
+}
+
+func TestUpdate_JSONPatch(t *testing.T) {
+	createTestContext := func(t testing.TB) *TestContext {
+		tc := createTestContextUsingInMemoryDB(t)
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text, n int)")
+		tc.ExecuteSQL(t, `INSERT INTO test (id, s, n) VALUES (1, "a", 10), (2, "b", 20)`)
+		return tc
+	}
+
+	patch := func(t *testing.T, tc *TestContext, body string) *http.Response {
+		req := tc.NewRequest(t, http.MethodPatch, "test?id=eq.1", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json-patch+json")
+		return tc.ExecuteRequest(t, req)
+	}
+
+	queryRow := func(t *testing.T, tc *TestContext, id int) map[string]interface{} {
+		row := map[string]interface{}{}
+		err := tc.DB().QueryRowx("SELECT s, n FROM test WHERE id = ?", id).MapScan(row)
+		assert.NoError(t, err)
+		return row
+	}
+
+	cases := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedRow    map[string]interface{}
+	}{
+		{
+			name:           "Add",
+			body:           `[{"op": "add", "path": "/s", "value": "c"}]`,
+			expectedStatus: http.StatusAccepted,
+			expectedRow:    map[string]interface{}{"s": "c", "n": int64(10)},
+		},
+		{
+			name:           "Replace",
+			body:           `[{"op": "replace", "path": "/n", "value": 11}]`,
+			expectedStatus: http.StatusAccepted,
+			expectedRow:    map[string]interface{}{"s": "a", "n": int64(11)},
+		},
+		{
+			name:           "Remove",
+			body:           `[{"op": "remove", "path": "/s"}]`,
+			expectedStatus: http.StatusAccepted,
+			expectedRow:    map[string]interface{}{"s": nil, "n": int64(10)},
+		},
+		{
+			name:           "TestPassed",
+			body:           `[{"op": "test", "path": "/s", "value": "a"}, {"op": "replace", "path": "/s", "value": "c"}]`,
+			expectedStatus: http.StatusAccepted,
+			expectedRow:    map[string]interface{}{"s": "c", "n": int64(10)},
+		},
+		{
+			name:           "TestFailed",
+			body:           `[{"op": "test", "path": "/s", "value": "b"}, {"op": "replace", "path": "/s", "value": "c"}]`,
+			expectedStatus: http.StatusConflict,
+			expectedRow:    map[string]interface{}{"s": "a", "n": int64(10)},
+		},
+		{
+			name: "Mixed",
+			body: `[
+				{"op": "test", "path": "/n", "value": 10},
+				{"op": "replace", "path": "/n", "value": 12},
+				{"op": "test", "path": "/n", "value": 12},
+				{"op": "add", "path": "/s", "value": "c"},
+				{"op": "remove", "path": "/s"}
+			]`,
+			expectedStatus: http.StatusAccepted,
+			expectedRow:    map[string]interface{}{"s": nil, "n": int64(12)},
+		},
+		{
+			name:           "TestFailedAfterReplace",
+			body:           `[{"op": "replace", "path": "/n", "value": 12}, {"op": "test", "path": "/n", "value": 10}]`,
+			expectedStatus: http.StatusConflict,
+			expectedRow:    map[string]interface{}{"s": "a", "n": int64(10)},
+		},
+		{
+			name:           "UnknownColumn",
+			body:           `[{"op": "add", "path": "/foo", "value": 1}]`,
+			expectedStatus: http.StatusBadRequest,
+			expectedRow:    map[string]interface{}{"s": "a", "n": int64(10)},
+		},
+		{
+			name:           "NestedPath",
+			body:           `[{"op": "add", "path": "/s/0", "value": 1}]`,
+			expectedStatus: http.StatusBadRequest,
+			expectedRow:    map[string]interface{}{"s": "a", "n": int64(10)},
+		},
+		{
+			name:           "UnsupportedOperation",
+			body:           `[{"op": "move", "from": "/s", "path": "/n"}]`,
+			expectedStatus: http.StatusBadRequest,
+			expectedRow:    map[string]interface{}{"s": "a", "n": int64(10)},
+		},
+		{
+			name:           "InvalidDocument",
+			body:           `{"op": "add", "path": "/s", "value": "c"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedRow:    map[string]interface{}{"s": "a", "n": int64(10)},
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			tc := createTestContext(t)
+			defer tc.CleanUp(t)
+
+			resp := patch(t, tc, c.body)
+			defer resp.Body.Close()
+			assert.Equal(t, c.expectedStatus, resp.StatusCode)
+
+			assert.Equal(t, c.expectedRow, queryRow(t, tc, 1))
+			// filtered out row remains unchanged
+			assert.Equal(t, map[string]interface{}{"s": "b", "n": int64(20)}, queryRow(t, tc, 2))
+		})
+	}
+}
+
+func TestUpdate_BeforeUpdateHook(t *testing.T) {
+	t.Parallel()
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.BeforeUpdate = func(table string, data map[string]interface{}) error {
+			if id, ok := data["id"].(float64); ok && id < 0 {
+				return errors.New("id must be non-negative")
+			}
+			return nil
+		}
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+	tc.ExecuteSQL(t, "INSERT INTO test (id) VALUES (1)")
+
+	cases := []struct {
+		name           string
+		contentType    string
+		body           string
+		expectedStatus int
+	}{
+		{"JSON", "application/json", `{"id": -1}`, http.StatusBadRequest},
+		{"MergePatch", "application/merge-patch+json", `{"id": -1}`, http.StatusBadRequest},
+		{"JSONPatch", "application/json-patch+json", `[{"op": "replace", "path": "/id", "value": -1}]`, http.StatusBadRequest},
+		{"Valid", "application/json", `{"id": 2}`, http.StatusAccepted},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := tc.NewRequest(t, http.MethodPatch, "test", bytes.NewBufferString(c.body))
+			req.Header.Set("Content-Type", c.contentType)
+			resp := tc.ExecuteRequest(t, req)
+			defer resp.Body.Close()
+
+			assert.Equal(t, c.expectedStatus, resp.StatusCode)
+			if c.expectedStatus == http.StatusBadRequest {
+				var body map[string]interface{}
+				assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+				assert.Equal(t, "id must be non-negative", body["hint"])
+			}
+		})
+	}
+
+	var id int
+	assert.NoError(t, tc.DB().Get(&id, "SELECT id FROM test"))
+	assert.Equal(t, 2, id)
+}
+
+func TestUpdate_Arithmetic(t *testing.T) {
+	// concurrent requests are served by multiple connections, hence using file db
+	dsn := "//" + filepath.Join(t.TempDir(), "test.db")
+	db := openTestDB(t, "--db-dsn", dsn)
+	server, err := NewServer(&ServerOptions{
+		Logger:          createTestLogger(t).WithName("test"),
+		Queryer:         db,
+		Execer:          db,
+		SecurityOptions: ServerSecurityOptions{EnabledTableOrViews: enabledTestTables},
+		AuthOptions:     ServerAuthOptions{disableAuth: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := NewTestContextWithDB(t, server.server.Handler, db, func(t testing.TB) {
+		assert.NoError(t, db.Close())
+	}, "")
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int, count int, score real, s text)")
+	tc.ExecuteSQL(t, "INSERT INTO test (id, count, score, s) VALUES (1, 10, 1.5, 'a')")
+
+	patch := func(t testing.TB, body string) {
+		req := tc.NewRequest(t, http.MethodPatch, "test?id=eq.1", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			patch(t, `{"count": "add.1"}`)
+		}()
+	}
+	wg.Wait()
+
+	var count int
+	assert.NoError(t, tc.DB().QueryRow("SELECT count FROM test WHERE id = 1").Scan(&count))
+	assert.Equal(t, 110, count)
+
+	patch(t, `{"count": "subtract.3", "score": "add.0.25", "s": "add.b"}`)
+
+	var (
+		score float64
+		s     string
+	)
+	assert.NoError(t, tc.DB().QueryRow("SELECT count, score, s FROM test WHERE id = 1").Scan(&count, &score, &s))
+	assert.Equal(t, 107, count)
+	assert.Equal(t, 1.75, score)
+	// non-numeric operand is set as is
+	assert.Equal(t, "add.b", s)
 }
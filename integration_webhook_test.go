@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type webhookTestReceiver struct {
+	server *httptest.Server
+	events chan WebhookEvent
+	// failures is the number of requests to fail before accepting.
+	failures atomic.Int32
+}
+
+func newWebhookTestReceiver(t testing.TB, secret string) *webhookTestReceiver {
+	rv := &webhookTestReceiver{events: make(chan WebhookEvent, 16)}
+	rv.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		assert.NoError(t, err)
+
+		signature := req.Header.Get(headerNameWebhookSignature)
+		if !hmac.Equal([]byte(signature), []byte(signWebhookPayload(secret, body))) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if rv.failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var event WebhookEvent
+		assert.NoError(t, json.Unmarshal(body, &event))
+		rv.events <- event
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return rv
+}
+
+func (r *webhookTestReceiver) Next(t testing.TB) WebhookEvent {
+	select {
+	case event := <-r.events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook event not received")
+		return WebhookEvent{}
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	t.Parallel()
+
+	const secret = "webhook-secret"
+	receiver := newWebhookTestReceiver(t, secret)
+	defer receiver.server.Close()
+
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.WebhookURL = receiver.server.URL
+		opts.WebhookSecret = secret
+		opts.ReturnLocation = true
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text, n int DEFAULT 10)")
+
+	t.Log("insert")
+	{
+		req := tc.NewRequest(t, http.MethodPost, "test", strings.NewReader(`[{"id": 1, "s": "a"}, {"id": 2, "s": "b"}]`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, "/test?rowid=eq.2", resp.Header.Get("Location"))
+
+		event := receiver.Next(t)
+		assert.Equal(t, "insert", event.Operation)
+		assert.Equal(t, "test", event.Table)
+		assert.EqualValues(t, map[string]interface{}{"id": float64(1), "s": "a", "n": float64(10)}, event.Data)
+
+		event = receiver.Next(t)
+		assert.Equal(t, "insert", event.Operation)
+		assert.EqualValues(t, map[string]interface{}{"id": float64(2), "s": "b", "n": float64(10)}, event.Data)
+	}
+
+	t.Log("update")
+	{
+		req := tc.NewRequest(t, http.MethodPatch, "test?id=eq.1", strings.NewReader(`{"s": "aa"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		event := receiver.Next(t)
+		assert.Equal(t, "update", event.Operation)
+		assert.EqualValues(t, map[string]interface{}{"id": float64(1), "s": "aa", "n": float64(10)}, event.Data)
+		assert.Equal(t, "id=eq.1", event.Filter)
+	}
+
+	t.Log("no rows written")
+	{
+		req := tc.NewRequest(t, http.MethodPatch, "test?id=eq.100", strings.NewReader(`{"s": "aa"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		req = tc.NewRequest(t, http.MethodDelete, "test?id=eq.100", nil)
+		resp = tc.ExecuteRequest(t, req)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		select {
+		case event := <-receiver.events:
+			t.Fatalf("unexpected webhook event: %v", event)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	t.Log("delete with retry")
+	{
+		receiver.failures.Store(1)
+
+		req := tc.NewRequest(t, http.MethodDelete, "test?id=eq.2", nil)
+		resp := tc.ExecuteRequest(t, req)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		event := receiver.Next(t)
+		assert.Equal(t, "delete", event.Operation)
+		assert.EqualValues(t, map[string]interface{}{"id": float64(2), "s": "b", "n": float64(10)}, event.Data)
+		assert.Equal(t, "id=eq.2", event.Filter)
+	}
+
+	t.Log("ordered")
+	{
+		for i := 10; i < 30; i++ {
+			req := tc.NewRequest(t, http.MethodPost, "test", strings.NewReader(fmt.Sprintf(`{"id": %d}`, i)))
+			req.Header.Set("Content-Type", "application/json")
+			resp := tc.ExecuteRequest(t, req)
+			assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		}
+		for i := 10; i < 30; i++ {
+			event := receiver.Next(t)
+			assert.Equal(t, float64(i), event.Data.(map[string]interface{})["id"])
+		}
+	}
+
+	t.Log("failed write")
+	{
+		req := tc.NewRequest(t, http.MethodPost, "test", strings.NewReader(`{"unknown": 1}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+		select {
+		case event := <-receiver.events:
+			t.Fatalf("unexpected webhook event: %v", event)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func TestWebhook_InvalidSignature(t *testing.T) {
+	t.Parallel()
+
+	receiver := newWebhookTestReceiver(t, "secret")
+	defer receiver.server.Close()
+
+	payload := []byte(`{"operation":"insert","table":"test"}`)
+	assert.NotEqual(t, signWebhookPayload("secret", payload), signWebhookPayload("other-secret", payload))
+
+	req, err := http.NewRequest(http.MethodPost, receiver.server.URL, strings.NewReader(string(payload)))
+	assert.NoError(t, err)
+	req.Header.Set(headerNameWebhookSignature, signWebhookPayload("other-secret", payload))
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
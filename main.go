@@ -8,9 +8,16 @@ import (
 )
 
 const (
-	cliFlagDBDSN    = "db-dsn"
-	cliFlagLogLevel = "log-level"
-	cliFlagLogDevel = "log-devel"
+	cliFlagDBDSN          = "db-dsn"
+	cliFlagDBMaxOpenConns = "db-max-open-conns"
+	cliFlagDBMaxIdleConns = "db-max-idle-conns"
+	cliFlagDBBusyTimeout  = "db-busy-timeout"
+	cliFlagDBWAL          = "db-wal"
+	cliFlagDBForeignKeys  = "db-foreign-keys"
+	cliFlagDBInitSQL      = "db-init-sql"
+	cliFlagDBSynchronous  = "db-synchronous"
+	cliFlagLogLevel       = "log-level"
+	cliFlagLogDevel       = "log-devel"
 )
 
 func bindDBDSNFlag(fs *pflag.FlagSet) {
@@ -22,16 +29,43 @@ func createMainCmd() *cobra.Command {
 		Use:          "sqlite-rest",
 		Short:        "Serve a RESTful API from a SQLite database",
 		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return loadConfig(cmd)
+		},
 	}
 
+	bindConfigFlag(cmd.PersistentFlags())
+
 	cmd.PersistentFlags().
 		Int8(cliFlagLogLevel, 5, "Log level to use. Use 8 or more for verbose log.")
 	cmd.PersistentFlags().
 		Bool(cliFlagLogDevel, false, "Enable devel log format?")
+	// NOTE: SQLite allows only one writer at a time, hence defaults to single connection
+	// to avoid lock contention.
+	cmd.PersistentFlags().
+		Int(cliFlagDBMaxOpenConns, 1, "Maximum number of open database connections. 0 means unlimited.")
+	cmd.PersistentFlags().
+		Int(cliFlagDBMaxIdleConns, 1, "Maximum number of idle database connections. 0 means no idle connections are retained.")
+	cmd.PersistentFlags().
+		Duration(cliFlagDBBusyTimeout, 0, "Time to wait for a locked database before returning SQLITE_BUSY. 0 means using the driver default.")
+	cmd.PersistentFlags().
+		Bool(cliFlagDBWAL, false, "Enable WAL journal mode on startup?")
+	cmd.PersistentFlags().
+		Bool(cliFlagDBForeignKeys, false, "Enforce foreign key constraints?")
+	cmd.PersistentFlags().
+		String(cliFlagDBSynchronous, "", "PRAGMA synchronous setting of the database connections: off, normal, full or extra. Empty value means using the SQLite default.")
+	cmd.PersistentFlags().
+		String(cliFlagDBInitSQL, "", "Semicolon-separated SQL statements to execute on each new database connection.")
 
 	cmd.AddCommand(
 		createServeCmd(),
 		createMigrateCmd(),
+		createSchemaCmd(),
+		createBackupCmd(),
+		createCheckCmd(),
+		createExportCmd(),
+		createImportCmd(),
+		createVersionCmd(),
 	)
 
 	cmd.CompletionOptions.DisableDefaultCmd = true
@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/pprof"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -24,12 +28,11 @@ func init() {
 }
 
 const metricsServerDisabledAddr = ""
-const pprofServerDisabledAddr = ""
 
 type MetricsServerOptions struct {
-	Logger  logr.Logger
-	Addr    string
-	Queryer sqlx.QueryerContext
+	Logger logr.Logger
+	Addr   string
+	DB     *sqlx.DB
 }
 
 func (opts *MetricsServerOptions) bindCLIFlags(fs *pflag.FlagSet) {
@@ -45,8 +48,8 @@ func (opts *MetricsServerOptions) defaults() error {
 	}
 
 	if opts.Addr != metricsServerDisabledAddr {
-		if opts.Queryer == nil {
-			return fmt.Errorf(".Queryer is required")
+		if opts.DB == nil {
+			return fmt.Errorf(".DB is required")
 		}
 	}
 
@@ -54,9 +57,9 @@ func (opts *MetricsServerOptions) defaults() error {
 }
 
 type metricsServer struct {
-	logger  logr.Logger
-	server  *http.Server
-	queryer sqlx.QueryerContext
+	logger logr.Logger
+	server *http.Server
+	db     *sqlx.DB
 }
 
 func NewMetricsServer(opts MetricsServerOptions) (*metricsServer, error) {
@@ -65,8 +68,8 @@ func NewMetricsServer(opts MetricsServerOptions) (*metricsServer, error) {
 	}
 
 	srv := &metricsServer{
-		logger:  opts.Logger,
-		queryer: opts.Queryer,
+		logger: opts.Logger,
+		db:     opts.DB,
 	}
 
 	if opts.Addr == metricsServerDisabledAddr {
@@ -93,7 +96,7 @@ func (server *metricsServer) monitorDatabaseSize(
 
 	observe := func() {
 		var size int64
-		err := server.queryer.QueryRowxContext(context.Background(), dbSizeQuery).Scan(&size)
+		err := server.db.QueryRowxContext(context.Background(), dbSizeQuery).Scan(&size)
 		if err != nil {
 			server.logger.Error(err, "failed to get database size")
 			return
@@ -115,6 +118,76 @@ func (server *metricsServer) monitorDatabaseSize(
 	}
 }
 
+// monitorWALSize estimates the size of the WAL file from the number of frames in the WAL.
+// The size is observed only if the database is in WAL journal mode.
+func (server *metricsServer) monitorWALSize(
+	done <-chan struct{},
+	observeFn func(sizeInBytes float64),
+) {
+	observe := func() {
+		ctx := context.Background()
+
+		var journalMode string
+		if err := server.db.QueryRowxContext(ctx, "PRAGMA journal_mode").Scan(&journalMode); err != nil {
+			server.logger.Error(err, "failed to get journal mode")
+			return
+		}
+		if !strings.EqualFold(journalMode, "wal") {
+			return
+		}
+
+		checkpoint, err := walCheckpoint(ctx, server.db, walCheckpointModePassive)
+		if err != nil {
+			server.logger.Error(err, "failed to checkpoint WAL")
+			return
+		}
+		var pageSize int64
+		if err := server.db.QueryRowxContext(ctx, "PRAGMA page_size").Scan(&pageSize); err != nil {
+			server.logger.Error(err, "failed to get page size")
+			return
+		}
+
+		observeFn(float64(checkpoint.Log * pageSize))
+	}
+	observe()
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			observe()
+		}
+	}
+}
+
+func (server *metricsServer) monitorDBStats(
+	done <-chan struct{},
+	observeFn func(stats sql.DBStats),
+) {
+	observeFn(server.db.Stats())
+
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			observeFn(server.db.Stats())
+		}
+	}
+}
+
+func observeDBStats(stats sql.DBStats) {
+	metricsDBOpenConnections.Set(float64(stats.OpenConnections))
+	metricsDBIdleConnections.Set(float64(stats.Idle))
+	metricsDBInUseConnections.Set(float64(stats.InUse))
+	metricsDBWaitCount.Set(float64(stats.WaitCount))
+}
+
 func (server *metricsServer) Start(done <-chan struct{}) {
 	if server.server == nil {
 		server.logger.V(8).Info("metrics server is disabled")
@@ -125,6 +198,11 @@ func (server *metricsServer) Start(done <-chan struct{}) {
 		metricsDatabaseSize.Set(sizeInBytes)
 		server.logger.V(8).Info("database size", "sizeInBytes", sizeInBytes)
 	})
+	go server.monitorWALSize(done, func(sizeInBytes float64) {
+		metricsWALSizeBytes.Set(sizeInBytes)
+		server.logger.V(8).Info("WAL size", "sizeInBytes", sizeInBytes)
+	})
+	go server.monitorDBStats(done, observeDBStats)
 	go server.server.ListenAndServe()
 
 	server.logger.Info("metrics server started", "addr", server.server.Addr)
@@ -160,6 +238,22 @@ var (
 		},
 	)
 
+	metricsRateLimitedRequestsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "rate_limited_requests_total",
+			Help:      "Total number of rate limited requests",
+		},
+	)
+
+	metricsActiveConcurrentRequests = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "active_concurrent_requests",
+			Help:      "Number of requests in flight when concurrent request limit is enabled",
+		},
+	)
+
 	metricsRequestTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: metricsNamespace,
@@ -179,6 +273,56 @@ var (
 		[]string{metricsLabelTarget, metricsLabelTargetOperation, metricsLabelHTTPCode},
 	)
 
+	metricsWALSizeBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "wal_size_bytes",
+			Help:      "Estimated size of the WAL file",
+		},
+	)
+
+	metricsDBOpenConnections = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "db_open_connections",
+			Help:      "Number of established database connections, both in use and idle",
+		},
+	)
+
+	metricsDBIdleConnections = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "db_idle_connections",
+			Help:      "Number of idle database connections",
+		},
+	)
+
+	metricsDBInUseConnections = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "db_in_use_connections",
+			Help:      "Number of database connections currently in use",
+		},
+	)
+
+	metricsDBWaitCount = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "db_wait_count",
+			Help:      "Total number of waits for a database connection",
+		},
+	)
+
+	metricsQueryRowsReturned = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "query_rows_returned",
+			Help:      "Number of rows returned or affected by the query",
+			Buckets:   []float64{0, 1, 10, 100, 1000, 10000},
+		},
+		[]string{metricsLabelTarget, metricsLabelTargetOperation},
+	)
+
 	metricsDatabaseSize = promauto.NewGauge(
 		prometheus.GaugeOpts{
 			Namespace: metricsNamespace,
@@ -212,14 +356,21 @@ func recordRequestMetrics(op string) func(http.Handler) http.Handler {
 
 type PprofServerOptions struct {
 	Logger logr.Logger
-	Addr   string
+	// Addr is the pprof server listen address. Nil value means disabled.
+	Addr *string
+	// Token is the bearer token for accessing the pprof endpoints. Empty value means no auth.
+	Token string
 }
 
 func (opts *PprofServerOptions) bindCLIFlags(fs *pflag.FlagSet) {
-	fs.StringVar(
-		&opts.Addr, "pprof-addr", pprofServerDisabledAddr,
+	fs.Var(
+		&optionalStringValue{p: &opts.Addr}, "pprof-addr",
 		"pprof server listen address. Empty value means disabled.",
 	)
+	fs.StringVar(
+		&opts.Token, "pprof-token", "",
+		"bearer token for accessing the pprof endpoints. Empty value means no auth.",
+	)
 }
 
 func (opts *PprofServerOptions) defaults() error {
@@ -227,9 +378,46 @@ func (opts *PprofServerOptions) defaults() error {
 		opts.Logger = logr.Discard()
 	}
 
+	if opts.Addr != nil {
+		if *opts.Addr == "" {
+			return fmt.Errorf(".Addr must not be empty, use nil to disable pprof server")
+		}
+		if _, err := net.ResolveTCPAddr("tcp", *opts.Addr); err != nil {
+			return fmt.Errorf(".Addr %q is invalid: %w", *opts.Addr, err)
+		}
+	}
+
 	return nil
 }
 
+// optionalStringValue is a string flag value which leaves the pointer as nil if the flag
+// is unset or empty.
+type optionalStringValue struct {
+	p **string
+}
+
+var _ pflag.Value = (*optionalStringValue)(nil)
+
+func (v *optionalStringValue) String() string {
+	if *v.p == nil {
+		return ""
+	}
+	return **v.p
+}
+
+func (v *optionalStringValue) Set(s string) error {
+	if s == "" {
+		*v.p = nil
+		return nil
+	}
+	*v.p = &s
+	return nil
+}
+
+func (v *optionalStringValue) Type() string {
+	return "string"
+}
+
 type pprofServer struct {
 	logger logr.Logger
 	server *http.Server
@@ -244,7 +432,7 @@ func NewPprofServer(opts PprofServerOptions) (*pprofServer, error) {
 		logger: opts.Logger,
 	}
 
-	if opts.Addr == pprofServerDisabledAddr {
+	if opts.Addr == nil {
 		return srv, nil
 	}
 
@@ -255,14 +443,28 @@ func NewPprofServer(opts PprofServerOptions) (*pprofServer, error) {
 	serverMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 	serverMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
 
+	var handler http.Handler = serverMux
+	if opts.Token != "" {
+		handler = createBearerTokenAuthMiddleware(opts.Token, responsePprofError)(handler)
+	}
+
 	srv.server = &http.Server{
-		Addr:    opts.Addr,
-		Handler: serverMux,
+		Addr:    *opts.Addr,
+		Handler: handler,
 	}
 
 	return srv, nil
 }
 
+func responsePprofError(w http.ResponseWriter, err error) {
+	statusCode := http.StatusInternalServerError
+	var serverError *ServerError
+	if errors.As(err, &serverError) {
+		statusCode = serverError.StatusCode
+	}
+	http.Error(w, err.Error(), statusCode)
+}
+
 func (server *pprofServer) Start(done <-chan struct{}) {
 	if server.server == nil {
 		return
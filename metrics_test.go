@@ -1,9 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,9 +27,9 @@ func TestMetricsServer_monitorDatabaseSize(t *testing.T) {
 	tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (1, "a"), (1, "a"), (1, "a")`)
 
 	metricsServer, err := NewMetricsServer(MetricsServerOptions{
-		Logger:  createTestLogger(t).WithName("test"),
-		Addr:    ":8081",
-		Queryer: tc.DB(),
+		Logger: createTestLogger(t).WithName("test"),
+		Addr:   ":8081",
+		DB:     tc.DB(),
 	})
 	assert.NoError(t, err)
 
@@ -36,3 +46,204 @@ func TestMetricsServer_monitorDatabaseSize(t *testing.T) {
 	close(done)
 	<-observeFinish
 }
+
+func TestMetricsServer_monitorWALSize(t *testing.T) {
+	t.Parallel()
+
+	tc := createTestContextWithHMACTokenAuth(t)
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "PRAGMA journal_mode=wal")
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int, s text)")
+	tc.ExecuteSQL(t, `INSERT INTO test (id, s) VALUES (1, "a"), (1, "a"), (1, "a")`)
+
+	metricsServer, err := NewMetricsServer(MetricsServerOptions{
+		Logger: createTestLogger(t).WithName("test"),
+		Addr:   ":8081",
+		DB:     tc.DB(),
+	})
+	assert.NoError(t, err)
+
+	done := make(chan struct{})
+	observeFinish := make(chan struct{})
+
+	go metricsServer.monitorWALSize(done, func(sizeInBytes float64) {
+		metricsWALSizeBytes.Set(sizeInBytes)
+		close(observeFinish)
+	})
+
+	<-observeFinish
+	close(done)
+
+	assert.True(t, testutil.ToFloat64(metricsWALSizeBytes) > 0)
+}
+
+func TestMetricsServer_monitorDBStats(t *testing.T) {
+	t.Parallel()
+
+	tc := createTestContextUsingInMemoryDB(t)
+	defer tc.CleanUp(t)
+
+	metricsServer, err := NewMetricsServer(MetricsServerOptions{
+		Logger: createTestLogger(t).WithName("test"),
+		Addr:   ":8081",
+		DB:     tc.DB(),
+	})
+	assert.NoError(t, err)
+
+	// hold a connection in use
+	rows, err := tc.DB().Queryx("select 1")
+	assert.NoError(t, err)
+	defer rows.Close()
+
+	done := make(chan struct{})
+	observeFinish := make(chan struct{})
+
+	go metricsServer.monitorDBStats(done, func(stats sql.DBStats) {
+		observeDBStats(stats)
+		close(observeFinish)
+	})
+
+	<-observeFinish
+	close(done)
+
+	err = testutil.CollectAndCompare(metricsDBInUseConnections, strings.NewReader(`
+# HELP sqlite_rest_db_in_use_connections Number of database connections currently in use
+# TYPE sqlite_rest_db_in_use_connections gauge
+sqlite_rest_db_in_use_connections 1
+`))
+	assert.NoError(t, err)
+}
+
+func TestMetrics_queryRowsReturned(t *testing.T) {
+	const table = "rows_returned_test"
+
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.SecurityOptions.EnabledTableOrViews = []string{table}
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE "+table+" (id int, s text)")
+	tc.ExecuteSQL(t, "INSERT INTO "+table+` (id, s) VALUES (1, "a"), (2, "a"), (3, "b")`)
+
+	readHistogram := func(t *testing.T, op string) (uint64, float64) {
+		var m dto.Metric
+		observer := metricsQueryRowsReturned.WithLabelValues(table, op)
+		assert.NoError(t, observer.(prometheus.Histogram).Write(&m))
+		return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+	}
+
+	execute := func(t *testing.T, method string, path string, body string) {
+		var req *http.Request
+		if body == "" {
+			req = tc.NewRequest(t, method, path, nil)
+		} else {
+			req = tc.NewRequest(t, method, path, bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		assert.Less(t, resp.StatusCode, http.StatusBadRequest)
+	}
+
+	execute(t, http.MethodGet, table, "")
+	execute(t, http.MethodGet, table+"?s=eq.a", "")
+	count, sum := readHistogram(t, "queryTableOrView")
+	assert.EqualValues(t, 2, count)
+	assert.EqualValues(t, 5, sum)
+
+	execute(t, http.MethodPost, table, `[{"id": 4, "s": "c"}, {"id": 5, "s": "c"}]`)
+	count, sum = readHistogram(t, "insertTable")
+	assert.EqualValues(t, 1, count)
+	assert.EqualValues(t, 2, sum)
+
+	execute(t, http.MethodPatch, table+"?s=eq.c", `{"s": "d"}`)
+	count, sum = readHistogram(t, "updateTable")
+	assert.EqualValues(t, 1, count)
+	assert.EqualValues(t, 2, sum)
+
+	execute(t, http.MethodDelete, table+"?s=eq.a", "")
+	count, sum = readHistogram(t, "deleteTable")
+	assert.EqualValues(t, 1, count)
+	assert.EqualValues(t, 2, sum)
+}
+
+func TestNewPprofServer(t *testing.T) {
+	t.Parallel()
+
+	addr := func(s string) *string { return &s }
+
+	t.Run("disabled", func(t *testing.T) {
+		srv, err := NewPprofServer(PprofServerOptions{})
+		assert.NoError(t, err)
+		assert.Nil(t, srv.server)
+	})
+
+	t.Run("valid addr", func(t *testing.T) {
+		for _, s := range []string{":6060", "127.0.0.1:6060", "localhost:0"} {
+			srv, err := NewPprofServer(PprofServerOptions{Addr: addr(s)})
+			assert.NoError(t, err, s)
+			if assert.NotNil(t, srv.server, s) {
+				assert.Equal(t, s, srv.server.Addr)
+			}
+		}
+	})
+
+	t.Run("invalid addr", func(t *testing.T) {
+		for _, s := range []string{"", "6060", "localhost", "127.0.0.1:port", ":99999"} {
+			_, err := NewPprofServer(PprofServerOptions{Addr: addr(s)})
+			assert.Error(t, err, s)
+		}
+	})
+
+	t.Run("cli flags", func(t *testing.T) {
+		for _, c := range []struct {
+			args     []string
+			expected *string
+		}{
+			{args: nil, expected: nil},
+			{args: []string{"--pprof-addr", ""}, expected: nil},
+			{args: []string{"--pprof-addr", ":6060"}, expected: addr(":6060")},
+		} {
+			opts := new(PprofServerOptions)
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			opts.bindCLIFlags(fs)
+			assert.NoError(t, fs.Parse(c.args))
+			assert.Equal(t, c.expected, opts.Addr, c.args)
+		}
+	})
+}
+
+func TestNewPprofServer_Token(t *testing.T) {
+	t.Parallel()
+
+	addr := ":6060"
+	srv, err := NewPprofServer(PprofServerOptions{Addr: &addr, Token: "secret"})
+	assert.NoError(t, err)
+
+	ts := httptest.NewServer(srv.server.Handler)
+	defer ts.Close()
+
+	get := func(t *testing.T, authorization string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/debug/pprof/heap?debug=1", nil)
+		assert.NoError(t, err)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	for _, authorization := range []string{"", "secret", "Bearer wrong", "Basic secret"} {
+		statusCode, _ := get(t, authorization)
+		assert.Equal(t, http.StatusUnauthorized, statusCode, authorization)
+	}
+
+	statusCode, body := get(t, "Bearer secret")
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Contains(t, body, "heap profile")
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+const headerNameRequestID = "X-Request-ID"
+
+type requestIDContextKey struct{}
+
+// WithRequestID returns a copy of ctx with the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID from ctx.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	requestID, ok := ctx.Value(requestIDContextKey{}).(string)
+	return requestID, ok
+}
+
+// newRequestID generates a random UUID (version 4).
+func newRequestID() string {
+	var b [16]byte
+	// NOTE: crypto/rand.Read never returns an error
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// requestIDMiddleware reads the request ID from the X-Request-ID header, or generates
+// one if absent. The request ID is set to the request context and the response header.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requestID := req.Header.Get(headerNameRequestID)
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+
+		w.Header().Set(headerNameRequestID, requestID)
+		next.ServeHTTP(w, req.WithContext(WithRequestID(req.Context(), requestID)))
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	t.Run("Provided", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContextUsingInMemoryDB(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+		req := tc.NewRequest(t, http.MethodGet, "test", nil)
+		req.Header.Set(headerNameRequestID, "foo-bar")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "foo-bar", resp.Header.Get(headerNameRequestID))
+	})
+
+	t.Run("Generated", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContextUsingInMemoryDB(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+		uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+		var requestIDs []string
+		for i := 0; i < 2; i++ {
+			req := tc.NewRequest(t, http.MethodGet, "test", nil)
+			resp := tc.ExecuteRequest(t, req)
+			resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			requestID := resp.Header.Get(headerNameRequestID)
+			assert.Regexp(t, uuidPattern, requestID)
+			requestIDs = append(requestIDs, requestID)
+		}
+		assert.NotEqual(t, requestIDs[0], requestIDs[1])
+	})
+
+	t.Run("Logging", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			mu    sync.Mutex
+			lines []string
+		)
+		logger := funcr.New(func(prefix, args string) {
+			mu.Lock()
+			defer mu.Unlock()
+			lines = append(lines, args)
+		}, funcr.Options{Verbosity: 12})
+
+		tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+			opts.Logger = logger
+		})
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+		req := tc.NewRequest(t, http.MethodGet, "test", nil)
+		req.Header.Set(headerNameRequestID, "foo-bar")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		mu.Lock()
+		defer mu.Unlock()
+		var found bool
+		for _, line := range lines {
+			if strings.Contains(line, `"request_id"="foo-bar"`) {
+				found = true
+				break
+			}
+		}
+		assert.True(t, found, "request ID not found in logs: %v", lines)
+	})
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	t.Run("Middleware", func(t *testing.T) {
+		t.Parallel()
+
+		server := &dbServer{logger: createTestLogger(t)}
+		panicking := func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				panic("boom")
+			})
+		}
+		handler := requestIDMiddleware(server.recoverMiddleware(panicking(http.NotFoundHandler())))
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+		assert.Equal(t, "Internal Server Error", body["message"])
+	})
+
+	t.Run("Handler", func(t *testing.T) {
+		t.Parallel()
+		tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+			opts.BeforeInsert = func(table string, data map[string]interface{}) error {
+				panic("boom")
+			}
+		})
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+		req := tc.NewRequest(t, http.MethodPost, "test", bytes.NewBufferString(`{"id": 1}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "Internal Server Error", body["message"])
+	})
+}
@@ -5,19 +5,25 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 
 	"github.com/go-logr/logr"
 	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
 	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/spf13/cobra"
 )
 
 const (
-	tableNameMigrations = "__sqlite_rest_migrations"
+	// tableNamePrefixInternal is the name prefix of the tables managed by sqlite-rest.
+	tableNamePrefixInternal = "__sqlite_rest_"
+	tableNameMigrations     = tableNamePrefixInternal + "migrations"
 
 	migrationDirectionUp   = "up"
 	migrationDirectionDown = "down"
@@ -33,6 +39,8 @@ func createMigrateCmd() *cobra.Command {
 	var (
 		flagDirection string
 		flagStep      int
+		flagDryRun    bool
+		flagSeed      bool
 	)
 
 	cmd := &cobra.Command{
@@ -58,6 +66,8 @@ func createMigrateCmd() *cobra.Command {
 				Logger:    logger,
 				DB:        db.DB,
 				SourceDIR: args[0],
+				DryRun:    flagDryRun,
+				ApplySeed: flagSeed,
 			}
 			migrator, err := NewMigrator(opts)
 			if err != nil {
@@ -86,6 +96,111 @@ func createMigrateCmd() *cobra.Command {
 		},
 	}
 
+	bindDBDSNFlag(cmd.Flags())
+	cmd.Flags().BoolVar(
+		&flagDryRun, "dry-run", false,
+		"apply migrations in a transaction and roll back, without persisting any changes",
+	)
+	cmd.Flags().BoolVar(
+		&flagSeed, "migrate-seed", false,
+		"apply {version}_*.seed.sql files after each migration step",
+	)
+
+	cmd.AddCommand(
+		createMigrateStatusCmd(),
+		createMigrateValidateCmd(),
+	)
+
+	return cmd
+}
+
+func createMigrateValidateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "validate migrations-dir",
+		Short:        "Validate applied migration files are not modified",
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger, err := createLogger(cmd)
+			if err != nil {
+				setupLogger.Error(err, "failed to create logger")
+				return err
+			}
+
+			db, err := openDB(cmd)
+			if err != nil {
+				setupLogger.Error(err, "create db")
+				return err
+			}
+			defer db.Close()
+
+			opts := &MigrateOptions{
+				Logger:    logger,
+				DB:        db.DB,
+				SourceDIR: args[0],
+			}
+			migrator, err := NewMigrator(opts)
+			if err != nil {
+				setupLogger.Error(err, "failed to create migrator")
+				return err
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			return migrator.Validate(ctx)
+		},
+	}
+
+	bindDBDSNFlag(cmd.Flags())
+
+	return cmd
+}
+
+func createMigrateStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "status migrations-dir",
+		Short:        "Show current database migration version",
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger, err := createLogger(cmd)
+			if err != nil {
+				setupLogger.Error(err, "failed to create logger")
+				return err
+			}
+
+			db, err := openDB(cmd)
+			if err != nil {
+				setupLogger.Error(err, "create db")
+				return err
+			}
+			defer db.Close()
+
+			opts := &MigrateOptions{
+				Logger:    logger,
+				DB:        db.DB,
+				SourceDIR: args[0],
+			}
+			migrator, err := NewMigrator(opts)
+			if err != nil {
+				setupLogger.Error(err, "failed to create migrator")
+				return err
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			version, dirty, err := migrator.Status(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "version: %d\ndirty: %t\n", version, dirty)
+
+			return nil
+		},
+	}
+
 	bindDBDSNFlag(cmd.Flags())
 
 	return cmd
@@ -95,6 +210,18 @@ type MigrateOptions struct {
 	Logger    logr.Logger
 	DB        *sql.DB
 	SourceDIR string
+	// SourceFS is the filesystem to read migrations from, e.g. an embed.FS.
+	// Migration files should be placed at the root of the filesystem.
+	// Only one of SourceDIR and SourceFS can be set.
+	SourceFS fs.FS
+	// DryRun applies the migrations in a transaction and rolls back afterwards.
+	DryRun bool
+	// ApplySeed applies `{version}_*.seed.sql` files after each migration step.
+	// Applied seeds are recorded and won't be re-applied.
+	ApplySeed bool
+	// UseTransactions wraps each migration step in `BEGIN IMMEDIATE ... COMMIT`.
+	// Defaults to true.
+	UseTransactions *bool
 }
 
 func (opts *MigrateOptions) defaults() error {
@@ -106,8 +233,20 @@ func (opts *MigrateOptions) defaults() error {
 		return fmt.Errorf(".DB is required")
 	}
 
+	if opts.UseTransactions == nil {
+		useTransactions := true
+		opts.UseTransactions = &useTransactions
+	}
+
+	if opts.SourceDIR != "" && opts.SourceFS != nil {
+		return fmt.Errorf("only one of .SourceDIR and .SourceFS can be set")
+	}
+	if opts.SourceFS != nil {
+		return nil
+	}
+
 	if opts.SourceDIR == "" {
-		return fmt.Errorf(".SourceDIR is required")
+		return fmt.Errorf(".SourceDIR or .SourceFS is required")
 	}
 	if s, err := filepath.Abs(opts.SourceDIR); err == nil {
 		opts.SourceDIR = s
@@ -126,8 +265,13 @@ func (opts *MigrateOptions) defaults() error {
 }
 
 type dbMigrator struct {
-	logger   logr.Logger
-	migrator *migrate.Migrate
+	logger    logr.Logger
+	migrator  *migrate.Migrate
+	source    source.Driver
+	sourceFS  fs.FS
+	db        *sql.DB
+	dryRun    bool
+	applySeed bool
 }
 
 func NewMigrator(opts *MigrateOptions) (*dbMigrator, error) {
@@ -135,28 +279,97 @@ func NewMigrator(opts *MigrateOptions) (*dbMigrator, error) {
 		return nil, err
 	}
 
-	driver, err := sqlite3.WithInstance(opts.DB, &sqlite3.Config{
+	var driver database.Driver
+	sqliteDriver, err := sqlite3.WithInstance(opts.DB, &sqlite3.Config{
 		MigrationsTable: tableNameMigrations,
+		// transaction is managed by txMigrationDriver
+		NoTxWrap: true,
 	})
 	if err != nil {
 		return nil, err
 	}
-	migrator, err := migrate.NewWithDatabaseInstance(
-		"file://"+opts.SourceDIR,
-		"sqlite3", driver,
+	if *opts.UseTransactions {
+		driver = &txMigrationDriver{
+			Sqlite: sqliteDriver.(*sqlite3.Sqlite),
+			db:     opts.DB,
+		}
+	} else {
+		driver = sqliteDriver
+	}
+	var (
+		sourceName   string
+		sourceDriver source.Driver
+		sourceFS     fs.FS
 	)
+	if opts.SourceFS != nil {
+		sourceName = "iofs"
+		sourceFS = opts.SourceFS
+		sourceDriver, err = iofs.New(opts.SourceFS, ".")
+	} else {
+		sourceName = "file"
+		sourceFS = os.DirFS(opts.SourceDIR)
+		sourceDriver, err = source.Open("file://" + opts.SourceDIR)
+	}
+	if err != nil {
+		return nil, err
+	}
+	migrator, err := migrate.NewWithInstance(sourceName, sourceDriver, "sqlite3", driver)
 	if err != nil {
 		return nil, err
 	}
 
 	rv := &dbMigrator{
-		logger:   opts.Logger.WithName("db-migrator"),
-		migrator: migrator,
+		logger:    opts.Logger.WithName("db-migrator"),
+		migrator:  migrator,
+		source:    sourceDriver,
+		sourceFS:  sourceFS,
+		db:        opts.DB,
+		dryRun:    opts.DryRun,
+		applySeed: opts.ApplySeed,
 	}
 
 	return rv, nil
 }
 
+// txMigrationDriver wraps each migration step in an immediate transaction.
+type txMigrationDriver struct {
+	*sqlite3.Sqlite
+
+	db *sql.DB
+}
+
+var _ database.Driver = (*txMigrationDriver)(nil)
+
+func (d *txMigrationDriver) Run(migration io.Reader) error {
+	query, err := io.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	// NOTE: transaction statements must be executed in the same connection
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return &database.Error{OrigErr: err, Err: "acquire connection failed"}
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction start failed"}
+	}
+	if _, err := conn.ExecContext(ctx, string(query)); err != nil {
+		if _, rollbackErr := conn.ExecContext(ctx, "ROLLBACK"); rollbackErr != nil {
+			err = errors.Join(err, rollbackErr)
+		}
+		return &database.Error{OrigErr: err, Query: query}
+	}
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction commit failed"}
+	}
+
+	return nil
+}
+
 func handleMigrateError(logger logr.Logger, op string, migrateErr error) error {
 	if migrateErr == nil {
 		logger.Info("applied operation")
@@ -184,21 +397,69 @@ func handleMigrateError(logger logr.Logger, op string, migrateErr error) error {
 
 func (m *dbMigrator) Up(ctx context.Context, step int) error {
 	logger := m.logger.WithName("up")
+	if err := m.Validate(ctx); err != nil {
+		logger.Error(err, "failed to validate applied migrations")
+		return fmt.Errorf("up: %w", err)
+	}
+	if m.dryRun {
+		return m.dryRunUp(ctx, logger, step)
+	}
 	logger.Info("applying operation")
 
 	var migrateErr error
 
-	if isApplyAllStep(step) {
+	switch {
+	case m.applySeed:
+		migrateErr = m.upWithSeeds(ctx, logger, step)
+	case isApplyAllStep(step):
 		migrateErr = m.migrator.Up()
-	} else {
+	default:
 		migrateErr = m.migrator.Steps(step)
 	}
+	if err := m.recordChecksums(ctx); err != nil {
+		logger.Error(err, "failed to record migration checksums")
+		return fmt.Errorf("up: %w", errors.Join(migrateErr, err))
+	}
 
 	return handleMigrateError(logger, "up", migrateErr)
 }
 
+// Status returns the current migration version and whether the database is dirty.
+// Version 0 is returned if no migrations have been applied.
+func (m *dbMigrator) Status(ctx context.Context) (version uint, dirty bool, err error) {
+	version, dirty, err = m.migrator.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("status: %w", err)
+	}
+
+	return version, dirty, nil
+}
+
+// MigratorState reports the migration state of the database.
+type MigratorState interface {
+	// PendingMigrations returns the number of migrations not applied yet.
+	PendingMigrations(ctx context.Context) (int, error)
+}
+
+var _ MigratorState = (*dbMigrator)(nil)
+
+func (m *dbMigrator) PendingMigrations(ctx context.Context) (int, error) {
+	migrations, err := m.pendingUpMigrations(migrationStepAll)
+	if err != nil {
+		return 0, fmt.Errorf("pending migrations: %w", err)
+	}
+
+	return len(migrations), nil
+}
+
 func (m *dbMigrator) Down(ctx context.Context, step int) error {
 	logger := m.logger.WithName("down")
+	if m.dryRun {
+		return m.dryRunDown(ctx, logger, step)
+	}
 	logger.Info("applying operation")
 
 	var migrateErr error
@@ -208,6 +469,10 @@ func (m *dbMigrator) Down(ctx context.Context, step int) error {
 	} else {
 		migrateErr = m.migrator.Steps(-step)
 	}
+	if err := m.recordChecksums(ctx); err != nil {
+		logger.Error(err, "failed to record migration checksums")
+		return fmt.Errorf("down: %w", errors.Join(migrateErr, err))
+	}
 
 	return handleMigrateError(logger, "up", migrateErr)
 }
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// tableNameMigrationChecksums records the checksums of applied migration files.
+//
+// NOTE: golang-migrate keeps only the latest version in tableNameMigrations,
+// so the checksums are recorded per version in a separated table.
+const tableNameMigrationChecksums = tableNamePrefixInternal + "migration_checksums"
+
+type migrationChecksum struct {
+	Version  uint
+	Filename string
+	Checksum string
+}
+
+func checksumMigration(migration dryRunMigration) string {
+	sum := sha256.Sum256([]byte(migration.content))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *dbMigrator) ensureChecksumsTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, fmt.Sprintf(
+		`create table if not exists %s (
+			version integer primary key,
+			filename text not null,
+			checksum text not null
+		)`,
+		tableNameMigrationChecksums,
+	))
+	if err != nil {
+		return fmt.Errorf("create migration checksums table: %w", err)
+	}
+
+	return nil
+}
+
+// recordChecksums records the checksums of applied up migrations
+// and removes the ones of reverted migrations.
+func (m *dbMigrator) recordChecksums(ctx context.Context) error {
+	if err := m.ensureChecksumsTable(ctx); err != nil {
+		return err
+	}
+
+	version, dirty, err := m.migrator.Version()
+	hasVersion := true
+	switch {
+	case errors.Is(err, migrate.ErrNilVersion):
+		hasVersion = false
+	case err != nil:
+		return err
+	}
+	isApplied := func(v uint) bool {
+		if dirty {
+			// the dirty version is not applied successfully
+			return v < version
+		}
+		return v <= version
+	}
+
+	if _, err := m.db.ExecContext(
+		ctx,
+		fmt.Sprintf("delete from %s where version > ?", tableNameMigrationChecksums),
+		version,
+	); err != nil {
+		return fmt.Errorf("remove migration checksums: %w", err)
+	}
+	if !hasVersion {
+		return nil
+	}
+
+	v, err := m.source.First()
+	for ; err == nil && isApplied(v); v, err = m.source.Next(v) {
+		migration, readErr := m.readMigration(v, migrationDirectionUp)
+		if errors.Is(readErr, fs.ErrNotExist) {
+			// no up migration for this version
+			continue
+		}
+		if readErr != nil {
+			return readErr
+		}
+
+		if _, execErr := m.db.ExecContext(
+			ctx,
+			fmt.Sprintf(
+				"insert or ignore into %s (version, filename, checksum) values (?, ?, ?)",
+				tableNameMigrationChecksums,
+			),
+			migration.version, migration.filename(), checksumMigration(migration),
+		); execErr != nil {
+			return fmt.Errorf("record migration checksum of %s: %w", migration.filename(), execErr)
+		}
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// checksumsTableExists checks if the checksums table has been created by a previous apply.
+func (m *dbMigrator) checksumsTableExists(ctx context.Context) (bool, error) {
+	var count int
+	err := m.db.QueryRowContext(
+		ctx,
+		"select count(1) from sqlite_master where type = 'table' and name = ?",
+		tableNameMigrationChecksums,
+	).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("query migration checksums table: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// Validate checks the applied migration files are not modified since applied.
+// It's read only, missing checksums table is treated as no checksums recorded.
+func (m *dbMigrator) Validate(ctx context.Context) error {
+	exists, err := m.checksumsTableExists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	rows, err := m.db.QueryContext(ctx, fmt.Sprintf(
+		"select version, filename, checksum from %s order by version",
+		tableNameMigrationChecksums,
+	))
+	if err != nil {
+		return fmt.Errorf("query migration checksums: %w", err)
+	}
+	defer rows.Close()
+
+	var records []migrationChecksum
+	for rows.Next() {
+		var r migrationChecksum
+		if err := rows.Scan(&r.Version, &r.Filename, &r.Checksum); err != nil {
+			return fmt.Errorf("scan migration checksum: %w", err)
+		}
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query migration checksums: %w", err)
+	}
+
+	var errs []error
+	for _, record := range records {
+		migration, err := m.readMigration(record.Version, migrationDirectionUp)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("applied migration %s: %w", record.Filename, err))
+			continue
+		}
+		if checksum := checksumMigration(migration); checksum != record.Checksum {
+			errs = append(errs, fmt.Errorf(
+				"applied migration %s has been modified: checksum mismatch (applied: %s, current: %s)",
+				record.Filename, record.Checksum, checksum,
+			))
+		}
+	}
+
+	return errors.Join(errs...)
+}
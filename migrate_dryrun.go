@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/go-logr/logr"
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// dryRunMigration is a migration file to be applied in dry run.
+type dryRunMigration struct {
+	version    uint
+	identifier string
+	direction  string
+	content    string
+}
+
+func (m dryRunMigration) filename() string {
+	return fmt.Sprintf("%d_%s.%s.sql", m.version, m.identifier, m.direction)
+}
+
+// currentVersion returns the current migration version. The second return value
+// is false if no migrations have been applied.
+func (m *dbMigrator) currentVersion() (uint, bool, error) {
+	version, dirty, err := m.migrator.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if dirty {
+		return 0, false, migrate.ErrDirty{Version: int(version)}
+	}
+
+	return version, true, nil
+}
+
+func (m *dbMigrator) readMigration(
+	version uint,
+	direction string,
+) (dryRunMigration, error) {
+	var (
+		r          io.ReadCloser
+		identifier string
+		err        error
+	)
+	switch direction {
+	case migrationDirectionDown:
+		r, identifier, err = m.source.ReadDown(version)
+	default:
+		r, identifier, err = m.source.ReadUp(version)
+	}
+	if err != nil {
+		return dryRunMigration{}, err
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return dryRunMigration{}, err
+	}
+
+	return dryRunMigration{
+		version:    version,
+		identifier: identifier,
+		direction:  direction,
+		content:    string(content),
+	}, nil
+}
+
+// pendingUpMigrations returns the migrations to apply for up direction.
+func (m *dbMigrator) pendingUpMigrations(step int) ([]dryRunMigration, error) {
+	version, hasVersion, err := m.currentVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []dryRunMigration
+	for isApplyAllStep(step) || len(rv) < step {
+		var next uint
+		if hasVersion {
+			next, err = m.source.Next(version)
+		} else {
+			next, err = m.source.First()
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		migration, err := m.readMigration(next, migrationDirectionUp)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, migration)
+		version, hasVersion = next, true
+	}
+
+	return rv, nil
+}
+
+// pendingDownMigrations returns the migrations to apply for down direction.
+func (m *dbMigrator) pendingDownMigrations(step int) ([]dryRunMigration, error) {
+	version, hasVersion, err := m.currentVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []dryRunMigration
+	for hasVersion && (isApplyAllStep(step) || len(rv) < step) {
+		migration, err := m.readMigration(version, migrationDirectionDown)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, migration)
+
+		prev, err := m.source.Prev(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		version = prev
+	}
+
+	return rv, nil
+}
+
+// applyInTransaction applies the migrations in order within a transaction,
+// the transaction is always rolled back.
+func (m *dbMigrator) applyInTransaction(
+	ctx context.Context,
+	logger logr.Logger,
+	migrations []dryRunMigration,
+) error {
+	if len(migrations) < 1 {
+		logger.Info("no pending migrations")
+		return nil
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for idx, migration := range migrations {
+		if _, err := tx.ExecContext(ctx, migration.content); err != nil {
+			logger.Error(err, "migration would fail", "migration", migration.filename())
+			for _, skipped := range migrations[idx+1:] {
+				logger.Info("migration would be skipped", "migration", skipped.filename())
+			}
+			return fmt.Errorf("dry run %s: %w", migration.filename(), err)
+		}
+		logger.Info("migration would succeed", "migration", migration.filename())
+	}
+
+	return nil
+}
+
+func (m *dbMigrator) dryRunUp(ctx context.Context, logger logr.Logger, step int) error {
+	logger = logger.WithName("dry-run")
+
+	migrations, err := m.pendingUpMigrations(step)
+	if err != nil {
+		return fmt.Errorf("up: %w", err)
+	}
+
+	return m.applyInTransaction(ctx, logger, migrations)
+}
+
+func (m *dbMigrator) dryRunDown(ctx context.Context, logger logr.Logger, step int) error {
+	logger = logger.WithName("dry-run")
+
+	migrations, err := m.pendingDownMigrations(step)
+	if err != nil {
+		return fmt.Errorf("down: %w", err)
+	}
+
+	return m.applyInTransaction(ctx, logger, migrations)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// tableNameSeeds records the applied seed files.
+const tableNameSeeds = tableNamePrefixInternal + "seeds"
+
+// seedFilenameRegex matches seed file in `{version}_{title}.seed.sql` format.
+var seedFilenameRegex = regexp.MustCompile(`^([0-9]+)_(.*)\.seed\.sql$`)
+
+type seedFile struct {
+	version  uint
+	filename string
+}
+
+// listSeedFiles lists the seed files from the migrations source in version order.
+func listSeedFiles(sourceFS fs.FS) ([]seedFile, error) {
+	entries, err := fs.ReadDir(sourceFS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read seed files: %w", err)
+	}
+
+	var rv []seedFile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := seedFilenameRegex.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse seed file version %q: %w", entry.Name(), err)
+		}
+		rv = append(rv, seedFile{version: uint(version), filename: entry.Name()})
+	}
+	sort.SliceStable(rv, func(i, j int) bool {
+		if rv[i].version != rv[j].version {
+			return rv[i].version < rv[j].version
+		}
+		return rv[i].filename < rv[j].filename
+	})
+
+	return rv, nil
+}
+
+// applySeeds applies the seed files of applied migration versions which haven't been applied before.
+func (m *dbMigrator) applySeeds(ctx context.Context, logger logr.Logger) error {
+	version, dirty, err := m.migrator.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		// no migrations applied
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return migrate.ErrDirty{Version: int(version)}
+	}
+
+	seeds, err := listSeedFiles(m.sourceFS)
+	if err != nil {
+		return err
+	}
+
+	if _, err := m.db.ExecContext(ctx, fmt.Sprintf(
+		`create table if not exists %s (
+			filename text primary key,
+			version integer not null
+		)`,
+		tableNameSeeds,
+	)); err != nil {
+		return fmt.Errorf("create seeds table: %w", err)
+	}
+
+	for _, seed := range seeds {
+		if seed.version > version {
+			break
+		}
+		if err := m.applySeedFile(ctx, logger, seed); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *dbMigrator) applySeedFile(ctx context.Context, logger logr.Logger, seed seedFile) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRowContext(
+		ctx,
+		fmt.Sprintf("select count(*) from %s where filename = ?", tableNameSeeds),
+		seed.filename,
+	).Scan(&count); err != nil {
+		return fmt.Errorf("query seed %s: %w", seed.filename, err)
+	}
+	if count > 0 {
+		logger.V(8).Info("seed has been applied", "seed", seed.filename)
+		return nil
+	}
+
+	content, err := fs.ReadFile(m.sourceFS, seed.filename)
+	if err != nil {
+		return fmt.Errorf("read seed %s: %w", seed.filename, err)
+	}
+	if _, err := tx.ExecContext(ctx, string(content)); err != nil {
+		return fmt.Errorf("apply seed %s: %w", seed.filename, err)
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		fmt.Sprintf("insert into %s (filename, version) values (?, ?)", tableNameSeeds),
+		seed.filename, seed.version,
+	); err != nil {
+		return fmt.Errorf("record seed %s: %w", seed.filename, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit seed %s: %w", seed.filename, err)
+	}
+
+	logger.Info("applied seed", "seed", seed.filename)
+	return nil
+}
+
+// upWithSeeds applies the migrations step by step, the seeds are applied after each step.
+func (m *dbMigrator) upWithSeeds(ctx context.Context, logger logr.Logger, step int) error {
+	pending, err := m.pendingUpMigrations(step)
+	if err != nil {
+		return err
+	}
+	if isApplyAllStep(step) && len(pending) < 1 {
+		// no pending migrations, seeds of applied migrations might be missing
+		if err := m.applySeeds(ctx, logger); err != nil {
+			return err
+		}
+		return migrate.ErrNoChange
+	}
+	if !isApplyAllStep(step) && len(pending) < step {
+		return migrate.ErrShortLimit{Short: uint(step - len(pending))}
+	}
+
+	if err := m.applySeeds(ctx, logger); err != nil {
+		return err
+	}
+	for range pending {
+		if err := m.migrator.Steps(1); err != nil {
+			return err
+		}
+		if err := m.applySeeds(ctx, logger); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
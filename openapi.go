@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// TableInfo describes a table or view with its columns.
+type TableInfo struct {
+	TableOrView
+	Columns []TableColumn
+}
+
+const openAPIVersion = "3.0.3"
+
+type jsonObject = map[string]interface{}
+
+// GenerateOpenAPISpec generates the OpenAPI 3.0 specification of the given tables and views.
+func GenerateOpenAPISpec(tables []TableInfo) []byte {
+	paths := jsonObject{}
+	schemas := jsonObject{}
+	for _, table := range tables {
+		schemas[table.Name] = openAPITableSchema(table)
+		paths["/"+table.Name] = openAPITablePathItem(table)
+	}
+
+	doc := jsonObject{
+		"openapi": openAPIVersion,
+		"info": jsonObject{
+			"title":   "sqlite-rest",
+			"version": ServerVersion,
+		},
+		"paths": paths,
+		"components": jsonObject{
+			"schemas":    schemas,
+			"parameters": openAPICommonParameters(),
+			"securitySchemes": jsonObject{
+				"bearerAuth": jsonObject{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+				"apiKeyAuth": jsonObject{
+					"type": "apiKey",
+					"in":   "header",
+					"name": headerNameAPIKey,
+				},
+			},
+		},
+	}
+
+	// NOTE: marshaling plain maps and slices never fails
+	b, _ := json.MarshalIndent(doc, "", "  ")
+	return b
+}
+
+// openAPIColumnSchema maps the column type to JSON schema following the type affinity rules.
+//
+// ref: https://www.sqlite.org/datatype3.html#determination_of_column_affinity
+func openAPIColumnSchema(column TableColumn) jsonObject {
+	t := strings.ToUpper(column.Type)
+
+	var rv jsonObject
+	switch {
+	case strings.Contains(t, "INT"):
+		rv = jsonObject{"type": "integer"}
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		rv = jsonObject{"type": "string"}
+	case t == "" || strings.Contains(t, "BLOB"):
+		rv = jsonObject{"type": "string", "format": "byte"}
+	default:
+		// REAL & NUMERIC affinity
+		rv = jsonObject{"type": "number"}
+	}
+	if !column.NotNull {
+		rv["nullable"] = true
+	}
+
+	return rv
+}
+
+func openAPITableSchema(table TableInfo) jsonObject {
+	properties := jsonObject{}
+	var required []string
+	for _, column := range table.Columns {
+		properties[column.Name] = openAPIColumnSchema(column)
+		if column.NotNull && column.DefaultValue == nil {
+			required = append(required, column.Name)
+		}
+	}
+
+	rv := jsonObject{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		rv["required"] = required
+	}
+	return rv
+}
+
+func openAPIParameterRef(name string) jsonObject {
+	return jsonObject{"$ref": "#/components/parameters/" + name}
+}
+
+func openAPICommonParameters() jsonObject {
+	queryParameter := func(name string, description string, schema jsonObject) jsonObject {
+		return jsonObject{
+			"name":        name,
+			"in":          "query",
+			"required":    false,
+			"description": description,
+			"schema":      schema,
+		}
+	}
+
+	return jsonObject{
+		queryParameterNameSelect: queryParameter(
+			queryParameterNameSelect,
+			"Columns to return, separated by comma",
+			jsonObject{"type": "string"},
+		),
+		queryParameterNameOrder: queryParameter(
+			queryParameterNameOrder,
+			"Ordering columns, e.g. `id.desc,name.asc`",
+			jsonObject{"type": "string"},
+		),
+		queryParameterNameLimit: queryParameter(
+			queryParameterNameLimit,
+			"Maximum number of rows to return",
+			jsonObject{"type": "integer", "minimum": 0},
+		),
+		queryParameterNameOffset: queryParameter(
+			queryParameterNameOffset,
+			"Number of rows to skip",
+			jsonObject{"type": "integer", "minimum": 0},
+		),
+		queryParameterNameCursor: queryParameter(
+			queryParameterNameCursor,
+			"Cursor for pagination, read from the Next-Cursor header",
+			jsonObject{"type": "string"},
+		),
+		queryParameterNameOnConflict: queryParameter(
+			queryParameterNameOnConflict,
+			"Columns for resolving upsert conflicts, separated by comma",
+			jsonObject{"type": "string"},
+		),
+		"prefer": jsonObject{
+			"name":        "Prefer",
+			"in":          "header",
+			"required":    false,
+			"description": "Request preferences, e.g. `count=exact`, `resolution=merge-duplicates`, `return=headers-only`, `handling=strict`",
+			"schema":      jsonObject{"type": "string"},
+		},
+	}
+}
+
+func openAPIFilterParameters(table TableInfo) []interface{} {
+	operators := make([]string, 0, len(queryOpereators))
+	for op := range queryOpereators {
+		operators = append(operators, op)
+	}
+	sort.Strings(operators)
+
+	var rv []interface{}
+	for _, column := range table.Columns {
+		rv = append(rv, jsonObject{
+			"name":     column.Name,
+			"in":       "query",
+			"required": false,
+			"description": fmt.Sprintf(
+				"Filter by %s using `operator.value`, supported operators: %s",
+				column.Name, strings.Join(operators, ", "),
+			),
+			"schema": jsonObject{"type": "string"},
+		})
+	}
+	return rv
+}
+
+func openAPITablePathItem(table TableInfo) jsonObject {
+	schemaRef := jsonObject{"$ref": "#/components/schemas/" + table.Name}
+	rowsContent := jsonObject{
+		mediaTypeJSON: jsonObject{
+			"schema": jsonObject{"type": "array", "items": schemaRef},
+		},
+	}
+	requestBody := jsonObject{
+		"required": true,
+		"content": jsonObject{
+			mediaTypeJSON: jsonObject{
+				"schema": jsonObject{
+					"oneOf": []interface{}{
+						schemaRef,
+						jsonObject{"type": "array", "items": schemaRef},
+					},
+				},
+			},
+		},
+	}
+	errorResponse := jsonObject{"description": "Error"}
+	filterParameters := openAPIFilterParameters(table)
+	withParameters := func(names ...string) []interface{} {
+		var rv []interface{}
+		for _, name := range names {
+			rv = append(rv, openAPIParameterRef(name))
+		}
+		return append(rv, filterParameters...)
+	}
+	operation := func(summary string, parameters []interface{}, responses jsonObject) jsonObject {
+		responses["default"] = errorResponse
+		rv := jsonObject{
+			"summary":   summary,
+			"tags":      []string{table.Name},
+			"responses": responses,
+			"security": []interface{}{
+				jsonObject{"bearerAuth": []string{}},
+				jsonObject{"apiKeyAuth": []string{}},
+			},
+		}
+		if len(parameters) > 0 {
+			rv["parameters"] = parameters
+		}
+		return rv
+	}
+
+	rv := jsonObject{
+		"get": operation(
+			fmt.Sprintf("Query %s", table.Name),
+			withParameters(
+				queryParameterNameSelect, queryParameterNameOrder,
+				queryParameterNameLimit, queryParameterNameOffset,
+				queryParameterNameCursor, "prefer",
+			),
+			jsonObject{
+				fmt.Sprint(http.StatusOK):             jsonObject{"description": "OK", "content": rowsContent},
+				fmt.Sprint(http.StatusPartialContent): jsonObject{"description": "Partial Content", "content": rowsContent},
+			},
+		),
+	}
+	if table.Type == "view" {
+		// views are read only
+		return rv
+	}
+
+	post := operation(
+		fmt.Sprintf("Insert into %s", table.Name),
+		[]interface{}{openAPIParameterRef(queryParameterNameOnConflict), openAPIParameterRef("prefer")},
+		jsonObject{fmt.Sprint(http.StatusCreated): jsonObject{"description": "Created"}},
+	)
+	post["requestBody"] = requestBody
+	rv["post"] = post
+
+	patch := operation(
+		fmt.Sprintf("Update %s", table.Name),
+		filterParameters,
+		jsonObject{fmt.Sprint(http.StatusAccepted): jsonObject{"description": "Accepted"}},
+	)
+	patch["requestBody"] = jsonObject{
+		"required": true,
+		"content": jsonObject{
+			mediaTypeJSON:       jsonObject{"schema": schemaRef},
+			mediaTypeMergePatch: jsonObject{"schema": schemaRef},
+			mediaTypeJSONPatch: jsonObject{
+				"schema": jsonObject{
+					"type": "array",
+					"items": jsonObject{
+						"type":     "object",
+						"required": []string{"op", "path"},
+						"properties": jsonObject{
+							"op": jsonObject{
+								"type": "string",
+								"enum": []string{jsonPatchOpAdd, jsonPatchOpReplace, jsonPatchOpRemove, jsonPatchOpTest},
+							},
+							"path":  jsonObject{"type": "string"},
+							"value": jsonObject{},
+						},
+					},
+				},
+			},
+		},
+	}
+	rv["patch"] = patch
+
+	put := operation(
+		fmt.Sprintf("Upsert single entry of %s", table.Name),
+		filterParameters,
+		jsonObject{fmt.Sprint(http.StatusOK): jsonObject{"description": "OK"}},
+	)
+	put["requestBody"] = jsonObject{
+		"required": true,
+		"content": jsonObject{
+			mediaTypeJSON: jsonObject{"schema": schemaRef},
+		},
+	}
+	rv["put"] = put
+
+	rv["delete"] = operation(
+		fmt.Sprintf("Delete from %s", table.Name),
+		filterParameters,
+		jsonObject{fmt.Sprint(http.StatusAccepted): jsonObject{"description": "Accepted"}},
+	)
+
+	return rv
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateOpenAPISpec(t *testing.T) {
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.SecurityOptions.WriteTableOrViews = []string{"test_write"}
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, `CREATE TABLE test (
+		id integer primary key,
+		s text not null,
+		price real,
+		data blob,
+		created_at text not null default current_timestamp
+	)`)
+	tc.ExecuteSQL(t, "CREATE VIEW test_view AS SELECT id, s FROM test")
+	tc.ExecuteSQL(t, "CREATE TABLE test_write (id int)")
+	tc.ExecuteSQL(t, "CREATE TABLE test_hidden (id int)")
+
+	req := tc.NewRequest(t, http.MethodGet, "openapi.json", nil)
+	resp := tc.ExecuteRequest(t, req)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, mediaTypeJSON, resp.Header.Get("Content-Type"))
+
+	res, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	doc, err := openapi3.NewLoader().LoadFromData(res)
+	assert.NoError(t, err)
+	assert.NoError(t, doc.Validate(context.Background()))
+
+	assert.Equal(t, openAPIVersion, doc.OpenAPI)
+	assert.NotNil(t, doc.Info)
+	assert.Len(t, doc.Paths.Map(), 3)
+
+	testPath := doc.Paths.Find("/test")
+	if assert.NotNil(t, testPath) {
+		assert.NotNil(t, testPath.Get)
+		assert.NotNil(t, testPath.Post)
+		assert.NotNil(t, testPath.Patch)
+		assert.NotNil(t, testPath.Put)
+		assert.NotNil(t, testPath.Delete)
+	}
+
+	viewPath := doc.Paths.Find("/test_view")
+	if assert.NotNil(t, viewPath) {
+		assert.NotNil(t, viewPath.Get)
+		assert.Nil(t, viewPath.Post)
+	}
+
+	assert.NotNil(t, doc.Paths.Find("/test_write"))
+	assert.Nil(t, doc.Paths.Find("/test_hidden"))
+
+	schema := doc.Components.Schemas["test"].Value
+	if assert.NotNil(t, schema) {
+		assert.Equal(t, []string{"s"}, schema.Required)
+		assert.True(t, schema.Properties["id"].Value.Type.Is("integer"))
+		assert.True(t, schema.Properties["s"].Value.Type.Is("string"))
+		assert.False(t, schema.Properties["s"].Value.Nullable)
+		assert.True(t, schema.Properties["price"].Value.Type.Is("number"))
+		assert.True(t, schema.Properties["price"].Value.Nullable)
+		assert.Equal(t, "byte", schema.Properties["data"].Value.Format)
+	}
+
+	for _, name := range []string{
+		queryParameterNameSelect, queryParameterNameOrder,
+		queryParameterNameLimit, queryParameterNameOffset,
+	} {
+		assert.Contains(t, doc.Components.Parameters, name)
+	}
+}
@@ -2,12 +2,17 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"mime"
 	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -19,6 +24,10 @@ const (
 	queryParameterNameLimit      = "limit"
 	queryParameterNameOffset     = "offset"
 	queryParameterNameOnConflict = "on_conflict"
+	queryParameterNameCursor     = "cursor"
+	queryParameterNameSchema     = "schema"
+	queryParameterNameFTSTable   = "fts_table"
+	queryParameterNameWith       = "with"
 
 	headerNamePrefer    = "Prefer"
 	headerNameRangeUnit = "range-unit"
@@ -30,6 +39,8 @@ const (
 
 	doubleColonCastingOperator = "::" // NOTE: this is a PostgreSQL specific operator
 	singleColonRenameOperator  = ":"
+	jsonPathArrowOperator      = "->"
+	jsonPathTextArrowOperator  = "->>"
 )
 
 type CompiledQuery struct {
@@ -44,21 +55,38 @@ func (q CompiledQuery) String() string {
 type QueryCompiler interface {
 	CompileAsSelect(table string) (CompiledQuery, error)
 	CompileAsExactCount(table string) (CompiledQuery, error)
+	CompileAsLastModified(table string, column string) (CompiledQuery, error)
+	CompileAsEstimatedCount(table string, columns []TableColumn) (CompiledEstimatedCount, error)
 	CompileAsUpdate(table string) (CompiledQuery, error)
+	CompileAsMergePatch(table string, columns []TableColumn) (CompiledQuery, error)
+	CompileAsJSONPatch(table string, columns []TableColumn) (CompiledJSONPatch, error)
 	CompileAsUpdateSingleEntry(table string) (CompiledQuery, error)
 	CompileAsInsert(table string) (CompiledQuery, error)
 	CompileAsDelete(table string) (CompiledQuery, error)
 	CompileContentRangeHeader(totalCount string) string
+	CompileNextCursorHeader(rows []map[string]interface{}) string
+	CompilePaginationLinks(totalCount string) string
+	// IsLimitCapped tells if the requested limit has been capped to the max limit.
+	IsLimitCapped() bool
 }
 
 type queryCompiler struct {
 	req *http.Request
+	// maxLimit is the maximum limit of the query. 0 means unlimited.
+	maxLimit    int64
+	limitCapped bool
 }
 
 func NewQueryCompilerFromRequest(req *http.Request) QueryCompiler {
 	return &queryCompiler{req: req}
 }
 
+// NewQueryCompilerFromRequestWithMaxLimit creates a query compiler which caps
+// the requested limit to maxLimit. 0 means unlimited.
+func NewQueryCompilerFromRequestWithMaxLimit(req *http.Request, maxLimit int64) QueryCompiler {
+	return &queryCompiler{req: req, maxLimit: maxLimit}
+}
+
 func (c *queryCompiler) getQueryParameters(name string) []string {
 	qp := c.req.URL.Query()
 	if !qp.Has(name) {
@@ -78,9 +106,13 @@ func (c *queryCompiler) getQueryParameter(name string) string {
 func (c *queryCompiler) CompileAsSelect(table string) (CompiledQuery, error) {
 	rv := CompiledQuery{}
 
+	resultColumns, err := c.getSelectResultColumns()
+	if err != nil {
+		return rv, err
+	}
 	rv.Query = fmt.Sprintf(
 		"select %s from %s",
-		strings.Join(c.getSelectResultColumns(), ", "),
+		strings.Join(resultColumns, ", "),
 		table,
 	)
 
@@ -88,6 +120,15 @@ func (c *queryCompiler) CompileAsSelect(table string) (CompiledQuery, error) {
 	if err != nil {
 		return rv, err
 	}
+	cursorClause, err := c.getCursorClause()
+	switch {
+	case err == nil:
+		parsedQueryClauses = append(parsedQueryClauses, cursorClause)
+	case errors.Is(err, errNoCursor):
+		// no cursor
+	default:
+		return rv, err
+	}
 	var queryClauses []string
 	for _, qc := range parsedQueryClauses {
 		queryClauses = append(queryClauses, qc.Expr)
@@ -118,6 +159,10 @@ func (c *queryCompiler) CompileAsSelect(table string) (CompiledQuery, error) {
 		return rv, err
 	}
 
+	if err := c.prependWithClause(&rv); err != nil {
+		return rv, err
+	}
+
 	return rv, nil
 }
 
@@ -142,9 +187,127 @@ func (c *queryCompiler) CompileAsExactCount(table string) (CompiledQuery, error)
 		rv.Query = fmt.Sprintf("%s where %s", rv.Query, strings.Join(queryClauses, " and "))
 	}
 
+	if err := c.prependWithClause(&rv); err != nil {
+		return rv, err
+	}
+
 	return rv, nil
 }
 
+// CompileAsLastModified compiles the query for reading the latest value of the column
+// among the rows matched by the request.
+func (c *queryCompiler) CompileAsLastModified(table string, column string) (CompiledQuery, error) {
+	rv := CompiledQuery{}
+
+	rv.Query = fmt.Sprintf(
+		"select max(%s) from %s",
+		quoteIdentifier(column),
+		table,
+	)
+
+	parsedQueryClauses, err := c.getQueryClauses()
+	if err != nil {
+		return rv, err
+	}
+	var queryClauses []string
+	for _, qc := range parsedQueryClauses {
+		queryClauses = append(queryClauses, qc.Expr)
+		rv.Values = append(rv.Values, qc.Values...)
+	}
+	if len(queryClauses) > 0 {
+		rv.Query = fmt.Sprintf("%s where %s", rv.Query, strings.Join(queryClauses, " and "))
+	}
+
+	if err := c.prependWithClause(&rv); err != nil {
+		return rv, err
+	}
+
+	return rv, nil
+}
+
+// estimatedCountSampleSize is the number of rows sampled for estimating the average row size.
+const estimatedCountSampleSize = 1000
+
+var errEstimatedCountUnsupported = errors.New("estimated count unsupported")
+
+// CompiledEstimatedCount holds the queries for estimating the row count of a table
+// without a full table scan.
+type CompiledEstimatedCount struct {
+	// Stat checks if the table has been analyzed, i.e. has rows in sqlite_stat1.
+	Stat CompiledQuery
+	// StatRowCount reads the row count recorded by ANALYZE in sqlite_stat1.
+	StatRowCount CompiledQuery
+	// DatabaseSize reads the database size from page count and page size.
+	DatabaseSize CompiledQuery
+	// Sample reads the number of sampled rows and the average row size of the samples.
+	Sample CompiledQuery
+	// SampleSize is the max number of sampled rows. If fewer rows are sampled,
+	// the sampled row count is the exact count.
+	SampleSize int
+}
+
+// CompileAsEstimatedCount compiles the queries for estimating the row count.
+// The estimation doesn't apply to filtered requests, errEstimatedCountUnsupported
+// is returned for them.
+func (c *queryCompiler) CompileAsEstimatedCount(
+	table string,
+	columns []TableColumn,
+) (CompiledEstimatedCount, error) {
+	rv := CompiledEstimatedCount{}
+
+	parsedQueryClauses, err := c.getQueryClauses()
+	if err != nil {
+		return rv, err
+	}
+	if len(parsedQueryClauses) > 0 || len(columns) < 1 {
+		return rv, errEstimatedCountUnsupported
+	}
+	if len(c.getQueryParameters(queryParameterNameWith)) > 0 {
+		// the table might be shadowed by the common table expressions
+		return rv, errEstimatedCountUnsupported
+	}
+
+	return compileEstimatedTableCount(table, columns), nil
+}
+
+// compileEstimatedTableCount compiles the queries for estimating the row count of the table
+// without filters.
+func compileEstimatedTableCount(table string, columns []TableColumn) CompiledEstimatedCount {
+	rv := CompiledEstimatedCount{}
+
+	rv.Stat = CompiledQuery{
+		Query: "select count(1) from sqlite_master where type = 'table' and name = 'sqlite_stat1'",
+	}
+	rv.StatRowCount = CompiledQuery{
+		// the first integer of the stat column is the number of rows in the table
+		Query:  "select cast(stat as integer) from sqlite_stat1 where tbl = ? order by idx is not null limit 1",
+		Values: []interface{}{table},
+	}
+	rv.DatabaseSize = CompiledQuery{
+		Query: "select page_count * page_size from pragma_page_count(), pragma_page_size()",
+	}
+
+	rowSizeExprs := make([]string, 0, len(columns))
+	selectColumns := make([]string, 0, len(columns))
+	for _, column := range columns {
+		name := `"` + strings.ReplaceAll(column.Name, `"`, `""`) + `"`
+		selectColumns = append(selectColumns, name)
+		rowSizeExprs = append(rowSizeExprs, fmt.Sprintf("length(quote(%s))", name))
+	}
+	rv.SampleSize = estimatedCountSampleSize
+	rv.Sample = CompiledQuery{
+		Query: fmt.Sprintf(
+			"select count(1), coalesce(avg(%s), 0) from (select %s from %s limit %d)",
+			strings.Join(rowSizeExprs, " + "),
+			strings.Join(selectColumns, ", "),
+			table,
+			rv.SampleSize,
+		),
+	}
+
+	return rv
+}
+
 func (c *queryCompiler) CompileAsUpdate(table string) (CompiledQuery, error) {
 	rv := CompiledQuery{}
 
@@ -162,12 +325,89 @@ func (c *queryCompiler) CompileAsUpdate(table string) (CompiledQuery, error) {
 		return rv, ErrBadRequest.WithHint("too many data to update")
 	}
 
-	columns := payload.GetSortedColumns()
-	updateValues := payload.Payload[0]
+	values := make(map[string]interface{}, len(payload.Payload[0]))
+	for column, value := range payload.Payload[0] {
+		if v, ok := parseArithmeticUpdateValue(value); ok {
+			values[column] = v
+		} else {
+			values[column] = value
+		}
+	}
+
+	return c.compileUpdate(table, payload.GetSortedColumns(), values)
+}
+
+const (
+	arithmeticOperatorAdd      = "add"
+	arithmeticOperatorSubtract = "subtract"
+)
+
+// arithmeticUpdateValue updates the column relative to its current value, which avoids
+// read-modify-write races.
+type arithmeticUpdateValue struct {
+	// Operator is the SQL arithmetic operator.
+	Operator string
+	Operand  interface{}
+}
+
+// parseArithmeticUpdateValue parses the `add.N` or `subtract.N` update value:
+//
+//	add.5 => col = col + 5
+//	subtract.3 => col = col - 3
+//
+// Values with non-numeric operand are set as is.
+func parseArithmeticUpdateValue(value interface{}) (arithmeticUpdateValue, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return arithmeticUpdateValue{}, false
+	}
+	ps := strings.SplitN(s, ".", 2)
+	if len(ps) != 2 {
+		return arithmeticUpdateValue{}, false
+	}
+
+	var rv arithmeticUpdateValue
+	switch ps[0] {
+	case arithmeticOperatorAdd:
+		rv.Operator = "+"
+	case arithmeticOperatorSubtract:
+		rv.Operator = "-"
+	default:
+		return arithmeticUpdateValue{}, false
+	}
+
+	if i, err := strconv.ParseInt(ps[1], 10, 64); err == nil {
+		rv.Operand = i
+	} else if f, err := strconv.ParseFloat(ps[1], 64); err == nil {
+		rv.Operand = f
+	} else {
+		return arithmeticUpdateValue{}, false
+	}
+
+	return rv, true
+}
+
+// compileUpdate compiles the update statement setting the columns to the values,
+// filtered by the query clauses.
+func (c *queryCompiler) compileUpdate(
+	table string,
+	columns []string,
+	values map[string]interface{},
+) (CompiledQuery, error) {
+	rv := CompiledQuery{}
+
 	var columnPlaceholders []string
 	for _, column := range columns {
+		if v, ok := values[column].(arithmeticUpdateValue); ok {
+			columnPlaceholders = append(
+				columnPlaceholders,
+				fmt.Sprintf("%s = %s %s ?", column, column, v.Operator),
+			)
+			rv.Values = append(rv.Values, v.Operand)
+			continue
+		}
 		columnPlaceholders = append(columnPlaceholders, fmt.Sprintf("%s = ?", column))
-		rv.Values = append(rv.Values, updateValues[column])
+		rv.Values = append(rv.Values, values[column])
 	}
 
 	rv.Query = fmt.Sprintf(
@@ -192,6 +432,182 @@ func (c *queryCompiler) CompileAsUpdate(table string) (CompiledQuery, error) {
 	return rv, nil
 }
 
+// CompiledJSONPatch is the compiled JSON Patch request.
+type CompiledJSONPatch struct {
+	// Test counts the target rows failing the test operations. Nil if there is no test operation.
+	Test *CompiledQuery
+	// Update applies the add, replace & remove operations.
+	Update CompiledQuery
+}
+
+const (
+	jsonPatchOpAdd     = "add"
+	jsonPatchOpReplace = "replace"
+	jsonPatchOpRemove  = "remove"
+	jsonPatchOpTest    = "test"
+)
+
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// column resolves the column name from the operation path. Only top-level paths are supported.
+func (op jsonPatchOperation) column() (string, error) {
+	if !strings.HasPrefix(op.Path, "/") || strings.Contains(op.Path[1:], "/") || len(op.Path) < 2 {
+		return "", ErrBadRequest.WithHint(fmt.Sprintf("unsupported path %q, only top-level column path is supported", op.Path))
+	}
+
+	// ref: https://www.rfc-editor.org/rfc/rfc6901#section-4
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(op.Path[1:]), nil
+}
+
+// CompileAsJSONPatch compiles the JSON Patch (RFC 6902) request. The add, replace & remove
+// operations are compiled as update statement, and the test operations are compiled as
+// query for checking the target rows before the update.
+//
+// ref: https://www.rfc-editor.org/rfc/rfc6902
+func (c *queryCompiler) CompileAsJSONPatch(table string, columns []TableColumn) (CompiledJSONPatch, error) {
+	rv := CompiledJSONPatch{}
+
+	body, err := c.readyRequestBody()
+	if err != nil {
+		if isRequestBodyTooLarge(err) {
+			return rv, errRequestBodyTooLarge
+		}
+		return rv, err
+	}
+
+	var ops []jsonPatchOperation
+	if err := json.Unmarshal(body, &ops); err != nil {
+		return rv, ErrBadRequest.WithHint("JSON patch must be an array of operations")
+	}
+
+	knownColumns := make(map[string]struct{}, len(columns))
+	for _, column := range columns {
+		knownColumns[column.Name] = struct{}{}
+	}
+
+	// values to set, operations are applied in order so later values take precedence
+	values := map[string]interface{}{}
+	var testColumns []string
+	testValues := map[string]interface{}{}
+	for _, op := range ops {
+		column, err := op.column()
+		if err != nil {
+			return rv, err
+		}
+		if _, ok := knownColumns[column]; !ok {
+			return rv, ErrBadRequest.WithHint(fmt.Sprintf("unknown column %q", column))
+		}
+		switch op.Value.(type) {
+		case map[string]interface{}, []interface{}:
+			return rv, ErrBadRequest.WithHint(fmt.Sprintf("column %q must be a scalar value", column))
+		}
+
+		switch op.Op {
+		case jsonPatchOpAdd, jsonPatchOpReplace:
+			values[column] = op.Value
+		case jsonPatchOpRemove:
+			values[column] = nil
+		case jsonPatchOpTest:
+			if v, ok := values[column]; ok {
+				// test against the value set by previous operations
+				if !reflect.DeepEqual(v, op.Value) {
+					return rv, ErrConflict.WithHint(fmt.Sprintf("test failed for column %q", column))
+				}
+				continue
+			}
+			if _, ok := testValues[column]; !ok {
+				testColumns = append(testColumns, column)
+			}
+			testValues[column] = op.Value
+		default:
+			return rv, ErrBadRequest.WithHint(fmt.Sprintf("unsupported operation %q", op.Op))
+		}
+	}
+	if len(values) < 1 {
+		return rv, ErrBadRequest.WithHint("no columns to update")
+	}
+
+	updateColumns := make([]string, 0, len(values))
+	for column := range values {
+		updateColumns = append(updateColumns, column)
+	}
+	sort.Strings(updateColumns)
+	rv.Update, err = c.compileUpdate(table, updateColumns, values)
+	if err != nil {
+		return rv, err
+	}
+
+	if len(testColumns) > 0 {
+		test := CompiledQuery{}
+		var testExprs []string
+		for _, column := range testColumns {
+			testExprs = append(testExprs, fmt.Sprintf("%s is ?", column))
+			test.Values = append(test.Values, testValues[column])
+		}
+		qcs := []string{fmt.Sprintf("not (%s)", strings.Join(testExprs, " and "))}
+
+		parsedQueryClauses, err := c.getQueryClauses()
+		if err != nil {
+			return rv, err
+		}
+		for _, qc := range parsedQueryClauses {
+			qcs = append(qcs, qc.Expr)
+			test.Values = append(test.Values, qc.Values...)
+		}
+		test.Query = fmt.Sprintf("select count(*) from %s where %s", table, strings.Join(qcs, " and "))
+		rv.Test = &test
+	}
+
+	return rv, nil
+}
+
+// CompileAsMergePatch compiles the JSON Merge Patch (RFC 7396) request as update statement.
+// Columns with null value are set to NULL, and absent columns are left unchanged.
+//
+// ref: https://www.rfc-editor.org/rfc/rfc7396
+func (c *queryCompiler) CompileAsMergePatch(table string, columns []TableColumn) (CompiledQuery, error) {
+	rv := CompiledQuery{}
+
+	body, err := c.readyRequestBody()
+	if err != nil {
+		if isRequestBodyTooLarge(err) {
+			return rv, errRequestBodyTooLarge
+		}
+		return rv, err
+	}
+
+	var patch map[string]interface{}
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		return rv, ErrBadRequest.WithHint("merge patch must be a JSON object")
+	}
+	if len(patch) < 1 {
+		return rv, ErrBadRequest.WithHint("no columns to update")
+	}
+
+	knownColumns := make(map[string]struct{}, len(columns))
+	for _, column := range columns {
+		knownColumns[column.Name] = struct{}{}
+	}
+	patchColumns := make([]string, 0, len(patch))
+	for column, value := range patch {
+		if _, ok := knownColumns[column]; !ok {
+			return rv, ErrBadRequest.WithHint(fmt.Sprintf("unknown column %q", column))
+		}
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return rv, ErrBadRequest.WithHint(fmt.Sprintf("column %q must be a scalar value", column))
+		}
+		patchColumns = append(patchColumns, column)
+	}
+	sort.Strings(patchColumns)
+
+	return c.compileUpdate(table, patchColumns, patch)
+}
+
 func (c *queryCompiler) CompileAsUpdateSingleEntry(table string) (CompiledQuery, error) {
 	rv := CompiledQuery{}
 
@@ -223,13 +639,14 @@ func (c *queryCompiler) CompileAsUpdateSingleEntry(table string) (CompiledQuery,
 		strings.Join(columnPlaceholders, ", "),
 	)
 
-	parsedQueryClauses, err := c.getQueryClauses()
+	parsedQueryClauses, err := c.getRequestQueryClauses()
 	if err != nil {
 		return rv, err
 	}
 	if len(parsedQueryClauses) < 1 {
 		return rv, ErrBadRequest.WithHint("expect to specifiy primary key query")
 	}
+	parsedQueryClauses = append(parsedQueryClauses, parenthesizeClauses(queryClausesFromContext(c.req.Context()))...)
 	var qcs []string
 	for _, qc := range parsedQueryClauses {
 		qcs = append(qcs, qc.Expr)
@@ -368,6 +785,16 @@ func getSelectResultColumn(columnName string) string {
 		//       no renaming will be applied
 	}
 
+	if strings.Contains(columnName, jsonPathArrowOperator) {
+		if expr, alias, ok := getJSONPathResultColumn(columnName); ok {
+			columnName = expr
+			if targetColumnName == "" {
+				targetColumnName = alias
+			}
+		}
+		// NOTE: if it's not a valid json path, the column is selected as is
+	}
+
 	if columnType == "" {
 		if targetColumnName == "" {
 			return columnName
@@ -381,22 +808,190 @@ func getSelectResultColumn(columnName string) string {
 	}
 }
 
-func (c *queryCompiler) getSelectResultColumns() []string {
+var jsonPathKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// getJSONPathResultColumn translates json path selection to json_extract call:
+//
+//	data->a->>b => json_extract(data, '$.a.b'), data_a_b
+//	data->items->0 => json_extract(data, '$.items[0]'), data_items_0
+//
+// Both -> and ->> extract the SQL value of the path.
+func getJSONPathResultColumn(s string) (expr string, alias string, ok bool) {
+	ps := strings.Split(strings.ReplaceAll(s, jsonPathTextArrowOperator, jsonPathArrowOperator), jsonPathArrowOperator)
+	if len(ps) < 2 {
+		return "", "", false
+	}
+	for _, p := range ps {
+		// keys are inlined to the query, only allow safe characters
+		if !jsonPathKeyPattern.MatchString(p) {
+			return "", "", false
+		}
+	}
+
+	path := "$"
+	for _, key := range ps[1:] {
+		if _, err := strconv.Atoi(key); err == nil {
+			path = fmt.Sprintf("%s[%s]", path, key)
+		} else {
+			path = fmt.Sprintf("%s.%s", path, key)
+		}
+	}
+
+	return fmt.Sprintf("json_extract(%s, '%s')", ps[0], path), strings.Join(ps, "_"), true
+}
+
+// getSelectSourceColumn returns the column name read by the select expression:
+//
+//	newName:data->a::text => data
+func getSelectSourceColumn(s string) string {
+	if ps := strings.SplitN(s, doubleColonCastingOperator, 2); len(ps) == 2 {
+		s = ps[0]
+	}
+	if ps := strings.SplitN(s, singleColonRenameOperator, 2); len(ps) == 2 {
+		s = ps[1]
+	}
+	if ps := strings.SplitN(s, jsonPathArrowOperator, 2); len(ps) == 2 {
+		s = ps[0]
+	}
+	return s
+}
+
+func (c *queryCompiler) getSelectResultColumns() ([]string, error) {
+	allowedColumns, restricted := allowedColumnsFromContext(c.req.Context())
+
 	v := c.getQueryParameter(queryParameterNameSelect)
-	if v == "" {
-		return []string{"*"}
+	if v == "" || v == "*" {
+		if restricted {
+			if len(allowedColumns) < 1 {
+				return nil, ErrAccessRestricted.WithHint("no column is allowed")
+			}
+			return allowedColumns, nil
+		}
+		return []string{"*"}, nil
 	}
 
-	vs := strings.Split(v, ",")
+	vs := splitSelectColumns(v)
 	// TOOD: support renaming
 	for idx := range vs {
+		// function calls are not resolved to the source columns, hence rejected when restricted
+		if err := c.checkColumnAllowed(vs[idx]); err != nil {
+			return nil, err
+		}
+		if isSelectFunctionCall(vs[idx]) {
+			column, err := getSelectFunctionResultColumn(vs[idx])
+			if err != nil {
+				return nil, err
+			}
+			vs[idx] = column
+			continue
+		}
 		vs[idx] = getSelectResultColumn(vs[idx])
 	}
 
-	return vs
+	return vs, nil
+}
+
+// checkColumnAllowed checks the column referenced by select, filter or order is allowed
+// by the column allow list from the request context.
+func (c *queryCompiler) checkColumnAllowed(column string) error {
+	allowedColumns, restricted := allowedColumnsFromContext(c.req.Context())
+	if restricted && !slices.Contains(allowedColumns, getSelectSourceColumn(column)) {
+		return ErrAccessRestricted.WithHint(fmt.Sprintf("column %s is not allowed", column))
+	}
+	return nil
+}
+
+// identifierPattern matches the plain identifiers which are safe to inline to the query.
+var identifierPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// rowidAliases are the implicit rowid columns of the tables.
+//
+// ref: https://www.sqlite.org/lang_createtable.html#rowid
+var rowidAliases = []string{"rowid", "oid", "_rowid_"}
+
+// checkFilterColumn checks the column referenced by filter, order or cursor before inlining
+// it to the query. The column must be a plain identifier, and a column of the target if
+// the target columns are known from the request context.
+func (c *queryCompiler) checkFilterColumn(column string) error {
+	if !identifierPattern.MatchString(column) {
+		return ErrBadRequest.WithHint(fmt.Sprintf("invalid column: %q", column))
+	}
+	if columns, ok := tableColumnsFromContext(c.req.Context()); ok {
+		known := slices.ContainsFunc(columns, func(s string) bool { return strings.EqualFold(s, column) }) ||
+			slices.ContainsFunc(rowidAliases, func(s string) bool { return strings.EqualFold(s, column) })
+		if !known {
+			return ErrBadRequest.WithHint(fmt.Sprintf("unknown column: %q", column))
+		}
+	}
+
+	return c.checkColumnAllowed(column)
+}
+
+type tableColumnsContextKey struct{}
+
+// WithTableColumns returns a copy of ctx with the column names of the target.
+func WithTableColumns(ctx context.Context, columns []string) context.Context {
+	return context.WithValue(ctx, tableColumnsContextKey{}, columns)
+}
+
+func tableColumnsFromContext(ctx context.Context) ([]string, bool) {
+	columns, ok := ctx.Value(tableColumnsContextKey{}).([]string)
+	return columns, ok
 }
 
+type allowedColumnsContextKey struct{}
+
+// WithAllowedColumns returns a copy of ctx restricting the selectable columns.
+func WithAllowedColumns(ctx context.Context, columns []string) context.Context {
+	return context.WithValue(ctx, allowedColumnsContextKey{}, columns)
+}
+
+func allowedColumnsFromContext(ctx context.Context) ([]string, bool) {
+	columns, ok := ctx.Value(allowedColumnsContextKey{}).([]string)
+	return columns, ok
+}
+
+type queryClausesContextKey struct{}
+
+// WithQueryClauses returns a copy of ctx with additional query clauses. These clauses
+// are applied to the compiled queries along with the clauses from the request.
+func WithQueryClauses(ctx context.Context, clauses ...CompiledQueryParameter) context.Context {
+	existing := queryClausesFromContext(ctx)
+	merged := make([]CompiledQueryParameter, 0, len(existing)+len(clauses))
+	merged = append(merged, existing...)
+	merged = append(merged, clauses...)
+	return context.WithValue(ctx, queryClausesContextKey{}, merged)
+}
+
+func queryClausesFromContext(ctx context.Context) []CompiledQueryParameter {
+	clauses, _ := ctx.Value(queryClausesContextKey{}).([]CompiledQueryParameter)
+	return clauses
+}
+
+// getQueryClauses returns the query clauses from the request and the request context.
 func (c *queryCompiler) getQueryClauses() ([]CompiledQueryParameter, error) {
+	rv, err := c.getRequestQueryClauses()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(rv, parenthesizeClauses(queryClausesFromContext(c.req.Context()))...), nil
+}
+
+// parenthesizeClauses wraps each clause in parentheses, so that the clauses are not
+// affected by the operator precedence when joined with "and".
+func parenthesizeClauses(clauses []CompiledQueryParameter) []CompiledQueryParameter {
+	rv := make([]CompiledQueryParameter, len(clauses))
+	for idx, clause := range clauses {
+		rv[idx] = CompiledQueryParameter{
+			Expr:   fmt.Sprintf("(%s)", clause.Expr),
+			Values: clause.Values,
+		}
+	}
+	return rv
+}
+
+func (c *queryCompiler) getRequestQueryClauses() ([]CompiledQueryParameter, error) {
 	var rv []CompiledQueryParameter
 	for k := range c.req.URL.Query() {
 		if !c.isColumnName(k) {
@@ -414,16 +1009,25 @@ func (c *queryCompiler) getQueryClauses() ([]CompiledQueryParameter, error) {
 		rv = append(rv, vs...)
 	}
 
-	return rv, nil
+	return parenthesizeClauses(rv), nil
 }
 
 func (c *queryCompiler) isColumnName(s string) bool {
+	return isColumnQueryParameter(s)
+}
+
+// isColumnQueryParameter checks if the query parameter name is a column filter.
+func isColumnQueryParameter(s string) bool {
 	switch strings.ToLower(s) {
 	case queryParameterNameSelect,
 		queryParameterNameOrder,
 		queryParameterNameLimit,
 		queryParameterNameOffset,
-		queryParameterNameOnConflict:
+		queryParameterNameOnConflict,
+		queryParameterNameCursor,
+		queryParameterNameSchema,
+		queryParameterNameFTSTable,
+		queryParameterNameWith:
 		return false
 	default:
 		return true
@@ -464,11 +1068,61 @@ func (c *queryCompiler) getQueryClausesByInput(
 	switch column {
 	case logicalOperatorAnd, logicalOperatorOr:
 		// or=a.eq.1,b.eq.2 => or(a.eq.1, b.eq.2)
-		return parseQueryClauses(fmt.Sprintf("%s(%s)", column, s))
+		return parseQueryClauses(fmt.Sprintf("%s(%s)", column, s), c.checkFilterColumn)
 	default:
+		if ftsTable := c.getQueryParameter(queryParameterNameFTSTable); ftsTable != "" {
+			if rv, ok, err := getFTSTableQueryClauses(ftsTable, column, s); ok {
+				if err != nil {
+					return nil, err
+				}
+				// the column refers to the full-text search table instead of the target
+				if !identifierPattern.MatchString(column) {
+					return nil, ErrBadRequest.WithHint(fmt.Sprintf("invalid column: %q", column))
+				}
+				return rv, c.checkColumnAllowed(column)
+			}
+		}
 		// id=eq.1
-		return parseQueryClauses(fmt.Sprintf("%s.%s", column, s))
+		return parseQueryClauses(fmt.Sprintf("%s.%s", column, s), c.checkFilterColumn)
+	}
+}
+
+var ftsTableNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// getFTSTableQueryClauses translates the fts query to match rows from the full-text search table,
+// which shares the rowid with the queried table:
+//
+//	title=fts.foo&fts_table=books_fts => rowid in (select rowid from books_fts where title MATCH 'foo')
+//
+// The second return value is false if s is not a fts query.
+func getFTSTableQueryClauses(
+	ftsTable string,
+	column string,
+	s string,
+) ([]CompiledQueryParameter, bool, error) {
+	const ftsOperatorPrefix = "fts."
+
+	op := "in"
+	if strings.HasPrefix(s, logicalOperatorNot+".") {
+		op = "not in"
+		s = s[len(logicalOperatorNot)+1:]
 	}
+	if !strings.HasPrefix(s, ftsOperatorPrefix) {
+		return nil, false, nil
+	}
+	if !ftsTableNamePattern.MatchString(ftsTable) {
+		return nil, true, ErrBadRequest.WithHint(fmt.Sprintf("invalid fts table: %q", ftsTable))
+	}
+
+	rv, err := mapAsFTSQuery(column, "fts", s[len(ftsOperatorPrefix):])
+	if err != nil {
+		return nil, true, err
+	}
+	for idx := range rv {
+		rv[idx].Expr = fmt.Sprintf("rowid %s (select rowid from %s where %s)", op, ftsTable, rv[idx].Expr)
+	}
+
+	return rv, true, nil
 }
 
 var orderByNulls = map[string]string{
@@ -476,6 +1130,14 @@ var orderByNulls = map[string]string{
 	"nullsfirst": "nulls first",
 }
 
+// orderByCollations maps the order suffix to the collating sequence.
+//
+// ref: https://www.sqlite.org/datatype3.html#collating_sequences
+var orderByCollations = map[string]string{
+	"nocase": "NOCASE",
+	"binary": "BINARY",
+}
+
 func (c *queryCompiler) getOrderClauses() ([]string, error) {
 	v := c.getQueryParameter(queryParameterNameOrder)
 	if v == "" {
@@ -492,6 +1154,17 @@ func (c *queryCompiler) getOrderClauses() ([]string, error) {
 	var vs []string
 	for _, v := range strings.Split(v, ",") {
 		ps := strings.Split(v, ".")
+		if !identifierPattern.MatchString(ps[0]) {
+			return nil, ErrBadRequest.WithHint(fmt.Sprintf("invalid order column: %q", ps[0]))
+		}
+		if err := c.checkColumnAllowed(ps[0]); err != nil {
+			return nil, err
+		}
+		// a.asc.nocase -> a collate NOCASE asc
+		if collation, exists := orderByCollations[ps[len(ps)-1]]; exists && len(ps) > 1 {
+			ps = ps[:len(ps)-1]
+			ps[0] = fmt.Sprintf("%s collate %s", ps[0], collation)
+		}
 		switch {
 		case len(ps) == 1:
 			vs = append(vs, ps[0])
@@ -511,8 +1184,153 @@ func (c *queryCompiler) getOrderClauses() ([]string, error) {
 	return vs, nil
 }
 
+var withClausePattern = regexp.MustCompile(`(?is)^\s*([a-z_][a-z0-9_]*)\s*(\([a-z0-9_,\s]*\))?\s*as\s*\((.+)\)\s*$`)
+
+// parseWithClause parses the common table expression from user input:
+//
+//	cte_name(col1)as(select 1) => cte_name(col1) AS (select 1)
+func parseWithClause(s string) (string, error) {
+	ms := withClausePattern.FindStringSubmatch(s)
+	if ms == nil {
+		return "", ErrBadRequest.WithHint(fmt.Sprintf("invalid with clause: %q", s))
+	}
+	name, columns, body := ms[1], strings.Join(strings.Fields(ms[2]), ""), ms[3]
+
+	// NOTE: the body is inlined to the query, hence we reject the inputs which might
+	//       terminate the statement, comment out the rest of the query or
+	//       break the parameter bindings.
+	for _, token := range []string{";", "--", "/*", "?"} {
+		if strings.Contains(body, token) {
+			return "", ErrBadRequest.WithHint(fmt.Sprintf("invalid with clause: %q", s))
+		}
+	}
+	// the body must not close the AS (...) group early
+	level := 0
+	for _, c := range body {
+		switch c {
+		case '(':
+			level += 1
+		case ')':
+			level -= 1
+		}
+		if level < 0 {
+			return "", ErrBadRequest.WithHint(fmt.Sprintf("invalid with clause: %q", s))
+		}
+	}
+	if level != 0 {
+		return "", ErrBadRequest.WithHint(fmt.Sprintf("invalid with clause: %q", s))
+	}
+
+	return fmt.Sprintf("%s%s AS (%s)", name, columns, body), nil
+}
+
+// prependWithClause prepends the common table expressions from the with query parameters.
+func (c *queryCompiler) prependWithClause(q *CompiledQuery) error {
+	vs := c.getQueryParameters(queryParameterNameWith)
+	if len(vs) < 1 {
+		return nil
+	}
+
+	ctes := make([]string, 0, len(vs))
+	for _, v := range vs {
+		cte, err := parseWithClause(v)
+		if err != nil {
+			return err
+		}
+		ctes = append(ctes, cte)
+	}
+	q.Query = fmt.Sprintf("WITH %s %s", strings.Join(ctes, ", "), q.Query)
+
+	return nil
+}
+
 var errNoLimitOffset = errors.New("no limit offset")
 
+var errNoCursor = errors.New("no cursor")
+
+// getCursorOrder returns the order column and the comparison operator for cursor pagination.
+// Cursor pagination is only possible when exactly one order column is specified.
+func (c *queryCompiler) getCursorOrder() (column string, op string, err error) {
+	v := c.getQueryParameter(queryParameterNameOrder)
+	if v == "" {
+		return "", "", errNoCursor
+	}
+	orders := strings.Split(v, ",")
+	if len(orders) != 1 {
+		return "", "", errNoCursor
+	}
+
+	ps := strings.Split(orders[0], ".")
+	op = ">"
+	for _, p := range ps[1:] {
+		if strings.EqualFold(p, "desc") {
+			op = "<"
+		}
+	}
+
+	return ps[0], op, nil
+}
+
+// getCursorClause translates the cursor query parameter to a query clause:
+//
+//	order=id.asc&cursor=10 => ("id" > 10)
+//	order=id.desc&cursor=10 => ("id" < 10)
+func (c *queryCompiler) getCursorClause() (CompiledQueryParameter, error) {
+	cursor := c.getQueryParameter(queryParameterNameCursor)
+	if cursor == "" {
+		return CompiledQueryParameter{}, errNoCursor
+	}
+
+	column, op, err := c.getCursorOrder()
+	if err != nil {
+		return CompiledQueryParameter{}, ErrBadRequest.WithHint("cursor requires exactly one order column")
+	}
+	if err := c.checkFilterColumn(column); err != nil {
+		return CompiledQueryParameter{}, err
+	}
+
+	_, offset, err := c.getLimitOffset()
+	if err != nil && !errors.Is(err, errNoLimitOffset) {
+		return CompiledQueryParameter{}, err
+	}
+	if offset != 0 || c.getQueryParameter(queryParameterNameOffset) != "" {
+		return CompiledQueryParameter{}, ErrBadRequest.WithHint("cursor cannot be used with offset")
+	}
+
+	return CompiledQueryParameter{
+		Expr:   fmt.Sprintf("(%s %s ?)", quoteIdentifier(column), op),
+		Values: []interface{}{cursor},
+	}, nil
+}
+
+// CompileNextCursorHeader returns the cursor value for retrieving the next page.
+// Empty string will be returned if cursor pagination is not applicable or there is
+// no more page to read.
+func (c *queryCompiler) CompileNextCursorHeader(rows []map[string]interface{}) string {
+	column, _, err := c.getCursorOrder()
+	if err != nil {
+		return ""
+	}
+
+	limit, offset, err := c.getLimitOffset()
+	if err != nil || offset != 0 || limit < 1 {
+		return ""
+	}
+	if int64(len(rows)) < limit {
+		// last page
+		return ""
+	}
+
+	v, exists := rows[len(rows)-1][column]
+	if !exists || v == nil {
+		return ""
+	}
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
 func (c *queryCompiler) CompileContentRangeHeader(totalCount string) string {
 	limit, offset, err := c.getLimitOffset()
 	if err != nil {
@@ -528,6 +1346,53 @@ func (c *queryCompiler) CompileContentRangeHeader(totalCount string) string {
 	return fmt.Sprintf("%d-%d/%s", offset, offset+limit-1, totalCount)
 }
 
+// CompilePaginationLinks returns the Link header value (RFC 5988) for paginated response.
+// The first and last relations are only available when the total count is known.
+func (c *queryCompiler) CompilePaginationLinks(totalCount string) string {
+	limit, offset, err := c.getLimitOffset()
+	if err != nil || limit < 1 {
+		// not paginated or unbound range
+		return ""
+	}
+
+	total, err := strconv.ParseInt(totalCount, 10, 64)
+	countKnown := err == nil
+
+	pageURL := func(offset int64) string {
+		u := *c.req.URL
+		qp := u.Query()
+		qp.Set(queryParameterNameLimit, strconv.FormatInt(limit, 10))
+		qp.Set(queryParameterNameOffset, strconv.FormatInt(offset, 10))
+		u.RawQuery = qp.Encode()
+		return u.RequestURI()
+	}
+
+	var links []string
+	addLink := func(offset int64, rel string) {
+		links = append(links, fmt.Sprintf("<%s>; rel=%q", pageURL(offset), rel))
+	}
+
+	if countKnown {
+		addLink(0, "first")
+	}
+	if offset > 0 {
+		prevOffset := offset - limit
+		if prevOffset < 0 {
+			prevOffset = 0
+		}
+		addLink(prevOffset, "prev")
+	}
+	if nextOffset := offset + limit; !countKnown || nextOffset < total {
+		addLink(nextOffset, "next")
+	}
+	if countKnown {
+		// the last page holds the last limit rows regardless of the current offset
+		addLink(max(total-limit, 0), "last")
+	}
+
+	return strings.Join(links, ", ")
+}
+
 func (c *queryCompiler) getLimitOffset() (limit int64, offset int64, err error) {
 	limit, offset, err = c.getLimitOffsetFromHeader()
 	if err == nil {
@@ -539,6 +1404,23 @@ func (c *queryCompiler) getLimitOffset() (limit int64, offset int64, err error)
 	return c.getLimitOffsetFromQueryParameter()
 }
 
+// capLimit caps the limit to the max limit. Negative limit means no upper bound,
+// which is also capped.
+func (c *queryCompiler) capLimit(limit int64) int64 {
+	if c.maxLimit < 1 {
+		return limit
+	}
+	if limit < 0 || limit > c.maxLimit {
+		c.limitCapped = true
+		return c.maxLimit
+	}
+	return limit
+}
+
+func (c *queryCompiler) IsLimitCapped() bool {
+	return c.limitCapped
+}
+
 func (c *queryCompiler) getLimitOffsetFromHeader() (int64, int64, error) {
 	rangeValue := c.req.Header.Get(headerNameRange)
 	if rangeValue == "" {
@@ -558,14 +1440,14 @@ func (c *queryCompiler) getLimitOffsetFromHeader() (int64, int64, error) {
 		// no limit, per: https://www.sqlite.org/lang_select.html#limitoffset
 		// If the LIMIT expression evaluates to a negative value,
 		// then there is no upper bound on the number of rows returned
-		return -1, offset, nil
+		return c.capLimit(-1), offset, nil
 	}
 	to, err := strconv.ParseInt(ps[1], 10, 64)
 	if err != nil {
 		return 0, 0, err
 	}
 
-	return to - offset + 1, offset, nil
+	return c.capLimit(to - offset + 1), offset, nil
 }
 
 func (c *queryCompiler) getLimitOffsetFromQueryParameter() (int64, int64, error) {
@@ -581,6 +1463,7 @@ func (c *queryCompiler) getLimitOffsetFromQueryParameter() (int64, int64, error)
 	if err != nil {
 		return 0, 0, err
 	}
+	limit = c.capLimit(limit)
 	offset, err := getInt64(queryParameterNameOffset)
 	switch {
 	case err == nil:
@@ -606,12 +1489,24 @@ func (c *queryCompiler) getInputPayload() (InputPayloadWithColumns, error) {
 		}
 
 		switch strings.ToLower(mt) {
-		case "application/json":
+		case mediaTypeJSON:
 			payload, err := c.tryReadInputPayloadAsJSON()
 			if err != nil {
+				if isRequestBodyTooLarge(err) {
+					return payload, errRequestBodyTooLarge
+				}
 				continue
 			}
 			return payload, nil
+		case mediaTypeCSV:
+			payload, err := c.tryReadInputPayloadAsCSV()
+			if err != nil {
+				if isRequestBodyTooLarge(err) {
+					return payload, errRequestBodyTooLarge
+				}
+				return payload, ErrBadRequest.WithHint(fmt.Sprintf("invalid csv payload: %s", err))
+			}
+			return payload, nil
 		default:
 			continue
 		}
@@ -620,6 +1515,13 @@ func (c *queryCompiler) getInputPayload() (InputPayloadWithColumns, error) {
 	return InputPayloadWithColumns{}, ErrUnsupportedMediaType
 }
 
+var errRequestBodyTooLarge = ErrBadRequest.WithHint("request body too large")
+
+func isRequestBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
 func (c *queryCompiler) tryReadInputPayloadAsJSON() (InputPayloadWithColumns, error) {
 	rv := InputPayloadWithColumns{
 		Columns: map[string]struct{}{},
@@ -662,6 +1564,45 @@ func (c *queryCompiler) tryReadInputPayloadAsJSON() (InputPayloadWithColumns, er
 	return rv, nil
 }
 
+// tryReadInputPayloadAsCSV reads the request body as CSV. The first record provides
+// the column names, and empty fields are read as NULL.
+func (c *queryCompiler) tryReadInputPayloadAsCSV() (InputPayloadWithColumns, error) {
+	rv := InputPayloadWithColumns{
+		Columns: map[string]struct{}{},
+	}
+
+	body, err := c.readyRequestBody()
+	if err != nil {
+		return rv, err
+	}
+
+	records, err := csv.NewReader(bytes.NewBuffer(body)).ReadAll()
+	if err != nil {
+		return rv, err
+	}
+	if len(records) < 1 {
+		return rv, nil
+	}
+
+	columns := records[0]
+	for _, column := range columns {
+		rv.Columns[column] = struct{}{}
+	}
+	for _, record := range records[1:] {
+		p := make(map[string]interface{}, len(columns))
+		for idx, column := range columns {
+			if record[idx] == "" {
+				p[column] = nil
+			} else {
+				p[column] = record[idx]
+			}
+		}
+		rv.Payload = append(rv.Payload, p)
+	}
+
+	return rv, nil
+}
+
 func (c *queryCompiler) readyRequestBody() ([]byte, error) {
 	source := c.req.Body
 	defer source.Close()
@@ -773,9 +1714,10 @@ func tokenizeSubQueries(s string) []string {
 	return rv
 }
 
-// parseQueryClauses parses user input queries to query parameters.
+// parseQueryClauses parses user input queries to query parameters. checkColumn is called
+// with each referenced column if not nil.
 // FIXME: this is a very naive and slow (O(n^2)) parser. We should employ a proper lexer & parser.
-func parseQueryClauses(s string) ([]CompiledQueryParameter, error) {
+func parseQueryClauses(s string, checkColumn func(column string) error) ([]CompiledQueryParameter, error) {
 	const (
 		logicalOperatorNotPrefix = logicalOperatorNot + "."
 		logicalOperatorAndPrefix = logicalOperatorAnd + "("
@@ -796,7 +1738,7 @@ func parseQueryClauses(s string) ([]CompiledQueryParameter, error) {
 
 		var rv []CompiledQueryParameter
 		for _, subQuery := range subQueries {
-			q, err := parseQueryClauses(subQuery)
+			q, err := parseQueryClauses(subQuery, checkColumn)
 			if err != nil {
 				return nil, err
 			}
@@ -805,11 +1747,11 @@ func parseQueryClauses(s string) ([]CompiledQueryParameter, error) {
 
 		return rv, nil
 	case strings.HasPrefix(s, logicalOperatorNotPrefix):
-		return negateCompiledQueryParameters(parseQueryClauses(s[len(logicalOperatorNotPrefix):]))
+		return negateCompiledQueryParameters(parseQueryClauses(s[len(logicalOperatorNotPrefix):], checkColumn))
 	case strings.HasPrefix(s, logicalOperatorAndPrefix):
-		return andCompiledQueryParameters(parseQueryClauses(s[len(logicalOperatorAnd):]))
+		return andCompiledQueryParameters(parseQueryClauses(s[len(logicalOperatorAnd):], checkColumn))
 	case strings.HasPrefix(s, logicalOperatorOrPrefix):
-		return orCompiledQueryParameters(parseQueryClauses(s[len(logicalOperatorOr):]))
+		return orCompiledQueryParameters(parseQueryClauses(s[len(logicalOperatorOr):], checkColumn))
 	default:
 		// column.operator.value | column.not.operator.value
 		ps := strings.SplitN(s, ".", 3)
@@ -817,6 +1759,11 @@ func parseQueryClauses(s string) ([]CompiledQueryParameter, error) {
 			return nil, ErrBadRequest.WithHint(fmt.Sprintf("invalid query clause: %q", s))
 		}
 		column, op, value := ps[0], ps[1], ps[2]
+		if checkColumn != nil {
+			if err := checkColumn(column); err != nil {
+				return nil, err
+			}
+		}
 		negate := false
 		if op == logicalOperatorNot {
 			negate = true
@@ -858,26 +1805,68 @@ func mapUserInputAsUnaryQuery(op string) queryOpereatorUserInputParseFunc {
 	}
 }
 
-func mapAsInQuery(column string, userInput string, value string) ([]CompiledQueryParameter, error) {
-	value = strings.TrimPrefix(value, "(")
-	value = strings.TrimSuffix(value, ")")
-	value = fmt.Sprintf("[%s]", value)
-	var ps []interface{}
-	// FIXME: this is not 100% safe to parse user input as JSON
-	if err := json.Unmarshal([]byte(value), &ps); err != nil {
-		return nil, err
+// mapAsILikeQuery matches case-insensitively. SQLite doesn't support ILIKE, hence both sides
+// are lowered before matching.
+func mapAsILikeQuery(column string, userInput string, value string) ([]CompiledQueryParameter, error) {
+	rv := []CompiledQueryParameter{
+		{
+			Expr:   fmt.Sprintf("LOWER(%s) LIKE LOWER(?)", column),
+			Values: []interface{}{value},
+		},
 	}
 
+	return rv, nil
+}
+
+// mapAsFTSQuery matches the full-text search table. Use the table name as the column
+// to match all columns of the table:
+//
+//	books_fts=fts.foo => books_fts MATCH 'foo'
+//	title=fts.foo => title MATCH 'foo'
+func mapAsFTSQuery(column string, userInput string, value string) ([]CompiledQueryParameter, error) {
 	rv := []CompiledQueryParameter{
 		{
-			Expr:   fmt.Sprintf("%s IN (%s)", column, strings.Repeat("?,", len(ps)-1)+"?"),
-			Values: ps,
+			Expr:   fmt.Sprintf("%s MATCH ?", column),
+			Values: []interface{}{value},
 		},
 	}
 
 	return rv, nil
 }
 
+func mapAsInQuery(column string, userInput string, value string) ([]CompiledQueryParameter, error) {
+	return mapAsInListQuery("IN")(column, userInput, value)
+}
+
+func mapAsNotInQuery(column string, userInput string, value string) ([]CompiledQueryParameter, error) {
+	return mapAsInListQuery("NOT IN")(column, userInput, value)
+}
+
+func mapAsInListQuery(op string) queryOpereatorUserInputParseFunc {
+	return func(column string, userInput string, value string) ([]CompiledQueryParameter, error) {
+		value = strings.TrimPrefix(value, "(")
+		value = strings.TrimSuffix(value, ")")
+		value = fmt.Sprintf("[%s]", value)
+		var ps []interface{}
+		// FIXME: this is not 100% safe to parse user input as JSON
+		if err := json.Unmarshal([]byte(value), &ps); err != nil {
+			return nil, err
+		}
+
+		// NOTE: the list is bound as a single JSON parameter so that large lists don't
+		//       exceed SQLITE_MAX_VARIABLE_NUMBER (999 for legacy SQLite versions).
+		//       SQLite accepts empty list, which matches no rows for IN and all rows for NOT IN.
+		rv := []CompiledQueryParameter{
+			{
+				Expr:   fmt.Sprintf("%s %s (select value from json_each(?))", column, op),
+				Values: []interface{}{value},
+			},
+		}
+
+		return rv, nil
+	}
+}
+
 func mapAsIsQuery(column string, userInput string, value string) ([]CompiledQueryParameter, error) {
 	rv := CompiledQueryParameter{
 		Expr:   fmt.Sprintf("%s IS ?", column),
@@ -898,16 +1887,127 @@ func mapAsIsQuery(column string, userInput string, value string) ([]CompiledQuer
 	return []CompiledQueryParameter{rv}, nil
 }
 
+// splitJSONPathQuery splits the json path and the operator query:
+//
+//	->>$.name.eq.Alice => $.name, eq, Alice
+//	$.tags.eq.foo => $.tags, eq, foo
+//	eq.foo => $, eq, foo
+func splitJSONPathQuery(value string) (path string, op string, opValue string, err error) {
+	value = strings.TrimPrefix(value, jsonPathTextArrowOperator)
+	value = strings.TrimPrefix(value, jsonPathArrowOperator)
+	if !strings.HasPrefix(value, "$") {
+		value = "$." + value
+	}
+
+	ps := strings.Split(value, ".")
+	// NOTE: the first segment is always the path root
+	for idx := 1; idx < len(ps)-1; idx++ {
+		if _, exists := jsonPathQueryOperators[ps[idx]]; exists {
+			return strings.Join(ps[:idx], "."), ps[idx], strings.Join(ps[idx+1:], "."), nil
+		}
+	}
+
+	return "", "", "", ErrBadRequest.WithHint(fmt.Sprintf("invalid json path query: %q", value))
+}
+
+// quoteSQLString quotes s as SQL string literal.
+func quoteSQLString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// mapAsJSONPathQuery filters by the value of json path:
+//
+//	data=jpath.->>$.name.eq.Alice => json_extract(data, '$.name') = 'Alice'
+func mapAsJSONPathQuery(column string, userInput string, value string) ([]CompiledQueryParameter, error) {
+	path, op, opValue, err := splitJSONPathQuery(value)
+	if err != nil {
+		return nil, err
+	}
+
+	rv, err := jsonPathQueryOperators[op](fmt.Sprintf("json_extract(%s, %s)", column, quoteSQLString(path)), op, opValue)
+	if err != nil {
+		return nil, err
+	}
+
+	return withJSONNumberValues(rv), nil
+}
+
+// withJSONNumberValues converts the numeric values to numbers. Unlike table columns,
+// the extracted json values have no type affinity, hence text values never equal to
+// numbers in comparison.
+func withJSONNumberValues(ps []CompiledQueryParameter) []CompiledQueryParameter {
+	for _, p := range ps {
+		for idx, v := range p.Values {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				p.Values[idx] = i
+			} else if f, err := strconv.ParseFloat(s, 64); err == nil {
+				p.Values[idx] = f
+			}
+		}
+	}
+
+	return ps
+}
+
+// mapAsJSONArrayElementQuery filters rows with any element of the json array matching the query:
+//
+//	tags=jarrelem.eq.foo => exists (select 1 from json_each(tags, '$') where value = 'foo')
+//	data=jarrelem.$.tags.eq.foo => exists (select 1 from json_each(data, '$.tags') where value = 'foo')
+func mapAsJSONArrayElementQuery(column string, userInput string, value string) ([]CompiledQueryParameter, error) {
+	path, op, opValue, err := splitJSONPathQuery(value)
+	if err != nil {
+		return nil, err
+	}
+
+	rv, err := jsonPathQueryOperators[op]("value", op, opValue)
+	if err != nil {
+		return nil, err
+	}
+	for idx := range rv {
+		rv[idx].Expr = fmt.Sprintf(
+			"exists (select 1 from json_each(%s, %s) where %s)",
+			column, quoteSQLString(path), rv[idx].Expr,
+		)
+	}
+
+	return withJSONNumberValues(rv), nil
+}
+
+// jsonPathQueryOperators are the operators can be applied to json path values.
+// NOTE: it's populated from queryOpereators in init to avoid initialization cycle.
+var jsonPathQueryOperators = map[string]queryOpereatorUserInputParseFunc{}
+
+func init() {
+	for op, f := range queryOpereators {
+		switch op {
+		case "jpath", "jarrelem", "fts":
+			// nested json path query and full-text search are not supported
+		default:
+			jsonPathQueryOperators[op] = f
+		}
+	}
+}
+
 // ref: https://postgrest.org/en/stable/api.html#operators
 var queryOpereators = map[string]queryOpereatorUserInputParseFunc{
 	"eq": mapUserInputAsUnaryQuery("="),
 	"gt": mapUserInputAsUnaryQuery(">"), "ge": mapUserInputAsUnaryQuery(">="),
 	"lt": mapUserInputAsUnaryQuery("<"), "le": mapUserInputAsUnaryQuery("<="),
 	"neq":  mapUserInputAsUnaryQuery("!="),
-	"like": mapUserInputAsUnaryQuery("LIKE"), "ilike": mapUserInputAsUnaryQuery("ILIKE"),
+	"like": mapUserInputAsUnaryQuery("LIKE"), "ilike": mapAsILikeQuery,
 	"in": mapAsInQuery,
-	"is": mapAsIsQuery,
-	// fts / plfts / phfts / wfts are unsupported
+	// notin is an alias of not.in
+	"notin": mapAsNotInQuery,
+	"is":    mapAsIsQuery,
+	// jpath / jarrelem query values stored as json text
+	"jpath":    mapAsJSONPathQuery,
+	"jarrelem": mapAsJSONArrayElementQuery,
+	"fts":      mapAsFTSQuery,
+	// plfts / phfts / wfts are unsupported
 	// cs / cd / ov are unsupported
 	// sl / sr / nxr / nxl / adj are unsupported
 }
@@ -950,13 +2050,16 @@ type CountMethod string
 const (
 	countNone  CountMethod = "" // fallback
 	countExact CountMethod = "exact"
-	// TODO: support planned / estimated count
+	// countEstimated estimates the row count from the database page count and
+	// sampled average row size, or the ANALYZE stats if available.
+	countEstimated CountMethod = "estimated"
+	// TODO: support planned count
 )
 
 // Valid checks if the count method is valid.
 func (c CountMethod) Valid() bool {
 	switch c {
-	case countNone, countExact:
+	case countNone, countExact, countEstimated:
 		return true
 	default:
 		return false
@@ -982,10 +2085,56 @@ func (r ResolutionMethod) Valid() bool {
 	}
 }
 
+// HandlingMethod specifies how unrecognised preferences are handled.
+type HandlingMethod string
+
+const (
+	handlingNone    HandlingMethod = "" // fallback, same as lenient
+	handlingLenient HandlingMethod = "lenient"
+	handlingStrict  HandlingMethod = "strict"
+)
+
+// Valid checks if the handling method is valid.
+func (h HandlingMethod) Valid() bool {
+	switch h {
+	case handlingNone, handlingLenient, handlingStrict:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReturnMethod specifies the response of write requests.
+type ReturnMethod string
+
+const (
+	returnNone    ReturnMethod = "" // fallback, same as minimal
+	returnMinimal ReturnMethod = "minimal"
+	// returnHeadersOnly responds with the result headers (e.g. X-Rows-Affected, Location) only.
+	returnHeadersOnly ReturnMethod = "headers-only"
+)
+
+// Valid checks if the return method is valid.
+func (r ReturnMethod) Valid() bool {
+	switch r {
+	case returnNone, returnMinimal, returnHeadersOnly:
+		return true
+	default:
+		return false
+	}
+}
+
 type Preference struct {
 	Resolution ResolutionMethod
 	Count      CountMethod
-	// TODO: retrun
+	// MaxAffected is the maximum number of rows allowed to be affected by update or delete.
+	// 0 means unlimited.
+	MaxAffected int
+	// Strict is true when `handling=strict` is requested. Unrecognised preferences
+	// are rejected in strict mode, and ignored otherwise.
+	Strict bool
+	// Return specifies the response of write requests.
+	Return ReturnMethod
 }
 
 func ParsePreferenceFromRequest(req *http.Request) (Preference, error) {
@@ -996,6 +2145,7 @@ func ParsePreferenceFromRequest(req *http.Request) (Preference, error) {
 		return rv, nil
 	}
 
+	var unknownPreferences []string
 	for _, p := range strings.Split(v, ",") {
 		p = strings.TrimSpace(p)
 		if p == "" {
@@ -1004,6 +2154,7 @@ func ParsePreferenceFromRequest(req *http.Request) (Preference, error) {
 		// a=b => a,b
 		ps := strings.SplitN(p, "=", 2)
 		if len(ps) < 2 {
+			unknownPreferences = append(unknownPreferences, p)
 			continue
 		}
 
@@ -1022,8 +2173,37 @@ func ParsePreferenceFromRequest(req *http.Request) (Preference, error) {
 			} else {
 				return rv, ErrBadRequest.WithHint(fmt.Sprintf("unsupported resolution preference: %s", ps[1]))
 			}
+		case "max-affected":
+			maxAffected, err := strconv.Atoi(ps[1])
+			if err != nil || maxAffected < 1 {
+				return rv, ErrBadRequest.WithHint(fmt.Sprintf("invalid max-affected preference: %s", ps[1]))
+			}
+			rv.MaxAffected = maxAffected
+		case "return":
+			// return=representation is not supported, which is handled as unknown preference
+			returnMethod := ReturnMethod(strings.ToLower(ps[1]))
+			if returnMethod.Valid() {
+				rv.Return = returnMethod
+			} else {
+				unknownPreferences = append(unknownPreferences, p)
+			}
+		case "handling":
+			handling := HandlingMethod(strings.ToLower(ps[1]))
+			if handling.Valid() {
+				rv.Strict = handling == handlingStrict
+			} else {
+				return rv, ErrBadRequest.WithHint(fmt.Sprintf("unsupported handling preference: %s", ps[1]))
+			}
+		default:
+			unknownPreferences = append(unknownPreferences, p)
 		}
 	}
 
+	if rv.Strict && len(unknownPreferences) > 0 {
+		return rv, ErrBadRequest.WithHint(
+			fmt.Sprintf("unsupported preferences: %s", strings.Join(unknownPreferences, ", ")),
+		)
+	}
+
 	return rv, nil
 }
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// selectFunctions lists the SQLite functions allowed in select expressions.
+//
+// ref: https://www.sqlite.org/lang_corefunc.html
+var selectFunctions = map[string]struct{}{
+	"abs":       {},
+	"coalesce":  {},
+	"format":    {},
+	"hex":       {},
+	"ifnull":    {},
+	"instr":     {},
+	"length":    {},
+	"lower":     {},
+	"ltrim":     {},
+	"nullif":    {},
+	"printf":    {},
+	"replace":   {},
+	"round":     {},
+	"rtrim":     {},
+	"substr":    {},
+	"substring": {},
+	"trim":      {},
+	"upper":     {},
+}
+
+// selectExpressionKeywords lists the keywords rejected in select expressions, which might
+// read other tables or break the query structure.
+var selectExpressionKeywords = map[string]struct{}{
+	"as":     {},
+	"attach": {},
+	"from":   {},
+	"group":  {},
+	"having": {},
+	"join":   {},
+	"limit":  {},
+	"order":  {},
+	"pragma": {},
+	"select": {},
+	"union":  {},
+	"values": {},
+	"where":  {},
+	"with":   {},
+}
+
+var (
+	selectExpressionTokenPattern = regexp.MustCompile(`[a-zA-Z_][a-zA-Z0-9_]*\s*\(?`)
+	selectAliasPattern           = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// isSelectFunctionCall checks if the select column is a function call expression.
+func isSelectFunctionCall(s string) bool {
+	return strings.Contains(s, "(")
+}
+
+// splitSelectColumns splits the select query parameter by the commas outside of
+// parentheses and string literals:
+//
+//	id,printf('%s %s', first, last) => id | printf('%s %s', first, last)
+func splitSelectColumns(s string) []string {
+	return splitTopLevel(s, ',')
+}
+
+// splitTopLevel splits s by sep outside of parentheses and single quoted string literals.
+func splitTopLevel(s string, sep rune) []string {
+	var (
+		rv      []string
+		level   int
+		quoted  bool
+		current strings.Builder
+	)
+	for _, c := range s {
+		switch {
+		case c == '\'':
+			// '' in string literal toggles twice
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			level += 1
+		case c == ')':
+			level -= 1
+		case c == sep && level == 0:
+			rv = append(rv, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteRune(c)
+	}
+	return append(rv, current.String())
+}
+
+// stripStringLiterals removes the single quoted string literals from s. ok is false if
+// the string literals are not terminated.
+func stripStringLiterals(s string) (rv string, ok bool) {
+	ps := strings.Split(s, "'")
+	if len(ps)%2 == 0 {
+		return "", false
+	}
+	var b strings.Builder
+	for idx := 0; idx < len(ps); idx += 2 {
+		b.WriteString(ps[idx])
+	}
+	return b.String(), true
+}
+
+// validateSelectExpression checks the function call expression before inlining it to the
+// query. Only the allowed functions can be called, and inputs which might terminate the
+// statement, comment out the rest of the query, break the parameter bindings or read
+// other tables are rejected.
+func validateSelectExpression(expr string) error {
+	invalid := ErrBadRequest.WithHint(fmt.Sprintf("invalid select expression: %q", expr))
+
+	code, ok := stripStringLiterals(expr)
+	if !ok {
+		return invalid
+	}
+	for _, token := range []string{";", "--", "/*", "?"} {
+		if strings.Contains(code, token) {
+			return invalid
+		}
+	}
+
+	level := 0
+	for _, c := range code {
+		switch c {
+		case '(':
+			level += 1
+		case ')':
+			level -= 1
+		}
+		if level < 0 {
+			return invalid
+		}
+	}
+	if level != 0 {
+		return invalid
+	}
+
+	for _, token := range selectExpressionTokenPattern.FindAllString(code, -1) {
+		name := strings.ToLower(strings.TrimSpace(strings.TrimSuffix(token, "(")))
+		if strings.HasSuffix(token, "(") {
+			if _, ok := selectFunctions[name]; !ok {
+				return ErrBadRequest.WithHint(fmt.Sprintf("unsupported function in select: %s", name))
+			}
+			continue
+		}
+		if _, ok := selectExpressionKeywords[name]; ok {
+			return invalid
+		}
+	}
+
+	return nil
+}
+
+// getSelectFunctionResultColumn translates the function call selection. The alias can be
+// specified before or after the expression:
+//
+//	full_name:printf('%s %s', first, last) => printf('%s %s', first, last) as full_name
+//	substr(name, 1, 1):initial => substr(name, 1, 1) as initial
+func getSelectFunctionResultColumn(s string) (string, error) {
+	var expr, alias string
+	switch ps := splitTopLevel(s, ':'); len(ps) {
+	case 1:
+		expr = ps[0]
+	case 2:
+		expr, alias = ps[0], ps[1]
+		if !isSelectFunctionCall(expr) {
+			expr, alias = alias, expr
+		}
+		alias = strings.TrimSpace(alias)
+		if !selectAliasPattern.MatchString(alias) {
+			return "", ErrBadRequest.WithHint(fmt.Sprintf("invalid select alias: %q", alias))
+		}
+	default:
+		return "", ErrBadRequest.WithHint(fmt.Sprintf("invalid select expression: %q", s))
+	}
+
+	expr = strings.TrimSpace(expr)
+	if err := validateSelectExpression(expr); err != nil {
+		return "", err
+	}
+
+	if alias == "" {
+		return expr, nil
+	}
+	return fmt.Sprintf("%s as %s", expr, alias), nil
+}
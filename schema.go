@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/cobra"
+)
+
+const (
+	schemaFormatText = "text"
+	schemaFormatJSON = "json"
+)
+
+// TableOrViewSchema describes the columns of a table or view.
+type TableOrViewSchema struct {
+	TableOrView
+	Columns []TableColumn `json:"columns"`
+}
+
+func querySchema(
+	ctx context.Context,
+	queryer sqlx.QueryerContext,
+	filter string,
+) ([]TableOrViewSchema, error) {
+	tableOrViews, err := queryTableOrViews(ctx, queryer)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]TableOrViewSchema, 0, len(tableOrViews))
+	for _, t := range tableOrViews {
+		if filter != "" && t.Name != filter {
+			continue
+		}
+
+		columns, err := queryTableColumns(ctx, queryer, t.Name)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, TableOrViewSchema{TableOrView: t, Columns: columns})
+	}
+
+	return rv, nil
+}
+
+func writeSchemaText(w io.Writer, schemas []TableOrViewSchema) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for idx, schema := range schemas {
+		if idx > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "%s (%s)\n", schema.Name, schema.Type)
+		fmt.Fprintln(tw, "  COLUMN\tTYPE\tNOT NULL\tDEFAULT\tPK")
+		for _, c := range schema.Columns {
+			defaultValue := ""
+			if c.DefaultValue != nil {
+				defaultValue = *c.DefaultValue
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%t\t%s\t%d\n", c.Name, c.Type, c.NotNull, defaultValue, c.PrimaryKey)
+		}
+	}
+
+	return tw.Flush()
+}
+
+func writeSchema(w io.Writer, schemas []TableOrViewSchema, format string) error {
+	switch format {
+	case schemaFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(schemas)
+	case schemaFormatText:
+		return writeSchemaText(w, schemas)
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func createSchemaCmd() *cobra.Command {
+	var (
+		flagFormat string
+		flagFilter string
+	)
+
+	cmd := &cobra.Command{
+		Use:          "schema",
+		Short:        "Print tables, views and their columns",
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if flagFormat != schemaFormatText && flagFormat != schemaFormatJSON {
+				return fmt.Errorf("unsupported format %q, should be %s or %s", flagFormat, schemaFormatText, schemaFormatJSON)
+			}
+
+			db, err := openDB(cmd)
+			if err != nil {
+				setupLogger.Error(err, "create db")
+				return err
+			}
+			defer db.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			schemas, err := querySchema(ctx, db, flagFilter)
+			if err != nil {
+				return err
+			}
+			if flagFilter != "" && len(schemas) < 1 {
+				return fmt.Errorf("table or view %q not found", flagFilter)
+			}
+
+			return writeSchema(cmd.OutOrStdout(), schemas, flagFormat)
+		},
+	}
+
+	bindDBDSNFlag(cmd.Flags())
+	cmd.Flags().StringVar(
+		&flagFormat, "format", schemaFormatText,
+		"output format, text or json",
+	)
+	cmd.Flags().StringVar(
+		&flagFilter, "filter", "",
+		"only print the table or view with the name. Empty value means all.",
+	)
+
+	return cmd
+}
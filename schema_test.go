@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaCmd(t *testing.T) {
+	dsn := "//" + filepath.Join(t.TempDir(), "test.db")
+
+	db := openTestDB(t, "--db-dsn", dsn)
+	for _, stmt := range []string{
+		"CREATE TABLE books (id INTEGER PRIMARY KEY, title TEXT NOT NULL, price REAL DEFAULT 0)",
+		"CREATE TABLE authors (name TEXT, born DATETIME, avatar BLOB)",
+		"CREATE TABLE book_authors (book_id INTEGER, author_name TEXT, PRIMARY KEY (book_id, author_name))",
+		"CREATE VIEW cheap_books AS SELECT id, title FROM books WHERE price < 10",
+	} {
+		_, err := db.Exec(stmt)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, db.Close())
+
+	runSchemaCmd := func(t *testing.T, args ...string) (string, error) {
+		cmd := createMainCmd()
+		var stdout bytes.Buffer
+		cmd.SetOut(&stdout)
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs(append([]string{"schema", "--db-dsn", dsn}, args...))
+		err := cmd.Execute()
+		return stdout.String(), err
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		output, err := runSchemaCmd(t, "--format", "json")
+		assert.NoError(t, err)
+
+		var schemas []TableOrViewSchema
+		assert.NoError(t, json.Unmarshal([]byte(output), &schemas))
+
+		columnsByTable := map[string]map[string]TableColumn{}
+		typeByTable := map[string]string{}
+		for _, schema := range schemas {
+			typeByTable[schema.Name] = schema.Type
+			columnsByTable[schema.Name] = map[string]TableColumn{}
+			for _, c := range schema.Columns {
+				columnsByTable[schema.Name][c.Name] = c
+			}
+		}
+
+		assert.Equal(t, map[string]string{
+			"authors":      "table",
+			"book_authors": "table",
+			"books":        "table",
+			"cheap_books":  "view",
+		}, typeByTable)
+
+		books := columnsByTable["books"]
+		assert.Len(t, books, 3)
+		assert.Equal(t, "INTEGER", books["id"].Type)
+		assert.EqualValues(t, 1, books["id"].PrimaryKey)
+		assert.Equal(t, "TEXT", books["title"].Type)
+		assert.True(t, books["title"].NotNull)
+		assert.EqualValues(t, 0, books["title"].PrimaryKey)
+		assert.Equal(t, "REAL", books["price"].Type)
+		if assert.NotNil(t, books["price"].DefaultValue) {
+			assert.Equal(t, "0", *books["price"].DefaultValue)
+		}
+
+		authors := columnsByTable["authors"]
+		assert.Equal(t, "DATETIME", authors["born"].Type)
+		assert.Equal(t, "BLOB", authors["avatar"].Type)
+
+		bookAuthors := columnsByTable["book_authors"]
+		assert.EqualValues(t, 1, bookAuthors["book_id"].PrimaryKey)
+		assert.EqualValues(t, 2, bookAuthors["author_name"].PrimaryKey)
+
+		assert.Len(t, columnsByTable["cheap_books"], 2)
+	})
+
+	t.Run("Text", func(t *testing.T) {
+		output, err := runSchemaCmd(t)
+		assert.NoError(t, err)
+
+		assert.Contains(t, output, "books (table)")
+		assert.Contains(t, output, "cheap_books (view)")
+		assert.Regexp(t, `id\s+INTEGER\s+false\s+1`, output)
+		assert.Regexp(t, `title\s+TEXT\s+true\s+0`, output)
+		assert.Regexp(t, `price\s+REAL\s+false\s+0\s+0`, output)
+		assert.Regexp(t, `author_name\s+TEXT\s+false\s+2`, output)
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+		output, err := runSchemaCmd(t, "--filter", "authors")
+		assert.NoError(t, err)
+
+		assert.Contains(t, output, "authors (table)")
+		assert.NotContains(t, output, "books")
+	})
+
+	t.Run("FilterNotFound", func(t *testing.T) {
+		_, err := runSchemaCmd(t, "--filter", "unknown")
+		assert.Error(t, err)
+	})
+
+	t.Run("InvalidFormat", func(t *testing.T) {
+		_, err := runSchemaCmd(t, "--format", "yaml")
+		assert.Error(t, err)
+	})
+}
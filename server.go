@@ -2,26 +2,55 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/cors"
 	"github.com/go-logr/logr"
 	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 const (
 	routeVarTableOrView = "tableOrView"
+
+	headerNameRowsAffected = "X-Rows-Affected"
+	headerNameNextCursor   = "Next-Cursor"
+	headerNameTotalCount   = "X-Total-Count"
+	headerNameCappedLimit  = "X-Capped-Limit"
+	headerNameCacheControl = "Cache-Control"
+
+	// cacheControlNoStore is the Cache-Control of the write responses.
+	cacheControlNoStore = "no-store"
+)
+
+const (
+	defaultHealthPath = "/healthz"
+	readinessPath     = "/readyz"
+)
+
+const defaultMaxRequestBodyBytes = 10 << 20 // 10MB
+
+const (
+	defaultDBRetryCount = 3
+	defaultDBRetryDelay = 50 * time.Millisecond
 )
 
 type ServerOptions struct {
@@ -29,15 +58,167 @@ type ServerOptions struct {
 	Addr            string
 	AuthOptions     ServerAuthOptions
 	SecurityOptions ServerSecurityOptions
+	CORSOptions     ServerCORSOptions
 	Queryer         sqlx.QueryerContext
 	Execer          sqlx.ExecerContext
+	// ReturnLocation sets the Location header of the inserted resource on insertion.
+	ReturnLocation bool
+	// BehindProxy resolves the client IP from the rightmost X-Forwarded-For entry.
+	BehindProxy bool
+	// TLSCertFile is the path to the TLS certificate file. TLS is enabled when both
+	// TLSCertFile and TLSKeyFile are set.
+	TLSCertFile string
+	// TLSKeyFile is the path to the TLS private key file.
+	TLSKeyFile string
+	// RequestTimeout is the timeout for handling a request. 0 means no timeout.
+	RequestTimeout time.Duration
+	// RateLimitPerIP is the allowed requests per second of each client IP. 0 means disabled.
+	RateLimitPerIP int
+	// RateLimitBurst is the maximum burst requests of each client IP.
+	// Defaults to RateLimitPerIP.
+	RateLimitBurst int
+	// MaxConcurrentRequests is the maximum number of requests in flight. 0 means unlimited.
+	MaxConcurrentRequests int
+	// MaxRequestBodyBytes is the maximum size of the request body in bytes. 0 means unlimited.
+	MaxRequestBodyBytes int64
+	// SSEPollInterval is the interval of polling the table or view changes for the events route.
+	SSEPollInterval time.Duration
+	// SubscribePollInterval is the interval of polling the subscription queries.
+	SubscribePollInterval time.Duration
+	// MaxLimit is the maximum number of rows can be requested via limit or Range header.
+	// 0 means unlimited.
+	MaxLimit int64
+	// TracerProvider is the OpenTelemetry tracer provider for tracing requests.
+	// Defaults to a no-op provider.
+	TracerProvider trace.TracerProvider
+	// HealthPath is the path of the liveness endpoint.
+	HealthPath string
+	// MigratorState checks pending migrations in the readiness endpoint. Optional.
+	MigratorState MigratorState
+	// GzipMinSize is the minimum size of the response in bytes to be gzip compressed.
+	GzipMinSize int
+	// AdminToken is the bearer token for accessing the admin endpoints.
+	// Empty value means admin endpoints are disabled.
+	AdminToken string
+	// BackupDir is the directory where the backups can be written via the admin endpoint.
+	// Empty value means backups can only be streamed in response.
+	BackupDir string
+	// BeforeInsert is called with each row to insert before the insertion. The request
+	// is rejected with 400 Bad Request if it returns an error. Optional.
+	BeforeInsert func(table string, data map[string]interface{}) error
+	// BeforeUpdate is called with the values to set before the update. The request
+	// is rejected with 400 Bad Request if it returns an error. Optional.
+	BeforeUpdate func(table string, data map[string]interface{}) error
+	// DBRetryCount is the number of retries when the write fails with SQLITE_BUSY.
+	// 0 means no retry.
+	DBRetryCount int
+	// DBRetryDelay is the delay before the first retry, doubled for each retry.
+	DBRetryDelay time.Duration
+	// StreamingThreshold is the estimated row count above which the JSON query response is
+	// streamed row by row instead of buffered. 0 means always buffering.
+	StreamingThreshold int
+	// CacheControl is the Cache-Control header value of the query responses.
+	// Empty value means not set.
+	CacheControl string
+	// LastModifiedColumn is the column for setting the Last-Modified header of the query
+	// response, if the table has the column. Empty value means disabled.
+	LastModifiedColumn string
+	// WebhookURL is the URL to post the write events to. Empty value means disabled.
+	WebhookURL string
+	// WebhookSecret is the key for signing the webhook payload with HMAC-SHA256.
+	// Empty value means the payload is not signed.
+	WebhookSecret string
 }
 
 func (opts *ServerOptions) bindCLIFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&opts.Addr, "http-addr", ":8080", "server listen address")
+	fs.BoolVar(
+		&opts.ReturnLocation, "return-location", false,
+		"set Location header of the inserted resource on insertion",
+	)
+	fs.BoolVar(
+		&opts.BehindProxy, "behind-proxy", false,
+		"resolve client IP from the rightmost X-Forwarded-For entry",
+	)
+	fs.StringVar(&opts.TLSCertFile, "tls-cert", "", "path to the TLS certificate file")
+	fs.StringVar(&opts.TLSKeyFile, "tls-key", "", "path to the TLS private key file")
+	fs.DurationVar(
+		&opts.RequestTimeout, "request-timeout", 30*time.Second,
+		"timeout for handling a request. 0 means no timeout.",
+	)
+	fs.IntVar(
+		&opts.RateLimitPerIP, "rate-limit-per-ip", 0,
+		"allowed requests per second of each client IP. 0 means disabled.",
+	)
+	fs.IntVar(
+		&opts.RateLimitBurst, "rate-limit-burst", 0,
+		"maximum burst requests of each client IP. Defaults to --rate-limit-per-ip.",
+	)
+	fs.IntVar(
+		&opts.MaxConcurrentRequests, "max-concurrent-requests", 0,
+		"maximum number of requests in flight. 0 means unlimited.",
+	)
+	fs.StringVar(&opts.HealthPath, "health-path", defaultHealthPath, "path of the liveness endpoint")
+	fs.IntVar(
+		&opts.GzipMinSize, "gzip-min-size", defaultGzipMinSize,
+		"minimum size of the response in bytes to be gzip compressed",
+	)
+	fs.Int64Var(
+		&opts.MaxRequestBodyBytes, "max-request-size", defaultMaxRequestBodyBytes,
+		"maximum size of the request body in bytes. 0 means unlimited.",
+	)
+	fs.DurationVar(
+		&opts.SSEPollInterval, "sse-poll-interval", defaultSSEPollInterval,
+		"interval of polling the table or view changes for the events route",
+	)
+	fs.DurationVar(
+		&opts.SubscribePollInterval, "subscribe-poll-interval", defaultSubscribePollInterval,
+		"interval of polling the subscription queries for the subscribe route",
+	)
+	fs.Int64Var(
+		&opts.MaxLimit, "max-limit", 0,
+		"maximum number of rows can be requested via limit or Range header. 0 means unlimited.",
+	)
+	fs.StringVar(
+		&opts.AdminToken, "admin-token", "",
+		"bearer token for accessing the admin endpoints. Empty value means disabled.",
+	)
+	fs.StringVar(
+		&opts.BackupDir, "admin-backup-dir", "",
+		"directory where the backups can be written via the admin endpoint. Empty value means streaming only.",
+	)
+	fs.IntVar(
+		&opts.DBRetryCount, "db-retry-count", defaultDBRetryCount,
+		"number of retries when the write fails with SQLITE_BUSY. 0 means no retry.",
+	)
+	fs.DurationVar(
+		&opts.DBRetryDelay, "db-retry-delay", defaultDBRetryDelay,
+		"delay before the first retry of SQLITE_BUSY write, doubled for each retry",
+	)
+	fs.IntVar(
+		&opts.StreamingThreshold, "streaming-threshold", 0,
+		"estimated row count above which the JSON query response is streamed. 0 means always buffering.",
+	)
+	fs.StringVar(
+		&opts.CacheControl, "cache-control", "",
+		"Cache-Control header value of the query responses, e.g. max-age=60. Empty value means not set.",
+	)
+	fs.StringVar(
+		&opts.LastModifiedColumn, "last-modified-column", defaultLastModifiedColumn,
+		"column for setting the Last-Modified header of the query response. Empty value means disabled.",
+	)
+	fs.StringVar(
+		&opts.WebhookURL, "webhook-url", "",
+		"URL to post the insert, update and delete events to. Empty value means disabled.",
+	)
+	fs.StringVar(
+		&opts.WebhookSecret, "webhook-secret", "",
+		"key for signing the webhook payload with HMAC-SHA256",
+	)
 
 	opts.AuthOptions.bindCLIFlags(fs)
 	opts.SecurityOptions.bindCLIFlags(fs)
+	opts.CORSOptions.bindCLIFlags(fs)
 }
 
 func (opts *ServerOptions) defaults() error {
@@ -47,6 +228,9 @@ func (opts *ServerOptions) defaults() error {
 	if err := opts.SecurityOptions.defaults(); err != nil {
 		return err
 	}
+	if err := opts.CORSOptions.defaults(); err != nil {
+		return err
+	}
 
 	if opts.Logger.GetSink() == nil {
 		opts.Logger = logr.Discard()
@@ -56,6 +240,94 @@ func (opts *ServerOptions) defaults() error {
 		opts.Addr = ":8080"
 	}
 
+	if (opts.TLSCertFile == "") != (opts.TLSKeyFile == "") {
+		return fmt.Errorf(".TLSCertFile and .TLSKeyFile must be set together")
+	}
+
+	if opts.RequestTimeout < 0 {
+		return fmt.Errorf(".RequestTimeout must be non-negative")
+	}
+
+	if opts.RateLimitPerIP < 0 {
+		return fmt.Errorf(".RateLimitPerIP must be non-negative")
+	}
+	if opts.RateLimitBurst < 0 {
+		return fmt.Errorf(".RateLimitBurst must be non-negative")
+	}
+	if opts.RateLimitPerIP > 0 && opts.RateLimitBurst == 0 {
+		opts.RateLimitBurst = opts.RateLimitPerIP
+	}
+
+	if opts.MaxConcurrentRequests < 0 {
+		return fmt.Errorf(".MaxConcurrentRequests must be non-negative")
+	}
+
+	if opts.MaxRequestBodyBytes < 0 {
+		return fmt.Errorf(".MaxRequestBodyBytes must be non-negative")
+	}
+
+	if opts.SSEPollInterval < 0 {
+		return fmt.Errorf(".SSEPollInterval must be non-negative")
+	}
+	if opts.SSEPollInterval == 0 {
+		opts.SSEPollInterval = defaultSSEPollInterval
+	}
+
+	if opts.SubscribePollInterval < 0 {
+		return fmt.Errorf(".SubscribePollInterval must be non-negative")
+	}
+	if opts.SubscribePollInterval == 0 {
+		opts.SubscribePollInterval = defaultSubscribePollInterval
+	}
+
+	if opts.MaxLimit < 0 {
+		return fmt.Errorf(".MaxLimit must be non-negative")
+	}
+
+	if opts.GzipMinSize < 0 {
+		return fmt.Errorf(".GzipMinSize must be non-negative")
+	}
+
+	if opts.HealthPath == "" {
+		opts.HealthPath = defaultHealthPath
+	}
+	if !strings.HasPrefix(opts.HealthPath, "/") {
+		return fmt.Errorf(".HealthPath must start with /")
+	}
+
+	if opts.BackupDir != "" {
+		backupDir, err := filepath.Abs(opts.BackupDir)
+		if err != nil {
+			return fmt.Errorf("resolve .BackupDir: %w", err)
+		}
+		opts.BackupDir = backupDir
+	}
+
+	if opts.StreamingThreshold < 0 {
+		return fmt.Errorf(".StreamingThreshold must be non-negative")
+	}
+
+	if opts.DBRetryCount < 0 {
+		return fmt.Errorf(".DBRetryCount must be non-negative")
+	}
+	if opts.DBRetryDelay < 0 {
+		return fmt.Errorf(".DBRetryDelay must be non-negative")
+	}
+	if opts.DBRetryDelay == 0 {
+		opts.DBRetryDelay = defaultDBRetryDelay
+	}
+
+	if opts.WebhookURL != "" {
+		u, err := url.Parse(opts.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf(".WebhookURL must be a valid http(s) URL")
+		}
+	}
+
+	if opts.TracerProvider == nil {
+		opts.TracerProvider = noop.NewTracerProvider()
+	}
+
 	if opts.Queryer == nil {
 		return fmt.Errorf(".Queryer is required")
 	}
@@ -68,10 +340,47 @@ func (opts *ServerOptions) defaults() error {
 }
 
 type dbServer struct {
-	logger  logr.Logger
-	server  *http.Server
-	queryer sqlx.QueryerContext
-	execer  sqlx.ExecerContext
+	logger         logr.Logger
+	server         *http.Server
+	queryer        sqlx.QueryerContext
+	execer         sqlx.ExecerContext
+	returnLocation bool
+	maxLimit       int64
+	// ssePollInterval is the interval of polling the table or view changes for the events route.
+	ssePollInterval time.Duration
+	// subscribePollInterval is the interval of polling the subscription queries.
+	subscribePollInterval time.Duration
+	// isOriginAllowed checks if the origin of the subscribe request is allowed.
+	isOriginAllowed func(origin string) bool
+	tlsCertFile     string
+	tlsKeyFile      string
+	// checkTableOrViewAccess checks if the request can apply the method on the table or view.
+	checkTableOrViewAccess func(req *http.Request, tableOrView string, method string) error
+	// isTableOrViewAccessible checks if the table or view can be listed in OpenAPI specification.
+	isTableOrViewAccessible func(tableOrView string) bool
+	// allowedMethods lists the methods the roles can apply on the table or view.
+	allowedMethods    func(tableOrView string, roles []string) []string
+	allowSchemaAccess bool
+	// disableIntrospection rejects the subscription queries reading the database schema.
+	disableIntrospection bool
+	migratorState        MigratorState
+	// batchHandler handles the operations of batch request.
+	batchHandler http.Handler
+	backupDir    string
+	// streamingThreshold is the estimated row count above which the JSON query response
+	// is streamed. 0 means always buffering.
+	streamingThreshold int
+	// cacheControl is the Cache-Control header value of the query responses.
+	cacheControl string
+	// lastModifiedColumn is the column for setting the Last-Modified header. Empty means disabled.
+	lastModifiedColumn string
+	// dbRetryCount is the number of retries when the write fails with SQLITE_BUSY.
+	dbRetryCount int
+	dbRetryDelay time.Duration
+	beforeInsert func(table string, data map[string]interface{}) error
+	beforeUpdate func(table string, data map[string]interface{}) error
+	// webhook dispatches the write events. nil means disabled.
+	webhook *webhookDispatcher
 }
 
 func NewServer(opts *ServerOptions) (*dbServer, error) {
@@ -86,19 +395,118 @@ func NewServer(opts *ServerOptions) (*dbServer, error) {
 			// TODO: make it configurable
 			ReadHeaderTimeout: 5 * time.Second,
 		},
-		queryer: opts.Queryer,
-		execer:  opts.Execer,
+		queryer:                 opts.Queryer,
+		execer:                  opts.Execer,
+		returnLocation:          opts.ReturnLocation,
+		maxLimit:                opts.MaxLimit,
+		ssePollInterval:         opts.SSEPollInterval,
+		subscribePollInterval:   opts.SubscribePollInterval,
+		isOriginAllowed:         opts.CORSOptions.isOriginAllowed,
+		tlsCertFile:             opts.TLSCertFile,
+		tlsKeyFile:              opts.TLSKeyFile,
+		isTableOrViewAccessible: opts.SecurityOptions.isTableOrViewAccessible,
+		allowedMethods:          opts.SecurityOptions.allowedMethods,
+		backupDir:               opts.BackupDir,
+		allowSchemaAccess:       opts.SecurityOptions.AllowSchemaAccess,
+		disableIntrospection:    opts.SecurityOptions.DisableIntrospection,
+		migratorState:           opts.MigratorState,
+		streamingThreshold:      opts.StreamingThreshold,
+		cacheControl:            opts.CacheControl,
+		lastModifiedColumn:      opts.LastModifiedColumn,
+		dbRetryCount:            opts.DBRetryCount,
+		dbRetryDelay:            opts.DBRetryDelay,
+		beforeInsert:            opts.BeforeInsert,
+		beforeUpdate:            opts.BeforeUpdate,
+	}
+	rv.checkTableOrViewAccess = opts.SecurityOptions.newTableOrViewAccessChecker(rv.queryerOf).Check
+	if opts.WebhookURL != "" {
+		rv.webhook = newWebhookDispatcher(rv.logger, opts.WebhookURL, opts.WebhookSecret)
 	}
 
 	serverMux := chi.NewRouter()
 
-	// TODO: allow specifying cors config from cli / table
+	serverMux.Use(requestIDMiddleware)
+	if opts.BehindProxy {
+		serverMux.Use(forwardedClientIPMiddleware)
+	}
 	serverMux.Use(
-		middleware.RequestID,
-		middleware.RealIP,
 		serverLogger(rv.logger),
-		cors.AllowAll().Handler,
+		rv.recoverMiddleware,
+		createGzipMiddleware(opts.GzipMinSize),
+		opts.CORSOptions.createCORSMiddleware(rv.responseError),
+		opts.SecurityOptions.createIPAllowListMiddleware(func(w http.ResponseWriter, err error) {
+			metricsAccessCheckFailedRequestsTotal.Inc()
+			rv.responseError(w, err)
+		}),
 	)
+	if opts.MaxConcurrentRequests > 0 {
+		// events and subscriptions hold the slots until the client disconnects
+		serverMux.Use(skipStreamingRoutes(createConcurrencyLimitMiddleware(opts.MaxConcurrentRequests, rv.responseError)))
+	}
+	if opts.RequestTimeout > 0 {
+		// events and subscriptions are streamed until the client disconnects
+		serverMux.Use(skipStreamingRoutes(createRequestTimeoutMiddleware(opts.RequestTimeout)))
+	}
+	if opts.MaxRequestBodyBytes > 0 {
+		serverMux.Use(createMaxRequestBodySizeMiddleware(opts.MaxRequestBodyBytes))
+	}
+	if opts.RateLimitPerIP > 0 {
+		serverMux.Use(createRateLimitMiddleware(
+			newIPRateLimiter(opts.RateLimitPerIP, opts.RateLimitBurst),
+			func(w http.ResponseWriter, err error) {
+				metricsRateLimitedRequestsTotal.Inc()
+				rv.responseError(w, err)
+			},
+		))
+	}
+
+	tracer := opts.TracerProvider.Tracer(tracerName)
+	instrument := func(op string) chi.Middlewares {
+		return chi.Chain(recordRequestMetrics(op), recordRequestSpan(tracer, op))
+	}
+
+	// health check endpoints are excluded from auth & access checks
+	serverMux.Get(opts.HealthPath, rv.handleHealthz)
+	serverMux.Get(readinessPath, rv.handleReadyz)
+
+	if opts.AdminToken != "" {
+		serverMux.Route(routeAdmin, func(r chi.Router) {
+			r.Use(createBearerTokenAuthMiddleware(opts.AdminToken, func(w http.ResponseWriter, err error) {
+				metricsAuthFailedRequestsTotal.Inc()
+				rv.responseError(w, err)
+			}))
+
+			r.With(instrument("adminBackup")...).Post("/backup", rv.handleAdminBackup)
+			r.With(instrument("adminCheckpoint")...).Post("/checkpoint", rv.handleAdminCheckpoint)
+			r.With(instrument("adminVacuum")...).Post("/vacuum", rv.handleAdminVacuum)
+		})
+	}
+
+	routePattern := fmt.Sprintf("/{%s:[^/]+}", routeVarTableOrView)
+	// NOTE: tableOrViewRoutes should be registered via Group, so the access check
+	// middleware runs after routing and can read the route variables.
+	tableOrViewRoutes := func(r chi.Router) {
+		r.Use(opts.SecurityOptions.createTableOrViewAccessCheckMiddleware(rv.queryerOf, func(w http.ResponseWriter, err error) {
+			metricsAccessCheckFailedRequestsTotal.Inc()
+			rv.responseError(w, err)
+		}))
+		r.Use(rv.tableColumnsMiddleware)
+
+		r.With(instrument("queryTableOrView")...).Get(routePattern, rv.handleQueryTableOrView)
+		r.With(instrument("headTableOrView")...).Head(routePattern, rv.handleHeadTableOrView)
+		r.With(instrument("insertTable")...).Post(routePattern, rv.handleInsertTable)
+		r.With(instrument("updateTable")...).Patch(routePattern, rv.handleUpdateTable)
+		r.With(instrument("updateSingleEntity")...).Put(routePattern, rv.handleUpdateSingleEntity)
+		r.With(instrument("deleteTable")...).Delete(routePattern, rv.handleDeleteTable)
+		r.With(instrument("tableOrViewEvents")...).Get(routePattern+routeSuffixEvents, rv.handleTableOrViewEvents)
+		r.With(instrument("tableOrViewSubscribe")...).Get(routePattern+routeSuffixSubscribe, rv.handleTableOrViewSubscribe)
+	}
+
+	// batch operations are dispatched to the table or view routes directly,
+	// as the batch request has been authenticated already
+	batchRouter := chi.NewRouter()
+	batchRouter.Group(tableOrViewRoutes)
+	rv.batchHandler = batchRouter
 
 	{
 		serverMux.
@@ -107,18 +515,15 @@ func NewServer(opts *ServerOptions) (*dbServer, error) {
 					metricsAuthFailedRequestsTotal.Inc()
 					rv.responseError(w, err)
 				}),
-				opts.SecurityOptions.createTableOrViewAccessCheckMiddleware(func(w http.ResponseWriter, err error) {
-					metricsAccessCheckFailedRequestsTotal.Inc()
-					rv.responseError(w, err)
-				}),
 			).
 			Group(func(r chi.Router) {
-				routePattern := fmt.Sprintf("/{%s:[^/]+}", routeVarTableOrView)
-				r.With(recordRequestMetrics("queryTableOrView")).Get(routePattern, rv.handleQueryTableOrView)
-				r.With(recordRequestMetrics("insertTable")).Post(routePattern, rv.handleInsertTable)
-				r.With(recordRequestMetrics("updateTable")).Patch(routePattern, rv.handleUpdateTable)
-				r.With(recordRequestMetrics("updateSingleEntity")).Put(routePattern, rv.handleUpdateSingleEntity)
-				r.With(recordRequestMetrics("deleteTable")).Delete(routePattern, rv.handleDeleteTable)
+				r.With(instrument("schemaDiscovery")...).Get("/", rv.handleSchemaDiscovery)
+				r.With(instrument("openAPISpec")...).Get("/openapi.json", rv.handleOpenAPISpec)
+				// OPTIONS is excluded from access check as it reports the accessible methods
+				r.With(instrument("optionsTableOrView")...).Options(routePattern, rv.handleOptionsTableOrView)
+
+				r.Group(tableOrViewRoutes)
+				r.With(instrument("batch")...).Post(routeBatch, rv.handleBatch)
 			})
 	}
 
@@ -128,9 +533,13 @@ func NewServer(opts *ServerOptions) (*dbServer, error) {
 }
 
 func (server *dbServer) Start(done <-chan struct{}) {
-	go server.server.ListenAndServe()
+	if server.tlsCertFile != "" && server.tlsKeyFile != "" {
+		go server.server.ListenAndServeTLS(server.tlsCertFile, server.tlsKeyFile)
+	} else {
+		go server.server.ListenAndServe()
+	}
 
-	server.logger.Info("server started", "addr", server.server.Addr)
+	server.logger.Info("server started", "addr", server.server.Addr, "tls", server.tlsCertFile != "")
 	<-done
 
 	server.logger.Info("shutting down server")
@@ -139,14 +548,95 @@ func (server *dbServer) Start(done <-chan struct{}) {
 	server.server.Shutdown(shutdownCtx)
 }
 
+// recoverMiddleware recovers the panic from the handler and responses 500 with JSON error.
+// tableColumnsMiddleware attaches the column names of the target to the request context,
+// so that the query compiler can reject the unknown columns referenced by the request.
+// The columns are queried only if the request references any column.
+func (server *dbServer) tableColumnsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !requestReferencesColumns(req) {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		target := chi.URLParam(req, routeVarTableOrView)
+		columns, err := queryTableColumns(req.Context(), server.queryerOf(req.Context()), target)
+		if err != nil {
+			server.responseError(w, err)
+			return
+		}
+		if len(columns) < 1 {
+			// unknown target, which is reported by the handler
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		// full-text search table has a hidden column with the same name as the table
+		names := []string{target}
+		for _, column := range columns {
+			names = append(names, column.Name)
+		}
+		next.ServeHTTP(w, req.WithContext(WithTableColumns(req.Context(), names)))
+	})
+}
+
+// requestReferencesColumns checks if the request query might reference the target columns.
+// Upgraded requests (subscriptions) receive the query after upgrading.
+func requestReferencesColumns(req *http.Request) bool {
+	if req.Header.Get("Upgrade") != "" {
+		return true
+	}
+	for name := range req.URL.Query() {
+		if name == queryParameterNameOrder || isColumnQueryParameter(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (server *dbServer) recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+			if rvr == http.ErrAbortHandler {
+				// aborted by the handler, the connection should be closed by the http server
+				panic(rvr)
+			}
+
+			server.requestLogger(req).Error(
+				fmt.Errorf("%v", rvr), "handler panicked",
+				"stack", string(debug.Stack()),
+			)
+			server.responseError(w, ErrInternalServerError)
+		}()
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// requestLogger returns the logger annotated with the request ID.
+func (server *dbServer) requestLogger(req *http.Request) logr.Logger {
+	return loggerWithRequestID(server.logger, req)
+}
+
 func (server *dbServer) responseHeader(w http.ResponseWriter, statusCode int) {
 	w.Header().Set("Server", ServerVersion)
 	w.WriteHeader(statusCode)
 }
 
 func (server *dbServer) responseError(w http.ResponseWriter, err error) {
-	var serverError *ServerError
+	var (
+		serverError *ServerError
+		sqliteError sqlite3.Error
+	)
 	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		server.responseError(w, ErrServiceUnavailable.WithHint("request timeout"))
+	case errors.As(err, &sqliteError):
+		server.responseError(w, newSQLiteServerError(sqliteError))
 	case errors.As(err, &serverError):
 		server.responseData(w, serverError, serverError.StatusCode)
 	default:
@@ -166,167 +656,1114 @@ func (server *dbServer) responseData(w http.ResponseWriter, data interface{}, st
 	}
 }
 
-func (server *dbServer) responseEmptyBody(w http.ResponseWriter, statusCode int) {
+func (server *dbServer) responseCSV(
+	w http.ResponseWriter,
+	columns []string,
+	rows []map[string]interface{},
+	statusCode int,
+) {
+	w.Header().Set("Content-Type", mediaTypeCSV+"; charset=utf-8")
 	server.responseHeader(w, statusCode)
+
+	if encodeErr := newCSVEncoder(w, columns).Encode(rows); encodeErr != nil {
+		server.logger.Error(encodeErr, "failed to write response")
+		return
+	}
 }
 
-func (server *dbServer) handleQueryTableOrView(
+// streamingPageSize is the number of rows read into memory at a time for streamed responses.
+const streamingPageSize = 1000
+
+// queryRowsInPages reads the rows of the select statement page by page and calls fn with
+// each page. The rows of a page are read into memory before calling fn, so the database
+// connection is released while fn writes the page to the client. fn is called at least once,
+// with an empty page if the statement returns no rows.
+//
+// NOTE: the pages are read with separate queries, so rows written between the queries can
+// be skipped or duplicated in the response.
+func (server *dbServer) queryRowsInPages(
+	ctx context.Context,
+	stmt CompiledQuery,
+	fn func(rows []map[string]interface{}) error,
+) error {
+	queryer := server.queryerOf(ctx)
+	pageQuery := fmt.Sprintf("select * from (%s) limit ? offset ?", stmt.Query)
+
+	for offset := 0; ; offset += streamingPageSize {
+		values := append(slices.Clone(stmt.Values), streamingPageSize, offset)
+		rows, err := queryer.QueryxContext(ctx, pageQuery, values...)
+		if err != nil {
+			return err
+		}
+		page := make([]map[string]interface{}, 0, streamingPageSize)
+		for rows.Next() {
+			p := make(map[string]interface{})
+			if err := rows.MapScan(p); err != nil {
+				rows.Close()
+				return err
+			}
+			page = append(page, p)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		if err := fn(page); err != nil {
+			return err
+		}
+		if len(page) < streamingPageSize {
+			return nil
+		}
+	}
+}
+
+// responseNDJSON writes each row as a JSON object followed by a newline without
+// buffering the whole result set.
+func (server *dbServer) responseNDJSON(
 	w http.ResponseWriter,
 	req *http.Request,
+	logger logr.Logger,
+	stmt CompiledQuery,
+	statusCode int,
 ) {
-	target := chi.URLParam(req, routeVarTableOrView)
-
-	logger := server.logger.WithValues("target", target, "route", "handleQueryTableOrView")
-
-	qc := NewQueryCompilerFromRequest(req)
-	selectStmt, err := qc.CompileAsSelect(target)
-	if err != nil {
-		logger.Error(err, "parse select query")
+	started := false
+	enc := json.NewEncoder(w)
+	err := server.queryRowsInPages(req.Context(), stmt, func(rows []map[string]interface{}) error {
+		if !started {
+			w.Header().Set("Content-Type", mediaTypeNDJSON)
+			server.responseHeader(w, statusCode)
+			started = true
+		}
+		for _, p := range rows {
+			if err := enc.Encode(p); err != nil {
+				return fmt.Errorf("write response: %w", err)
+			}
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+	case isClientDisconnected(req):
+		logger.V(4).Info("client disconnected")
+	case !started:
+		logger.Error(err, "query values")
 		server.responseError(w, err)
-		return
+	default:
+		// response has been started, we can only abort here
+		logger.Error(err, "read rows")
 	}
-	logger.V(8).Info(selectStmt.Query)
+}
 
-	rows, err := server.queryer.QueryxContext(req.Context(), selectStmt.Query, selectStmt.Values...)
-	if err != nil {
-		logger.Error(err, "query values")
-		server.responseError(w, err)
-		return
+// shouldStreamRows checks if the estimated row count of the target exceeds the streaming
+// threshold. The query filters are not considered, hence the estimation is the upper bound.
+func (server *dbServer) shouldStreamRows(ctx context.Context, logger logr.Logger, target string) bool {
+	if server.streamingThreshold < 1 {
+		return false
 	}
-	defer rows.Close()
 
-	// make sure return list instead of null for empty list
-	// FIXME: reflect column type and scan typed value instead of using `interface{}`
-	rv := make([]map[string]interface{}, 0)
-	rows.ColumnTypes()
-	for rows.Next() {
-		p := make(map[string]interface{})
-		if err := rows.MapScan(p); err != nil {
-			server.responseError(w, err)
-			return
+	queryer := server.queryerOf(ctx)
+	columns, err := queryTableColumns(ctx, queryer, target)
+	if err != nil || len(columns) < 1 {
+		if err != nil {
+			logger.Error(err, "query columns for streaming")
 		}
-		rv = append(rv, p)
+		return false
 	}
-
-	responseStatusCode := http.StatusOK
-
-	w.Header().Set("Content-Type", "application/json") // TODO: horner request config
-
-	preference, err := ParsePreferenceFromRequest(req)
+	count, err := estimateCount(ctx, queryer, compileEstimatedTableCount(target, columns))
 	if err != nil {
-		logger.Error(err, "parse preference")
-		server.responseError(w, err)
-		return
+		logger.Error(err, "estimate count for streaming")
+		return false
 	}
-	var countTotal string
-	switch preference.Count {
-	case countNone:
-		countTotal = "*"
-	case countExact:
-		responseStatusCode = http.StatusPartialContent
 
-		countStmt, err := qc.CompileAsExactCount(target)
-		if err != nil {
-			logger.Error(err, "parse count query")
-			server.responseError(w, err)
-			return
-		}
-		logger.V(8).Info(countStmt.Query)
+	return count > int64(server.streamingThreshold)
+}
 
-		var count int64
-		if err := server.queryer.QueryRowxContext(
-			req.Context(),
-			countStmt.Query, countStmt.Values...,
-		).Scan(&count); err != nil {
-			logger.Error(err, "count values")
-			server.responseError(w, err)
-			return
+// responseJSONStream writes the rows as JSON array page by page. The response is flushed
+// after the first page, so it's sent with chunked encoding without Content-Length.
+func (server *dbServer) responseJSONStream(
+	w http.ResponseWriter,
+	req *http.Request,
+	logger logr.Logger,
+	stmt CompiledQuery,
+	statusCode int,
+) int {
+	started := false
+	written := 0
+	err := server.queryRowsInPages(req.Context(), stmt, func(rows []map[string]interface{}) error {
+		if !started {
+			w.Header().Set("Content-Type", mediaTypeJSON)
+			server.responseHeader(w, statusCode)
+			started = true
+			if _, err := io.WriteString(w, "["); err != nil {
+				return fmt.Errorf("write response: %w", err)
+			}
 		}
-		countTotal = fmt.Sprint(count)
+		for _, p := range rows {
+			b, err := json.Marshal(p)
+			if err != nil {
+				return fmt.Errorf("encode row: %w", err)
+			}
+			if written > 0 {
+				b = append([]byte(","), b...)
+			}
+			if _, err := w.Write(b); err != nil {
+				return fmt.Errorf("write response: %w", err)
+			}
+			written += 1
+		}
+		// ignore the error as the response writer might not support flushing
+		_ = http.NewResponseController(w).Flush()
+		return nil
+	})
+	switch {
+	case err == nil:
+		if _, err := io.WriteString(w, "]\n"); err != nil {
+			logger.Error(err, "failed to write response")
+		}
+	case isClientDisconnected(req):
+		logger.V(4).Info("client disconnected")
+	case !started:
+		logger.Error(err, "query values")
+		server.responseError(w, err)
+	default:
+		// the response is left as invalid JSON to signal the failure
+		logger.Error(err, "read rows")
 	}
+	return written
+}
 
-	if v := qc.CompileContentRangeHeader(countTotal); v != "" {
-		w.Header().Set("Range-Unit", "items")
-		w.Header().Set("Content-Range", v)
+// setCacheControl sets the Cache-Control header of the query response if configured.
+func (server *dbServer) setCacheControl(w http.ResponseWriter) {
+	if server.cacheControl != "" {
+		w.Header().Set(headerNameCacheControl, server.cacheControl)
 	}
+}
 
-	server.responseData(w, rv, responseStatusCode)
+func (server *dbServer) responseEmptyBody(w http.ResponseWriter, statusCode int) {
+	server.responseHeader(w, statusCode)
 }
 
-func (server *dbServer) handleInsertTable(
+func (server *dbServer) setRowsAffectedHeader(
 	w http.ResponseWriter,
-	req *http.Request,
+	logger logr.Logger,
+	result sql.Result,
 ) {
-	target := chi.URLParam(req, routeVarTableOrView)
-
-	logger := server.logger.WithValues("target", target, "route", "handleInsertTable")
-
-	qc := NewQueryCompilerFromRequest(req)
-	insertStmt, err := qc.CompileAsInsert(target)
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		logger.Error(err, "parse insert query")
-		server.responseError(w, err)
+		// the statement has been executed, so we don't fail the request here
+		logger.Error(err, "read rows affected")
 		return
 	}
-	logger.V(8).Info(insertStmt.Query)
 
-	_, err = server.execer.ExecContext(req.Context(), insertStmt.Query, insertStmt.Values...)
+	w.Header().Set(headerNameRowsAffected, fmt.Sprint(rowsAffected))
+}
+
+func (server *dbServer) observeRowsAffected(
+	logger logr.Logger,
+	target string,
+	op string,
+	result sql.Result,
+) {
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		server.responseError(w, err)
+		logger.Error(err, "read rows affected")
 		return
 	}
 
-	// TODO: implement support for retrieving object by inserted id
-	server.responseEmptyBody(w, http.StatusCreated)
+	metricsQueryRowsReturned.WithLabelValues(target, op).Observe(float64(rowsAffected))
 }
 
-func (server *dbServer) handleUpdateTable(
+func (server *dbServer) handleHealthz(
 	w http.ResponseWriter,
 	req *http.Request,
 ) {
-	target := chi.URLParam(req, routeVarTableOrView)
+	rv := map[string]string{
+		"status":  "ok",
+		"version": ServerVersion,
+	}
+	// liveness doesn't depend on the database, hence the error is only logged
+	if synchronous, err := querySynchronousMode(req.Context(), server.queryer); err == nil {
+		rv["synchronous"] = synchronous
+	} else {
+		server.requestLogger(req).Error(err, "query synchronous mode")
+	}
 
-	logger := server.logger.WithValues("target", target, "route", "handleUpdateTable")
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	server.responseData(w, rv, http.StatusOK)
+}
 
-	qc := NewQueryCompilerFromRequest(req)
-	updateStmt, err := qc.CompileAsUpdate(target)
-	if err != nil {
-		logger.Error(err, "parse update query")
-		server.responseError(w, err)
+func (server *dbServer) handleReadyz(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	logger := server.requestLogger(req).WithValues("route", "handleReadyz")
+
+	var v int
+	if err := server.queryer.QueryRowxContext(req.Context(), "select 1").Scan(&v); err != nil {
+		logger.Error(err, "ping database")
+		server.responseError(w, ErrServiceUnavailable.WithHint(fmt.Sprintf("ping database: %s", err)))
 		return
 	}
-	logger.V(8).Info(updateStmt.Query)
 
-	_, err = server.execer.ExecContext(req.Context(), updateStmt.Query, updateStmt.Values...)
-	if err != nil {
-		server.responseError(w, err)
-		return
+	if server.migratorState != nil {
+		pending, err := server.migratorState.PendingMigrations(req.Context())
+		if err != nil {
+			logger.Error(err, "check pending migrations")
+			server.responseError(w, ErrServiceUnavailable.WithHint(fmt.Sprintf("check pending migrations: %s", err)))
+			return
+		}
+		if pending > 0 {
+			server.responseError(w, ErrServiceUnavailable.WithHint(fmt.Sprintf("%d pending migrations", pending)))
+			return
+		}
 	}
 
-	server.responseEmptyBody(w, http.StatusAccepted)
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	server.responseData(w, map[string]string{"status": "ok"}, http.StatusOK)
 }
 
-func (server *dbServer) handleUpdateSingleEntity(
+func (server *dbServer) handleSchemaDiscovery(
 	w http.ResponseWriter,
 	req *http.Request,
 ) {
-	target := chi.URLParam(req, routeVarTableOrView)
-
-	logger := server.logger.WithValues("target", target, "route", "handleUpdateSingleEntity")
+	logger := server.requestLogger(req).WithValues("route", "handleSchemaDiscovery")
 
-	qc := NewQueryCompilerFromRequest(req)
-	updateStmt, err := qc.CompileAsUpdateSingleEntry(target)
+	tableOrViews, err := queryTableOrViews(req.Context(), server.queryer)
 	if err != nil {
-		logger.Error(err, "parse update single entry query")
+		logger.Error(err, "query tables and views")
 		server.responseError(w, err)
 		return
 	}
-	logger.V(8).Info(updateStmt.Query)
 
-	_, err = server.execer.ExecContext(req.Context(), updateStmt.Query, updateStmt.Values...)
-	if err != nil {
-		server.responseError(w, err)
-		return
+	// make sure return list instead of null for empty list
+	rv := make([]TableOrView, 0, len(tableOrViews))
+	for _, t := range tableOrViews {
+		// same check as reading the table or view
+		err := server.checkTableOrViewAccess(req, t.Name, http.MethodGet)
+		switch {
+		case err == nil:
+			rv = append(rv, t)
+		case isAccessRestricted(err):
+			// not readable
+		default:
+			logger.Error(err, "check table or view access", "target", t.Name)
+			server.responseError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	server.responseData(w, rv, http.StatusOK)
+}
+
+func (server *dbServer) handleOpenAPISpec(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	logger := server.requestLogger(req).WithValues("route", "handleOpenAPISpec")
+
+	tableOrViews, err := queryTableOrViews(req.Context(), server.queryer)
+	if err != nil {
+		logger.Error(err, "query tables and views")
+		server.responseError(w, err)
+		return
+	}
+
+	var tables []TableInfo
+	for _, t := range tableOrViews {
+		if !server.isTableOrViewAccessible(t.Name) {
+			continue
+		}
+		columns, err := queryTableColumns(req.Context(), server.queryer, t.Name)
+		if err != nil {
+			logger.Error(err, "query table columns", "target", t.Name)
+			server.responseError(w, err)
+			return
+		}
+		tables = append(tables, TableInfo{TableOrView: t, Columns: columns})
+	}
+
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	server.responseHeader(w, http.StatusOK)
+	if _, err := w.Write(GenerateOpenAPISpec(tables)); err != nil {
+		logger.Error(err, "failed to write response")
+	}
+}
+
+func (server *dbServer) handleDescribeTableOrView(
+	w http.ResponseWriter,
+	req *http.Request,
+	logger logr.Logger,
+	target string,
+) {
+	if !server.allowSchemaAccess {
+		server.responseError(w, ErrAccessRestricted.WithHint("schema access is disabled"))
+		return
+	}
+
+	columns, err := queryTableColumns(req.Context(), server.queryerOf(req.Context()), target)
+	if err != nil {
+		logger.Error(err, "query table columns")
+		server.responseError(w, err)
+		return
+	}
+	if len(columns) < 1 {
+		// pragma_table_info returns empty result for unknown table
+		server.responseError(w, ErrBadRequest.WithHint(fmt.Sprintf("no such table: %s", target)))
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	server.responseData(w, columns, http.StatusOK)
+}
+
+// queryCount queries the total count of the request with the count method.
+func (server *dbServer) queryCount(
+	req *http.Request,
+	qc QueryCompiler,
+	target string,
+	method CountMethod,
+) (int64, error) {
+	ctx := req.Context()
+	logger := server.requestLogger(req)
+	queryer := server.queryerOf(ctx)
+
+	if method == countEstimated {
+		columns, err := queryTableColumns(ctx, queryer, target)
+		if err != nil {
+			return 0, err
+		}
+		stmt, err := qc.CompileAsEstimatedCount(target, columns)
+		switch {
+		case err == nil:
+			return estimateCount(ctx, queryer, stmt)
+		case errors.Is(err, errEstimatedCountUnsupported):
+			// fallback to exact count
+		default:
+			return 0, err
+		}
+	}
+
+	countStmt, err := qc.CompileAsExactCount(target)
+	if err != nil {
+		return 0, err
+	}
+	logger.V(8).Info(countStmt.Query)
+
+	var count int64
+	if err := queryer.QueryRowxContext(ctx, countStmt.Query, countStmt.Values...).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// estimateCount estimates the row count with the ANALYZE stats if available,
+// otherwise with database size divided by the average row size.
+func estimateCount(
+	ctx context.Context,
+	queryer sqlx.QueryerContext,
+	stmt CompiledEstimatedCount,
+) (int64, error) {
+	queryRow := func(q CompiledQuery, dest ...interface{}) error {
+		return queryer.QueryRowxContext(ctx, q.Query, q.Values...).Scan(dest...)
+	}
+
+	var hasStat int64
+	if err := queryRow(stmt.Stat, &hasStat); err != nil {
+		return 0, err
+	}
+	if hasStat > 0 {
+		var count int64
+		err := queryRow(stmt.StatRowCount, &count)
+		switch {
+		case err == nil:
+			return count, nil
+		case errors.Is(err, sql.ErrNoRows):
+			// table not analyzed
+		default:
+			return 0, err
+		}
+	}
+
+	var (
+		sampledRows int64
+		avgRowSize  float64
+	)
+	if err := queryRow(stmt.Sample, &sampledRows, &avgRowSize); err != nil {
+		return 0, err
+	}
+	if sampledRows < int64(stmt.SampleSize) || avgRowSize <= 0 {
+		// all rows are sampled
+		return sampledRows, nil
+	}
+
+	var dbSize int64
+	if err := queryRow(stmt.DatabaseSize, &dbSize); err != nil {
+		return 0, err
+	}
+	if estimated := int64(float64(dbSize) / avgRowSize); estimated > sampledRows {
+		return estimated, nil
+	}
+	return sampledRows, nil
+}
+
+func (server *dbServer) handleQueryTableOrView(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	target := chi.URLParam(req, routeVarTableOrView)
+
+	logger := server.requestLogger(req).WithValues("target", target, "route", "handleQueryTableOrView")
+
+	if req.URL.Query().Get(queryParameterNameSchema) == "true" {
+		server.handleDescribeTableOrView(w, req, logger, target)
+		return
+	}
+
+	server.queryTableOrView(w, req, logger, target, true)
+}
+
+// handleOptionsTableOrView responds the methods allowed on the table or view via the Allow header.
+func (server *dbServer) handleOptionsTableOrView(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	target := chi.URLParam(req, routeVarTableOrView)
+
+	claims, _ := JWTClaimsFromContext(req.Context())
+	methods := server.allowedMethods(target, rolesFromClaims(claims))
+	if len(methods) < 1 {
+		server.responseError(w, ErrAccessRestricted)
+		return
+	}
+
+	w.Header().Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleHeadTableOrView responds the same headers as handleQueryTableOrView without body.
+func (server *dbServer) handleHeadTableOrView(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	target := chi.URLParam(req, routeVarTableOrView)
+
+	logger := server.requestLogger(req).WithValues("target", target, "route", "handleHeadTableOrView")
+
+	server.queryTableOrView(w, req, logger, target, false)
+}
+
+// queryTableOrView queries the table or view and responds the rows. When withBody is false,
+// only the headers are responded.
+func (server *dbServer) queryTableOrView(
+	w http.ResponseWriter,
+	req *http.Request,
+	logger logr.Logger,
+	target string,
+	withBody bool,
+) {
+	qc := NewQueryCompilerFromRequestWithMaxLimit(req, server.maxLimit)
+	selectStmt, err := qc.CompileAsSelect(target)
+	if err != nil {
+		logger.Error(err, "parse select query")
+		server.responseError(w, err)
+		return
+	}
+	logger.V(8).Info(selectStmt.Query)
+
+	responseStatusCode := http.StatusOK
+	if qc.IsLimitCapped() {
+		w.Header().Set(headerNameCappedLimit, "true")
+	}
+
+	preference, err := ParsePreferenceFromRequest(req)
+	if err != nil {
+		logger.Error(err, "parse preference")
+		server.responseError(w, err)
+		return
+	}
+	// NOTE: count is queried before reading the rows so that the headers can be set
+	//       before streaming the response body.
+	countTotal := "*"
+	if preference.Count != countNone {
+		count, err := server.queryCount(req, qc, target, preference.Count)
+		if err != nil {
+			logger.Error(err, "count values")
+			server.responseError(w, err)
+			return
+		}
+		countTotal = fmt.Sprint(count)
+		w.Header().Set(headerNameTotalCount, countTotal)
+	}
+
+	if v := qc.CompileContentRangeHeader(countTotal); v != "" {
+		w.Header().Set("Range-Unit", "items")
+		w.Header().Set("Content-Range", v)
+		if preference.Count != countNone {
+			// only paginated response is partial
+			responseStatusCode = http.StatusPartialContent
+		}
+	}
+
+	if v := qc.CompilePaginationLinks(countTotal); v != "" {
+		w.Header().Set("Link", v)
+	}
+
+	lastModified, ok, err := server.queryLastModified(req, qc, target)
+	if err != nil {
+		logger.Error(err, "query last modified")
+		server.responseError(w, err)
+		return
+	}
+	if ok {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+		// If-None-Match takes precedence over If-Modified-Since
+		if req.Header.Get("If-None-Match") == "" && isNotModifiedSince(req.Header.Get("If-Modified-Since"), lastModified) {
+			server.setCacheControl(w)
+			server.responseEmptyBody(w, http.StatusNotModified)
+			return
+		}
+	}
+
+	responseMediaType := negotiateResponseMediaType(req)
+	if responseMediaType == mediaTypeNDJSON && withBody {
+		// NDJSON response is streamed page by page, hence Next-Cursor header is not available.
+		server.setCacheControl(w)
+		server.responseNDJSON(w, req, logger, selectStmt, responseStatusCode)
+		return
+	}
+	if withBody && responseMediaType == mediaTypeJSON && server.shouldStreamRows(req.Context(), logger, target) {
+		// streamed response is written page by page, hence Next-Cursor and ETag headers are not available.
+		server.setCacheControl(w)
+		written := server.responseJSONStream(w, req, logger, selectStmt, responseStatusCode)
+		metricsQueryRowsReturned.WithLabelValues(target, "queryTableOrView").Observe(float64(written))
+		return
+	}
+
+	rows, err := server.queryerOf(req.Context()).QueryxContext(req.Context(), selectStmt.Query, selectStmt.Values...)
+	if err != nil {
+		if isClientDisconnected(req) {
+			logger.V(4).Info("client disconnected")
+			return
+		}
+		logger.Error(err, "query values")
+		server.responseError(w, err)
+		return
+	}
+	// NOTE: the query is interrupted by the driver once the request context is cancelled
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		logger.Error(err, "read columns")
+		server.responseError(w, err)
+		return
+	}
+
+	server.setCacheControl(w)
+
+	if responseMediaType == mediaTypeNDJSON {
+		w.Header().Set("Content-Type", mediaTypeNDJSON)
+		server.responseEmptyBody(w, responseStatusCode)
+		return
+	}
+
+	// make sure return list instead of null for empty list
+	// FIXME: reflect column type and scan typed value instead of using `interface{}`
+	rv := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		p := make(map[string]interface{})
+		if err := rows.MapScan(p); err != nil {
+			server.responseError(w, err)
+			return
+		}
+		rv = append(rv, p)
+	}
+	if err := rows.Err(); err != nil {
+		if isClientDisconnected(req) {
+			logger.V(4).Info("client disconnected")
+			return
+		}
+		logger.Error(err, "read rows")
+		server.responseError(w, err)
+		return
+	}
+
+	if withBody {
+		metricsQueryRowsReturned.WithLabelValues(target, "queryTableOrView").Observe(float64(len(rv)))
+	}
+
+	if v := qc.CompileNextCursorHeader(rv); v != "" {
+		w.Header().Set(headerNameNextCursor, v)
+	}
+
+	etag, err := computeETag(responseMediaType, rv)
+	if err != nil {
+		logger.Error(err, "compute ETag")
+		server.responseError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if matchesETag(req.Header.Get("If-None-Match"), etag) {
+		server.responseEmptyBody(w, http.StatusNotModified)
+		return
+	}
+
+	switch {
+	case !withBody:
+		if responseMediaType == mediaTypeCSV {
+			w.Header().Set("Content-Type", mediaTypeCSV+"; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", mediaTypeJSON)
+		}
+		server.responseEmptyBody(w, responseStatusCode)
+	case responseMediaType == mediaTypeCSV:
+		server.responseCSV(w, columns, rv, responseStatusCode)
+	default:
+		w.Header().Set("Content-Type", mediaTypeJSON)
+		server.responseData(w, rv, responseStatusCode)
+	}
+}
+
+func (server *dbServer) handleInsertTable(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	target := chi.URLParam(req, routeVarTableOrView)
+
+	logger := server.requestLogger(req).WithValues("target", target, "route", "handleInsertTable")
+
+	qc := NewQueryCompilerFromRequest(req)
+	insertStmt, err := qc.CompileAsInsert(target)
+	if err != nil {
+		logger.Error(err, "parse insert query")
+		server.responseError(w, err)
+		return
+	}
+	logger.V(8).Info(insertStmt.Query)
+
+	if err := server.runBeforeInsert(req, target); err != nil {
+		logger.Error(err, "before insert hook")
+		server.responseError(w, err)
+		return
+	}
+
+	result, writtenRows, err := server.execWriteWithRetry(req.Context(), insertStmt)
+	if err != nil {
+		server.responseError(w, err)
+		return
+	}
+	server.observeRowsAffected(logger, target, "insertTable", result)
+	server.dispatchWebhookEvents(req, webhookOperationInsert, target, writtenRows)
+
+	headersOnly := isHeadersOnlyReturn(req)
+	if headersOnly {
+		server.setRowsAffectedHeader(w, logger, result)
+	}
+	if server.returnLocation || headersOnly {
+		location, err := server.getInsertedResourceLocation(req.Context(), target, result)
+		if err != nil {
+			// the insertion has been committed, so we don't fail the request here
+			logger.Error(err, "resolve inserted resource location")
+		} else if location != "" {
+			w.Header().Set("Location", location)
+		}
+	}
+
+	w.Header().Set(headerNameCacheControl, cacheControlNoStore)
+	server.responseEmptyBody(w, http.StatusCreated)
+}
+
+// isHeadersOnlyReturn checks if the write request prefers `return=headers-only`.
+// Invalid preference has been rejected when compiling the query, hence ignored here.
+func isHeadersOnlyReturn(req *http.Request) bool {
+	preference, err := ParsePreferenceFromRequest(req)
+	return err == nil && preference.Return == returnHeadersOnly
+}
+
+// getInsertedResourceLocation returns the location of the last inserted row.
+// Empty string will be returned if no row was inserted.
+func (server *dbServer) getInsertedResourceLocation(
+	ctx context.Context,
+	target string,
+	result sql.Result,
+) (string, error) {
+	id, err := result.LastInsertId()
+	if err != nil {
+		return "", fmt.Errorf("read last insert id: %w", err)
+	}
+	if id == 0 {
+		return "", nil
+	}
+
+	column, err := queryIntegerPrimaryKeyColumn(ctx, server.queryerOf(ctx), target)
+	if err != nil {
+		return "", err
+	}
+	if column == "" {
+		column = "rowid"
+	}
+
+	return fmt.Sprintf("/%s?%s=eq.%d", target, url.QueryEscape(column), id), nil
+}
+
+// execWriteWithMaxAffected executes the write statement and rejects the request if it
+// affects more rows than the `Prefer: max-affected=N` limit. The statement is executed in a
+// transaction which is rolled back when the limit is exceeded, so the check can't race with
+// concurrent writes.
+func (server *dbServer) execWriteWithMaxAffected(
+	req *http.Request,
+	stmt CompiledQuery,
+) (sql.Result, []map[string]interface{}, error) {
+	ctx := req.Context()
+
+	preference, err := ParsePreferenceFromRequest(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if preference.MaxAffected < 1 {
+		return server.execWriteWithRetry(ctx, stmt)
+	}
+
+	// the batch transaction is rolled back by the failed operation, so a transaction
+	// is only started outside of batch
+	var tx *sqlx.Tx
+	if _, inTx := dbTxFromContext(ctx); !inTx {
+		beginner, ok := server.execer.(txBeginner)
+		if !ok {
+			return nil, nil, fmt.Errorf("max-affected is not supported")
+		}
+		tx, err = beginner.BeginTxx(ctx, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer tx.Rollback() // no-op after commit
+		ctx = withDBTx(ctx, tx)
+	}
+
+	result, rows, err := server.execWriteWithRetry(ctx, stmt)
+	if err != nil {
+		return nil, nil, err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return nil, nil, err
+	}
+	if count > int64(preference.MaxAffected) {
+		return nil, nil, ErrBadRequest.WithHint(fmt.Sprintf(
+			"would affect %d rows, limit is %d", count, preference.MaxAffected,
+		))
+	}
+
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return result, rows, nil
+}
+
+// execWithRetry executes the write statement, retrying with exponential backoff when the
+// database is busy. Statements in a batch transaction are not retried.
+// 503 Service Unavailable is returned if the database is still busy after the retries.
+func (server *dbServer) execWithRetry(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var rv sql.Result
+	err := server.retryOnBusy(ctx, func() error {
+		var err error
+		rv, err = server.execerOf(ctx).ExecContext(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// retryOnBusy calls fn, retrying with exponential backoff when the database is busy.
+func (server *dbServer) retryOnBusy(ctx context.Context, fn func() error) error {
+	retryCount := server.dbRetryCount
+	if _, inTx := dbTxFromContext(ctx); inTx {
+		retryCount = 0
+	}
+
+	delay := server.dbRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		var sqliteError sqlite3.Error
+		if !errors.As(err, &sqliteError) || sqliteError.Code != sqlite3.ErrBusy {
+			return err
+		}
+		if attempt >= retryCount {
+			rv := ErrServiceUnavailable.WithHint(sqliteError.Error())
+			rv.Code = sqliteErrorCode(sqliteError)
+			return rv
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// returningLastInsertRowIDColumn is the RETURNING column of the last inserted rowid,
+// which is removed from the returned rows.
+const returningLastInsertRowIDColumn = tableNamePrefixInternal + "last_insert_rowid"
+
+// returningResult is the result of a write statement executed with RETURNING clause.
+type returningResult struct {
+	rows         []map[string]interface{}
+	lastInsertID int64
+}
+
+var _ sql.Result = returningResult{}
+
+func (r returningResult) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r returningResult) RowsAffected() (int64, error) {
+	return int64(len(r.rows)), nil
+}
+
+// execWriteWithRetry executes the write statement with retries. When the webhook is
+// configured, the statement is executed with RETURNING clause and the written rows are
+// returned for the webhook events.
+func (server *dbServer) execWriteWithRetry(
+	ctx context.Context,
+	stmt CompiledQuery,
+) (sql.Result, []map[string]interface{}, error) {
+	if server.webhook == nil {
+		result, err := server.execWithRetry(ctx, stmt.Query, stmt.Values...)
+		return result, nil, err
+	}
+
+	query := fmt.Sprintf("%s returning *, last_insert_rowid() as %s", stmt.Query, returningLastInsertRowIDColumn)
+	var rv returningResult
+	err := server.retryOnBusy(ctx, func() error {
+		rv = returningResult{}
+		rows, err := server.queryerOf(ctx).QueryxContext(ctx, query, stmt.Values...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			p := make(map[string]interface{})
+			if err := rows.MapScan(p); err != nil {
+				return err
+			}
+			if id, ok := p[returningLastInsertRowIDColumn].(int64); ok {
+				rv.lastInsertID = id
+			}
+			delete(p, returningLastInsertRowIDColumn)
+			rv.rows = append(rv.rows, p)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return rv, rv.rows, nil
+}
+
+// compileUpdateQuery compiles the update query by the request media type.
+// For JSON Patch request, the test operations are checked before returning the update query.
+func (server *dbServer) compileUpdateQuery(req *http.Request, target string) (CompiledQuery, error) {
+	qc := NewQueryCompilerFromRequest(req)
+
+	switch requestMediaType(req) {
+	case mediaTypeMergePatch:
+		columns, err := queryTableColumns(req.Context(), server.queryerOf(req.Context()), target)
+		if err != nil {
+			return CompiledQuery{}, err
+		}
+		return qc.CompileAsMergePatch(target, columns)
+	case mediaTypeJSONPatch:
+		columns, err := queryTableColumns(req.Context(), server.queryerOf(req.Context()), target)
+		if err != nil {
+			return CompiledQuery{}, err
+		}
+		patch, err := qc.CompileAsJSONPatch(target, columns)
+		if err != nil {
+			return CompiledQuery{}, err
+		}
+		if patch.Test != nil {
+			var failed int64
+			err := server.queryerOf(req.Context()).QueryRowxContext(req.Context(), patch.Test.Query, patch.Test.Values...).
+				Scan(&failed)
+			if err != nil {
+				return CompiledQuery{}, err
+			}
+			if failed > 0 {
+				return CompiledQuery{}, ErrConflict.WithHint(fmt.Sprintf("test failed for %d rows", failed))
+			}
+		}
+		return patch.Update, nil
+	default:
+		return qc.CompileAsUpdate(target)
+	}
+}
+
+// readUpdateValues reads the values to set from the update request. For JSON Patch request,
+// the removed columns are set to nil.
+func readUpdateValues(req *http.Request) (map[string]interface{}, error) {
+	qc := &queryCompiler{req: req}
+
+	switch requestMediaType(req) {
+	case mediaTypeMergePatch:
+		body, err := qc.readyRequestBody()
+		if err != nil {
+			return nil, err
+		}
+		var rv map[string]interface{}
+		if err := json.Unmarshal(body, &rv); err != nil {
+			return nil, err
+		}
+		return rv, nil
+	case mediaTypeJSONPatch:
+		body, err := qc.readyRequestBody()
+		if err != nil {
+			return nil, err
+		}
+		var ops []jsonPatchOperation
+		if err := json.Unmarshal(body, &ops); err != nil {
+			return nil, err
+		}
+		rv := map[string]interface{}{}
+		for _, op := range ops {
+			column, err := op.column()
+			if err != nil {
+				return nil, err
+			}
+			switch op.Op {
+			case jsonPatchOpAdd, jsonPatchOpReplace:
+				rv[column] = op.Value
+			case jsonPatchOpRemove:
+				rv[column] = nil
+			}
+		}
+		return rv, nil
+	default:
+		payload, err := qc.getInputPayload()
+		if err != nil {
+			return nil, err
+		}
+		if len(payload.Payload) < 1 {
+			return nil, nil
+		}
+		return payload.Payload[0], nil
+	}
+}
+
+// runBeforeInsert calls the before insert hook with each row of the request.
+func (server *dbServer) runBeforeInsert(req *http.Request, target string) error {
+	if server.beforeInsert == nil {
+		return nil
+	}
+
+	payload, err := (&queryCompiler{req: req}).getInputPayload()
+	if err != nil {
+		return err
+	}
+	for _, row := range payload.Payload {
+		if err := server.beforeInsert(target, row); err != nil {
+			return ErrBadRequest.WithHint(err.Error())
+		}
+	}
+	return nil
+}
+
+// runBeforeUpdate calls the before update hook with the values to set.
+func (server *dbServer) runBeforeUpdate(req *http.Request, target string) error {
+	if server.beforeUpdate == nil {
+		return nil
+	}
+
+	values, err := readUpdateValues(req)
+	if err != nil {
+		return err
+	}
+	if err := server.beforeUpdate(target, values); err != nil {
+		return ErrBadRequest.WithHint(err.Error())
+	}
+	return nil
+}
+
+func (server *dbServer) handleUpdateTable(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	target := chi.URLParam(req, routeVarTableOrView)
+
+	logger := server.requestLogger(req).WithValues("target", target, "route", "handleUpdateTable")
+
+	updateStmt, err := server.compileUpdateQuery(req, target)
+	if err != nil {
+		logger.Error(err, "parse update query")
+		server.responseError(w, err)
+		return
+	}
+	logger.V(8).Info(updateStmt.Query)
+
+	if err := server.runBeforeUpdate(req, target); err != nil {
+		logger.Error(err, "before update hook")
+		server.responseError(w, err)
+		return
+	}
+
+	result, writtenRows, err := server.execWriteWithMaxAffected(req, updateStmt)
+	if err != nil {
+		server.responseError(w, err)
+		return
+	}
+	server.setRowsAffectedHeader(w, logger, result)
+	server.observeRowsAffected(logger, target, "updateTable", result)
+	server.dispatchWebhookEvents(req, webhookOperationUpdate, target, writtenRows)
+
+	w.Header().Set(headerNameCacheControl, cacheControlNoStore)
+	server.responseEmptyBody(w, http.StatusAccepted)
+}
+
+func (server *dbServer) handleUpdateSingleEntity(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	target := chi.URLParam(req, routeVarTableOrView)
+
+	logger := server.requestLogger(req).WithValues("target", target, "route", "handleUpdateSingleEntity")
+
+	qc := NewQueryCompilerFromRequest(req)
+	updateStmt, err := qc.CompileAsUpdateSingleEntry(target)
+	if err != nil {
+		logger.Error(err, "parse update single entry query")
+		server.responseError(w, err)
+		return
+	}
+	logger.V(8).Info(updateStmt.Query)
+
+	if err := server.runBeforeUpdate(req, target); err != nil {
+		logger.Error(err, "before update hook")
+		server.responseError(w, err)
+		return
+	}
+
+	result, writtenRows, err := server.execWriteWithRetry(req.Context(), updateStmt)
+	if err != nil {
+		server.responseError(w, err)
+		return
+	}
+	server.setRowsAffectedHeader(w, logger, result)
+	server.observeRowsAffected(logger, target, "updateSingleEntity", result)
+	w.Header().Set(headerNameCacheControl, cacheControlNoStore)
+	server.dispatchWebhookEvents(req, webhookOperationUpdate, target, writtenRows)
+
+	if isHeadersOnlyReturn(req) {
+		server.responseEmptyBody(w, http.StatusOK)
 	}
 }
 
@@ -336,7 +1773,7 @@ func (server *dbServer) handleDeleteTable(
 ) {
 	target := chi.URLParam(req, routeVarTableOrView)
 
-	logger := server.logger.WithValues("target", target, "route", "handleDeleteTable")
+	logger := server.requestLogger(req).WithValues("target", target, "route", "handleDeleteTable")
 
 	qc := NewQueryCompilerFromRequest(req)
 	updateStmt, err := qc.CompileAsDelete(target)
@@ -347,12 +1784,16 @@ func (server *dbServer) handleDeleteTable(
 	}
 	logger.V(8).Info(updateStmt.Query)
 
-	_, err = server.execer.ExecContext(req.Context(), updateStmt.Query, updateStmt.Values...)
+	result, writtenRows, err := server.execWriteWithMaxAffected(req, updateStmt)
 	if err != nil {
 		server.responseError(w, err)
 		return
 	}
+	server.setRowsAffectedHeader(w, logger, result)
+	server.observeRowsAffected(logger, target, "deleteTable", result)
+	server.dispatchWebhookEvents(req, webhookOperationDelete, target, writtenRows)
 
+	w.Header().Set(headerNameCacheControl, cacheControlNoStore)
 	server.responseEmptyBody(w, http.StatusAccepted)
 }
 
@@ -391,7 +1832,7 @@ func createServeCmd() *cobra.Command {
 			}
 
 			metricsServerOpts.Logger = logger
-			metricsServerOpts.Queryer = db
+			metricsServerOpts.DB = db
 			metricsServer, err := NewMetricsServer(*metricsServerOpts)
 			if err != nil {
 				setupLogger.Error(err, "failed to create metrics server")
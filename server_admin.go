@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const routeAdmin = "/_admin"
+
+// adminVacuumTimeout is the timeout for VACUUM, which is not bounded by the request timeout
+// as rebuilding a large database can take a long time.
+const adminVacuumTimeout = time.Hour
+
+// resolveBackupDest resolves the backup destination path within the backup dir.
+func (server *dbServer) resolveBackupDest(dest string) (string, error) {
+	if server.backupDir == "" {
+		return "", ErrAccessRestricted.WithHint("backup to file is disabled")
+	}
+
+	if !filepath.IsAbs(dest) {
+		dest = filepath.Join(server.backupDir, dest)
+	}
+	dest = filepath.Clean(dest)
+
+	rel, err := filepath.Rel(server.backupDir, dest)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrAccessRestricted.WithHint(fmt.Sprintf("dest %q is outside of the backup dir", dest))
+	}
+
+	return dest, nil
+}
+
+type adminBackupRequest struct {
+	// Dest is the path of the backup file. The backup is streamed in response when empty.
+	Dest string `json:"dest"`
+}
+
+func (server *dbServer) handleAdminBackup(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	logger := server.requestLogger(req).WithValues("route", "handleAdminBackup")
+
+	db, ok := server.execer.(*sqlx.DB)
+	if !ok {
+		server.responseError(w, fmt.Errorf("backup is not supported"))
+		return
+	}
+
+	var payload adminBackupRequest
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		if isRequestBodyTooLarge(err) {
+			server.responseError(w, errRequestBodyTooLarge)
+			return
+		}
+		server.responseError(w, ErrBadRequest.WithHint(fmt.Sprintf("decode backup request: %s", err)))
+		return
+	}
+
+	if payload.Dest != "" {
+		dest, err := server.resolveBackupDest(payload.Dest)
+		if err != nil {
+			server.responseError(w, err)
+			return
+		}
+
+		logger = logger.WithValues("dest", dest)
+		if err := backupDB(req.Context(), db, dest, defaultBackupProgressInterval, nil); err != nil {
+			logger.Error(err, "backup database")
+			server.responseError(w, err)
+			return
+		}
+		logger.Info("backup completed")
+
+		w.Header().Set("Content-Type", mediaTypeJSON)
+		server.responseData(w, adminBackupRequest{Dest: dest}, http.StatusCreated)
+		return
+	}
+
+	tempDir, err := os.MkdirTemp("", "sqlite-rest-backup-*")
+	if err != nil {
+		logger.Error(err, "create temp dir")
+		server.responseError(w, err)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	dest := filepath.Join(tempDir, "backup.db")
+	if err := backupDB(req.Context(), db, dest, defaultBackupProgressInterval, nil); err != nil {
+		logger.Error(err, "backup database")
+		server.responseError(w, err)
+		return
+	}
+
+	f, err := os.Open(dest)
+	if err != nil {
+		logger.Error(err, "open backup file")
+		server.responseError(w, err)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="backup.db"`)
+	if stat, err := f.Stat(); err == nil {
+		w.Header().Set("Content-Length", fmt.Sprint(stat.Size()))
+	}
+	server.responseHeader(w, http.StatusOK)
+	if _, err := io.Copy(w, f); err != nil {
+		logger.Error(err, "stream backup file")
+	}
+}
+
+type adminCheckpointRequest struct {
+	// Mode is the WAL checkpoint mode. Defaults to passive.
+	Mode string `json:"mode"`
+}
+
+func (server *dbServer) handleAdminCheckpoint(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	logger := server.requestLogger(req).WithValues("route", "handleAdminCheckpoint")
+
+	var payload adminCheckpointRequest
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		if isRequestBodyTooLarge(err) {
+			server.responseError(w, errRequestBodyTooLarge)
+			return
+		}
+		server.responseError(w, ErrBadRequest.WithHint(fmt.Sprintf("decode checkpoint request: %s", err)))
+		return
+	}
+	mode := strings.ToLower(payload.Mode)
+	if mode == "" {
+		mode = walCheckpointModePassive
+	}
+	if !isValidWALCheckpointMode(mode) {
+		server.responseError(w, ErrBadRequest.WithHint(fmt.Sprintf("invalid checkpoint mode %q", payload.Mode)))
+		return
+	}
+
+	rv, err := walCheckpoint(req.Context(), server.queryer, mode)
+	if err != nil {
+		logger.Error(err, "checkpoint WAL", "mode", mode)
+		server.responseError(w, err)
+		return
+	}
+	logger.Info("checkpoint completed", "mode", mode, "busy", rv.Busy, "log", rv.Log, "checkpointed", rv.Checkpointed)
+
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	server.responseData(w, rv, http.StatusOK)
+}
+
+type adminVacuumRequest struct {
+	// Dest is the path of the file to vacuum into. The database is vacuumed in place when empty.
+	Dest string `json:"dest"`
+}
+
+type adminVacuumResponse struct {
+	Dest      string `json:"dest,omitempty"`
+	ElapsedMS int64  `json:"elapsed_ms"`
+}
+
+func (server *dbServer) handleAdminVacuum(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	logger := server.requestLogger(req).WithValues("route", "handleAdminVacuum")
+
+	var payload adminVacuumRequest
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		if isRequestBodyTooLarge(err) {
+			server.responseError(w, errRequestBodyTooLarge)
+			return
+		}
+		server.responseError(w, ErrBadRequest.WithHint(fmt.Sprintf("decode vacuum request: %s", err)))
+		return
+	}
+
+	stmt := "VACUUM"
+	var args []interface{}
+	var rv adminVacuumResponse
+	if payload.Dest != "" {
+		dest, err := server.resolveBackupDest(payload.Dest)
+		if err != nil {
+			server.responseError(w, err)
+			return
+		}
+		stmt = "VACUUM INTO ?"
+		args = append(args, dest)
+		rv.Dest = dest
+		logger = logger.WithValues("dest", dest)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), adminVacuumTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := server.execer.ExecContext(ctx, stmt, args...); err != nil {
+		logger.Error(err, "vacuum database")
+		server.responseError(w, err)
+		return
+	}
+	rv.ElapsedMS = time.Since(start).Milliseconds()
+	logger.Info("vacuum completed", "elapsedMS", rv.ElapsedMS)
+
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	server.responseData(w, rv, http.StatusOK)
+}
@@ -1,22 +1,41 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
-	"github.com/golang-jwt/jwt"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/spf13/pflag"
 )
 
 const (
 	headerNameAuthorizer = "Authorization"
+	headerNameAPIKey     = "X-Api-Key"
 	headerPrefixBearer   = "Bearer"
 )
 
 type ServerAuthOptions struct {
-	RSAPublicKeyFilePath string
-	TokenFilePath        string
+	RSAPublicKeyFilePath     string
+	RSAPublicKeyDirPath      string
+	ECDSAPublicKeyFilePath   string
+	Ed25519PublicKeyFilePath string
+	TokenFilePath            string
+	// Audience is the expected audience (aud) of the token. Empty value skips the validation.
+	Audience string
+	// Issuer is the expected issuer (iss) of the token. Empty value skips the validation.
+	Issuer string
+	// ClockSkew is the leeway for validating time based claims (exp, nbf, iat).
+	ClockSkew time.Duration
+	// APIKeyFilePath is the path to the API keys file, one key per line.
+	APIKeyFilePath string
+	// APIKeyHashed indicates the keys in APIKeyFilePath are hex encoded SHA-256 hashes.
+	APIKeyHashed bool
 
 	// for unit test
 	disableAuth bool
@@ -24,20 +43,66 @@ type ServerAuthOptions struct {
 
 func (opts *ServerAuthOptions) bindCLIFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&opts.RSAPublicKeyFilePath, "auth-rsa-public-key", "", "path to the RSA public key file")
+	fs.StringVar(
+		&opts.RSAPublicKeyDirPath, "auth-rsa-public-key-dir", "",
+		"path to the directory of RSA public key files. Token signed by any of the keys is accepted.",
+	)
+	fs.StringVar(&opts.ECDSAPublicKeyFilePath, "auth-ecdsa-public-key", "", "path to the ECDSA public key file")
+	fs.StringVar(&opts.Ed25519PublicKeyFilePath, "auth-ed25519-public-key", "", "path to the Ed25519 public key file")
 	fs.StringVar(&opts.TokenFilePath, "auth-token-file", "", "path to the token file")
+	fs.StringVar(
+		&opts.Audience, "auth-jwt-audience", "",
+		"expected audience (aud) of the JWT. Empty value means no validation.",
+	)
+	fs.StringVar(
+		&opts.Issuer, "auth-jwt-issuer", "",
+		"expected issuer (iss) of the JWT. Empty value means no validation.",
+	)
+	fs.DurationVar(
+		&opts.ClockSkew, "auth-jwt-clock-skew", 0,
+		"clock skew tolerance for validating time based claims (exp, nbf, iat) of the JWT",
+	)
+	fs.StringVar(
+		&opts.APIKeyFilePath, "auth-api-key-file", "",
+		"path to the API keys file, one key per line. API key is read from the X-Api-Key header.",
+	)
+	fs.BoolVar(
+		&opts.APIKeyHashed, "auth-api-key-hashed", false,
+		"keys in the API keys file are hex encoded SHA-256 hashes",
+	)
 }
 
+const authKeyFlags = "--auth-rsa-public-key, --auth-rsa-public-key-dir, --auth-ecdsa-public-key, --auth-ed25519-public-key or --auth-token-file"
+
 func (opts *ServerAuthOptions) defaults() error {
 	if opts.disableAuth {
 		return nil
 	}
 
-	if opts.RSAPublicKeyFilePath == "" && opts.TokenFilePath == "" {
-		return fmt.Errorf("specifies at least --auth-rsa-public-key or --auth-token-file")
+	var authMethods int
+	for _, v := range []string{
+		opts.RSAPublicKeyFilePath,
+		opts.RSAPublicKeyDirPath,
+		opts.ECDSAPublicKeyFilePath,
+		opts.Ed25519PublicKeyFilePath,
+		opts.TokenFilePath,
+	} {
+		if v != "" {
+			authMethods += 1
+		}
+	}
+
+	if authMethods < 1 {
+		if opts.Issuer != "" {
+			return fmt.Errorf("--auth-jwt-issuer requires one of %s", authKeyFlags)
+		}
+		if opts.APIKeyFilePath == "" {
+			return fmt.Errorf("specifies at least --auth-api-key-file or one of %s", authKeyFlags)
+		}
 	}
 
-	if opts.RSAPublicKeyFilePath != "" && opts.TokenFilePath != "" {
-		return fmt.Errorf("cannot specific --auth-rsa-public-key and --auth-token-file at the same time")
+	if authMethods > 1 {
+		return fmt.Errorf("cannot specific more than one of %s at the same time", authKeyFlags)
 	}
 
 	return nil
@@ -52,10 +117,7 @@ func (opts *ServerAuthOptions) createAuthMiddleware(
 		}
 	}
 
-	jwtParser := &jwt.Parser{
-		ValidMethods:         []string{},
-		SkipClaimsValidation: false,
-	}
+	var validMethods []string
 
 	jwtKeyFunc := jwt.Keyfunc(func(t *jwt.Token) (interface{}, error) {
 		return nil, fmt.Errorf("invalid token")
@@ -67,8 +129,8 @@ func (opts *ServerAuthOptions) createAuthMiddleware(
 	case opts.RSAPublicKeyFilePath != "":
 		keyReader := readFileWithStatCache(opts.RSAPublicKeyFilePath)
 
-		jwtParser.ValidMethods = append(
-			jwtParser.ValidMethods,
+		validMethods = append(
+			validMethods,
 			jwt.SigningMethodRS256.Name,
 			jwt.SigningMethodRS384.Name,
 			jwt.SigningMethodRS512.Name,
@@ -85,11 +147,81 @@ func (opts *ServerAuthOptions) createAuthMiddleware(
 			}
 			return v, nil
 		}
+	case opts.RSAPublicKeyDirPath != "":
+		// NOTE: multiple keys are used for key rotation
+		keysReader := readDirFilesWithStatCache(opts.RSAPublicKeyDirPath)
+
+		validMethods = append(
+			validMethods,
+			jwt.SigningMethodRS256.Name,
+			jwt.SigningMethodRS384.Name,
+			jwt.SigningMethodRS512.Name,
+		)
+		jwtKeyFunc = func(t *jwt.Token) (interface{}, error) {
+			bs, err := keysReader()
+			if err != nil {
+				return nil, err
+			}
+
+			var keySet jwt.VerificationKeySet
+			for _, b := range bs {
+				v, err := jwt.ParseRSAPublicKeyFromPEM(b)
+				if err != nil {
+					// not a public key file, skip
+					continue
+				}
+				keySet.Keys = append(keySet.Keys, v)
+			}
+			if len(keySet.Keys) < 1 {
+				return nil, fmt.Errorf("no public key found")
+			}
+			return keySet, nil
+		}
+	case opts.ECDSAPublicKeyFilePath != "":
+		keyReader := readFileWithStatCache(opts.ECDSAPublicKeyFilePath)
+
+		validMethods = append(
+			validMethods,
+			jwt.SigningMethodES256.Name,
+			jwt.SigningMethodES384.Name,
+			jwt.SigningMethodES512.Name,
+		)
+		jwtKeyFunc = func(t *jwt.Token) (interface{}, error) {
+			b, err := keyReader()
+			if err != nil {
+				return nil, err
+			}
+
+			v, err := jwt.ParseECPublicKeyFromPEM(b)
+			if err != nil {
+				return nil, err
+			}
+			return v, nil
+		}
+	case opts.Ed25519PublicKeyFilePath != "":
+		keyReader := readFileWithStatCache(opts.Ed25519PublicKeyFilePath)
+
+		validMethods = append(
+			validMethods,
+			jwt.SigningMethodEdDSA.Alg(),
+		)
+		jwtKeyFunc = func(t *jwt.Token) (interface{}, error) {
+			b, err := keyReader()
+			if err != nil {
+				return nil, err
+			}
+
+			v, err := jwt.ParseEdPublicKeyFromPEM(b)
+			if err != nil {
+				return nil, err
+			}
+			return v, nil
+		}
 	case opts.TokenFilePath != "":
 		tokenReader := readFileWithStatCache(opts.TokenFilePath)
 
-		jwtParser.ValidMethods = append(
-			jwtParser.ValidMethods,
+		validMethods = append(
+			validMethods,
 			jwt.SigningMethodHS256.Name,
 			jwt.SigningMethodHS384.Name,
 			jwt.SigningMethodHS512.Name,
@@ -104,8 +236,42 @@ func (opts *ServerAuthOptions) createAuthMiddleware(
 		}
 	}
 
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods(validMethods),
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.ClockSkew > 0 {
+		parserOpts = append(parserOpts, jwt.WithLeeway(opts.ClockSkew))
+	}
+	jwtParser := jwt.NewParser(parserOpts...)
+
+	var apiKeysReader func() ([]byte, error)
+	if opts.APIKeyFilePath != "" {
+		apiKeysReader = readFileWithStatCache(opts.APIKeyFilePath)
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if apiKey := r.Header.Get(headerNameAPIKey); apiKey != "" {
+				if apiKeysReader == nil {
+					responseErr(w, ErrUnauthorized.WithHint("api key auth is not enabled"))
+					return
+				}
+
+				if err := opts.verifyAPIKey(apiKeysReader, apiKey); err != nil {
+					responseErr(w, ErrUnauthorized.WithHint(err.Error()))
+					return
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			v := r.Header.Get(headerNameAuthorizer)
 
 			if v == "" {
@@ -124,14 +290,89 @@ func (opts *ServerAuthOptions) createAuthMiddleware(
 				return
 			}
 
-			// TODO: add rbac support
-			_, err := jwtParser.Parse(ps[1], jwtKeyFunc)
+			token, err := jwtParser.Parse(ps[1], jwtKeyFunc)
 			if err != nil {
 				responseErr(w, ErrUnauthorized.WithHint(err.Error()))
 				return
 			}
+			if claims, ok := token.Claims.(jwt.MapClaims); ok {
+				r = r.WithContext(WithJWTClaims(r.Context(), claims))
+			}
 
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+type jwtClaimsContextKey struct{}
+
+// WithJWTClaims returns a copy of ctx with the verified JWT claims.
+func WithJWTClaims(ctx context.Context, claims jwt.MapClaims) context.Context {
+	return context.WithValue(ctx, jwtClaimsContextKey{}, claims)
+}
+
+// JWTClaimsFromContext returns the verified JWT claims from ctx.
+func JWTClaimsFromContext(ctx context.Context) (jwt.MapClaims, bool) {
+	claims, ok := ctx.Value(jwtClaimsContextKey{}).(jwt.MapClaims)
+	return claims, ok
+}
+
+// verifyAPIKey checks if the API key is listed in the API keys file.
+func (opts *ServerAuthOptions) verifyAPIKey(
+	apiKeysReader func() ([]byte, error),
+	apiKey string,
+) error {
+	b, err := apiKeysReader()
+	if err != nil {
+		return err
+	}
+
+	if opts.APIKeyHashed {
+		h := sha256.Sum256([]byte(apiKey))
+		apiKey = hex.EncodeToString(h[:])
+	}
+
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if opts.APIKeyHashed {
+			line = strings.ToLower(line)
+		}
+
+		if subtle.ConstantTimeCompare([]byte(line), []byte(apiKey)) == 1 {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid api key")
+}
+
+// createBearerTokenAuthMiddleware checks the request carries the static token as bearer token.
+func createBearerTokenAuthMiddleware(
+	token string,
+	responseErr func(w http.ResponseWriter, err error),
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			v := req.Header.Get(headerNameAuthorizer)
+			if v == "" {
+				responseErr(w, ErrUnauthorized.WithHint("missing auth header"))
+				return
+			}
+
+			ps := strings.SplitN(v, " ", 2)
+			if len(ps) != 2 || !strings.EqualFold(ps[0], headerPrefixBearer) {
+				responseErr(w, ErrUnauthorized.WithHint("invalid auth header"))
+				return
+			}
+			if subtle.ConstantTimeCompare([]byte(ps[1]), []byte(token)) != 1 {
+				responseErr(w, ErrUnauthorized.WithHint("invalid token"))
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
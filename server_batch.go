@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+const routeBatch = "/_batch"
+
+type dbTxContextKey struct{}
+
+// withDBTx returns a context with the transaction for executing statements.
+func withDBTx(ctx context.Context, tx *sqlx.Tx) context.Context {
+	return context.WithValue(ctx, dbTxContextKey{}, tx)
+}
+
+func dbTxFromContext(ctx context.Context) (*sqlx.Tx, bool) {
+	tx, ok := ctx.Value(dbTxContextKey{}).(*sqlx.Tx)
+	return tx, ok
+}
+
+// queryerOf returns the transaction from context if any, otherwise the server queryer.
+func (server *dbServer) queryerOf(ctx context.Context) sqlx.QueryerContext {
+	if tx, ok := dbTxFromContext(ctx); ok {
+		return tx
+	}
+	return server.queryer
+}
+
+// execerOf returns the transaction from context if any, otherwise the server execer.
+func (server *dbServer) execerOf(ctx context.Context) sqlx.ExecerContext {
+	if tx, ok := dbTxFromContext(ctx); ok {
+		return tx
+	}
+	return server.execer
+}
+
+type txBeginner interface {
+	BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
+}
+
+// BatchOperation describes an operation in the batch request.
+type BatchOperation struct {
+	// Method is the HTTP method of the operation. Only POST, PATCH and DELETE are supported.
+	Method string `json:"method"`
+	// Path is the table path of the operation, e.g. `/books`.
+	Path string `json:"path"`
+	// Query is the optional query string of the operation, e.g. `id=eq.1`.
+	Query string `json:"query,omitempty"`
+	// Body is the optional JSON payload of the operation.
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// BatchOperationResult describes the response of an operation in the batch request.
+type BatchOperationResult struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+func (op BatchOperation) validate() error {
+	switch op.Method {
+	case http.MethodPost, http.MethodPatch, http.MethodDelete:
+	default:
+		return fmt.Errorf("unsupported method %q", op.Method)
+	}
+
+	table := strings.TrimPrefix(op.Path, "/")
+	if table == "" || strings.Contains(table, "/") || !strings.HasPrefix(op.Path, "/") {
+		return fmt.Errorf("invalid path %q", op.Path)
+	}
+
+	return nil
+}
+
+// newRequest creates the request of the operation, which inherits the parent context.
+func (op BatchOperation) newRequest(parent *http.Request) (*http.Request, error) {
+	target := op.Path
+	if op.Query != "" {
+		target += "?" + strings.TrimPrefix(op.Query, "?")
+	}
+
+	// reset the routing context for routing the operation
+	ctx := context.WithValue(parent.Context(), chi.RouteCtxKey, chi.NewRouteContext())
+	req, err := http.NewRequestWithContext(ctx, op.Method, target, bytes.NewReader(op.Body))
+	if err != nil {
+		return nil, err
+	}
+	req.RemoteAddr = parent.RemoteAddr
+	if len(op.Body) > 0 {
+		req.Header.Set("Content-Type", mediaTypeJSON)
+	}
+	req.Header.Set("Accept", mediaTypeJSON)
+
+	return req, nil
+}
+
+// batchResponseWriter captures the response of an operation.
+type batchResponseWriter struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func newBatchResponseWriter() *batchResponseWriter {
+	return &batchResponseWriter{header: make(http.Header)}
+}
+
+func (w *batchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *batchResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (w *batchResponseWriter) result() BatchOperationResult {
+	rv := BatchOperationResult{Status: w.statusCode}
+	if rv.Status == 0 {
+		rv.Status = http.StatusOK
+	}
+	if body := bytes.TrimSpace(w.body.Bytes()); len(body) > 0 && json.Valid(body) {
+		rv.Body = body
+	}
+	return rv
+}
+
+// handleBatch executes the operations in a single transaction. The transaction is rolled back
+// when any of the operations fails, and the response status is the one of the failed operation.
+func (server *dbServer) handleBatch(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	logger := server.requestLogger(req).WithValues("route", "handleBatch")
+
+	var ops []BatchOperation
+	if err := json.NewDecoder(req.Body).Decode(&ops); err != nil {
+		if isRequestBodyTooLarge(err) {
+			server.responseError(w, errRequestBodyTooLarge)
+			return
+		}
+		server.responseError(w, ErrBadRequest.WithHint(fmt.Sprintf("decode batch operations: %s", err)))
+		return
+	}
+	for idx, op := range ops {
+		if err := op.validate(); err != nil {
+			server.responseError(w, ErrBadRequest.WithHint(fmt.Sprintf("operation %d: %s", idx, err)))
+			return
+		}
+	}
+
+	beginner, ok := server.execer.(txBeginner)
+	if !ok {
+		server.responseError(w, fmt.Errorf("batch operations are not supported"))
+		return
+	}
+	tx, err := beginner.BeginTxx(req.Context(), nil)
+	if err != nil {
+		logger.Error(err, "begin transaction")
+		server.responseError(w, err)
+		return
+	}
+	defer tx.Rollback() // no-op after commit
+
+	// webhook events are dispatched only if the transaction is committed
+	opCtx, pendingEvents := withPendingWebhookEvents(withDBTx(req.Context(), tx))
+
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	results := make([]BatchOperationResult, 0, len(ops))
+	for idx, op := range ops {
+		opReq, err := op.newRequest(req.WithContext(opCtx))
+		if err != nil {
+			server.responseError(w, ErrBadRequest.WithHint(fmt.Sprintf("operation %d: %s", idx, err)))
+			return
+		}
+
+		opWriter := newBatchResponseWriter()
+		server.batchHandler.ServeHTTP(opWriter, opReq)
+		result := opWriter.result()
+		results = append(results, result)
+
+		if result.Status >= http.StatusBadRequest {
+			logger.V(8).Info("operation failed, rolling back", "operation", idx, "status", result.Status)
+			server.responseData(w, results, result.Status)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error(err, "commit transaction")
+		server.responseError(w, err)
+		return
+	}
+	if server.webhook != nil {
+		server.webhook.Dispatch(pendingEvents.events...)
+	}
+
+	server.responseData(w, results, http.StatusOK)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const defaultLastModifiedColumn = "updated_at"
+
+// computeETag computes the strong ETag of the rows in the response media type.
+// The rows are encoded as JSON, which sorts the map keys, so the ETag is stable for the same rows.
+func computeETag(mediaType string, rows []map[string]interface{}) (string, error) {
+	h := fnv.New64a()
+	h.Write([]byte(mediaType))
+	if err := json.NewEncoder(h).Encode(rows); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(`"%x"`, h.Sum64()), nil
+}
+
+// etagSuffixGzip is appended to the ETag of gzip compressed responses, as the compressed
+// and identity representations must not share the same strong ETag.
+//
+// ref: https://www.rfc-editor.org/rfc/rfc9110#section-8.8.3.3
+const etagSuffixGzip = "-gzip"
+
+// withETagSuffix appends suffix to the opaque tag: "abc" => "abc-gzip".
+func withETagSuffix(etag string, suffix string) string {
+	if !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + suffix + `"`
+}
+
+// matchesETag checks if the If-None-Match header value matches the ETag. The ETag of the
+// gzip compressed representation matches as well, since the handler doesn't know if the
+// response will be compressed.
+//
+// ref: https://www.rfc-editor.org/rfc/rfc9110#name-if-none-match
+func matchesETag(ifNoneMatch string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" {
+			return true
+		}
+		// weak comparison
+		v = strings.TrimPrefix(v, "W/")
+		if v == etag || v == withETagSuffix(etag, etagSuffixGzip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseSQLiteTime parses the time value stored in SQLite, which can be text in the
+// SQLite timestamp formats or unix timestamp in seconds.
+func parseSQLiteTime(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case int64:
+		return time.Unix(v, 0), true
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case []byte:
+		return parseSQLiteTime(string(v))
+	case string:
+		s := strings.TrimSuffix(v, "Z")
+		for _, layout := range sqlite3.SQLiteTimestampFormats {
+			if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+				return t, true
+			}
+		}
+		return time.Time{}, false
+	default:
+		return time.Time{}, false
+	}
+}
+
+// queryLastModified returns the latest value of the last modified column among the rows
+// matched by the request. false is returned if the table doesn't have the column or no
+// valid value is found.
+//
+// NOTE: deleted rows don't change the latest value, clients should use ETag to detect them.
+func (server *dbServer) queryLastModified(
+	req *http.Request,
+	qc QueryCompiler,
+	target string,
+) (time.Time, bool, error) {
+	if server.lastModifiedColumn == "" {
+		return time.Time{}, false, nil
+	}
+
+	ctx := req.Context()
+	queryer := server.queryerOf(ctx)
+
+	// reuse the columns resolved by tableColumnsMiddleware to save a query
+	columnNames, ok := tableColumnsFromContext(ctx)
+	if !ok {
+		columns, err := queryTableColumns(ctx, queryer, target)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		for _, column := range columns {
+			columnNames = append(columnNames, column.Name)
+		}
+	}
+	if !slices.Contains(columnNames, server.lastModifiedColumn) {
+		return time.Time{}, false, nil
+	}
+
+	stmt, err := qc.CompileAsLastModified(target, server.lastModifiedColumn)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	server.requestLogger(req).V(8).Info(stmt.Query)
+
+	var v interface{}
+	if err := queryer.QueryRowxContext(ctx, stmt.Query, stmt.Values...).Scan(&v); err != nil {
+		return time.Time{}, false, err
+	}
+
+	t, ok := parseSQLiteTime(v)
+	return t, ok, nil
+}
+
+// isNotModifiedSince checks if the resource is not modified since the If-Modified-Since header value.
+//
+// ref: https://www.rfc-editor.org/rfc/rfc9110#name-if-modified-since
+func isNotModifiedSince(ifModifiedSince string, lastModified time.Time) bool {
+	if ifModifiedSince == "" {
+		return false
+	}
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	// HTTP date has second precision
+	return !lastModified.Truncate(time.Second).After(since)
+}
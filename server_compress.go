@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+const defaultGzipMinSize = 1024 // 1KB
+
+// acceptsGzip checks if the client accepts gzip encoded response.
+func acceptsGzip(req *http.Request) bool {
+	for _, v := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		encoding, params, _ := strings.Cut(strings.TrimSpace(v), ";")
+		if !strings.EqualFold(strings.TrimSpace(encoding), "gzip") {
+			continue
+		}
+		if strings.ReplaceAll(strings.TrimSpace(params), " ", "") == "q=0" {
+			return false
+		}
+		return true
+	}
+
+	return false
+}
+
+// gzipResponseWriter buffers the response until minSize bytes are written. Responses
+// smaller than minSize are written as is, otherwise the response is gzip compressed.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+
+	minSize    int
+	statusCode int
+	// ifNoneMatch is the If-None-Match header of the request.
+	ifNoneMatch string
+	buf         bytes.Buffer
+	gz          *gzip.Writer
+	// passthrough is true when the response is decided to be written without compression.
+	passthrough bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+
+	switch {
+	case w.gz != nil:
+		return w.gz.Write(b)
+	case w.passthrough:
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf.Write(b)
+	if w.buf.Len() >= w.minSize {
+		if err := w.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (w *gzipResponseWriter) startGzip() error {
+	h := w.Header()
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	if etag := h.Get("ETag"); etag != "" {
+		h.Set("ETag", withETagSuffix(etag, etagSuffixGzip))
+	}
+	w.ResponseWriter.WriteHeader(w.statusCode)
+
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+	_, err := w.gz.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// writeUncompressed writes the buffered response without compression.
+func (w *gzipResponseWriter) writeUncompressed() error {
+	w.passthrough = true
+	if w.statusCode == http.StatusNotModified {
+		// keep the ETag of the compressed representation validated by the client
+		h := w.Header()
+		if etag := withETagSuffix(h.Get("ETag"), etagSuffixGzip); etag != "" && strings.Contains(w.ifNoneMatch, etag) {
+			h.Set("ETag", etag)
+		}
+	}
+	if w.statusCode != 0 {
+		w.ResponseWriter.WriteHeader(w.statusCode)
+	}
+	if w.buf.Len() < 1 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+func (w *gzipResponseWriter) Flush() {
+	if w.gz == nil && !w.passthrough {
+		w.writeUncompressed()
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *gzipResponseWriter) Close() error {
+	switch {
+	case w.gz != nil:
+		return w.gz.Close()
+	case w.passthrough:
+		return nil
+	default:
+		return w.writeUncompressed()
+	}
+}
+
+// createGzipMiddleware compresses responses with gzip when the client accepts it.
+// Responses smaller than minSize bytes are not compressed.
+func createGzipMiddleware(minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			// NOTE: upgraded connections (e.g. WebSocket) are hijacked from the response writer
+			if req.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, req)
+				return
+			}
+			// the response might be compressed depending on the request, hence caches must
+			// key on Accept-Encoding whether this response is compressed or not
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsGzip(req) {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			gw := &gzipResponseWriter{
+				ResponseWriter: w,
+				minSize:        minSize,
+				ifNoneMatch:    req.Header.Get("If-None-Match"),
+			}
+			defer gw.Close()
+
+			next.ServeHTTP(gw, req)
+		})
+	}
+}
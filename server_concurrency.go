@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+)
+
+// createConcurrencyLimitMiddleware limits the number of requests in flight. Requests which
+// can not acquire a slot immediately are rejected with 503 Service Unavailable.
+func createConcurrencyLimitMiddleware(
+	maxConcurrentRequests int,
+	responseErr func(w http.ResponseWriter, err error),
+) func(http.Handler) http.Handler {
+	slots := make(chan struct{}, maxConcurrentRequests)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			select {
+			case slots <- struct{}{}:
+			default:
+				w.Header().Set("Retry-After", "1")
+				responseErr(w, ErrServiceUnavailable.WithHint("too many concurrent requests"))
+				return
+			}
+
+			metricsActiveConcurrentRequests.Inc()
+			defer func() {
+				metricsActiveConcurrentRequests.Dec()
+				<-slots
+			}()
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
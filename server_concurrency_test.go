@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := &dbServer{logger: createTestLogger(t)}
+	mw := createConcurrencyLimitMiddleware(1, server.responseError)
+	ts := httptest.NewServer(mw(handler))
+	defer ts.Close()
+
+	activeBefore := testutil.ToFloat64(metricsActiveConcurrentRequests)
+
+	slowDone := make(chan int)
+	go func() {
+		resp, err := http.Get(ts.URL + "/slow")
+		if !assert.NoError(t, err) {
+			slowDone <- 0
+			return
+		}
+		resp.Body.Close()
+		slowDone <- resp.StatusCode
+	}()
+	<-started
+	assert.Equal(t, activeBefore+1, testutil.ToFloat64(metricsActiveConcurrentRequests))
+
+	resp, err := http.Get(ts.URL + "/fast")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-slowDone)
+	assert.Equal(t, activeBefore, testutil.ToFloat64(metricsActiveConcurrentRequests))
+
+	resp, err = http.Get(ts.URL + "/fast")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
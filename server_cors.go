@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/cors"
+	"github.com/spf13/pflag"
+)
+
+const corsAllowAll = "*"
+
+type ServerCORSOptions struct {
+	// AllowedOrigins list of origins allowed for cross-origin requests. `*` allows all origins,
+	// otherwise the origin should match exactly.
+	// Defaults to allow all origins.
+	AllowedOrigins []string
+	// AllowedMethods list of methods allowed for cross-origin requests.
+	// Defaults to all supported methods.
+	AllowedMethods []string
+	// AllowedHeaders list of headers allowed for cross-origin requests. `*` allows all headers.
+	// Defaults to allow all headers.
+	AllowedHeaders []string
+	// MaxAge is the duration in seconds for caching preflight results. 0 means not set.
+	MaxAge int
+}
+
+func (opts *ServerCORSOptions) bindCLIFlags(fs *pflag.FlagSet) {
+	fs.StringSliceVar(
+		&opts.AllowedOrigins,
+		"cors-allowed-origin",
+		[]string{},
+		"list of origins allowed for cross-origin requests. Empty value means allow all.",
+	)
+	fs.StringSliceVar(
+		&opts.AllowedMethods,
+		"cors-allowed-method",
+		[]string{},
+		"list of methods allowed for cross-origin requests. Empty value means all supported methods.",
+	)
+	fs.StringSliceVar(
+		&opts.AllowedHeaders,
+		"cors-allowed-header",
+		[]string{},
+		"list of headers allowed for cross-origin requests. Empty value means allow all.",
+	)
+	fs.IntVar(
+		&opts.MaxAge,
+		"cors-max-age",
+		0,
+		"duration in seconds for caching preflight results. 0 means not set.",
+	)
+}
+
+func (opts *ServerCORSOptions) defaults() error {
+	if len(opts.AllowedOrigins) < 1 {
+		opts.AllowedOrigins = []string{corsAllowAll}
+	}
+	if len(opts.AllowedMethods) < 1 {
+		opts.AllowedMethods = []string{
+			http.MethodHead,
+			http.MethodGet,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+		}
+	}
+	if len(opts.AllowedHeaders) < 1 {
+		opts.AllowedHeaders = []string{corsAllowAll}
+	}
+	if opts.MaxAge < 0 {
+		return fmt.Errorf(".MaxAge must be non-negative")
+	}
+
+	return nil
+}
+
+func (opts *ServerCORSOptions) isOriginAllowed(origin string) bool {
+	for _, allowed := range opts.AllowedOrigins {
+		if allowed == corsAllowAll || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (opts *ServerCORSOptions) createCORSMiddleware(
+	responseErr func(w http.ResponseWriter, err error),
+) func(http.Handler) http.Handler {
+	corsHandler := cors.Handler(cors.Options{
+		AllowedOrigins:   opts.AllowedOrigins,
+		AllowedMethods:   opts.AllowedMethods,
+		AllowedHeaders:   opts.AllowedHeaders,
+		AllowCredentials: false,
+		MaxAge:           opts.MaxAge,
+	})
+
+	return func(next http.Handler) http.Handler {
+		h := corsHandler(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			isPreflight := req.Method == http.MethodOptions &&
+				req.Header.Get("Access-Control-Request-Method") != ""
+			origin := req.Header.Get("Origin")
+			if isPreflight && origin != "" && !opts.isOriginAllowed(origin) {
+				responseErr(w, ErrAccessRestricted.WithHint(
+					fmt.Sprintf("origin %q is not allowed", origin),
+				))
+				return
+			}
+
+			h.ServeHTTP(w, req)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	mediaTypeJSON   = "application/json"
+	mediaTypeCSV    = "text/csv"
+	mediaTypeNDJSON = "application/x-ndjson"
+
+	mediaTypeMergePatch = "application/merge-patch+json"
+	mediaTypeJSONPatch  = "application/json-patch+json"
+)
+
+// requestMediaType returns the media type of the request body in lower case.
+// Empty string is returned if the Content-Type header is missing or invalid.
+func requestMediaType(req *http.Request) string {
+	mt, _, err := mime.ParseMediaType(req.Header.Get("content-type"))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(mt)
+}
+
+// negotiateResponseMediaType selects the response media type from the Accept header.
+// Falls back to JSON if no supported media type is requested.
+func negotiateResponseMediaType(req *http.Request) string {
+	accept := req.Header.Get("accept")
+	if accept == "" {
+		return mediaTypeJSON
+	}
+
+	for _, v := range strings.Split(accept, ",") {
+		mt, _, err := mime.ParseMediaType(v)
+		if err != nil {
+			continue
+		}
+
+		switch mt = strings.ToLower(mt); mt {
+		case mediaTypeJSON, mediaTypeCSV, mediaTypeNDJSON:
+			return mt
+		default:
+			continue
+		}
+	}
+
+	return mediaTypeJSON
+}
+
+// csvEncoder writes rows as RFC 4180 CSV, with the first record as the column headers.
+type csvEncoder struct {
+	w       *csv.Writer
+	columns []string
+}
+
+func newCSVEncoder(w io.Writer, columns []string) *csvEncoder {
+	return &csvEncoder{
+		w:       csv.NewWriter(w),
+		columns: columns,
+	}
+}
+
+func (enc *csvEncoder) Encode(rows []map[string]interface{}) error {
+	if err := enc.w.Write(enc.columns); err != nil {
+		return err
+	}
+
+	record := make([]string, len(enc.columns))
+	for _, row := range rows {
+		for idx, column := range enc.columns {
+			record[idx] = formatCSVValue(row[column])
+		}
+		if err := enc.w.Write(record); err != nil {
+			return err
+		}
+	}
+
+	enc.w.Flush()
+	return enc.w.Error()
+}
+
+// formatCSVValue formats a scanned value as CSV field. NULL is written as empty field,
+// which is the same as empty string.
+func formatCSVValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"regexp"
+
+	"github.com/mattn/go-sqlite3"
 )
 
 type ServerError struct {
@@ -46,6 +49,26 @@ var (
 		Message:    "Access Restricted",
 		StatusCode: http.StatusForbidden,
 	}
+
+	ErrConflict = &ServerError{
+		Message:    "Conflict",
+		StatusCode: http.StatusConflict,
+	}
+
+	ErrServiceUnavailable = &ServerError{
+		Message:    "Service Unavailable",
+		StatusCode: http.StatusServiceUnavailable,
+	}
+
+	ErrTooManyRequests = &ServerError{
+		Message:    "Too Many Requests",
+		StatusCode: http.StatusTooManyRequests,
+	}
+
+	ErrInternalServerError = &ServerError{
+		Message:    "Internal Server Error",
+		StatusCode: http.StatusInternalServerError,
+	}
 )
 
 func ErrUnsupportedOperator(op string) *ServerError {
@@ -55,3 +78,117 @@ func ErrUnsupportedOperator(op string) *ServerError {
 		StatusCode: http.StatusBadRequest,
 	}
 }
+
+// sqliteErrorCodeNames maps the primary result codes to the canonical names.
+//
+// ref: https://www.sqlite.org/rescode.html
+var sqliteErrorCodeNames = map[sqlite3.ErrNo]string{
+	sqlite3.ErrError:      "SQLITE_ERROR",
+	sqlite3.ErrInternal:   "SQLITE_INTERNAL",
+	sqlite3.ErrPerm:       "SQLITE_PERM",
+	sqlite3.ErrAbort:      "SQLITE_ABORT",
+	sqlite3.ErrBusy:       "SQLITE_BUSY",
+	sqlite3.ErrLocked:     "SQLITE_LOCKED",
+	sqlite3.ErrNomem:      "SQLITE_NOMEM",
+	sqlite3.ErrReadonly:   "SQLITE_READONLY",
+	sqlite3.ErrInterrupt:  "SQLITE_INTERRUPT",
+	sqlite3.ErrIoErr:      "SQLITE_IOERR",
+	sqlite3.ErrCorrupt:    "SQLITE_CORRUPT",
+	sqlite3.ErrNotFound:   "SQLITE_NOTFOUND",
+	sqlite3.ErrFull:       "SQLITE_FULL",
+	sqlite3.ErrCantOpen:   "SQLITE_CANTOPEN",
+	sqlite3.ErrProtocol:   "SQLITE_PROTOCOL",
+	sqlite3.ErrEmpty:      "SQLITE_EMPTY",
+	sqlite3.ErrSchema:     "SQLITE_SCHEMA",
+	sqlite3.ErrTooBig:     "SQLITE_TOOBIG",
+	sqlite3.ErrConstraint: "SQLITE_CONSTRAINT",
+	sqlite3.ErrMismatch:   "SQLITE_MISMATCH",
+	sqlite3.ErrMisuse:     "SQLITE_MISUSE",
+	sqlite3.ErrNoLFS:      "SQLITE_NOLFS",
+	sqlite3.ErrAuth:       "SQLITE_AUTH",
+	sqlite3.ErrFormat:     "SQLITE_FORMAT",
+	sqlite3.ErrRange:      "SQLITE_RANGE",
+	sqlite3.ErrNotADB:     "SQLITE_NOTADB",
+	sqlite3.ErrNotice:     "SQLITE_NOTICE",
+	sqlite3.ErrWarning:    "SQLITE_WARNING",
+}
+
+// sqliteExtendedErrorCodeNames maps the extended result codes to the canonical names.
+var sqliteExtendedErrorCodeNames = map[sqlite3.ErrNoExtended]string{
+	sqlite3.ErrBusyRecovery:         "SQLITE_BUSY_RECOVERY",
+	sqlite3.ErrBusySnapshot:         "SQLITE_BUSY_SNAPSHOT",
+	sqlite3.ErrLockedSharedCache:    "SQLITE_LOCKED_SHAREDCACHE",
+	sqlite3.ErrReadonlyRecovery:     "SQLITE_READONLY_RECOVERY",
+	sqlite3.ErrReadonlyCantLock:     "SQLITE_READONLY_CANTLOCK",
+	sqlite3.ErrReadonlyRollback:     "SQLITE_READONLY_ROLLBACK",
+	sqlite3.ErrReadonlyDbMoved:      "SQLITE_READONLY_DBMOVED",
+	sqlite3.ErrAbortRollback:        "SQLITE_ABORT_ROLLBACK",
+	sqlite3.ErrCorruptVTab:          "SQLITE_CORRUPT_VTAB",
+	sqlite3.ErrCantOpenNoTempDir:    "SQLITE_CANTOPEN_NOTEMPDIR",
+	sqlite3.ErrCantOpenIsDir:        "SQLITE_CANTOPEN_ISDIR",
+	sqlite3.ErrCantOpenFullPath:     "SQLITE_CANTOPEN_FULLPATH",
+	sqlite3.ErrCantOpenConvPath:     "SQLITE_CANTOPEN_CONVPATH",
+	sqlite3.ErrConstraintCheck:      "SQLITE_CONSTRAINT_CHECK",
+	sqlite3.ErrConstraintCommitHook: "SQLITE_CONSTRAINT_COMMITHOOK",
+	sqlite3.ErrConstraintForeignKey: "SQLITE_CONSTRAINT_FOREIGNKEY",
+	sqlite3.ErrConstraintFunction:   "SQLITE_CONSTRAINT_FUNCTION",
+	sqlite3.ErrConstraintNotNull:    "SQLITE_CONSTRAINT_NOTNULL",
+	sqlite3.ErrConstraintPrimaryKey: "SQLITE_CONSTRAINT_PRIMARYKEY",
+	sqlite3.ErrConstraintTrigger:    "SQLITE_CONSTRAINT_TRIGGER",
+	sqlite3.ErrConstraintUnique:     "SQLITE_CONSTRAINT_UNIQUE",
+	sqlite3.ErrConstraintVTab:       "SQLITE_CONSTRAINT_VTAB",
+	sqlite3.ErrConstraintRowID:      "SQLITE_CONSTRAINT_ROWID",
+}
+
+// sqliteErrorCode returns the canonical name of the SQLite error, e.g. SQLITE_CONSTRAINT_UNIQUE.
+// The extended result code is preferred when known.
+func sqliteErrorCode(err sqlite3.Error) string {
+	if name, ok := sqliteExtendedErrorCodeNames[err.ExtendedCode]; ok {
+		return name
+	}
+	if name, ok := sqliteErrorCodeNames[err.Code]; ok {
+		return name
+	}
+	return fmt.Sprintf("SQLITE_ERROR_%d", int(err.ExtendedCode))
+}
+
+// sqliteConstraintErrorPattern matches the constraint violation message,
+// e.g. `UNIQUE constraint failed: books.isbn` or `CHECK constraint failed: positive_price`.
+var sqliteConstraintErrorPattern = regexp.MustCompile(
+	`(UNIQUE|NOT NULL|CHECK|FOREIGN KEY|PRIMARY KEY) constraint failed(?::\s*(.+))?`,
+)
+
+// sqliteConstraintHint extracts the failed constraint and the columns (table.column) or
+// the constraint name from the error message. Empty string is returned if the error is
+// not a constraint violation.
+func sqliteConstraintHint(err sqlite3.Error) string {
+	if err.Code != sqlite3.ErrConstraint {
+		return ""
+	}
+
+	ms := sqliteConstraintErrorPattern.FindStringSubmatch(err.Error())
+	if len(ms) < 1 {
+		return ""
+	}
+	if ms[2] == "" {
+		return fmt.Sprintf("%s constraint failed", ms[1])
+	}
+	return fmt.Sprintf("%s constraint failed: %s", ms[1], ms[2])
+}
+
+// newSQLiteServerError converts the SQLite error to server error.
+func newSQLiteServerError(err sqlite3.Error) *ServerError {
+	var rv *ServerError
+	switch err.ExtendedCode {
+	case sqlite3.ErrConstraintForeignKey:
+		rv = ErrBadRequest.WithHint(err.Error())
+	default:
+		rv = &ServerError{Message: err.Error(), StatusCode: http.StatusInternalServerError}
+	}
+	rv.Code = sqliteErrorCode(err)
+	if hint := sqliteConstraintHint(err); hint != "" {
+		rv.Hint = hint
+	}
+
+	return rv
+}
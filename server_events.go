@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-logr/logr"
+)
+
+const (
+	routeSuffixEvents = "/events"
+
+	mediaTypeEventStream = "text/event-stream"
+
+	defaultSSEPollInterval = 2 * time.Second
+
+	tableEventInsert = "insert"
+	tableEventUpdate = "update"
+	tableEventDelete = "delete"
+)
+
+// tableEvent describes a changed row of the table or view.
+type tableEvent struct {
+	Event string
+	// Data is the JSON encoded row. For delete event, it's the row before deletion.
+	Data []byte
+}
+
+// tableSnapshot holds the JSON encoded rows of a poll, keyed by the row identity.
+type tableSnapshot struct {
+	keys []string
+	rows map[string][]byte
+}
+
+// diffTableSnapshots compares the snapshots and returns the events for the changed rows.
+// Events are ordered by the current rows, followed by the deleted rows.
+func diffTableSnapshots(prev tableSnapshot, curr tableSnapshot) []tableEvent {
+	var rv []tableEvent
+	for _, key := range curr.keys {
+		row := curr.rows[key]
+		prevRow, exists := prev.rows[key]
+		switch {
+		case !exists:
+			rv = append(rv, tableEvent{Event: tableEventInsert, Data: row})
+		case string(prevRow) != string(row):
+			rv = append(rv, tableEvent{Event: tableEventUpdate, Data: row})
+		}
+	}
+	for _, key := range prev.keys {
+		if _, exists := curr.rows[key]; !exists {
+			rv = append(rv, tableEvent{Event: tableEventDelete, Data: prev.rows[key]})
+		}
+	}
+
+	return rv
+}
+
+// queryPrimaryKeyColumns returns the primary key columns of the table ordered by
+// the key index. Empty list will be returned for views or tables without primary key.
+func (server *dbServer) queryPrimaryKeyColumns(ctx context.Context, target string) ([]string, error) {
+	columns, err := queryTableColumns(ctx, server.queryerOf(ctx), target)
+	if err != nil {
+		return nil, err
+	}
+
+	var pkColumns []TableColumn
+	for _, column := range columns {
+		if column.PrimaryKey > 0 {
+			pkColumns = append(pkColumns, column)
+		}
+	}
+	sort.Slice(pkColumns, func(i, j int) bool {
+		return pkColumns[i].PrimaryKey < pkColumns[j].PrimaryKey
+	})
+
+	rv := make([]string, 0, len(pkColumns))
+	for _, column := range pkColumns {
+		rv = append(rv, column.Name)
+	}
+	return rv, nil
+}
+
+// queryTableSnapshot executes the select statement and keys the rows by the primary key
+// columns. When the primary key is not selected, the whole row is used as the key,
+// hence updates are reported as delete and insert.
+func (server *dbServer) queryTableSnapshot(
+	ctx context.Context,
+	selectStmt CompiledQuery,
+	pkColumns []string,
+) (tableSnapshot, error) {
+	rv := tableSnapshot{rows: map[string][]byte{}}
+
+	rows, err := server.queryerOf(ctx).QueryxContext(ctx, selectStmt.Query, selectStmt.Values...)
+	if err != nil {
+		return rv, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p := make(map[string]interface{})
+		if err := rows.MapScan(p); err != nil {
+			return rv, err
+		}
+		row, err := json.Marshal(p)
+		if err != nil {
+			return rv, err
+		}
+
+		key := string(row)
+		if len(pkColumns) > 0 {
+			pk := make([]interface{}, 0, len(pkColumns))
+			for _, column := range pkColumns {
+				v, exists := p[column]
+				if !exists {
+					pk = nil
+					break
+				}
+				pk = append(pk, v)
+			}
+			if pk != nil {
+				b, err := json.Marshal(pk)
+				if err != nil {
+					return rv, err
+				}
+				key = string(b)
+			}
+		}
+
+		if _, exists := rv.rows[key]; !exists {
+			rv.keys = append(rv.keys, key)
+		}
+		rv.rows[key] = row
+	}
+	if err := rows.Err(); err != nil {
+		return rv, err
+	}
+
+	return rv, nil
+}
+
+// writeTableEvent writes the event in the server-sent events format.
+//
+// ref: https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation
+func writeTableEvent(w http.ResponseWriter, event tableEvent) error {
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Event, event.Data)
+	return err
+}
+
+// handleTableOrViewEvents streams the changed rows of the table or view as server-sent events.
+// The rows are polled with the request query every poll interval. The stream starts with
+// a `: ready` comment once the initial rows are read, changes after that are reported.
+func (server *dbServer) handleTableOrViewEvents(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	target := chi.URLParam(req, routeVarTableOrView)
+
+	logger := server.requestLogger(req).WithValues("target", target, "route", "handleTableOrViewEvents")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		server.responseError(w, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	qc := NewQueryCompilerFromRequestWithMaxLimit(req, server.maxLimit)
+	selectStmt, err := qc.CompileAsSelect(target)
+	if err != nil {
+		logger.Error(err, "parse select query")
+		server.responseError(w, err)
+		return
+	}
+	logger.V(8).Info(selectStmt.Query)
+
+	ctx := req.Context()
+	pkColumns, err := server.queryPrimaryKeyColumns(ctx, target)
+	if err != nil {
+		logger.Error(err, "query primary key columns")
+		server.responseError(w, err)
+		return
+	}
+
+	snapshot, err := server.queryTableSnapshot(ctx, selectStmt, pkColumns)
+	if err != nil {
+		logger.Error(err, "query values")
+		server.responseError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaTypeEventStream)
+	w.Header().Set(headerNameCacheControl, "no-cache")
+	// disable response buffering of nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	server.responseHeader(w, http.StatusOK)
+	if _, err := fmt.Fprint(w, ": ready\n\n"); err != nil {
+		logger.Error(err, "write event")
+		return
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(server.ssePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// client disconnected or request timed out
+			return
+		case <-ticker.C:
+		}
+
+		curr, err := server.queryTableSnapshot(ctx, selectStmt, pkColumns)
+		if err != nil {
+			if ctx.Err() == nil {
+				// response has been started, we can only abort here
+				logger.Error(err, "query values")
+			}
+			return
+		}
+
+		events := diffTableSnapshots(snapshot, curr)
+		snapshot = curr
+		if len(events) < 1 {
+			continue
+		}
+		if err := writeTableEvents(w, logger, events); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeTableEvents(w http.ResponseWriter, logger logr.Logger, events []tableEvent) error {
+	for _, event := range events {
+		if err := writeTableEvent(w, event); err != nil {
+			logger.Error(err, "write event")
+			return err
+		}
+	}
+	return nil
+}
+
+// isTableOrViewStreamingPath checks if the request path is a long-lived streaming route,
+// e.g. `/books/events` or `/books/subscribe`.
+func isTableOrViewStreamingPath(path string) bool {
+	if strings.Count(path, "/") != 2 {
+		return false
+	}
+	return strings.HasSuffix(path, routeSuffixEvents) || strings.HasSuffix(path, routeSuffixSubscribe)
+}
+
+// skipStreamingRoutes skips the middleware for the long-lived streaming routes.
+func skipStreamingRoutes(mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withMiddleware := mw(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if isTableOrViewStreamingPath(req.URL.Path) {
+				next.ServeHTTP(w, req)
+				return
+			}
+			withMiddleware.ServeHTTP(w, req)
+		})
+	}
+}
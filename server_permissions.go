@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// tableNamePermissions is the table mapping the JWT role to the accessible tables or views.
+	tableNamePermissions = "_permissions"
+
+	defaultAllowCacheTTL = 30 * time.Second
+)
+
+type dbPermissionsCacheEntry struct {
+	tableOrViews []string
+	expiresAt    time.Time
+}
+
+// dbPermissionsCache caches the accessible tables or views of the roles read from the
+// permissions table.
+type dbPermissionsCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]dbPermissionsCacheEntry
+}
+
+func newDBPermissionsCache(ttl time.Duration) *dbPermissionsCache {
+	return &dbPermissionsCache{
+		ttl:     ttl,
+		entries: map[string]dbPermissionsCacheEntry{},
+	}
+}
+
+// tableOrViewsOf returns the accessible tables or views of the role.
+func (c *dbPermissionsCache) tableOrViewsOf(
+	ctx context.Context,
+	queryer sqlx.QueryerContext,
+	role string,
+) ([]string, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[role]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.tableOrViews, nil
+	}
+
+	var tableOrViews []string
+	err := sqlx.SelectContext(
+		ctx, queryer, &tableOrViews,
+		fmt.Sprintf("SELECT table_name FROM %s WHERE role = ?", tableNamePermissions),
+		role,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query permissions of role %q: %w", role, err)
+	}
+
+	if c.ttl > 0 {
+		c.mu.Lock()
+		c.entries[role] = dbPermissionsCacheEntry{
+			tableOrViews: tableOrViews,
+			expiresAt:    now.Add(c.ttl),
+		}
+		c.mu.Unlock()
+	}
+
+	return tableOrViews, nil
+}
+
+// isTableOrViewAllowedByDB checks if any role of the request is allowed to access the table
+// or view in the permissions table.
+func (opts *ServerSecurityOptions) isTableOrViewAllowedByDB(
+	req *http.Request,
+	queryerOf func(ctx context.Context) sqlx.QueryerContext,
+	tableOrView string,
+) (bool, error) {
+	if opts.dbPermissions == nil {
+		return false, nil
+	}
+
+	claims, _ := JWTClaimsFromContext(req.Context())
+	for _, role := range rolesFromClaims(claims) {
+		tableOrViews, err := opts.dbPermissions.tableOrViewsOf(req.Context(), queryerOf(req.Context()), role)
+		if err != nil {
+			return false, err
+		}
+		if slices.Contains(tableOrViews, tableOrView) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// rateLimiterEvictInterval is the interval for evicting stale limiters.
+	rateLimiterEvictInterval = time.Minute
+	// rateLimiterStaleDuration is the idle duration of a limiter to be considered as stale.
+	rateLimiterStaleDuration = 3 * time.Minute
+)
+
+type ipRateLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen atomic.Int64 // unix nano
+}
+
+// ipRateLimiter limits requests by client IP.
+type ipRateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	limiters  sync.Map // client IP -> *ipRateLimiterEntry
+	lastEvict atomic.Int64
+	now       func() time.Time
+}
+
+func newIPRateLimiter(perSecond int, burst int) *ipRateLimiter {
+	rv := &ipRateLimiter{
+		limit: rate.Limit(perSecond),
+		burst: burst,
+		now:   time.Now,
+	}
+	rv.lastEvict.Store(rv.now().UnixNano())
+	return rv
+}
+
+func (l *ipRateLimiter) Allow(ip string) bool {
+	now := l.now()
+	l.evictStale(now)
+
+	v, ok := l.limiters.Load(ip)
+	if !ok {
+		v, _ = l.limiters.LoadOrStore(ip, &ipRateLimiterEntry{
+			limiter: rate.NewLimiter(l.limit, l.burst),
+		})
+	}
+	entry := v.(*ipRateLimiterEntry)
+	entry.lastSeen.Store(now.UnixNano())
+
+	return entry.limiter.AllowN(now, 1)
+}
+
+// RetryAfter returns the duration in seconds for client to retry.
+func (l *ipRateLimiter) RetryAfter() int {
+	return int(math.Max(1, math.Ceil(1/float64(l.limit))))
+}
+
+// evictStale removes the limiters that are idle for a while.
+func (l *ipRateLimiter) evictStale(now time.Time) {
+	lastEvict := l.lastEvict.Load()
+	if now.Sub(time.Unix(0, lastEvict)) < rateLimiterEvictInterval {
+		return
+	}
+	if !l.lastEvict.CompareAndSwap(lastEvict, now.UnixNano()) {
+		// other goroutine is evicting
+		return
+	}
+
+	l.limiters.Range(func(key, value any) bool {
+		entry := value.(*ipRateLimiterEntry)
+		if now.Sub(time.Unix(0, entry.lastSeen.Load())) > rateLimiterStaleDuration {
+			l.limiters.Delete(key)
+		}
+		return true
+	})
+}
+
+func createRateLimitMiddleware(
+	limiter *ipRateLimiter,
+	responseErr func(w http.ResponseWriter, err error),
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ip := clientIP(req)
+			if ip != nil && !limiter.Allow(ip.String()) {
+				w.Header().Set("Retry-After", fmt.Sprint(limiter.RetryAfter()))
+				responseErr(w, ErrTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
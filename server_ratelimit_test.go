@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+		opts.RateLimitPerIP = 1
+		opts.RateLimitBurst = 3
+	})
+	defer tc.CleanUp(t)
+
+	tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+	rateLimitedBefore := testutil.ToFloat64(metricsRateLimitedRequestsTotal)
+	for i := 0; i < 5; i++ {
+		req := tc.NewRequest(t, http.MethodGet, "test", nil)
+		resp := tc.ExecuteRequest(t, req)
+		resp.Body.Close()
+
+		if i < 3 {
+			assert.Equal(t, http.StatusOK, resp.StatusCode, "request #%d", i)
+		} else {
+			assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode, "request #%d", i)
+			assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+		}
+	}
+	assert.Equal(t, rateLimitedBefore+2, testutil.ToFloat64(metricsRateLimitedRequestsTotal))
+}
+
+func TestIPRateLimiter_evictStale(t *testing.T) {
+	now := time.Now()
+	limiter := newIPRateLimiter(1, 1)
+	limiter.now = func() time.Time { return now }
+
+	assert.True(t, limiter.Allow("10.0.0.1"))
+	assert.False(t, limiter.Allow("10.0.0.1"))
+
+	now = now.Add(rateLimiterStaleDuration + time.Second)
+	assert.True(t, limiter.Allow("10.0.0.2"))
+
+	_, ok := limiter.limiters.Load("10.0.0.1")
+	assert.False(t, ok, "stale limiter should be evicted")
+	_, ok = limiter.limiters.Load("10.0.0.2")
+	assert.True(t, ok)
+}
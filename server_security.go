@@ -1,17 +1,87 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
 	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
 )
 
-// TODO: generally speaking, we need a fine-grained RBAC system.
-
 type ServerSecurityOptions struct {
 	// EnabledTableOrViews list of table or view names that are accessible (read & write).
 	EnabledTableOrViews []string
+	// EnabledTableOrViewsFile is the path to the newline-delimited file of table or view names
+	// that are accessible (read & write). The file is reloaded when changed.
+	EnabledTableOrViewsFile string
+	// WildcardTablePatterns list of glob patterns (e.g. `user_*`) matching the table or view
+	// names that are accessible (read & write).
+	//
+	// ref: https://pkg.go.dev/path#Match
+	WildcardTablePatterns []string
+	// AllowFromDB allows the tables or views listed in the `_permissions` table for the JWT
+	// role claim, in addition to the allow lists.
+	AllowFromDB bool
+	// AllowCacheTTL is the duration of caching the permissions read from the database.
+	// 0 means no caching.
+	AllowCacheTTL time.Duration
+	// DenyMode makes all tables and views accessible except the ones in DeniedTableOrViews.
+	// Can not be used with the allow lists.
+	DenyMode bool
+	// DeniedTableOrViews list of table or view names that are not accessible in deny mode.
+	DeniedTableOrViews []string
+	// ReadTableOrViews list of table or view names that are accessible for reading (GET & HEAD).
+	ReadTableOrViews []string
+	// WriteTableOrViews list of table or view names that are accessible for writing (POST, PATCH & PUT).
+	WriteTableOrViews []string
+	// DeleteTableOrViews list of table or view names that are accessible for deleting (DELETE).
+	DeleteTableOrViews []string
+	// ReadOnlyTableOrViews list of table or view names that are accessible (read only).
+	ReadOnlyTableOrViews []string
+	// RowLevelSecurityColumn is the column for restricting the accessible rows.
+	// When set, only rows with the column value equal to the JWT claim
+	// (RowLevelSecurityClaim) are accessible.
+	RowLevelSecurityColumn string
+	// RowLevelSecurityClaim is the JWT claim for restricting the accessible rows.
+	// Defaults to "sub".
+	RowLevelSecurityClaim string
+	// RolesFilePath is the path to the YAML file defining RolesMap.
+	RolesFilePath string
+	// RolesMap maps the JWT role claim to the allowed `table:method` pairs.
+	// Use `*` to match any table or method. Empty map means role check is disabled.
+	RolesMap map[string][]string
+	// ColumnAllowFilePath is the path to the YAML file defining ColumnAllowList.
+	ColumnAllowFilePath string
+	// ColumnAllowList maps the table or view name to the selectable columns. Tables or views
+	// not in the map are not restricted.
+	ColumnAllowList map[string][]string
+	// AllowSchemaAccess allows describing table columns via `?schema=true`.
+	AllowSchemaAccess bool
+	// DisableIntrospection blocks describing table columns via `?schema=true`, and rejects
+	// the select and common table expressions reading the schema table or PRAGMA.
+	DisableIntrospection bool
+	// AllowCommonTableExpressions allows prepending common table expressions via `?with=`.
+	// NOTE: the expressions can read any table in the database.
+	AllowCommonTableExpressions bool
+	// IPAllowList list of client IP addresses or CIDR ranges that are allowed to access.
+	// Empty list means IP check is disabled.
+	IPAllowList []string
+
+	ipAllowNets   []*net.IPNet
+	dbPermissions *dbPermissionsCache
+	// readEnabledTableOrViewsFile reads the content of EnabledTableOrViewsFile.
+	readEnabledTableOrViewsFile func() ([]byte, error)
 }
 
 func (opts *ServerSecurityOptions) bindCLIFlags(fs *pflag.FlagSet) {
@@ -21,30 +91,657 @@ func (opts *ServerSecurityOptions) bindCLIFlags(fs *pflag.FlagSet) {
 		[]string{},
 		"list of table or view names that are accessible (read & write)",
 	)
+	fs.StringVar(
+		&opts.EnabledTableOrViewsFile,
+		"security-allow-table-file",
+		"",
+		"path to the newline-delimited file of table or view names that are accessible (read & write). The file is reloaded when changed.",
+	)
+	fs.StringSliceVar(
+		&opts.WildcardTablePatterns,
+		"security-wildcard-table",
+		[]string{},
+		"list of glob patterns (e.g. user_*) matching the table or view names that are accessible (read & write)",
+	)
+	fs.BoolVar(
+		&opts.AllowFromDB,
+		"security-allow-from-db",
+		false,
+		"allow the tables or views listed in the _permissions table for the JWT role",
+	)
+	fs.DurationVar(
+		&opts.AllowCacheTTL,
+		"security-allow-cache-ttl",
+		defaultAllowCacheTTL,
+		"duration of caching the permissions read from the _permissions table. 0 means no caching.",
+	)
+	fs.BoolVar(
+		&opts.DenyMode,
+		"security-deny-mode",
+		false,
+		"make all tables and views accessible except the ones in --security-deny-table",
+	)
+	fs.StringSliceVar(
+		&opts.DeniedTableOrViews,
+		"security-deny-table",
+		[]string{},
+		"list of table or view names that are not accessible in deny mode",
+	)
+	fs.StringSliceVar(
+		&opts.ReadTableOrViews,
+		"security-allow-table-read",
+		[]string{},
+		"list of table or view names that are accessible for reading (GET & HEAD)",
+	)
+	fs.StringSliceVar(
+		&opts.WriteTableOrViews,
+		"security-allow-table-write",
+		[]string{},
+		"list of table or view names that are accessible for writing (POST, PATCH & PUT)",
+	)
+	fs.StringSliceVar(
+		&opts.DeleteTableOrViews,
+		"security-allow-table-delete",
+		[]string{},
+		"list of table or view names that are accessible for deleting (DELETE)",
+	)
+	fs.StringSliceVar(
+		&opts.ReadOnlyTableOrViews,
+		"security-readonly-table",
+		[]string{},
+		"list of table or view names that are accessible (read only)",
+	)
+	fs.StringVar(
+		&opts.RowLevelSecurityColumn,
+		"security-rls-column",
+		"",
+		"column for restricting accessible rows to the ones matching the JWT claim. Empty value means disabled.",
+	)
+	fs.StringVar(
+		&opts.RowLevelSecurityClaim,
+		"security-rls-claim",
+		defaultRowLevelSecurityClaim,
+		"JWT claim for restricting accessible rows",
+	)
+	fs.StringVar(
+		&opts.RolesFilePath,
+		"security-roles-file",
+		"",
+		"path to the YAML file mapping JWT role to allowed table:method pairs. Empty value means disabled.",
+	)
+	fs.StringVar(
+		&opts.ColumnAllowFilePath,
+		"security-column-allow-file",
+		"",
+		"path to the YAML file mapping table or view names to the selectable columns. Empty value means disabled.",
+	)
+	fs.BoolVar(
+		&opts.AllowSchemaAccess,
+		"security-allow-schema-access",
+		true,
+		"allow describing table columns via ?schema=true",
+	)
+	fs.BoolVar(
+		&opts.DisableIntrospection,
+		"security-disable-introspection",
+		false,
+		"block ?schema=true, and reject select and common table expressions reading sqlite_master, sqlite_schema or PRAGMA",
+	)
+	fs.BoolVar(
+		&opts.AllowCommonTableExpressions,
+		"security-allow-cte",
+		false,
+		"allow common table expressions via ?with=. NOTE: the expressions can read any table in the database.",
+	)
+	fs.StringSliceVar(
+		&opts.IPAllowList,
+		"security-ip-allow",
+		[]string{},
+		"list of client IP addresses or CIDR ranges that are allowed to access. Empty value means disabled.",
+	)
 }
 
+const defaultRowLevelSecurityClaim = "sub"
+
 func (opts *ServerSecurityOptions) defaults() error {
+	if opts.RowLevelSecurityColumn != "" && opts.RowLevelSecurityClaim == "" {
+		opts.RowLevelSecurityClaim = defaultRowLevelSecurityClaim
+	}
+
+	if opts.RolesFilePath != "" && len(opts.RolesMap) < 1 {
+		b, err := os.ReadFile(opts.RolesFilePath)
+		if err != nil {
+			return fmt.Errorf("read roles file %q: %w", opts.RolesFilePath, err)
+		}
+		if err := yaml.Unmarshal(b, &opts.RolesMap); err != nil {
+			return fmt.Errorf("parse roles file %q: %w", opts.RolesFilePath, err)
+		}
+	}
+
+	if opts.ColumnAllowFilePath != "" && len(opts.ColumnAllowList) < 1 {
+		b, err := os.ReadFile(opts.ColumnAllowFilePath)
+		if err != nil {
+			return fmt.Errorf("read column allow file %q: %w", opts.ColumnAllowFilePath, err)
+		}
+		if err := yaml.Unmarshal(b, &opts.ColumnAllowList); err != nil {
+			return fmt.Errorf("parse column allow file %q: %w", opts.ColumnAllowFilePath, err)
+		}
+	}
+
+	hasAllowList := len(opts.EnabledTableOrViews) > 0 ||
+		opts.EnabledTableOrViewsFile != "" ||
+		opts.AllowFromDB ||
+		len(opts.WildcardTablePatterns) > 0 ||
+		len(opts.ReadTableOrViews) > 0 ||
+		len(opts.WriteTableOrViews) > 0 ||
+		len(opts.DeleteTableOrViews) > 0 ||
+		len(opts.ReadOnlyTableOrViews) > 0
+	if opts.DenyMode && hasAllowList {
+		return fmt.Errorf(".DenyMode can not be used with the table allow lists")
+	}
+	if !opts.DenyMode && len(opts.DeniedTableOrViews) > 0 {
+		return fmt.Errorf(".DeniedTableOrViews requires .DenyMode")
+	}
+
+	for _, pattern := range opts.WildcardTablePatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid wildcard table pattern %q: %w", pattern, err)
+		}
+	}
+
+	if opts.AllowCacheTTL < 0 {
+		return fmt.Errorf(".AllowCacheTTL must be non-negative")
+	}
+	opts.dbPermissions = nil
+	if opts.AllowFromDB {
+		opts.dbPermissions = newDBPermissionsCache(opts.AllowCacheTTL)
+	}
+
+	opts.readEnabledTableOrViewsFile = nil
+	if opts.EnabledTableOrViewsFile != "" {
+		opts.readEnabledTableOrViewsFile = readFileWithStatCache(opts.EnabledTableOrViewsFile)
+		if _, err := opts.readEnabledTableOrViewsFile(); err != nil {
+			return fmt.Errorf("read allow table file %q: %w", opts.EnabledTableOrViewsFile, err)
+		}
+	}
+
+	opts.ipAllowNets = nil
+	for _, s := range opts.IPAllowList {
+		ipNet, err := parseIPNet(s)
+		if err != nil {
+			return fmt.Errorf("parse IP allow list: %w", err)
+		}
+		opts.ipAllowNets = append(opts.ipAllowNets, ipNet)
+	}
+
 	return nil
 }
 
-func (opts *ServerSecurityOptions) createTableOrViewAccessCheckMiddleware(
+// parseIPNet parses s as CIDR range or a single IP address.
+func parseIPNet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		return ipNet, nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// clientIP returns the IP address of the request client.
+// When the server is behind proxy, the remote address is resolved from the forwarded headers.
+func clientIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// forwardedClientIPMiddleware sets the remote address of the request to the client IP
+// from X-Forwarded-For header. Only the rightmost entry is used as it is appended by the
+// proxy in front of the server; entries on the left are supplied by the client and can
+// be spoofed.
+func forwardedClientIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if values := req.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			hops := strings.Split(values[len(values)-1], ",")
+			if ip := net.ParseIP(strings.TrimSpace(hops[len(hops)-1])); ip != nil {
+				req.RemoteAddr = ip.String()
+			}
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (opts *ServerSecurityOptions) createIPAllowListMiddleware(
 	responseErr func(w http.ResponseWriter, err error),
 ) func(http.Handler) http.Handler {
-	accessibleTableOrViews := make(map[string]struct{})
-	for _, t := range opts.EnabledTableOrViews {
-		accessibleTableOrViews[t] = struct{}{}
+	return func(next http.Handler) http.Handler {
+		if len(opts.ipAllowNets) < 1 {
+			// IP check is disabled
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ip := clientIP(req)
+			if ip != nil {
+				for _, ipNet := range opts.ipAllowNets {
+					if ipNet.Contains(ip) {
+						next.ServeHTTP(w, req)
+						return
+					}
+				}
+			}
+
+			responseErr(w, ErrAccessRestricted.WithHint("client IP is not allowed"))
+		})
 	}
+}
+
+const (
+	jwtClaimRole = "role"
+
+	roleWildcard = "*"
+)
+
+// rolesFromClaims reads the roles from the role claim, which can be a string or a list of strings.
+func rolesFromClaims(claims map[string]interface{}) []string {
+	switch v := claims[jwtClaimRole].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var rv []string
+		for _, r := range v {
+			if s, ok := r.(string); ok {
+				rv = append(rv, s)
+			}
+		}
+		return rv
+	default:
+		return nil
+	}
+}
+
+// isRoleAllowed checks if any of the roles is allowed to apply the method on the table.
+func (opts *ServerSecurityOptions) isRoleAllowed(roles []string, table string, method string) bool {
+	for _, role := range roles {
+		for _, pair := range opts.RolesMap[role] {
+			ps := strings.SplitN(pair, ":", 2)
+			if len(ps) != 2 {
+				continue
+			}
+			if ps[0] != roleWildcard && ps[0] != table {
+				continue
+			}
+			if ps[1] != roleWildcard && !strings.EqualFold(ps[1], method) {
+				continue
+			}
+			return true
+		}
+	}
+
+	return false
+}
+
+func isWriteMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPatch, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func toTableOrViewsSet(tableOrViews ...[]string) map[string]struct{} {
+	rv := make(map[string]struct{})
+	for _, ts := range tableOrViews {
+		for _, t := range ts {
+			rv[t] = struct{}{}
+		}
+	}
+	return rv
+}
+
+// parseTableOrViewsFile parses the newline-delimited table or view names.
+// Empty lines and lines starting with `#` are skipped.
+func parseTableOrViewsFile(content []byte) []string {
+	var rv []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rv = append(rv, line)
+	}
+	return rv
+}
+
+// isTableOrViewDenied checks if the table or view is denied in deny mode. SQLite internal
+// tables and the tables managed by sqlite-rest are always denied.
+func (opts *ServerSecurityOptions) isTableOrViewDenied(tableOrView string) bool {
+	return strings.HasPrefix(tableOrView, "sqlite_") ||
+		strings.HasPrefix(tableOrView, tableNamePrefixInternal) ||
+		tableOrView == tableNamePermissions ||
+		slices.Contains(opts.DeniedTableOrViews, tableOrView)
+}
+
+// isTableOrViewEnabled checks if the table or view is accessible by all methods, either
+// by exact name or by wildcard pattern. In deny mode, all tables or views except the
+// denied ones are enabled.
+func (opts *ServerSecurityOptions) isTableOrViewEnabled(tableOrView string) bool {
+	if opts.DenyMode {
+		return !opts.isTableOrViewDenied(tableOrView)
+	}
+	if slices.Contains(opts.EnabledTableOrViews, tableOrView) {
+		return true
+	}
+	if opts.readEnabledTableOrViewsFile != nil {
+		// the file might be removed or unreadable after startup, deny access in this case
+		content, err := opts.readEnabledTableOrViewsFile()
+		if err == nil && slices.Contains(parseTableOrViewsFile(content), tableOrView) {
+			return true
+		}
+	}
+	for _, pattern := range opts.WildcardTablePatterns {
+		// patterns have been validated in defaults
+		if matched, _ := path.Match(pattern, tableOrView); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// isTableOrViewReadable checks if the table or view is accessible for reading.
+func (opts *ServerSecurityOptions) isTableOrViewReadable(tableOrView string) bool {
+	return opts.isTableOrViewEnabled(tableOrView) ||
+		slices.Contains(opts.ReadTableOrViews, tableOrView) ||
+		slices.Contains(opts.ReadOnlyTableOrViews, tableOrView)
+}
+
+// isTableOrViewAccessible checks if the table or view is accessible by any method.
+func (opts *ServerSecurityOptions) isTableOrViewAccessible(tableOrView string) bool {
+	return opts.isTableOrViewReadable(tableOrView) ||
+		slices.Contains(opts.WriteTableOrViews, tableOrView) ||
+		slices.Contains(opts.DeleteTableOrViews, tableOrView)
+}
+
+// tableOrViewMethods lists the methods supported by the table or view routes.
+var tableOrViewMethods = []string{
+	http.MethodGet,
+	http.MethodPost,
+	http.MethodPatch,
+	http.MethodPut,
+	http.MethodDelete,
+	http.MethodHead,
+}
+
+// isMethodAllowed checks if the method can be applied on the table or view.
+func (opts *ServerSecurityOptions) isMethodAllowed(tableOrView string, method string) bool {
+	if slices.Contains(opts.ReadOnlyTableOrViews, tableOrView) {
+		return !isWriteMethod(method)
+	}
+	if opts.isTableOrViewEnabled(tableOrView) {
+		return true
+	}
+
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return slices.Contains(opts.ReadTableOrViews, tableOrView)
+	case http.MethodPost, http.MethodPatch, http.MethodPut:
+		return slices.Contains(opts.WriteTableOrViews, tableOrView)
+	case http.MethodDelete:
+		return slices.Contains(opts.DeleteTableOrViews, tableOrView)
+	default:
+		return false
+	}
+}
+
+// allowedMethods lists the methods the roles can apply on the table or view.
+// Role check is skipped when RolesMap is empty.
+func (opts *ServerSecurityOptions) allowedMethods(tableOrView string, roles []string) []string {
+	var rv []string
+	for _, method := range tableOrViewMethods {
+		if !opts.isMethodAllowed(tableOrView, method) {
+			continue
+		}
+		if len(opts.RolesMap) > 0 {
+			roleMethod := method
+			if roleMethod == http.MethodHead {
+				roleMethod = http.MethodGet
+			}
+			if !opts.isRoleAllowed(roles, tableOrView, roleMethod) {
+				continue
+			}
+		}
+		rv = append(rv, method)
+	}
+
+	return rv
+}
+
+// tableOrViewAccessChecker checks if a request can apply a method on a table or view.
+// It's shared by the table or view routes and the schema discovery.
+type tableOrViewAccessChecker struct {
+	opts                           *ServerSecurityOptions
+	queryerOf                      func(ctx context.Context) sqlx.QueryerContext
+	accessibleTableOrViewsByMethod map[string]map[string]struct{}
+	readOnlyTableOrViews           map[string]struct{}
+}
+
+func (opts *ServerSecurityOptions) newTableOrViewAccessChecker(
+	queryerOf func(ctx context.Context) sqlx.QueryerContext,
+) *tableOrViewAccessChecker {
+	return &tableOrViewAccessChecker{
+		opts:      opts,
+		queryerOf: queryerOf,
+		// --security-allow-table is a shorthand for all methods
+		accessibleTableOrViewsByMethod: map[string]map[string]struct{}{
+			http.MethodGet:    toTableOrViewsSet(opts.EnabledTableOrViews, opts.ReadTableOrViews),
+			http.MethodHead:   toTableOrViewsSet(opts.EnabledTableOrViews, opts.ReadTableOrViews),
+			http.MethodPost:   toTableOrViewsSet(opts.EnabledTableOrViews, opts.WriteTableOrViews),
+			http.MethodPatch:  toTableOrViewsSet(opts.EnabledTableOrViews, opts.WriteTableOrViews),
+			http.MethodPut:    toTableOrViewsSet(opts.EnabledTableOrViews, opts.WriteTableOrViews),
+			http.MethodDelete: toTableOrViewsSet(opts.EnabledTableOrViews, opts.DeleteTableOrViews),
+		},
+		readOnlyTableOrViews: toTableOrViewsSet(opts.ReadOnlyTableOrViews),
+	}
+}
+
+// Check returns ErrAccessRestricted if the request is not allowed to apply the method on
+// the table or view.
+func (c *tableOrViewAccessChecker) Check(req *http.Request, target string, method string) error {
+	opts := c.opts
+
+	if opts.DenyMode {
+		if opts.isTableOrViewDenied(target) {
+			return ErrAccessRestricted.WithHint(fmt.Sprintf("%s is denied", target))
+		}
+	} else if _, ok := c.readOnlyTableOrViews[target]; ok {
+		if isWriteMethod(method) {
+			return ErrAccessRestricted.WithHint(fmt.Sprintf("%s is read only", target))
+		}
+	} else if _, ok := c.accessibleTableOrViewsByMethod[method][target]; !ok {
+		allowed := opts.isTableOrViewEnabled(target)
+		if !allowed {
+			var err error
+			allowed, err = opts.isTableOrViewAllowedByDB(req, c.queryerOf, target)
+			if err != nil {
+				return err
+			}
+		}
+		if !allowed || !slices.Contains(tableOrViewMethods, method) {
+			return ErrAccessRestricted
+		}
+	}
+
+	if len(opts.RolesMap) > 0 {
+		claims, _ := JWTClaimsFromContext(req.Context())
+		roleMethod := method
+		if roleMethod == http.MethodHead {
+			// HEAD is the same as GET without response body
+			roleMethod = http.MethodGet
+		}
+		if !opts.isRoleAllowed(rolesFromClaims(claims), target, roleMethod) {
+			return ErrAccessRestricted.WithHint(fmt.Sprintf("%s %s is not allowed", method, target))
+		}
+	}
+
+	return nil
+}
+
+// isAccessRestricted checks if the error is returned for restricted access.
+func isAccessRestricted(err error) bool {
+	var serverErr *ServerError
+	return errors.As(err, &serverErr) && serverErr.StatusCode == http.StatusForbidden
+}
+
+func (opts *ServerSecurityOptions) createTableOrViewAccessCheckMiddleware(
+	queryerOf func(ctx context.Context) sqlx.QueryerContext,
+	responseErr func(w http.ResponseWriter, err error),
+) func(http.Handler) http.Handler {
+	checker := opts.newTableOrViewAccessChecker(queryerOf)
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 			target := chi.URLParam(req, routeVarTableOrView)
 
-			if _, ok := accessibleTableOrViews[target]; !ok {
-				responseErr(w, ErrAccessRestricted)
+			if err := checker.Check(req, target, req.Method); err != nil {
+				responseErr(w, err)
 				return
 			}
 
+			if withs := req.URL.Query()[queryParameterNameWith]; len(withs) > 0 {
+				if !opts.AllowCommonTableExpressions {
+					responseErr(w, ErrAccessRestricted.WithHint("common table expressions are not allowed"))
+					return
+				}
+				if err := checkWithClauseNames(req.Context(), queryerOf(req.Context()), target, withs); err != nil {
+					responseErr(w, err)
+					return
+				}
+			}
+
+			if opts.DisableIntrospection {
+				if req.URL.Query().Get(queryParameterNameSchema) == "true" {
+					responseErr(w, ErrAccessRestricted.WithHint("introspection is disabled"))
+					return
+				}
+				if err := checkIntrospectionQueryParameters(req); err != nil {
+					responseErr(w, err)
+					return
+				}
+			}
+
+			// full-text search table is queried along with the target, hence it must be readable
+			if ftsTable := req.URL.Query().Get(queryParameterNameFTSTable); ftsTable != "" {
+				readable := opts.isTableOrViewReadable(ftsTable)
+				if readable && len(opts.RolesMap) > 0 {
+					claims, _ := JWTClaimsFromContext(req.Context())
+					readable = opts.isRoleAllowed(rolesFromClaims(claims), ftsTable, http.MethodGet)
+				}
+				if !readable {
+					responseErr(w, ErrAccessRestricted.WithHint(
+						fmt.Sprintf("%s is not readable", ftsTable),
+					))
+					return
+				}
+			}
+
+			if columns, ok := opts.ColumnAllowList[target]; ok {
+				req = req.WithContext(WithAllowedColumns(req.Context(), columns))
+			}
+
+			if opts.RowLevelSecurityColumn != "" {
+				claims, ok := JWTClaimsFromContext(req.Context())
+				if !ok {
+					responseErr(w, ErrAccessRestricted.WithHint("missing JWT claims"))
+					return
+				}
+				claimValue, ok := claims[opts.RowLevelSecurityClaim]
+				if !ok {
+					responseErr(w, ErrAccessRestricted.WithHint(
+						fmt.Sprintf("missing JWT claim %q", opts.RowLevelSecurityClaim),
+					))
+					return
+				}
+
+				req = req.WithContext(WithQueryClauses(req.Context(), CompiledQueryParameter{
+					Expr:   fmt.Sprintf("%s = ?", opts.RowLevelSecurityColumn),
+					Values: []interface{}{claimValue},
+				}))
+			}
+
 			next.ServeHTTP(w, req)
 		})
 	}
 }
+
+// checkWithClauseNames rejects the common table expressions shadowing the target or any
+// existing table or view, which would bypass the table and column access checks.
+func checkWithClauseNames(
+	ctx context.Context,
+	queryer sqlx.QueryerContext,
+	target string,
+	withs []string,
+) error {
+	for _, with := range withs {
+		ms := withClausePattern.FindStringSubmatch(with)
+		if ms == nil {
+			// invalid with clause is rejected by the query compiler
+			continue
+		}
+		name := ms[1]
+
+		if strings.EqualFold(name, target) {
+			return ErrAccessRestricted.WithHint(fmt.Sprintf("common table expression %s shadows the target", name))
+		}
+
+		var count int
+		err := queryer.QueryRowxContext(
+			ctx,
+			`select count(1) from (
+				select name, type from sqlite_master
+				union all
+				select name, type from sqlite_temp_master
+			) where type in ('table', 'view') and name = ? collate nocase`,
+			name,
+		).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAccessRestricted.WithHint(fmt.Sprintf("common table expression %s shadows table or view", name))
+		}
+	}
+
+	return nil
+}
+
+// introspectionPattern matches the schema tables and PRAGMA statements or functions
+// (e.g. `pragma_table_info`).
+var introspectionPattern = regexp.MustCompile(`(?i)\b(sqlite_(temp_)?(master|schema)|pragma)(\b|_)`)
+
+// checkIntrospectionQueryParameters rejects the select and common table expressions which
+// read the database schema.
+func checkIntrospectionQueryParameters(req *http.Request) error {
+	qp := req.URL.Query()
+	for _, name := range []string{queryParameterNameSelect, queryParameterNameWith} {
+		for _, v := range qp[name] {
+			if introspectionPattern.MatchString(v) {
+				return ErrBadRequest.WithHint(fmt.Sprintf("introspection is disabled: %s=%s", name, v))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	routeSuffixSubscribe = "/subscribe"
+
+	defaultSubscribePollInterval = 2 * time.Second
+
+	// subscribeWriteTimeout is the timeout for writing a message to the subscriber.
+	subscribeWriteTimeout = 10 * time.Second
+)
+
+// SubscriptionQuery is the query spec sent by the subscriber.
+type SubscriptionQuery struct {
+	// Query is the query string of the subscription, e.g. `select=id,title&price=lt.10`.
+	Query string `json:"query"`
+}
+
+// SubscriptionDiff is the result diff pushed to the subscriber. The first diff of a
+// subscription lists all the rows as added.
+type SubscriptionDiff struct {
+	Added   []json.RawMessage `json:"added"`
+	Removed []json.RawMessage `json:"removed"`
+	Changed []json.RawMessage `json:"changed"`
+}
+
+// SubscriptionError is pushed to the subscriber when the subscription fails.
+type SubscriptionError struct {
+	Error *ServerError `json:"error"`
+}
+
+func (d SubscriptionDiff) isEmpty() bool {
+	return len(d.Added) < 1 && len(d.Removed) < 1 && len(d.Changed) < 1
+}
+
+// newSubscriptionDiff groups the events by the change type.
+func newSubscriptionDiff(events []tableEvent) SubscriptionDiff {
+	// make sure return list instead of null for empty list
+	rv := SubscriptionDiff{
+		Added:   []json.RawMessage{},
+		Removed: []json.RawMessage{},
+		Changed: []json.RawMessage{},
+	}
+	for _, event := range events {
+		switch event.Event {
+		case tableEventInsert:
+			rv.Added = append(rv.Added, event.Data)
+		case tableEventDelete:
+			rv.Removed = append(rv.Removed, event.Data)
+		case tableEventUpdate:
+			rv.Changed = append(rv.Changed, event.Data)
+		}
+	}
+
+	return rv
+}
+
+// subscriptionRequest creates the request for compiling the subscription query.
+func subscriptionRequest(req *http.Request, spec SubscriptionQuery) (*http.Request, error) {
+	qp, err := url.ParseQuery(spec.Query)
+	if err != nil {
+		return nil, ErrBadRequest.WithHint(fmt.Sprintf("invalid query: %s", err))
+	}
+	// NOTE: these parameters are checked by the access check middleware with the
+	//       upgrade request, hence they are not allowed to be set by the subscriber.
+	for _, name := range []string{queryParameterNameWith, queryParameterNameFTSTable} {
+		if qp.Has(name) {
+			return nil, ErrBadRequest.WithHint(fmt.Sprintf("%s is not supported in subscription", name))
+		}
+	}
+
+	rv := req.Clone(req.Context())
+	rv.URL.RawQuery = qp.Encode()
+	return rv, nil
+}
+
+// handleTableOrViewSubscribe upgrades the request to WebSocket. The subscriber sends
+// SubscriptionQuery as JSON message, then the query is polled every poll interval and
+// the changes are pushed as SubscriptionDiff. Sending a new SubscriptionQuery replaces
+// the current subscription.
+func (server *dbServer) handleTableOrViewSubscribe(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	target := chi.URLParam(req, routeVarTableOrView)
+
+	logger := server.requestLogger(req).WithValues("target", target, "route", "handleTableOrViewSubscribe")
+
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(req *http.Request) bool {
+			origin := req.Header.Get("Origin")
+			return origin == "" || server.isOriginAllowed(origin)
+		},
+		Error: func(w http.ResponseWriter, req *http.Request, status int, reason error) {
+			server.responseError(w, &ServerError{StatusCode: status, Message: reason.Error()})
+		},
+	}
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		// response has been written by the upgrader
+		logger.Error(err, "upgrade connection")
+		return
+	}
+	defer conn.Close()
+
+	ctx := req.Context()
+	pkColumns, err := server.queryPrimaryKeyColumns(ctx, target)
+	if err != nil {
+		logger.Error(err, "query primary key columns")
+		return
+	}
+
+	// specs are read in background so that the close frame can be handled while polling
+	specs := make(chan SubscriptionQuery)
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		for {
+			var spec SubscriptionQuery
+			if err := conn.ReadJSON(&spec); err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					logger.V(8).Info("read subscription query", "err", err.Error())
+				}
+				return
+			}
+			select {
+			case specs <- spec:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	writeJSON := func(v interface{}) error {
+		if err := conn.SetWriteDeadline(time.Now().Add(subscribeWriteTimeout)); err != nil {
+			return err
+		}
+		return conn.WriteJSON(v)
+	}
+	writeError := func(err error) {
+		var (
+			serverErr   *ServerError
+			sqliteError sqlite3.Error
+		)
+		switch {
+		case errors.As(err, &sqliteError):
+			serverErr = newSQLiteServerError(sqliteError)
+		case errors.As(err, &serverErr):
+		default:
+			serverErr = &ServerError{StatusCode: http.StatusInternalServerError, Message: err.Error()}
+		}
+		if writeErr := writeJSON(SubscriptionError{Error: serverErr}); writeErr != nil {
+			logger.Error(writeErr, "write subscription error")
+		}
+	}
+
+	var (
+		selectStmt CompiledQuery
+		snapshot   tableSnapshot
+		// pollC is nil before the first subscription query is received
+		pollC  <-chan time.Time
+		ticker = time.NewTicker(server.subscribePollInterval)
+	)
+	defer ticker.Stop()
+
+	for {
+		// fresh is true when the subscription is (re)started, the diff is pushed even if empty
+		fresh := false
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-readDone:
+			return
+		case spec := <-specs:
+			specReq, err := subscriptionRequest(req, spec)
+			if err != nil {
+				writeError(err)
+				return
+			}
+			// the upgrade request has been checked by the access check middleware, the
+			// subscription query needs to be checked again
+			if server.disableIntrospection {
+				if err := checkIntrospectionQueryParameters(specReq); err != nil {
+					writeError(err)
+					return
+				}
+			}
+			qc := NewQueryCompilerFromRequestWithMaxLimit(specReq, server.maxLimit)
+			selectStmt, err = qc.CompileAsSelect(target)
+			if err != nil {
+				logger.Error(err, "parse select query")
+				writeError(err)
+				return
+			}
+			logger.V(8).Info(selectStmt.Query)
+
+			snapshot = tableSnapshot{}
+			fresh = true
+			pollC = ticker.C
+		case <-pollC:
+		}
+
+		curr, err := server.queryTableSnapshot(ctx, selectStmt, pkColumns)
+		if err != nil {
+			logger.Error(err, "query values")
+			writeError(err)
+			return
+		}
+		diff := newSubscriptionDiff(diffTableSnapshots(snapshot, curr))
+		snapshot = curr
+		if diff.isEmpty() && !fresh {
+			continue
+		}
+		if err := writeJSON(diff); err != nil {
+			logger.Error(err, "write subscription diff")
+			return
+		}
+	}
+}
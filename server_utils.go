@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-logr/logr"
@@ -16,9 +19,55 @@ func (l httpLogger) Print(v ...interface{}) {
 	l.Info(fmt.Sprint(v...))
 }
 
-func serverLogger(logr logr.Logger) func(http.Handler) http.Handler {
+// loggerWithRequestID annotates the logger with the ID of the request.
+func loggerWithRequestID(logger logr.Logger, req *http.Request) logr.Logger {
+	if requestID, ok := RequestIDFromContext(req.Context()); ok {
+		return logger.WithValues("request_id", requestID)
+	}
+	return logger
+}
+
+type requestLogFormatter struct {
+	logger logr.Logger
+}
+
+func (f requestLogFormatter) NewLogEntry(req *http.Request) middleware.LogEntry {
 	formatter := &middleware.DefaultLogFormatter{
-		Logger: httpLogger{logr},
+		Logger: httpLogger{loggerWithRequestID(f.logger, req)},
+	}
+	return formatter.NewLogEntry(req)
+}
+
+func serverLogger(logr logr.Logger) func(http.Handler) http.Handler {
+	return middleware.RequestLogger(requestLogFormatter{logger: logr})
+}
+
+// createRequestTimeoutMiddleware sets the timeout to the request context. Queries
+// are interrupted when the timeout is exceeded.
+func createRequestTimeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx, cancel := context.WithTimeout(req.Context(), timeout)
+			defer cancel()
+
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+// isClientDisconnected checks if the request has been cancelled by the client.
+func isClientDisconnected(req *http.Request) bool {
+	return errors.Is(req.Context().Err(), context.Canceled)
+}
+
+// createMaxRequestBodySizeMiddleware limits the size of the request body. Reading
+// beyond the limit fails with *http.MaxBytesError.
+func createMaxRequestBodySizeMiddleware(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			req.Body = http.MaxBytesReader(w, req.Body, limit)
+
+			next.ServeHTTP(w, req)
+		})
 	}
-	return middleware.RequestLogger(formatter)
 }
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	headerNameWebhookSignature = "X-Sqlite-Rest-Signature"
+
+	webhookOperationInsert = "insert"
+	webhookOperationUpdate = "update"
+	webhookOperationDelete = "delete"
+
+	// webhookMaxRetries is the number of retries after the first failed delivery.
+	webhookMaxRetries = 3
+	// defaultWebhookRetryBackoff is the delay before the first retry, doubled for each retry.
+	defaultWebhookRetryBackoff = 500 * time.Millisecond
+	defaultWebhookTimeout      = 10 * time.Second
+	// webhookQueueSize is the max number of events waiting for delivery. Events are
+	// dropped when the queue is full.
+	webhookQueueSize = 1024
+)
+
+// WebhookEvent is the payload posted to the webhook URL after a write operation.
+type WebhookEvent struct {
+	Operation string `json:"operation"`
+	Table     string `json:"table"`
+	// Data is the written row: the inserted row for insert, the row after update for update
+	// and the deleted row for delete.
+	Data interface{} `json:"data,omitempty"`
+	// Filter is the query string filtering the updated or deleted rows.
+	Filter string `json:"filter,omitempty"`
+}
+
+// signWebhookPayload returns the hex encoded HMAC-SHA256 signature of the payload.
+func signWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookDispatcher posts the write events to the webhook URL in background. Events
+// are delivered one by one by a single worker, so they are received in the written order.
+type webhookDispatcher struct {
+	logger       logr.Logger
+	url          string
+	secret       string
+	client       *http.Client
+	retryBackoff time.Duration
+	queue        chan WebhookEvent
+}
+
+func newWebhookDispatcher(logger logr.Logger, url string, secret string) *webhookDispatcher {
+	rv := &webhookDispatcher{
+		logger:       logger.WithName("webhook"),
+		url:          url,
+		secret:       secret,
+		client:       &http.Client{Timeout: defaultWebhookTimeout},
+		retryBackoff: defaultWebhookRetryBackoff,
+		queue:        make(chan WebhookEvent, webhookQueueSize),
+	}
+	go rv.run()
+	return rv
+}
+
+func (d *webhookDispatcher) run() {
+	for event := range d.queue {
+		if err := d.deliver(event); err != nil {
+			d.logger.Error(err, "deliver webhook", "operation", event.Operation, "table", event.Table)
+		}
+	}
+}
+
+// Dispatch queues the events for delivery. Events are dropped if the queue is full.
+func (d *webhookDispatcher) Dispatch(events ...WebhookEvent) {
+	for _, event := range events {
+		select {
+		case d.queue <- event:
+		default:
+			d.logger.Error(
+				fmt.Errorf("queue is full"), "drop webhook",
+				"operation", event.Operation, "table", event.Table,
+			)
+		}
+	}
+}
+
+func (d *webhookDispatcher) deliver(event WebhookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	backoff := d.retryBackoff
+	for attempt := 0; ; attempt++ {
+		err = d.post(payload)
+		if err == nil {
+			return nil
+		}
+		if attempt >= webhookMaxRetries {
+			return err
+		}
+		d.logger.V(4).Info("retry webhook", "attempt", attempt+1, "err", err.Error())
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (d *webhookDispatcher) post(payload []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, d.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mediaTypeJSON)
+	if d.secret != "" {
+		req.Header.Set(headerNameWebhookSignature, signWebhookPayload(d.secret, payload))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type pendingWebhookEventsContextKey struct{}
+
+// pendingWebhookEvents collects the events of a batch request, which are dispatched
+// after the transaction is committed.
+type pendingWebhookEvents struct {
+	events []WebhookEvent
+}
+
+func withPendingWebhookEvents(ctx context.Context) (context.Context, *pendingWebhookEvents) {
+	pending := &pendingWebhookEvents{}
+	return context.WithValue(ctx, pendingWebhookEventsContextKey{}, pending), pending
+}
+
+func pendingWebhookEventsFromContext(ctx context.Context) (*pendingWebhookEvents, bool) {
+	pending, ok := ctx.Value(pendingWebhookEventsContextKey{}).(*pendingWebhookEvents)
+	return pending, ok
+}
+
+// dispatchWebhookEvents sends an event for each written row to the webhook if configured.
+// No event is sent if no row is written.
+func (server *dbServer) dispatchWebhookEvents(
+	req *http.Request,
+	operation string,
+	target string,
+	rows []map[string]interface{},
+) {
+	if server.webhook == nil || len(rows) < 1 {
+		return
+	}
+
+	events := make([]WebhookEvent, 0, len(rows))
+	for _, row := range rows {
+		event := WebhookEvent{Operation: operation, Table: target, Data: row}
+		if operation != webhookOperationInsert {
+			event.Filter = req.URL.RawQuery
+		}
+		events = append(events, event)
+	}
+
+	if pending, ok := pendingWebhookEventsFromContext(req.Context()); ok {
+		pending.events = append(pending.events, events...)
+		return
+	}
+	server.webhook.Dispatch(events...)
+}
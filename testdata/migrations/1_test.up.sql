@@ -0,0 +1 @@
+create table test (id int);
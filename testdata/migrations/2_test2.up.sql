@@ -0,0 +1 @@
+create table test2 (id int);
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/b4fun/sqlite-rest"
+
+const (
+	spanNamePrefix = "sqlite-rest."
+
+	spanAttributeDBTable        = attribute.Key("db.table")
+	spanAttributeDBOperation    = attribute.Key("db.operation")
+	spanAttributeHTTPStatusCode = attribute.Key("http.status_code")
+)
+
+// recordRequestSpan starts a span for the request. The span context is set to the
+// request context, so queries executed with the request context are traced under the span.
+func recordRequestSpan(tracer trace.Tracer, op string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, span := tracer.Start(
+				r.Context(),
+				spanNamePrefix+op,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					spanAttributeDBTable.String(chi.URLParam(r, routeVarTableOrView)),
+					spanAttributeDBOperation.String(op),
+				),
+			)
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			defer func() {
+				statusCode := ww.Status()
+				span.SetAttributes(spanAttributeHTTPStatusCode.Int(statusCode))
+				if statusCode >= http.StatusInternalServerError {
+					span.SetStatus(codes.Error, http.StatusText(statusCode))
+				}
+				span.End()
+			}()
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+		})
+	}
+}
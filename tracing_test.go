@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	createTestContext := func(t testing.TB) (*TestContext, *tracetest.InMemoryExporter) {
+		exporter := tracetest.NewInMemoryExporter()
+		tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+		tc := createTestContextUsingInMemoryDBWithServerOptions(t, func(opts *ServerOptions) {
+			opts.TracerProvider = tracerProvider
+		})
+		return tc, exporter
+	}
+
+	waitForSpan := func(t *testing.T, exporter *tracetest.InMemoryExporter) tracetest.SpanStub {
+		var spans tracetest.SpanStubs
+		assert.Eventually(t, func() bool {
+			spans = exporter.GetSpans()
+			return len(spans) > 0
+		}, 5*time.Second, 10*time.Millisecond)
+		if !assert.Len(t, spans, 1) {
+			t.FailNow()
+		}
+		return spans[0]
+	}
+
+	assertAttributes := func(t *testing.T, span tracetest.SpanStub, expected ...attribute.KeyValue) {
+		for _, kv := range expected {
+			assert.Contains(t, span.Attributes, kv)
+		}
+	}
+
+	t.Run("Query", func(t *testing.T) {
+		t.Parallel()
+		tc, exporter := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+		req := tc.NewRequest(t, http.MethodGet, "test", nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		span := waitForSpan(t, exporter)
+		assert.Equal(t, "sqlite-rest.queryTableOrView", span.Name)
+		assertAttributes(
+			t, span,
+			attribute.String("db.table", "test"),
+			attribute.String("db.operation", "queryTableOrView"),
+			attribute.Int("http.status_code", http.StatusOK),
+		)
+	})
+
+	t.Run("Insert", func(t *testing.T) {
+		t.Parallel()
+		tc, exporter := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		tc.ExecuteSQL(t, "CREATE TABLE test (id int)")
+
+		req := tc.NewRequest(t, http.MethodPost, "test", bytes.NewBufferString(`{"id": 1}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		span := waitForSpan(t, exporter)
+		assert.Equal(t, "sqlite-rest.insertTable", span.Name)
+		assertAttributes(
+			t, span,
+			attribute.String("db.table", "test"),
+			attribute.String("db.operation", "insertTable"),
+			attribute.Int("http.status_code", http.StatusCreated),
+		)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Parallel()
+		tc, exporter := createTestContext(t)
+		defer tc.CleanUp(t)
+
+		req := tc.NewRequest(t, http.MethodGet, "test", nil)
+		resp := tc.ExecuteRequest(t, req)
+		defer resp.Body.Close()
+		assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+
+		span := waitForSpan(t, exporter)
+		assert.Equal(t, "sqlite-rest.queryTableOrView", span.Name)
+		assertAttributes(
+			t, span,
+			attribute.Int("http.status_code", resp.StatusCode),
+		)
+	})
+}
@@ -3,38 +3,61 @@ package main
 import (
 	"fmt"
 	"runtime/debug"
+
+	"github.com/spf13/cobra"
 )
 
 // ServerVersion defines the server application version.
 // Use -ldflags "-X main.ServerVersion=1.0.0" to override the version.
 var ServerVersion string
 
-func loadServerVersionFromBuildInfo() string {
+// buildInfo describes the build information of the binary.
+type buildInfo struct {
+	Version   string
+	GoVersion string
+	// Commit is the short VCS revision, "unknown" if not available.
+	Commit string
+	Dirty  bool
+}
+
+func readBuildInfo() (buildInfo, bool) {
 	info, ok := debug.ReadBuildInfo()
 	if !ok {
-		return ""
+		return buildInfo{}, false
 	}
 
-	var (
-		commit string = "unknown"
-		dirty  bool
-	)
+	rv := buildInfo{
+		Version:   info.Main.Version,
+		GoVersion: info.GoVersion,
+		Commit:    "unknown",
+	}
 	for _, s := range info.Settings {
 		switch {
 		case s.Key == "vcs.revision":
-			commit = s.Value
+			rv.Commit = s.Value
 			if len(s.Value) > 10 {
-				commit = commit[:10]
+				rv.Commit = rv.Commit[:10]
 			}
 		case s.Key == "vcs.modified":
-			dirty = s.Value == "true"
+			rv.Dirty = s.Value == "true"
 		}
 	}
-	if dirty {
+
+	return rv, true
+}
+
+func loadServerVersionFromBuildInfo() string {
+	info, ok := readBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	commit := info.Commit
+	if info.Dirty {
 		commit += "-dirty"
 	}
 
-	s := fmt.Sprintf("sqlite-rest/%s (%s, commit/%s)", info.Main.Version, info.GoVersion, commit)
+	s := fmt.Sprintf("sqlite-rest/%s (%s, commit/%s)", info.Version, info.GoVersion, commit)
 
 	return s
 }
@@ -55,3 +78,25 @@ func setServerVersion() {
 func init() {
 	setServerVersion()
 }
+
+func createVersionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Print the version information",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := cmd.OutOrStdout()
+
+			fmt.Fprintln(out, ServerVersion)
+			if info, ok := readBuildInfo(); ok {
+				fmt.Fprintf(out, "Go version: %s\n", info.GoVersion)
+				fmt.Fprintf(out, "Commit: %s\n", info.Commit)
+				fmt.Fprintf(out, "Dirty: %t\n", info.Dirty)
+			}
+
+			return nil
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionCmd(t *testing.T) {
+	cmd := createMainCmd()
+	var stdout bytes.Buffer
+	cmd.SetOut(&stdout)
+	cmd.SetArgs([]string{"version"})
+
+	assert.NoError(t, cmd.Execute())
+
+	output := stdout.String()
+	assert.NotEmpty(t, ServerVersion)
+	assert.Contains(t, output, ServerVersion)
+	assert.Contains(t, output, "Go version: "+runtime.Version())
+	assert.Contains(t, output, "Commit: ")
+	assert.Contains(t, output, "Dirty: ")
+}